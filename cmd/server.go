@@ -31,6 +31,7 @@ var ServerCmd = &cobra.Command{
 			bootstrap.InitDatabase,
 			bootstrap.InitProvider,
 			bootstrap.InitOp,
+			bootstrap.InitProxyCache,
 			bootstrap.InitRtmp,
 			bootstrap.InitVendorBackend,
 			bootstrap.InitSetting,
@@ -2,11 +2,22 @@ package bootstrap
 
 import (
 	"context"
+	"time"
 
 	"github.com/synctv-org/synctv/internal/op"
+	sysnotify "github.com/synctv-org/synctv/internal/sysNotify"
 )
 
+// shutdownTimeout bounds how long the rooms get to close on exit
+const shutdownTimeout = 10 * time.Second
+
 func InitOp(ctx context.Context) error {
 	op.Init(4096)
+	sysnotify.RegisterSysNotifyTask(0, sysnotify.NewSysNotifyTask("op", sysnotify.NotifyTypeEXIT, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_, err := op.Shutdown(ctx, 0)
+		return err
+	}))
 	return nil
 }
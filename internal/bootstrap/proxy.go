@@ -0,0 +1,37 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/synctv-org/synctv/internal/cache"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/utils"
+)
+
+func InitProxyCache(ctx context.Context) error {
+	if conf.Conf.Proxy.CacheSize <= 0 {
+		return nil
+	}
+	var dir string
+	if conf.Conf.Proxy.DiskCacheSize > 0 {
+		p := conf.Conf.Proxy.DiskCachePath
+		if p == "" {
+			p = "proxy_cache"
+		}
+		var err error
+		dir, err = utils.OptFilePath(p)
+		if err != nil {
+			return err
+		}
+	}
+	c, err := cache.NewSegmentCache(
+		conf.Conf.Proxy.CacheSize<<20,
+		dir,
+		conf.Conf.Proxy.DiskCacheSize<<20,
+	)
+	if err != nil {
+		return err
+	}
+	cache.SetProxySegmentCache(c)
+	return nil
+}
@@ -77,8 +77,8 @@ func AlistAuthorizationCacheWithConfigInitFunc(ctx context.Context, v *model.Ali
 
 type AlistMovieCache = refreshcache.RefreshCache[*AlistMovieCacheData, *AlistUserCache]
 
-func NewAlistMovieCache(movie *model.Movie) *AlistMovieCache {
-	return refreshcache.NewRefreshCache(NewAlistMovieCacheInitFunc(movie), time.Minute*14)
+func NewAlistMovieCache(movie *model.Movie, backend BackendResolver) *AlistMovieCache {
+	return refreshcache.NewRefreshCache(NewAlistMovieCacheInitFunc(movie, backend), time.Minute*14)
 }
 
 type AlistMovieCacheData struct {
@@ -137,7 +137,7 @@ func genAliM3U8ListFile(urls []*alist.FsOtherResp_VideoPreviewPlayInfo_LiveTrans
 	return buf.Bytes()
 }
 
-func NewAlistMovieCacheInitFunc(movie *model.Movie) func(ctx context.Context, args ...*AlistUserCache) (*AlistMovieCacheData, error) {
+func NewAlistMovieCacheInitFunc(movie *model.Movie, backend BackendResolver) func(ctx context.Context, args ...*AlistUserCache) (*AlistMovieCacheData, error) {
 	return func(ctx context.Context, args ...*AlistUserCache) (*AlistMovieCacheData, error) {
 		if len(args) == 0 {
 			return nil, errors.New("need alist user cache")
@@ -157,7 +157,7 @@ func NewAlistMovieCacheInitFunc(movie *model.Movie) func(ctx context.Context, ar
 		if aucd.Host == "" {
 			return nil, errors.New("not bind alist vendor")
 		}
-		cli := vendor.LoadAlistClient(movie.Base.VendorInfo.Backend)
+		cli := vendor.LoadAlistClient(backend.resolve(movie.Base.VendorInfo.Backend))
 		fg, err := cli.FsGet(ctx, &alist.FsGetReq{
 			Host:     aucd.Host,
 			Token:    aucd.Token,
@@ -30,13 +30,13 @@ type BilibiliSubtitleCache map[string]*struct {
 	Srt *refreshcache.RefreshCache[[]byte, struct{}]
 }
 
-func NewBilibiliSharedMpdCacheInitFunc(movie *model.Movie) func(ctx context.Context, args ...*BilibiliUserCache) (*BilibiliMpdCache, error) {
+func NewBilibiliSharedMpdCacheInitFunc(movie *model.Movie, backend BackendResolver) func(ctx context.Context, args ...*BilibiliUserCache) (*BilibiliMpdCache, error) {
 	return func(ctx context.Context, args ...*BilibiliUserCache) (*BilibiliMpdCache, error) {
-		return BilibiliSharedMpdCacheInitFunc(ctx, movie, args...)
+		return BilibiliSharedMpdCacheInitFunc(ctx, movie, backend, args...)
 	}
 }
 
-func BilibiliSharedMpdCacheInitFunc(ctx context.Context, movie *model.Movie, args ...*BilibiliUserCache) (*BilibiliMpdCache, error) {
+func BilibiliSharedMpdCacheInitFunc(ctx context.Context, movie *model.Movie, backend BackendResolver, args ...*BilibiliUserCache) (*BilibiliMpdCache, error) {
 	if len(args) == 0 {
 		return nil, errors.New("no bilibili user cache data")
 	}
@@ -49,7 +49,7 @@ func BilibiliSharedMpdCacheInitFunc(ctx context.Context, movie *model.Movie, arg
 	} else {
 		cookies = vendorInfo.Cookies
 	}
-	cli := vendor.LoadBilibiliClient(movie.Base.VendorInfo.Backend)
+	cli := vendor.LoadBilibiliClient(backend.resolve(movie.Base.VendorInfo.Backend))
 	var m, hevcM *mpd.MPD
 	biliInfo := movie.Base.VendorInfo.Bilibili
 	switch {
@@ -130,13 +130,13 @@ func BilibiliSharedMpdCacheInitFunc(ctx context.Context, movie *model.Movie, arg
 	}, nil
 }
 
-func NewBilibiliNoSharedMovieCacheInitFunc(movie *model.Movie) func(ctx context.Context, key string, args ...*BilibiliUserCache) (string, error) {
+func NewBilibiliNoSharedMovieCacheInitFunc(movie *model.Movie, backend BackendResolver) func(ctx context.Context, key string, args ...*BilibiliUserCache) (string, error) {
 	return func(ctx context.Context, key string, args ...*BilibiliUserCache) (string, error) {
-		return BilibiliNoSharedMovieCacheInitFunc(ctx, movie, args...)
+		return BilibiliNoSharedMovieCacheInitFunc(ctx, movie, backend, args...)
 	}
 }
 
-func BilibiliNoSharedMovieCacheInitFunc(ctx context.Context, movie *model.Movie, args ...*BilibiliUserCache) (string, error) {
+func BilibiliNoSharedMovieCacheInitFunc(ctx context.Context, movie *model.Movie, backend BackendResolver, args ...*BilibiliUserCache) (string, error) {
 	if len(args) == 0 {
 		return "", errors.New("no bilibili user cache data")
 	}
@@ -149,7 +149,7 @@ func BilibiliNoSharedMovieCacheInitFunc(ctx context.Context, movie *model.Movie,
 	} else {
 		cookies = vendorInfo.Cookies
 	}
-	cli := vendor.LoadBilibiliClient(movie.Base.VendorInfo.Backend)
+	cli := vendor.LoadBilibiliClient(backend.resolve(movie.Base.VendorInfo.Backend))
 	var u string
 	biliInfo := movie.Base.VendorInfo.Bilibili
 	switch {
@@ -200,13 +200,13 @@ type bilibiliSubtitleResp struct {
 	} `json:"body"`
 }
 
-func NewBilibiliSubtitleCacheInitFunc(movie *model.Movie) func(ctx context.Context, args ...*BilibiliUserCache) (BilibiliSubtitleCache, error) {
+func NewBilibiliSubtitleCacheInitFunc(movie *model.Movie, backend BackendResolver) func(ctx context.Context, args ...*BilibiliUserCache) (BilibiliSubtitleCache, error) {
 	return func(ctx context.Context, args ...*BilibiliUserCache) (BilibiliSubtitleCache, error) {
-		return BilibiliSubtitleCacheInitFunc(ctx, movie, args...)
+		return BilibiliSubtitleCacheInitFunc(ctx, movie, backend, args...)
 	}
 }
 
-func BilibiliSubtitleCacheInitFunc(ctx context.Context, movie *model.Movie, args ...*BilibiliUserCache) (BilibiliSubtitleCache, error) {
+func BilibiliSubtitleCacheInitFunc(ctx context.Context, movie *model.Movie, backend BackendResolver, args ...*BilibiliUserCache) (BilibiliSubtitleCache, error) {
 	if len(args) == 0 {
 		return nil, errors.New("no bilibili user cache data")
 	}
@@ -227,7 +227,7 @@ func BilibiliSubtitleCacheInitFunc(ctx context.Context, movie *model.Movie, args
 		cookies = vendorInfo.Cookies
 	}
 
-	cli := vendor.LoadBilibiliClient(movie.Base.VendorInfo.Backend)
+	cli := vendor.LoadBilibiliClient(backend.resolve(movie.Base.VendorInfo.Backend))
 	resp, err := cli.GetSubtitles(ctx, &bilibili.GetSubtitlesReq{
 		Cookies: utils.HttpCookieToMap(cookies),
 		Bvid:    biliInfo.Bvid,
@@ -302,11 +302,11 @@ type BilibiliMovieCache struct {
 	Subtitle      *refreshcache.RefreshCache[BilibiliSubtitleCache, *BilibiliUserCache]
 }
 
-func NewBilibiliMovieCache(movie *model.Movie) *BilibiliMovieCache {
+func NewBilibiliMovieCache(movie *model.Movie, backend BackendResolver) *BilibiliMovieCache {
 	return &BilibiliMovieCache{
-		NoSharedMovie: newMapCache(NewBilibiliNoSharedMovieCacheInitFunc(movie), time.Minute*60),
-		SharedMpd:     refreshcache.NewRefreshCache(NewBilibiliSharedMpdCacheInitFunc(movie), time.Minute*60),
-		Subtitle:      refreshcache.NewRefreshCache(NewBilibiliSubtitleCacheInitFunc(movie), 0),
+		NoSharedMovie: newMapCache(NewBilibiliNoSharedMovieCacheInitFunc(movie, backend), time.Minute*60),
+		SharedMpd:     refreshcache.NewRefreshCache(NewBilibiliSharedMpdCacheInitFunc(movie, backend), time.Minute*60),
+		Subtitle:      refreshcache.NewRefreshCache(NewBilibiliSubtitleCacheInitFunc(movie, backend), 0),
 	}
 }
 
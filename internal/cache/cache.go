@@ -170,3 +170,14 @@ func (b *MapCache[T, A]) StoreOrRefreshWithDynamicFunc(ctx context.Context, key
 		return refreshFunc(ctx, key, args...)
 	}), args...)
 }
+
+// BackendResolver picks the vendor backend for a movie, backend is the one
+// recorded on the movie or on the user's vendor binding
+type BackendResolver func(backend string) string
+
+func (b BackendResolver) resolve(backend string) string {
+	if b == nil {
+		return backend
+	}
+	return b(backend)
+}
@@ -69,11 +69,11 @@ type EmbyMovieCacheData struct {
 
 type EmbyMovieCache = refreshcache.RefreshCache[*EmbyMovieCacheData, *EmbyUserCache]
 
-func NewEmbyMovieCache(movie *model.Movie) *EmbyMovieCache {
-	return refreshcache.NewRefreshCache(NewEmbyMovieCacheInitFunc(movie), 0)
+func NewEmbyMovieCache(movie *model.Movie, backend BackendResolver) *EmbyMovieCache {
+	return refreshcache.NewRefreshCache(NewEmbyMovieCacheInitFunc(movie, backend), 0)
 }
 
-func NewEmbyMovieCacheInitFunc(movie *model.Movie) func(ctx context.Context, args ...*EmbyUserCache) (*EmbyMovieCacheData, error) {
+func NewEmbyMovieCacheInitFunc(movie *model.Movie, backend BackendResolver) func(ctx context.Context, args ...*EmbyUserCache) (*EmbyMovieCacheData, error) {
 	return func(ctx context.Context, args ...*EmbyUserCache) (*EmbyMovieCacheData, error) {
 		if len(args) == 0 {
 			return nil, errors.New("need emby user cache")
@@ -99,7 +99,7 @@ func NewEmbyMovieCacheInitFunc(movie *model.Movie) func(ctx context.Context, arg
 		if err != nil {
 			return nil, err
 		}
-		cli := vendor.LoadEmbyClient(aucd.Backend)
+		cli := vendor.LoadEmbyClient(backend.resolve(aucd.Backend))
 		data, err := cli.GetItem(ctx, &emby.GetItemReq{
 			Host:   aucd.Host,
 			Token:  aucd.ApiKey,
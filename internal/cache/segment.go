@@ -0,0 +1,333 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SegmentSize is the size of the ranges the proxy fetches from upstreams
+const SegmentSize = 4 << 20
+
+// segmentFetchTimeout bounds a shared upstream fetch, it is not tied to
+// the viewer that started it so other viewers waiting on it are not cut off
+const segmentFetchTimeout = time.Minute
+
+var ErrRangeNotSupported = errors.New("upstream does not support range requests")
+
+type Segment struct {
+	Data []byte
+	// Total is the size of the whole resource
+	Total       int64
+	ContentType string
+}
+
+type SegmentFetchFunc func(ctx context.Context, start, end int64) (*Segment, error)
+
+type segmentKey struct {
+	movieID string
+	index   int64
+}
+
+type segmentEntry struct {
+	key  segmentKey
+	seg  *Segment
+	size int64
+	// file is set when the segment was spilled to disk
+	file string
+}
+
+// SegmentCache caches fixed size ranges of proxied movies so that viewers
+// watching the same movie share upstream fetches
+type SegmentCache struct {
+	lock     sync.Mutex
+	entries  map[segmentKey]*list.Element
+	mem      *list.List
+	memSize  int64
+	memMax   int64
+	disk     *list.List
+	diskSize int64
+	diskMax  int64
+	diskDir  string
+	// noRange remembers movies whose upstream ignores range requests
+	noRange map[string]struct{}
+	// gen is bumped on invalidation so in flight fetches are not stored
+	gen    uint64
+	group  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewSegmentCache keeps up to memMax bytes in memory, evicted segments are
+// written to diskDir while they fit in diskMax bytes, an empty diskDir
+// disables the disk spill
+func NewSegmentCache(memMax int64, diskDir string, diskMax int64) (*SegmentCache, error) {
+	c := &SegmentCache{
+		entries: make(map[segmentKey]*list.Element),
+		mem:     list.New(),
+		memMax:  memMax,
+		disk:    list.New(),
+		noRange: make(map[string]struct{}),
+	}
+	if diskDir != "" && diskMax > 0 {
+		if err := os.MkdirAll(diskDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		// segments left over from the previous run are not indexed
+		old, err := filepath.Glob(filepath.Join(diskDir, "*.seg"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range old {
+			_ = os.Remove(f)
+		}
+		c.diskDir = diskDir
+		c.diskMax = diskMax
+	}
+	return c, nil
+}
+
+// Get returns the segment at index, fetching it once for all concurrent callers on a miss
+func (c *SegmentCache) Get(ctx context.Context, movieID string, index int64, fetch SegmentFetchFunc) (*Segment, error) {
+	key := segmentKey{movieID: movieID, index: index}
+	if seg, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return seg, nil
+	}
+	c.misses.Add(1)
+	ch := c.group.DoChan(fmt.Sprintf("%s/%d", movieID, index), func() (any, error) {
+		if seg, ok := c.get(key); ok {
+			return seg, nil
+		}
+		c.lock.Lock()
+		gen := c.gen
+		c.lock.Unlock()
+		fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), segmentFetchTimeout)
+		defer cancel()
+		start := index * SegmentSize
+		seg, err := fetch(fctx, start, start+SegmentSize-1)
+		if err != nil {
+			return nil, err
+		}
+		c.add(key, seg, gen)
+		return seg, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*Segment), nil
+	}
+}
+
+// get returns the cached segment, a spilled segment is taken off the disk
+// index and read back into memory. The lock only guards the index, files
+// are read, written and removed without it so a slow disk does not stall
+// the lookups of other movies. A file lost to a racing spill or removal is
+// a miss and is fetched again.
+func (c *SegmentCache) get(key segmentKey) (*Segment, bool) {
+	c.lock.Lock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.lock.Unlock()
+		return nil, false
+	}
+	e := el.Value.(*segmentEntry)
+	if e.file == "" {
+		c.mem.MoveToFront(el)
+		c.lock.Unlock()
+		return e.seg, true
+	}
+	// concurrent lookups of the segment miss until it is back in memory
+	c.removeDisk(el)
+	gen := c.gen
+	c.lock.Unlock()
+
+	data, err := os.ReadFile(e.file)
+	_ = os.Remove(e.file)
+	if err != nil {
+		return nil, false
+	}
+	seg := &Segment{
+		Data:        data,
+		Total:       e.seg.Total,
+		ContentType: e.seg.ContentType,
+	}
+	c.add(key, seg, gen)
+	return seg, true
+}
+
+func (c *SegmentCache) add(key segmentKey, seg *Segment, gen uint64) {
+	c.lock.Lock()
+	if gen != c.gen {
+		c.lock.Unlock()
+		return
+	}
+	if _, ok := c.entries[key]; ok {
+		c.lock.Unlock()
+		return
+	}
+	evicted := c.addMem(key, seg)
+	c.lock.Unlock()
+	for _, e := range evicted {
+		c.spill(e, gen)
+	}
+}
+
+// addMem must be called with the lock held, it returns the segments evicted
+// from memory, they are spilled by the caller once the lock is released
+func (c *SegmentCache) addMem(key segmentKey, seg *Segment) []*segmentEntry {
+	e := &segmentEntry{
+		key:  key,
+		seg:  seg,
+		size: int64(len(seg.Data)),
+	}
+	c.entries[key] = c.mem.PushFront(e)
+	c.memSize += e.size
+	var evicted []*segmentEntry
+	for c.memSize > c.memMax && c.mem.Len() > 0 {
+		el := c.mem.Back()
+		e := c.mem.Remove(el).(*segmentEntry)
+		c.memSize -= e.size
+		delete(c.entries, e.key)
+		evicted = append(evicted, e)
+	}
+	return evicted
+}
+
+// spill writes a segment evicted from memory to disk, it must be called
+// without the lock, the segment is dropped if the movie was invalidated
+// or fetched again in the meantime
+func (c *SegmentCache) spill(e *segmentEntry, gen uint64) {
+	if c.diskDir == "" || e.size > c.diskMax {
+		return
+	}
+	sum := sha256.Sum256([]byte(e.key.movieID))
+	file := filepath.Join(c.diskDir, fmt.Sprintf("%s-%d.seg", hex.EncodeToString(sum[:16]), e.key.index))
+	if err := os.WriteFile(file, e.seg.Data, 0o644); err != nil {
+		return
+	}
+	spilled := &segmentEntry{
+		key:  e.key,
+		size: e.size,
+		file: file,
+		seg: &Segment{
+			Total:       e.seg.Total,
+			ContentType: e.seg.ContentType,
+		},
+	}
+	c.lock.Lock()
+	if _, ok := c.entries[e.key]; ok || gen != c.gen {
+		c.lock.Unlock()
+		_ = os.Remove(file)
+		return
+	}
+	c.entries[e.key] = c.disk.PushFront(spilled)
+	c.diskSize += e.size
+	var removed []string
+	for c.diskSize > c.diskMax && c.disk.Len() > 0 {
+		removed = append(removed, c.removeDisk(c.disk.Back()))
+	}
+	c.lock.Unlock()
+	for _, f := range removed {
+		_ = os.Remove(f)
+	}
+}
+
+// removeDisk must be called with the lock held, it drops the segment from
+// the index and returns its file for the caller to remove without the lock
+func (c *SegmentCache) removeDisk(el *list.Element) string {
+	e := c.disk.Remove(el).(*segmentEntry)
+	c.diskSize -= e.size
+	delete(c.entries, e.key)
+	return e.file
+}
+
+// Invalidate drops all cached segments of the movie
+func (c *SegmentCache) Invalidate(movieID string) {
+	c.lock.Lock()
+	c.gen++
+	delete(c.noRange, movieID)
+	var removed []string
+	for key, el := range c.entries {
+		if key.movieID != movieID {
+			continue
+		}
+		if el.Value.(*segmentEntry).file != "" {
+			removed = append(removed, c.removeDisk(el))
+			continue
+		}
+		c.memSize -= c.mem.Remove(el).(*segmentEntry).size
+		delete(c.entries, key)
+	}
+	c.lock.Unlock()
+	for _, f := range removed {
+		_ = os.Remove(f)
+	}
+}
+
+// MarkNoRange makes the proxy pass requests of the movie through uncached
+func (c *SegmentCache) MarkNoRange(movieID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.noRange[movieID] = struct{}{}
+}
+
+func (c *SegmentCache) NoRange(movieID string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.noRange[movieID]
+	return ok
+}
+
+type SegmentCacheStats struct {
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Segments   int    `json:"segments"`
+	MemorySize int64  `json:"memorySize"`
+	DiskSize   int64  `json:"diskSize"`
+}
+
+func (c *SegmentCache) Stats() SegmentCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return SegmentCacheStats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Segments:   len(c.entries),
+		MemorySize: c.memSize,
+		DiskSize:   c.diskSize,
+	}
+}
+
+var proxySegments atomic.Pointer[SegmentCache]
+
+// SetProxySegmentCache sets the cache used by the movie proxy, nil disables it
+func SetProxySegmentCache(c *SegmentCache) {
+	proxySegments.Store(c)
+}
+
+func ProxySegmentCache() *SegmentCache {
+	return proxySegments.Load()
+}
+
+// InvalidateProxySegments drops cached segments of the movie, it is called
+// when the movie is edited or deleted
+func InvalidateProxySegments(movieID string) {
+	if c := proxySegments.Load(); c != nil {
+		c.Invalidate(movieID)
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fetchFill(calls *atomic.Int32, b byte) SegmentFetchFunc {
+	return func(ctx context.Context, start, end int64) (*Segment, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return &Segment{
+			Data:  bytes.Repeat([]byte{b}, 16),
+			Total: 64,
+		}, nil
+	}
+}
+
+func TestSegmentCacheCoalesce(t *testing.T) {
+	c, err := NewSegmentCache(1<<20, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		calls atomic.Int32
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Get(context.Background(), "m", 0, fetchFill(&calls, 'a')); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("fetch called %d times, want 1", n)
+	}
+	if s := c.Stats(); s.Segments != 1 || s.MemorySize != 16 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestSegmentCacheSpillAndInvalidate(t *testing.T) {
+	c, err := NewSegmentCache(16, t.TempDir(), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	for i := int64(0); i < 3; i++ {
+		if _, err := c.Get(context.Background(), "m", i, fetchFill(&calls, byte('a'+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := c.Stats(); s.Segments != 3 || s.MemorySize != 16 || s.DiskSize != 32 {
+		t.Fatalf("stats = %+v", s)
+	}
+	seg, err := c.Get(context.Background(), "m", 0, fetchFill(&calls, 'x'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seg.Data[0] != 'a' || seg.Total != 64 {
+		t.Fatalf("segment = %q/%d, want spilled segment", seg.Data, seg.Total)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("fetch called %d times, want 3", n)
+	}
+	c.Invalidate("m")
+	if s := c.Stats(); s.Segments != 0 || s.MemorySize != 0 || s.DiskSize != 0 {
+		t.Fatalf("stats after invalidate = %+v", s)
+	}
+}
+
+func TestSegmentCacheMissingSpill(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewSegmentCache(16, dir, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	for i := int64(0); i < 2; i++ {
+		if _, err := c.Get(context.Background(), "m", i, fetchFill(&calls, byte('a'+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("spilled files = %v %v, want 1", files, err)
+	}
+	if err := os.Remove(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	seg, err := c.Get(context.Background(), "m", 0, fetchFill(&calls, 'x'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seg.Data[0] != 'x' || calls.Load() != 3 {
+		t.Fatalf("segment = %q after %d fetches, want it fetched again", seg.Data, calls.Load())
+	}
+}
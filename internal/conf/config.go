@@ -22,6 +22,12 @@ type Config struct {
 
 	// RateLimit
 	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// Proxy
+	Proxy ProxyConfig `yaml:"proxy"`
+
+	// Transcode
+	Transcode TranscodeConfig `yaml:"transcode"`
 }
 
 func (c *Config) Save(file string) error {
@@ -47,5 +53,11 @@ func DefaultConfig() *Config {
 
 		// RateLimit
 		RateLimit: DefaultRateLimitConfig(),
+
+		// Proxy
+		Proxy: DefaultProxyConfig(),
+
+		// Transcode
+		Transcode: DefaultTranscodeConfig(),
 	}
 }
@@ -0,0 +1,15 @@
+package conf
+
+type ProxyConfig struct {
+	CacheSize     int64  `yaml:"cache_size" lc:"default: 256" hc:"memory size in MB of the shared movie proxy segment cache, 0 disables the cache" env:"PROXY_CACHE_SIZE"`
+	DiskCacheSize int64  `yaml:"disk_cache_size" lc:"default: 0" hc:"disk size in MB for segments evicted from memory, 0 disables the disk spill" env:"PROXY_DISK_CACHE_SIZE"`
+	DiskCachePath string `yaml:"disk_cache_path" lc:"default: proxy_cache" hc:"relative paths are resolved against the data dir" env:"PROXY_DISK_CACHE_PATH"`
+}
+
+func DefaultProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		CacheSize:     256,
+		DiskCacheSize: 0,
+		DiskCachePath: "",
+	}
+}
@@ -0,0 +1,13 @@
+package conf
+
+type TranscodeConfig struct {
+	FFmpegPath string   `yaml:"ffmpeg_path" lc:"default: ffmpeg" hc:"ffmpeg binary used to transcode proxied live streams" env:"TRANSCODE_FFMPEG_PATH"`
+	Profiles   []string `yaml:"profiles" hc:"transcode profiles movies may use, e.g. h264-source, h264-720p, h264-480p, empty disables live transcoding"`
+}
+
+func DefaultTranscodeConfig() TranscodeConfig {
+	return TranscodeConfig{
+		FFmpegPath: "ffmpeg",
+		Profiles:   nil,
+	}
+}
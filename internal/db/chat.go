@@ -0,0 +1,39 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateChatMessage(message *model.ChatMessage) error {
+	return db.Create(message).Error
+}
+
+// TrimChatMessages deletes the oldest chat messages of the room beyond keep
+func TrimChatMessages(roomID string, keep int) error {
+	var ids []uint64
+	err := db.Model(&model.ChatMessage{}).
+		Where("room_id = ?", roomID).
+		Order("id DESC").
+		Offset(keep).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return db.Where("room_id = ? AND id <= ?", roomID, ids[0]).Delete(&model.ChatMessage{}).Error
+}
+
+func DeleteChatMessages(roomID string) error {
+	return db.Where("room_id = ?", roomID).Delete(&model.ChatMessage{}).Error
+}
+
+// EachChatMessages calls fn with the chat messages sent while the movie was
+// playing, oldest first and at most batchSize at a time
+func EachChatMessages(roomID, movieID string, batchSize int, fn func([]*model.ChatMessage) error) error {
+	var messages []*model.ChatMessage
+	return db.Where("room_id = ? AND movie_id = ?", roomID, movieID).
+		FindInBatches(&messages, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(messages)
+		}).Error
+}
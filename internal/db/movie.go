@@ -25,6 +25,26 @@ func DeleteMovieByID(roomID, id string) error {
 	return HandleNotFound(err, "room or movie")
 }
 
+func SetMovieCreatorID(roomID, id, creatorID string) error {
+	err := db.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Update("creator_id", creatorID).Error
+	return HandleNotFound(err, "room or movie")
+}
+
+func SetMoviePinned(roomID, id string, pinned bool) error {
+	err := db.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Update("pinned", pinned).Error
+	return HandleNotFound(err, "room or movie")
+}
+
+func SetMovieVisibility(roomID, id string, visibility model.MovieVisibility) error {
+	err := db.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Update("visibility", visibility).Error
+	return HandleNotFound(err, "room or movie")
+}
+
+func SetMovieDuration(roomID, id string, duration float64) error {
+	err := db.Model(&model.Movie{}).Where("room_id = ? AND id = ?", roomID, id).Update("base_duration", duration).Error
+	return HandleNotFound(err, "room or movie")
+}
+
 func LoadAndDeleteMovieByID(roomID, id string, columns ...clause.Column) (*model.Movie, error) {
 	movie := &model.Movie{}
 	err := db.Unscoped().Clauses(clause.Returning{Columns: columns}).Where("room_id = ? AND id = ?", roomID, id).Delete(movie).Error
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func CreateMovieAudits(audits []*model.MovieAudit) error {
+	return db.Create(audits).Error
+}
+
+func GetMovieAudits(roomID, movieID string) ([]*model.MovieAudit, error) {
+	var audits []*model.MovieAudit
+	err := db.Where("room_id = ? AND movie_id = ?", roomID, movieID).Order("id ASC").Find(&audits).Error
+	return audits, HandleNotFound(err, "movie audits")
+}
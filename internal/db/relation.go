@@ -1,6 +1,8 @@
 package db
 
 import (
+	"slices"
+
 	"github.com/synctv-org/synctv/internal/model"
 	"gorm.io/gorm"
 )
@@ -65,8 +67,49 @@ func GetAllRoomUsersRelation(roomID string, scopes ...func(*gorm.DB) *gorm.DB) [
 	return roomUserRelations
 }
 
+// GetRoomAdminRelations returns the active relations holding all given permissions, oldest first
+func GetRoomAdminRelations(roomID string, permissions model.RoomUserPermission) ([]*model.RoomUserRelation, error) {
+	var roomUserRelations []*model.RoomUserRelation
+	err := db.Where("room_id = ? AND status = ? AND permissions & ? = ?", roomID, model.RoomUserStatusActive, permissions, permissions).
+		Order("created_at ASC").
+		Find(&roomUserRelations).Error
+	return roomUserRelations, err
+}
+
 func GetAllRoomUsersRelationCount(roomID string, scopes ...func(*gorm.DB) *gorm.DB) int64 {
 	var count int64
 	db.Model(&model.RoomUserRelation{}).Where("room_id = ?", roomID).Scopes(scopes...).Count(&count)
 	return count
 }
+
+// CreateRoomUserRelations creates the relations of the users in one transaction,
+// users that already have a relation with the room are skipped and returned
+func CreateRoomUserRelations(roomID string, userIDs []string, conf ...CreateRoomUserRelationConfig) (existing []string, err error) {
+	err = Transactional(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.RoomUserRelation{}).
+			Where("room_id = ? AND user_id IN ?", roomID, userIDs).
+			Pluck("user_id", &existing).Error; err != nil {
+			return err
+		}
+		relations := make([]*model.RoomUserRelation, 0, len(userIDs)-len(existing))
+		for _, id := range userIDs {
+			if slices.Contains(existing, id) {
+				continue
+			}
+			r := &model.RoomUserRelation{
+				RoomID:      roomID,
+				UserID:      id,
+				Permissions: model.DefaultPermissions,
+			}
+			for _, c := range conf {
+				c(r)
+			}
+			relations = append(relations, r)
+		}
+		if len(relations) == 0 {
+			return nil
+		}
+		return tx.Create(&relations).Error
+	})
+	return existing, err
+}
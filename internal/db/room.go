@@ -51,6 +51,9 @@ func CreateRoom(name, password string, maxCount int64, conf ...CreateRoomConfig)
 		c(r)
 	}
 	if password != "" {
+		if err := model.CheckPasswordLength(password); err != nil {
+			return nil, err
+		}
 		var err error
 		r.HashedPassword, err = bcrypt.GenerateFromPassword(stream.StringToBytes(password), bcrypt.DefaultCost)
 		if err != nil {
@@ -87,10 +90,68 @@ func GetRoomByID(id string) (*model.Room, error) {
 }
 
 func SaveRoomSettings(roomID string, setting model.RoomSettings) error {
-	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("setting", setting).Error
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&model.Room{}); err != nil {
+		return err
+	}
+	// the settings are embedded, every column of them is written so
+	// false and empty values are saved too
+	var columns []string
+	for _, f := range stmt.Schema.Fields {
+		if len(f.BindNames) > 1 && f.BindNames[0] == "Settings" {
+			columns = append(columns, f.DBName)
+		}
+	}
+	err := db.Model(&model.Room{}).Where("id = ?", roomID).Select(columns).Updates(&model.Room{Settings: setting}).Error
+	return HandleNotFound(err, "room")
+}
+
+func SetRoomHidden(roomID string, hidden bool) error {
+	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("settings_hidden", hidden).Error
+	return HandleNotFound(err, "room")
+}
+
+func SetRoomMaxMovieDuration(roomID string, seconds float64) error {
+	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("settings_max_movie_duration", seconds).Error
 	return HandleNotFound(err, "room")
 }
 
+func SetRoomPlaylistSort(roomID string, sort model.PlaylistSort) error {
+	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("settings_playlist_sort", sort).Error
+	return HandleNotFound(err, "room")
+}
+
+// roomChildModels are the tables keyed by the id of the room, no foreign
+// keys are created when migrating so they are moved with the room by hand
+var roomChildModels = []any{
+	new(model.RoomUserRelation),
+	new(model.Movie),
+	new(model.RoomWebhook),
+	new(model.MovieAudit),
+	new(model.ChatMessage),
+}
+
+// SetRoomID changes the primary key of the room and the room id of its
+// members, movies, webhooks, audit entries and chat history in one transaction
+func SetRoomID(roomID, newID string) error {
+	return Transactional(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Room{}).Where("id = ?", roomID).Update("id", newID)
+		if result.Error != nil {
+			return HandleNotFound(result.Error, "room")
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound("room")
+		}
+		for _, m := range roomChildModels {
+			err := tx.Model(m).Where("room_id = ?", roomID).UpdateColumn("room_id", newID).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func DeleteRoomByID(roomID string) error {
 	err := db.Unscoped().Where("id = ?", roomID).Delete(&model.Room{}).Error
 	return HandleNotFound(err, "room")
@@ -99,6 +160,9 @@ func DeleteRoomByID(roomID string) error {
 func SetRoomPassword(roomID, password string) error {
 	var hashedPassword []byte
 	if password != "" {
+		if err := model.CheckPasswordLength(password); err != nil {
+			return err
+		}
 		var err error
 		hashedPassword, err = bcrypt.GenerateFromPassword(stream.StringToBytes(password), bcrypt.DefaultCost)
 		if err != nil {
@@ -137,6 +201,43 @@ func GetAllRoomsByUserID(userID string) []*model.Room {
 	return rooms
 }
 
+// SetRoomCreatorLastSeen records when the creator was last in the room,
+// it does not change the update time of the room
+func SetRoomCreatorLastSeen(roomID string, at int64) error {
+	err := db.Model(&model.Room{}).Where("id = ?", roomID).UpdateColumn("creator_last_seen_at", at).Error
+	return HandleNotFound(err, "room")
+}
+
+// TransferRoomCreator changes the room creator and records the previous one,
+// the new creator gets full permissions and the previous creator keeps them
+func TransferRoomCreator(roomID, from, to string, at int64) error {
+	return Transactional(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Room{}).Where("id = ? AND creator_id = ?", roomID, from).Updates(map[string]any{
+			"creator_id":             to,
+			"previous_creator_id":    from,
+			"creator_transferred_at": at,
+			"creator_last_seen_at":   at,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("room creator has changed")
+		}
+		var err error
+		for _, id := range []string{from, to} {
+			err = tx.Where("room_id = ? AND user_id = ?", roomID, id).Assign(model.RoomUserRelation{
+				Status:      model.RoomUserStatusActive,
+				Permissions: model.PermissionAll,
+			}).FirstOrCreate(&model.RoomUserRelation{RoomID: roomID, UserID: id}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func SetRoomStatus(roomID string, status model.RoomStatus) error {
 	err := db.Model(&model.Room{}).Where("id = ?", roomID).Update("status", status).Error
 	return HandleNotFound(err, "room")
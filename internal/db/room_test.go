@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points the package at a fresh in memory database migrated
+// like the server does, without foreign keys
+func useTestDB(t *testing.T) {
+	t.Helper()
+	d, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		TranslateError:                           true,
+		Logger:                                   logger.Discard,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		IgnoreRelationshipsWhenMigrating:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = d
+	t.Cleanup(func() {
+		db = prev
+		if sqlDB, err := d.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
+
+func TestSetRoomID(t *testing.T) {
+	useTestDB(t)
+	u, err := CreateUser("creator", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := CreateRoom("room", "", 0, WithCreator(u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FirstOrCreateRoomUserRelation(r.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateMovie(&model.Movie{RoomID: r.ID, CreatorID: u.ID, Base: model.BaseMovie{Name: "movie"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRoomWebhook(&model.RoomWebhook{RoomID: r.ID, URL: "https://example.com/hook"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateMovieAudits([]*model.MovieAudit{{RoomID: r.ID, UserID: u.ID, Action: model.MovieAuditAdded}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateChatMessage(&model.ChatMessage{RoomID: r.ID, UserID: u.ID, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const newID = "0123456789abcdef0123456789abcdef"
+	if err := SetRoomID(r.ID, newID); err != nil {
+		t.Fatalf("SetRoomID() = %v", err)
+	}
+	if _, err := GetRoomByID(newID); err != nil {
+		t.Fatalf("GetRoomByID(new id) = %v", err)
+	}
+	for _, m := range roomChildModels {
+		var old, moved int64
+		db.Model(m).Where("room_id = ?", r.ID).Count(&old)
+		db.Model(m).Where("room_id = ?", newID).Count(&moved)
+		if old != 0 || moved != 1 {
+			t.Errorf("%T: %d rows left under the old id, %d under the new one, want 0 and 1", m, old, moved)
+		}
+	}
+	if err := SetRoomID(r.ID, newID); err == nil {
+		t.Fatal("SetRoomID() of a missing room = nil")
+	}
+}
+
+func TestSaveRoomSettings(t *testing.T) {
+	useTestDB(t)
+	r, err := CreateRoom("settings", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := r.Settings
+	s.ChatHistory = true
+	s.VendorBackends = map[string]string{model.VendorEmby: "pinned"}
+	if err := SaveRoomSettings(r.ID, s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetRoomByID(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Settings.ChatHistory || got.Settings.VendorBackends[model.VendorEmby] != "pinned" {
+		t.Fatalf("settings = %+v, want the saved settings", got.Settings)
+	}
+}
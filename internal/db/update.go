@@ -15,12 +15,13 @@ type dbVersion struct {
 	Upgrade     func(*gorm.DB) error
 }
 
-const CurrentVersion = "0.0.3"
+const CurrentVersion = "0.0.5"
 
 var models = []any{
 	new(model.Setting),
 	new(model.User),
 	new(model.UserProvider),
+	new(model.UserBlock),
 	new(model.Room),
 	new(model.RoomUserRelation),
 	new(model.Movie),
@@ -28,6 +29,9 @@ var models = []any{
 	new(model.AlistVendor),
 	new(model.EmbyVendor),
 	new(model.VendorBackend),
+	new(model.RoomWebhook),
+	new(model.MovieAudit),
+	new(model.ChatMessage),
 }
 
 var dbVersions = map[string]dbVersion{
@@ -50,6 +54,15 @@ var dbVersions = map[string]dbVersion{
 		},
 	},
 	"0.0.3": {
+		NextVersion: "0.0.4",
+		Upgrade:     nil,
+	},
+	"0.0.4": {
+		NextVersion: "0.0.5",
+		// session tokens were stored in plain text
+		Upgrade: hashSessionTokens,
+	},
+	"0.0.5": {
 		NextVersion: "",
 	},
 }
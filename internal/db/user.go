@@ -89,6 +89,9 @@ func CreateUser(username string, password string, conf ...CreateUserConfig) (*mo
 	if password == "" {
 		return nil, errors.New("password cannot be empty")
 	}
+	if err := model.CheckPasswordLength(password); err != nil {
+		return nil, err
+	}
 	hashedPassword, err := bcrypt.GenerateFromPassword(stream.StringToBytes(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -97,18 +100,26 @@ func CreateUser(username string, password string, conf ...CreateUserConfig) (*mo
 }
 
 func CreateOrLoadUser(username string, password string, conf ...CreateUserConfig) (*model.User, error) {
+	u, _, err := LoadOrCreateUser(username, password, conf...)
+	return u, err
+}
+
+// LoadOrCreateUser loads the user by username and only hashes the password
+// when a new user has to be created, created reports which one happened
+func LoadOrCreateUser(username string, password string, conf ...CreateUserConfig) (u *model.User, created bool, err error) {
 	if username == "" {
-		return nil, errors.New("username cannot be empty")
+		return nil, false, errors.New("username cannot be empty")
 	}
 	var user model.User
 	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return CreateUser(username, password, conf...)
+			u, err := CreateUser(username, password, conf...)
+			return u, err == nil, err
 		} else {
-			return nil, err
+			return nil, false, err
 		}
 	}
-	return &user, nil
+	return &user, false, nil
 }
 
 func CreateOrLoadUserWithHashedPassword(username string, hashedPassword []byte, conf ...CreateUserConfig) (*model.User, error) {
@@ -352,6 +363,33 @@ func SetUsernameByID(userID string, username string) error {
 	return HandleNotFound(err, "user")
 }
 
+func SetUserColorByID(userID string, color string) error {
+	err := db.Model(&model.User{}).Where("id = ?", userID).Update("color", color).Error
+	return HandleNotFound(err, "user")
+}
+
+func SetUserAvatarByID(userID string, avatar string) error {
+	err := db.Model(&model.User{}).Where("id = ?", userID).Update("avatar", avatar).Error
+	return HandleNotFound(err, "user")
+}
+
+func BlockUser(userID, blockedUserID string) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.UserBlock{
+		UserID:        userID,
+		BlockedUserID: blockedUserID,
+	}).Error
+}
+
+func UnblockUser(userID, blockedUserID string) error {
+	return db.Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).Delete(&model.UserBlock{}).Error
+}
+
+func IsUserBlocked(userID, blockedUserID string) (bool, error) {
+	var count int64
+	err := db.Model(&model.UserBlock{}).Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).Count(&count).Error
+	return count > 0, err
+}
+
 func GetAllUserCount(scopes ...func(*gorm.DB) *gorm.DB) int64 {
 	var count int64
 	db.Model(&model.User{}).Scopes(scopes...).Count(&count)
@@ -364,6 +402,33 @@ func GetAllUsers(scopes ...func(*gorm.DB) *gorm.DB) []*model.User {
 	return users
 }
 
+// hashSessionTokens replaces the session tokens stored in plain text with
+// their hash, so the users keep their sessions
+func hashSessionTokens(db *gorm.DB) error {
+	var users []*model.User
+	err := db.Select("id", "session_token").Where("session_token <> ''").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, u := range users {
+			err := tx.Model(&model.User{}).
+				Where("id = ?", u.ID).
+				UpdateColumn("session_token", model.HashSessionToken(u.SessionTokenHash)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetUserSessionTokenHash stores the hash of a session token, see model.HashSessionToken
+func SetUserSessionTokenHash(id string, hash string) error {
+	err := db.Model(&model.User{}).Where("id = ?", id).Update("session_token", hash).Error
+	return HandleNotFound(err, "user")
+}
+
 func SetUserHashedPassword(id string, hashedPassword []byte) error {
 	err := db.Model(&model.User{}).Where("id = ?", id).Update("hashed_password", hashedPassword).Error
 	return HandleNotFound(err, "user")
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestHashSessionTokens(t *testing.T) {
+	useTestDB(t)
+	u, err := CreateUser("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a token stored in plain text before tokens were hashed
+	const token = "plain"
+	if err := SetUserSessionTokenHash(u.ID, token); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := CreateUser("bob", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUserSessionTokenHash(empty.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := hashSessionTokens(db); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SessionTokenHash != model.HashSessionToken(token) {
+		t.Fatalf("session token = %q, want the hash of the stored token", got.SessionTokenHash)
+	}
+	if got, err := GetUserByID(empty.ID); err != nil || got.SessionTokenHash != "" {
+		t.Fatalf("session token of a user without one = %q %v, want empty", got.SessionTokenHash, err)
+	}
+}
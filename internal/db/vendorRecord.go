@@ -113,3 +113,15 @@ func CreateOrSaveEmbyVendor(vendorInfo *model.EmbyVendor) (*model.EmbyVendor, er
 func DeleteEmbyVendor(userID, serverID string) error {
 	return db.Where("user_id = ? AND server_id = ?", userID, serverID).Delete(&model.EmbyVendor{}).Error
 }
+
+func DeleteUserVendors(userID string) error {
+	return Transactional(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.BilibiliVendor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.AlistVendor{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.EmbyVendor{}).Error
+	})
+}
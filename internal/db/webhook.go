@@ -0,0 +1,26 @@
+package db
+
+import (
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func CreateRoomWebhook(webhook *model.RoomWebhook) error {
+	return db.Create(webhook).Error
+}
+
+func GetRoomWebhooks(roomID string) ([]*model.RoomWebhook, error) {
+	var webhooks []*model.RoomWebhook
+	err := db.Where("room_id = ?", roomID).Order("created_at ASC").Find(&webhooks).Error
+	return webhooks, HandleNotFound(err, "room webhooks")
+}
+
+func DeleteRoomWebhook(roomID, id string) error {
+	result := db.Where("room_id = ? AND id = ?", roomID, id).Delete(&model.RoomWebhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound("room webhook")
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ChatMessage is a chat message of a room kept for the danmaku export,
+// Seek is the position of the current movie when it was sent
+type ChatMessage struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	RoomID    string    `gorm:"not null;index:idx_chat_message_movie,priority:1;type:char(32)" json:"-"`
+	MovieID   string    `gorm:"not null;index:idx_chat_message_movie,priority:2;type:char(32)" json:"movieId"`
+	UserID    string    `gorm:"not null;type:char(32)" json:"userId"`
+	Message   string    `gorm:"not null;type:varchar(4096)" json:"message"`
+	Seek      float64   `json:"seek"`
+}
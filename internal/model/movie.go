@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"net/url"
+	"path"
 	"strings"
 	"time"
 
@@ -16,7 +18,36 @@ type Movie struct {
 	Position  uint      `gorm:"not null" json:"-"`
 	RoomID    string    `gorm:"not null;index;type:char(32)" json:"-"`
 	CreatorID string    `gorm:"index;type:char(32)" json:"creatorId"`
-	Base      BaseMovie `gorm:"embedded;embeddedPrefix:base_" json:"base"`
+	// Pinned movies are listed ahead of the others in every playlist sort
+	Pinned bool `gorm:"default:false" json:"pinned"`
+	// Visibility hides staged movies from the room, see MovieVisibility
+	Visibility MovieVisibility `gorm:"type:varchar(16);default:public" json:"visibility"`
+	Base       BaseMovie       `gorm:"embedded;embeddedPrefix:base_" json:"base"`
+}
+
+// MovieVisibility decides who sees a movie in the playlist, the creator
+// of the movie, room creator and site admins always see it
+type MovieVisibility string
+
+const (
+	MovieVisibilityPublic MovieVisibility = "public"
+	// MovieVisibilityAdmins shows the movie to the admins of the room
+	MovieVisibilityAdmins  MovieVisibility = "admins"
+	MovieVisibilityCreator MovieVisibility = "creator"
+)
+
+// Valid reports whether v is a known visibility, empty is public for older movies
+func (v MovieVisibility) Valid() bool {
+	switch v {
+	case "", MovieVisibilityPublic, MovieVisibilityAdmins, MovieVisibilityCreator:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v MovieVisibility) Public() bool {
+	return v == "" || v == MovieVisibilityPublic
 }
 
 func (m *Movie) BeforeCreate(tx *gorm.DB) error {
@@ -28,7 +59,7 @@ func (m *Movie) BeforeCreate(tx *gorm.DB) error {
 
 type BaseMovie struct {
 	Url        string               `gorm:"type:varchar(8192)" json:"url"`
-	Name       string               `gorm:"not null;type:varchar(128)" json:"name"`
+	Name       string               `gorm:"not null;type:varchar(1024)" json:"name"`
 	Live       bool                 `json:"live"`
 	Proxy      bool                 `json:"proxy"`
 	RtmpSource bool                 `json:"rtmpSource"`
@@ -36,6 +67,89 @@ type BaseMovie struct {
 	Headers    map[string]string    `gorm:"serializer:fastjson;type:text" json:"headers"`
 	Subtitles  map[string]*Subtitle `gorm:"serializer:fastjson;type:text" json:"subtitles"`
 	VendorInfo VendorInfo           `gorm:"embedded;embeddedPrefix:vendor_info_" json:"vendorInfo,omitempty"`
+	// ExternalSystem and ExternalID reference the item in an external system (e.g. emby, jellyfin)
+	ExternalSystem string `gorm:"type:varchar(32)" json:"externalSystem,omitempty"`
+	ExternalID     string `gorm:"type:varchar(64)" json:"externalId,omitempty"`
+	// Duration is the total length in seconds, 0 if unknown
+	Duration  float64   `json:"duration,omitempty"`
+	MediaKind MediaKind `gorm:"type:varchar(16)" json:"mediaKind,omitempty"`
+	Poster    string    `gorm:"type:varchar(8192)" json:"poster,omitempty"`
+	// TranscodeProfile re-encodes a proxied live stream, empty keeps the source codecs
+	TranscodeProfile string `gorm:"type:varchar(32)" json:"transcodeProfile,omitempty"`
+	// Chapters are sorted by start and do not overlap
+	Chapters []Chapter `gorm:"serializer:fastjson;type:text" json:"chapters,omitempty"`
+}
+
+type ChapterAction string
+
+const (
+	ChapterActionNone ChapterAction = "none"
+	// ChapterActionSkip seeks past the chapter when the room auto skips chapters
+	ChapterActionSkip ChapterAction = "skip"
+)
+
+func (a ChapterAction) Valid() bool {
+	switch a {
+	case "", ChapterActionNone, ChapterActionSkip:
+		return true
+	default:
+		return false
+	}
+}
+
+// Chapter marks a part of a movie in seconds, an End of 0 lasts until the
+// next chapter or the end of the movie
+type Chapter struct {
+	Name   string        `json:"name"`
+	Start  float64       `json:"start"`
+	End    float64       `json:"end,omitempty"`
+	Action ChapterAction `json:"action,omitempty"`
+}
+
+type MediaKind string
+
+const (
+	MediaKindUnknown MediaKind = ""
+	MediaKindVideo   MediaKind = "video"
+	MediaKindAudio   MediaKind = "audio"
+)
+
+func (k MediaKind) Valid() bool {
+	switch k {
+	case MediaKindUnknown, MediaKindVideo, MediaKindAudio:
+		return true
+	default:
+		return false
+	}
+}
+
+var audioExts = map[string]struct{}{
+	".mp3": {}, ".m4a": {}, ".aac": {}, ".flac": {}, ".ogg": {},
+	".oga": {}, ".opus": {}, ".wav": {}, ".wma": {},
+}
+
+var videoExts = map[string]struct{}{
+	".mp4": {}, ".mkv": {}, ".webm": {}, ".flv": {}, ".avi": {},
+	".mov": {}, ".m4v": {}, ".ts": {}, ".m3u8": {}, ".mpd": {},
+}
+
+// InferMediaKind guesses the media kind from the movie url extension
+func (m *BaseMovie) InferMediaKind() MediaKind {
+	if m.Live || m.RtmpSource {
+		return MediaKindVideo
+	}
+	p := m.Url
+	if u, err := url.Parse(m.Url); err == nil {
+		p = u.Path
+	}
+	ext := strings.ToLower(path.Ext(p))
+	if _, ok := audioExts[ext]; ok {
+		return MediaKindAudio
+	}
+	if _, ok := videoExts[ext]; ok {
+		return MediaKindVideo
+	}
+	return MediaKindUnknown
 }
 
 type Subtitle struct {
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type MovieAuditAction string
+
+const (
+	MovieAuditAdded          MovieAuditAction = "added"
+	MovieAuditEdited         MovieAuditAction = "edited"
+	MovieAuditDeleted        MovieAuditAction = "deleted"
+	MovieAuditCreatorChanged MovieAuditAction = "creator_changed"
+)
+
+// MovieAudit is an append only record of a change to a movie of a room,
+// the records of a movie are kept after it was deleted
+type MovieAudit struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	RoomID    string    `gorm:"not null;index:idx_movie_audit_movie,priority:1;type:char(32)" json:"-"`
+	MovieID   string    `gorm:"not null;index:idx_movie_audit_movie,priority:2;type:char(32)" json:"movieId"`
+	// UserID is who made the change, empty for changes made by the server
+	UserID string           `gorm:"type:char(32)" json:"userId,omitempty"`
+	Action MovieAuditAction `gorm:"not null;type:varchar(16)" json:"action"`
+	// Detail is the new creator id of a creator change
+	Detail string `gorm:"type:varchar(64)" json:"detail,omitempty"`
+}
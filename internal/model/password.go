@@ -0,0 +1,20 @@
+package model
+
+import (
+	"fmt"
+)
+
+// MaxPasswordLength is the most bytes of a password bcrypt uses, the rest
+// would be ignored when hashing and comparing
+const MaxPasswordLength = 72
+
+var ErrPasswordTooLong = fmt.Errorf("password is longer than %d bytes", MaxPasswordLength)
+
+// CheckPasswordLength returns ErrPasswordTooLong for passwords bcrypt would
+// truncate, they are rejected instead so every byte of a password matters
+func CheckPasswordLength(password string) error {
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	return nil
+}
@@ -41,6 +41,16 @@ type Room struct {
 	HashedPassword     []byte
 	GroupUserRelations []RoomUserRelation `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Movies             []Movie            `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Webhooks           []RoomWebhook      `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	MovieAudits        []MovieAudit       `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ChatMessages       []ChatMessage      `gorm:"foreignKey:RoomID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	// PreviousCreatorID and CreatorTransferredAt (unix milli) are set
+	// when the room was taken over from an absent creator
+	PreviousCreatorID    string `gorm:"type:char(32)"`
+	CreatorTransferredAt int64
+	// CreatorLastSeenAt is the unix milli time the creator last joined or
+	// left the room, 0 if it was not recorded yet
+	CreatorLastSeenAt int64
 }
 
 func (r *Room) BeforeCreate(tx *gorm.DB) error {
@@ -58,6 +68,54 @@ type RoomSettings struct {
 	DisableJoinNewUser     bool               `gorm:"default:false" json:"disableJoinNewUser"`
 	JoinNeedReview         bool               `gorm:"default:false" json:"joinNeedReview"`
 	UserDefaultPermissions RoomUserPermission `json:"userDefaultPermissions"`
+	// BufferingAssist pauses playback while too many clients are buffering
+	BufferingAssist bool `gorm:"default:false" json:"bufferingAssist"`
+	// BufferingAssistRatio is the fraction of online clients that must be buffering
+	BufferingAssistRatio float64 `gorm:"default:0.5" json:"bufferingAssistRatio"`
+	// BufferingAssistThreshold is how long in seconds a client must be buffering
+	BufferingAssistThreshold float64 `gorm:"default:2" json:"bufferingAssistThreshold"`
+	// AllowedRates limits the playback rates clients may pick, empty allows any positive rate
+	AllowedRates []float64 `gorm:"serializer:fastjson;type:text" json:"allowedRates,omitempty"`
+	// AllowedReactions is the emoji set viewers may react with, empty uses the default set
+	AllowedReactions []string `gorm:"serializer:fastjson;type:text" json:"allowedReactions,omitempty"`
+	// DisableReactions turns reactions off in the room even when the server allows them
+	DisableReactions bool `gorm:"default:false" json:"disableReactions"`
+	// MaxSeekDelta is how many seconds regular members may seek away from the
+	// current position at once, 0 allows any seek
+	MaxSeekDelta float64 `gorm:"default:0" json:"maxSeekDelta"`
+	// MaxMovieDuration is how many seconds a movie added to the room may last, 0 is unlimited
+	MaxMovieDuration float64 `gorm:"default:0" json:"maxMovieDuration"`
+	// AutoSkipChapters seeks past the chapters marked to be skipped
+	AutoSkipChapters bool `gorm:"default:false" json:"autoSkipChapters"`
+	// VendorBackends maps a vendor name to the backend the room prefers for it
+	VendorBackends map[string]string `gorm:"serializer:fastjson;type:text" json:"vendorBackends,omitempty"`
+	// DefaultMovieHeaders are added to the headers of every movie pushed to
+	// the room, the headers of the movie win on conflict
+	DefaultMovieHeaders map[string]string `gorm:"serializer:fastjson;type:text" json:"defaultMovieHeaders,omitempty"`
+	// PlaylistSort is the order movies are listed and auto advanced in
+	PlaylistSort PlaylistSort `gorm:"type:varchar(16);default:manual" json:"playlistSort"`
+	// ChatHistory keeps the chat for the danmaku export when the server allows it
+	ChatHistory bool `gorm:"default:false" json:"chatHistory"`
+}
+
+// PlaylistSort orders the playlist without moving the movies, the manual
+// order is kept so switching back to it is lossless
+type PlaylistSort string
+
+const (
+	PlaylistSortManual    PlaylistSort = "manual"
+	PlaylistSortCreatedAt PlaylistSort = "createdAt"
+	PlaylistSortName      PlaylistSort = "name"
+)
+
+// Valid reports whether s is a known sort, empty is the manual order of older rooms
+func (s PlaylistSort) Valid() bool {
+	switch s {
+	case "", PlaylistSortManual, PlaylistSortCreatedAt, PlaylistSortName:
+		return true
+	default:
+		return false
+	}
 }
 
 func (r *Room) NeedPassword() bool {
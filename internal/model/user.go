@@ -1,6 +1,9 @@
 package model
 
 import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"time"
@@ -42,17 +45,32 @@ type User struct {
 	ID                   string `gorm:"primaryKey;type:char(32)" json:"id"`
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
-	RegisteredByProvider bool               `gorm:"not null;default:false"`
-	UserProviders        []UserProvider     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Username             string             `gorm:"not null;uniqueIndex;type:varchar(32)"`
-	HashedPassword       []byte             `gorm:"not null"`
-	Role                 Role               `gorm:"not null;default:2"`
-	RoomUserRelations    []RoomUserRelation `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Rooms                []Room             `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Movies               []Movie            `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
-	BilibiliVendor       *BilibiliVendor    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	AlistVendor          []*AlistVendor     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	EmbyVendor           []*EmbyVendor      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RegisteredByProvider bool           `gorm:"not null;default:false"`
+	UserProviders        []UserProvider `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Username             string         `gorm:"not null;uniqueIndex;type:varchar(32)"`
+	HashedPassword       []byte         `gorm:"not null"`
+	// SessionTokenHash is the sha256 of the session token, see HashSessionToken
+	SessionTokenHash string `gorm:"column:session_token;type:char(64)" json:"-"`
+	// IssuedSessionToken is the token issued when the user was created, it
+	// is only set on the created model and never stored
+	IssuedSessionToken string             `gorm:"-" json:"-"`
+	Role               Role               `gorm:"not null;default:2"`
+	Color              string             `gorm:"type:varchar(7)"`
+	Avatar             string             `gorm:"type:varchar(1024)"`
+	RoomUserRelations  []RoomUserRelation `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Rooms              []Room             `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Movies             []Movie            `gorm:"foreignKey:CreatorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	BilibiliVendor     *BilibiliVendor    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	AlistVendor        []*AlistVendor     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	EmbyVendor         []*EmbyVendor      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	BlockedUsers       []UserBlock        `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// UserBlock records that UserID does not accept whispers from BlockedUserID
+type UserBlock struct {
+	UserID        string `gorm:"primaryKey;type:char(32)"`
+	BlockedUserID string `gorm:"primaryKey;type:char(32)"`
+	CreatedAt     time.Time
 }
 
 func (u *User) CheckPassword(password string) bool {
@@ -68,9 +86,30 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == "" {
 		u.ID = utils.SortUUID()
 	}
+	if u.SessionTokenHash == "" {
+		u.IssuedSessionToken = NewSessionToken()
+		u.SessionTokenHash = HashSessionToken(u.IssuedSessionToken)
+	}
 	return nil
 }
 
+// NewSessionToken returns a random token that lets a user reconnect
+// without sending the password again
+func NewSessionToken() string {
+	b := make([]byte, 32)
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// HashSessionToken returns what is stored for a session token, so the
+// tokens in a leaked database can not be used
+func HashSessionToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
 func (u *User) IsRoot() bool {
 	return u.Role == RoleRoot
 }
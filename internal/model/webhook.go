@@ -0,0 +1,63 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/synctv-org/synctv/utils"
+	"gorm.io/gorm"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventUserJoined     WebhookEvent = "user_joined"
+	WebhookEventUserLeft       WebhookEvent = "user_left"
+	WebhookEventMovieAdded     WebhookEvent = "movie_added"
+	WebhookEventCurrentChanged WebhookEvent = "current_changed"
+	WebhookEventRoomClosing    WebhookEvent = "room_closing"
+)
+
+func (e WebhookEvent) Valid() bool {
+	switch e {
+	case WebhookEventUserJoined, WebhookEventUserLeft, WebhookEventMovieAdded, WebhookEventCurrentChanged, WebhookEventRoomClosing:
+		return true
+	default:
+		return false
+	}
+}
+
+// RoomWebhook receives signed POSTs of the room events it subscribed to
+type RoomWebhook struct {
+	ID        string    `gorm:"primaryKey;type:char(32)" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	RoomID    string    `gorm:"not null;index;type:char(32)" json:"roomId"`
+	URL       string    `gorm:"not null;type:varchar(2048)" json:"url"`
+	// Secret is the HMAC key the request bodies are signed with
+	Secret string         `gorm:"not null;type:char(64)" json:"-"`
+	Events []WebhookEvent `gorm:"serializer:fastjson;type:text" json:"events"`
+}
+
+func (w *RoomWebhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = utils.SortUUID()
+	}
+	if w.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(b)
+	}
+	return nil
+}
+
+func (w *RoomWebhook) Subscribed(event WebhookEvent) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package op
+
+import (
+	"time"
+
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+func roomTTL() time.Duration {
+	return time.Duration(settings.RoomTTL.Get()) * time.Hour
+}
+
+// touch records user driven activity and extends the lifetime of the room
+// in the room cache, reads must use markRead so they do not keep an unused
+// room loaded
+func (r *Room) touch() {
+	now := time.Now()
+	r.lastActive.Store(now.UnixMilli())
+	if roomCache == nil {
+		return
+	}
+	if e, ok := roomCache.Load(r.ID); ok && e.Value() == r {
+		e.SetExpiration(now.Add(roomTTL()))
+	}
+}
+
+// markRead records that the room was read, it does not extend its lifetime
+func (r *Room) markRead() {
+	r.lastRead.Store(time.Now().UnixMilli())
+}
+
+// LastActive returns when the room was last changed by a user, zero if never since loaded
+func (r *Room) LastActive() time.Time {
+	return unixMilliOrZero(r.lastActive.Load())
+}
+
+// LastRead returns when the room was last loaded for a request, zero if never
+func (r *Room) LastRead() time.Time {
+	return unixMilliOrZero(r.lastRead.Load())
+}
+
+func unixMilliOrZero(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
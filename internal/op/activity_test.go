@@ -0,0 +1,52 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/zijiren233/gencontainer/synccache"
+)
+
+func init() {
+	if roomCache == nil {
+		roomCache = synccache.NewSyncCache[string, *Room](time.Minute)
+	}
+}
+
+func storeTestRoom(id string, ttl time.Duration) *Room {
+	r := newRoom(&model.Room{ID: id})
+	roomCache.Store(id, r, ttl)
+	return r
+}
+
+func TestRoomActivity(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	read := storeTestRoom("read", ttl)
+	status := storeTestRoom("status", ttl)
+	client := storeTestRoom("client", ttl)
+
+	_ = PeopleNum(read.ID)
+	RangeRoomCache(func(string, *RoomEntry) bool { return true })
+	if _, err := status.SetStatus(true, 0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient("a")
+	if err := client.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer client.hub.Close()
+
+	time.Sleep(2 * ttl)
+	if _, ok := roomCache.Load(read.ID); ok {
+		t.Fatal("room with only reads was not collected")
+	}
+	for _, r := range []*Room{status, client} {
+		if _, ok := roomCache.Load(r.ID); !ok {
+			t.Fatalf("active room %s was collected", r.ID)
+		}
+		if r.LastActive().IsZero() {
+			t.Fatalf("LastActive() of %s is zero", r.ID)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package op
+
+import (
+	"sync"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+type ActivityType string
+
+const (
+	ActivityUserJoined     ActivityType = "user_joined"
+	ActivityUserLeft       ActivityType = "user_left"
+	ActivityMovieAdded     ActivityType = "movie_added"
+	ActivityMovieDeleted   ActivityType = "movie_deleted"
+	ActivityMoviesCleared  ActivityType = "movies_cleared"
+	ActivityCurrentChanged ActivityType = "current_changed"
+	ActivityPlayed         ActivityType = "played"
+	ActivityPaused         ActivityType = "paused"
+	// ActivityCreatorChanged is a takeover or reclaim of the room by the user
+	ActivityCreatorChanged ActivityType = "creator_changed"
+)
+
+// Activity is an entry of the room activity feed, the user is empty
+// when the server made the change, see SystemSender
+type Activity struct {
+	Type ActivityType `json:"type"`
+	// Time is a unix milli time
+	Time      int64  `json:"time"`
+	UserID    string `json:"userId,omitempty"`
+	Username  string `json:"username,omitempty"`
+	MovieID   string `json:"movieId,omitempty"`
+	MovieName string `json:"movieName,omitempty"`
+	// the movie as it was logged, to hide the activity from members who
+	// do not see the movie, see Room.VisibleActivityLog
+	movieCreatorID  string
+	movieVisibility model.MovieVisibility
+}
+
+func (a *Activity) setMovie(m *model.Movie) {
+	a.MovieID = m.ID
+	a.MovieName = m.Base.Name
+	a.movieCreatorID = m.CreatorID
+	a.movieVisibility = m.Visibility
+}
+
+const defaultActivityLogSize = 100
+
+// WithActivityLogSize sets how many activities the room keeps, 0 disables the feed
+func WithActivityLogSize(n int) RoomConf {
+	return func(r *Room) {
+		r.activities.size = max(n, 0)
+	}
+}
+
+// activityLog is a ring buffer of the latest activities of a room
+type activityLog struct {
+	lock sync.Mutex
+	// size is the length of buf once it is allocated by the first add
+	size int
+	buf  []Activity
+	// next is the index the next activity is written to
+	next int
+	full bool
+}
+
+func (l *activityLog) add(a Activity) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.buf == nil {
+		if l.size == 0 {
+			return
+		}
+		l.buf = make([]Activity, l.size)
+	}
+	l.buf[l.next] = a
+	l.next++
+	if l.next == len(l.buf) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// latest returns up to limit of the newest activities oldest first,
+// limit <= 0 returns all of them
+func (l *activityLog) latest(limit int) []Activity {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.buf)
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	list := make([]Activity, limit)
+	start := l.next - limit
+	if start < 0 {
+		start += len(l.buf)
+	}
+	for i := range list {
+		list[i] = l.buf[(start+i)%len(l.buf)]
+	}
+	return list
+}
+
+func (r *Room) logActivity(a Activity) {
+	a.Time = time.Now().UnixMilli()
+	r.activities.add(a)
+}
+
+func (r *Room) logUserActivity(t ActivityType, u *User, m *model.Movie) {
+	a := Activity{Type: t, UserID: u.ID, Username: u.Username}
+	if m != nil {
+		a.setMovie(m)
+	}
+	r.logActivity(a)
+}
+
+// ActivityLog returns up to limit of the latest activities of the room oldest first,
+// limit <= 0 returns every activity kept, see WithActivityLogSize
+func (r *Room) ActivityLog(limit int) []Activity {
+	return r.activities.latest(limit)
+}
+
+// VisibleActivityLog is ActivityLog without the activities of movies
+// visible reports false for, see User.MovieVisibleFunc
+func (r *Room) VisibleActivityLog(limit int, visible func(m *model.Movie) bool) []Activity {
+	all := r.activities.latest(0)
+	list := all[:0]
+	for _, a := range all {
+		if a.MovieID == "" || visible(&model.Movie{
+			ID:         a.MovieID,
+			CreatorID:  a.movieCreatorID,
+			Visibility: a.movieVisibility,
+		}) {
+			list = append(list, a)
+		}
+	}
+	if limit > 0 && limit < len(list) {
+		list = list[len(list)-limit:]
+	}
+	return list
+}
@@ -0,0 +1,104 @@
+package op
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func activityMovieIDs(list []Activity) []string {
+	ids := make([]string, len(list))
+	for i, a := range list {
+		ids[i] = a.MovieID
+	}
+	return ids
+}
+
+func TestActivityLogRing(t *testing.T) {
+	l := &activityLog{buf: make([]Activity, 3)}
+	if got := l.latest(0); len(got) != 0 {
+		t.Fatalf("latest() = %v, want empty", got)
+	}
+	for _, id := range []string{"a", "b"} {
+		l.add(Activity{MovieID: id})
+	}
+	if got := activityMovieIDs(l.latest(0)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("latest(0) = %v, want [a b]", got)
+	}
+	for _, id := range []string{"c", "d", "e"} {
+		l.add(Activity{MovieID: id})
+	}
+	if got := activityMovieIDs(l.latest(0)); !reflect.DeepEqual(got, []string{"c", "d", "e"}) {
+		t.Fatalf("latest(0) = %v, want [c d e]", got)
+	}
+	if got := activityMovieIDs(l.latest(2)); !reflect.DeepEqual(got, []string{"d", "e"}) {
+		t.Fatalf("latest(2) = %v, want [d e]", got)
+	}
+}
+
+func TestRoomActivityLog(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.SetCurrentMovie(nil, false)
+	got := r.ActivityLog(10)
+	if len(got) != 1 || got[0].Type != ActivityCurrentChanged || got[0].Time == 0 {
+		t.Fatalf("ActivityLog() = %+v, want one current change", got)
+	}
+	if got[0].UserID != "" || got[0].Username != "" {
+		t.Fatalf("server change recorded user %q", got[0].Username)
+	}
+	u := &User{}
+	u.ID, u.Username = "u1", "alice"
+	r.setCurrentMovie(nil, false, u)
+	got = r.ActivityLog(1)
+	if got[0].UserID != "u1" || got[0].Username != "alice" {
+		t.Fatalf("ActivityLog() = %+v, want the change recorded by alice", got)
+	}
+}
+
+func TestVisibleActivityLog(t *testing.T) {
+	r := newRoom(&model.Room{CreatorID: "host"})
+	u := &User{}
+	u.ID, u.Username = "u1", "alice"
+	for _, m := range []*model.Movie{
+		{ID: "public"},
+		{ID: "staged", CreatorID: "u2", Visibility: model.MovieVisibilityCreator},
+		{ID: "own", CreatorID: "u1", Visibility: model.MovieVisibilityCreator},
+	} {
+		r.logUserActivity(ActivityMovieAdded, u, m)
+	}
+	r.logActivity(Activity{Type: ActivityPaused})
+
+	member := &User{User: model.User{ID: "u1"}}
+	got := activityMovieIDs(r.VisibleActivityLog(0, member.MovieVisibleFunc(r)))
+	if !reflect.DeepEqual(got, []string{"public", "own", ""}) {
+		t.Fatalf("VisibleActivityLog() = %v, want [public own <paused>]", got)
+	}
+	// the limit counts visible activities only
+	got = activityMovieIDs(r.VisibleActivityLog(3, member.MovieVisibleFunc(r)))
+	if !reflect.DeepEqual(got, []string{"public", "own", ""}) {
+		t.Fatalf("VisibleActivityLog(3) = %v, want [public own <paused>]", got)
+	}
+	host := &User{User: model.User{ID: "host"}}
+	if got := r.VisibleActivityLog(0, host.MovieVisibleFunc(r)); len(got) != 4 {
+		t.Fatalf("VisibleActivityLog() of the creator = %v, want every activity", activityMovieIDs(got))
+	}
+}
+
+func TestWithActivityLogSize(t *testing.T) {
+	r := newRoom(&model.Room{}, WithActivityLogSize(2))
+	for _, id := range []string{"a", "b", "c"} {
+		r.logActivity(Activity{MovieID: id})
+	}
+	if got := activityMovieIDs(r.ActivityLog(0)); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("ActivityLog(0) = %v, want [b c]", got)
+	}
+	disabled := newRoom(&model.Room{}, WithActivityLogSize(0))
+	disabled.logActivity(Activity{MovieID: "a"})
+	if got := disabled.ActivityLog(0); len(got) != 0 {
+		t.Fatalf("ActivityLog(0) of a room without feed = %v, want empty", got)
+	}
+	if size := newRoom(&model.Room{}).activities.size; size != defaultActivityLogSize {
+		t.Fatalf("activity log size = %d, want %d", size, defaultActivityLogSize)
+	}
+}
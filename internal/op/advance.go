@@ -0,0 +1,123 @@
+package op
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+// autoAdvanceInterval is how often a room with auto advance checks
+// whether the current movie has ended
+const autoAdvanceInterval = time.Second
+
+func (r *Room) AutoAdvance() bool {
+	return atomic.LoadUint32(&r.autoAdvance) == 1
+}
+
+// SetAutoAdvance makes the room play the next movie of the list once the
+// current movie ended, the switch is broadcast as AUTO_ADVANCED so
+// clients do not advance on their own
+func (r *Room) SetAutoAdvance(enabled bool) {
+	r.autoAdvanceLock.Lock()
+	defer r.autoAdvanceLock.Unlock()
+	if !enabled {
+		if atomic.SwapUint32(&r.autoAdvance, 0) == 1 {
+			close(r.autoAdvanceStop)
+			r.autoAdvanceStop = nil
+		}
+		return
+	}
+	if atomic.SwapUint32(&r.autoAdvance, 1) == 1 {
+		return
+	}
+	r.autoAdvanceStop = make(chan struct{})
+	go r.autoAdvanceLoop(r.autoAdvanceStop)
+}
+
+func (r *Room) autoAdvanceLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(autoAdvanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.Closed() {
+				return
+			}
+			r.checkAutoAdvance()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ended reports whether c is a movie that played to its end
+func ended(c Current) bool {
+	return c.Movie.ID != "" && !c.Movie.Base.Live && c.Status.Playing &&
+		c.Movie.Base.Duration > 0 && c.Status.Seek >= c.Movie.Base.Duration
+}
+
+// checkAutoAdvance switches to the next movie if the current one ended,
+// nothing is switched if the movie was changed or seeked back meanwhile
+func (r *Room) checkAutoAdvance() {
+	c := r.current.Current()
+	if !ended(c) {
+		return
+	}
+	next, err := r.PeekNextMovie()
+	if err != nil {
+		return
+	}
+	if !r.setCurrentMovieIf(func(now Current) bool {
+		return now.Movie.ID == c.Movie.ID && ended(now)
+	}, &next.Movie, true, 0, nil) {
+		return
+	}
+	_ = r.Broadcast(&ElementMessage{
+		Type:   pb.ElementMessageType_CHANGE_CURRENT,
+		Sender: SystemSender,
+	})
+	_ = r.Broadcast(&ElementMessage{
+		Type:    pb.ElementMessageType_AUTO_ADVANCED,
+		Sender:  SystemSender,
+		Message: next.Movie.ID,
+	})
+}
+
+var ErrPlaylistEmpty = errors.New("playlist has no next movie")
+
+// PeekNextMovie returns the movie auto-advance would play after the current
+// one in the playlist sort of the room, the first movie if nothing is playing,
+// the current movie is not changed and staged movies are skipped
+func (r *Room) PeekNextMovie() (*Movie, error) {
+	next, ok := r.movies.Next(r.Settings.PlaylistSort, r.current.Current().Movie.ID)
+	if !ok {
+		return nil, ErrPlaylistEmpty
+	}
+	return next, nil
+}
+
+// Next returns the first public movie after id in the given order,
+// an empty id returns the first public movie
+func (m *movies) Next(sort model.PlaylistSort, id string) (*Movie, bool) {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	ms := m.ordered(sort)
+	if id != "" {
+		i := slices.IndexFunc(ms, func(movie *Movie) bool { return movie.Movie.ID == id })
+		if i < 0 {
+			return nil, false
+		}
+		ms = ms[i+1:]
+	}
+	for _, movie := range ms {
+		if movie.Movie.Visibility.Public() {
+			return movie, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,136 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+func TestCheckAutoAdvance(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{
+			{ID: "a", Position: 1, Base: model.BaseMovie{Duration: 10}},
+			{ID: "b", Position: 2, Base: model.BaseMovie{Duration: 10}},
+		})
+	})
+	r.SetCurrentMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Duration: 10}}, true)
+
+	r.current.SetSeekRate(9, 1, 0)
+	r.checkAutoAdvance()
+	if id := r.current.Current().Movie.ID; id != "a" {
+		t.Fatalf("current = %s before the end, want a", id)
+	}
+
+	r.current.SetSeekRate(10, 1, 0)
+	r.checkAutoAdvance()
+	c := r.current.Current()
+	if c.Movie.ID != "b" || !c.Status.Playing || c.Status.Seek > 1 {
+		t.Fatalf("current = %s playing = %v seek = %f, want b true 0", c.Movie.ID, c.Status.Playing, c.Status.Seek)
+	}
+
+	// b is the last movie
+	r.current.SetSeekRate(10, 1, 0)
+	r.checkAutoAdvance()
+	if id := r.current.Current().Movie.ID; id != "b" {
+		t.Fatalf("current = %s after the last movie, want b", id)
+	}
+}
+
+func TestCheckAutoAdvanceBroadcast(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{
+			{ID: "a", Position: 1, Base: model.BaseMovie{Duration: 10}},
+			{ID: "b", Position: 2, Base: model.BaseMovie{Duration: 10}},
+		})
+	})
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	r.SetCurrentMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Duration: 10}}, true)
+	r.current.SetSeekRate(10, 1, 0)
+	r.checkAutoAdvance()
+	for _, want := range []pb.ElementMessageType{pb.ElementMessageType_CHANGE_CURRENT, pb.ElementMessageType_AUTO_ADVANCED} {
+		select {
+		case msg := <-c.GetReadChan():
+			if em, ok := msg.(*PreparedMessage).Message.(*ElementMessage); !ok || em.Type != want {
+				t.Fatalf("got %#v, want %v", msg, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v was not broadcast", want)
+		}
+	}
+}
+
+func TestCheckAutoAdvanceRecheck(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{
+			{ID: "a", Position: 1, Base: model.BaseMovie{Duration: 10}},
+			{ID: "b", Position: 2, Base: model.BaseMovie{Duration: 10}},
+			{ID: "c", Position: 3, Base: model.BaseMovie{Duration: 10}},
+		})
+	})
+	r.SetCurrentMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Duration: 10}}, true)
+	r.current.SetSeekRate(10, 1, 0)
+	prev := r.current.Current()
+	// a member picks c between the check and the switch
+	r.SetCurrentMovie(&model.Movie{ID: "c", Base: model.BaseMovie{Duration: 10}}, true)
+	if r.setCurrentMovieIf(func(now Current) bool {
+		return now.Movie.ID == prev.Movie.ID
+	}, &model.Movie{ID: "b"}, true, 0, nil) {
+		t.Fatal("setCurrentMovieIf() switched a changed movie")
+	}
+	if id := r.current.Current().Movie.ID; id != "c" {
+		t.Fatalf("current = %s, want c", id)
+	}
+}
+
+func TestSetAutoAdvance(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.SetAutoAdvance(true)
+	r.SetAutoAdvance(true)
+	if !r.AutoAdvance() {
+		t.Fatal("AutoAdvance() = false, want true")
+	}
+	r.SetAutoAdvance(false)
+	r.SetAutoAdvance(false)
+	if r.AutoAdvance() || r.autoAdvanceStop != nil {
+		t.Fatal("auto advance is still running")
+	}
+}
+
+func TestPeekNextMovie(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	if _, err := r.PeekNextMovie(); err != ErrPlaylistEmpty {
+		t.Fatalf("PeekNextMovie() of an empty list = %v, want %v", err, ErrPlaylistEmpty)
+	}
+	r.movies.restore([]*model.Movie{
+		{ID: "a", Position: 1, Base: model.BaseMovie{Name: "b"}},
+		{ID: "b", Position: 2, Base: model.BaseMovie{Name: "a"}},
+	})
+	next, err := r.PeekNextMovie()
+	if err != nil || next.Movie.ID != "a" {
+		t.Fatalf("PeekNextMovie() without current = %v, want a", err)
+	}
+	r.SetCurrentMovie(&next.Movie, false)
+	if next, err = r.PeekNextMovie(); err != nil || next.Movie.ID != "b" {
+		t.Fatalf("PeekNextMovie() after a = %v, want b", err)
+	}
+	if id := r.current.Current().Movie.ID; id != "a" {
+		t.Fatalf("PeekNextMovie() changed the current movie to %s", id)
+	}
+	// b sorts first by name
+	r.Settings.PlaylistSort = model.PlaylistSortName
+	if _, err := r.PeekNextMovie(); err != ErrPlaylistEmpty {
+		t.Fatalf("PeekNextMovie() of the last movie = %v, want %v", err, ErrPlaylistEmpty)
+	}
+}
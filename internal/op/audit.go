@@ -0,0 +1,37 @@
+package op
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// audit appends the records to the movie history, a failure is only
+// logged since the change it records was already made
+func (r *Room) audit(audits []*model.MovieAudit) {
+	if len(audits) == 0 {
+		return
+	}
+	if err := db.CreateMovieAudits(audits); err != nil {
+		log.Errorf("room %s: save movie audits error: %v", r.ID, err)
+	}
+}
+
+func (r *Room) auditMovies(userID string, action model.MovieAuditAction, movieIDs ...string) {
+	audits := make([]*model.MovieAudit, len(movieIDs))
+	for i, id := range movieIDs {
+		audits[i] = &model.MovieAudit{
+			RoomID:  r.ID,
+			MovieID: id,
+			UserID:  userID,
+			Action:  action,
+		}
+	}
+	r.audit(audits)
+}
+
+// MovieHistory returns the recorded changes of the movie, oldest first,
+// it also works for movies that were deleted
+func (r *Room) MovieHistory(id string) ([]*model.MovieAudit, error) {
+	return db.GetMovieAudits(r.ID, id)
+}
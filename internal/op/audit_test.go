@@ -0,0 +1,118 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func newAuditRoom(t *testing.T) (*Room, *User) {
+	t.Helper()
+	useTestDB(t)
+	u, err := CreateUser("audit", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.CreateRoom("audit", "", 0, db.WithCreator(&u.Value().User))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRoom(m), u.Value()
+}
+
+type auditEntry struct {
+	action model.MovieAuditAction
+	userID string
+}
+
+func checkMovieHistory(t *testing.T, r *Room, id string, want []auditEntry) {
+	t.Helper()
+	audits, err := r.MovieHistory(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]auditEntry, len(audits))
+	for i, a := range audits {
+		got[i] = auditEntry{action: a.Action, userID: a.UserID}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("history of %s = %v, want %v", id, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("history of %s = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestMovieHistory(t *testing.T) {
+	r, u := newAuditRoom(t)
+	if err := u.AddMovieToRoom(r, &model.BaseMovie{Name: "a", Url: "https://example.com/a.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	id := r.movies.IDs()[0]
+	if err := u.UpdateMovie(r, id, &model.BaseMovie{Name: "b", Url: "https://example.com/b.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	// changes made by the server are recorded without a user
+	if err := r.SetMovieCreator(id, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteMovieByID(id); err != nil {
+		t.Fatal(err)
+	}
+	checkMovieHistory(t, r, id, []auditEntry{
+		{model.MovieAuditAdded, u.ID},
+		{model.MovieAuditEdited, u.ID},
+		{model.MovieAuditCreatorChanged, ""},
+		{model.MovieAuditDeleted, ""},
+	})
+}
+
+func TestClearMoviesHistory(t *testing.T) {
+	r, u := newAuditRoom(t)
+	for _, name := range []string{"a", "b"} {
+		if err := u.AddMovieToRoom(r, &model.BaseMovie{Name: name, Url: "https://example.com/" + name + ".mp4"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := r.movies.IDs()
+	if err := u.ClearMovies(r); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		checkMovieHistory(t, r, id, []auditEntry{
+			{model.MovieAuditAdded, u.ID},
+			{model.MovieAuditDeleted, u.ID},
+		})
+	}
+	if err := u.AddMovieToRoom(r, &model.BaseMovie{Name: "c", Url: "https://example.com/c.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	id := r.movies.IDs()[0]
+	if err := r.ClearMovies(); err != nil {
+		t.Fatal(err)
+	}
+	checkMovieHistory(t, r, id, []auditEntry{
+		{model.MovieAuditAdded, u.ID},
+		{model.MovieAuditDeleted, ""},
+	})
+}
+
+func TestMovieHistoryRenamedRoom(t *testing.T) {
+	r, u := newAuditRoom(t)
+	if err := u.AddMovieToRoom(r, &model.BaseMovie{Name: "a", Url: "https://example.com/a.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	id := r.movies.IDs()[0]
+	newID := "0123456789abcdef0123456789abcdef"
+	if err := r.Rename(newID); err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.GetRoomByID(newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMovieHistory(t, newRoom(m), id, []auditEntry{{model.MovieAuditAdded, u.ID}})
+}
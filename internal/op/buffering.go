@@ -0,0 +1,239 @@
+package op
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+const (
+	// maxAutoPausesPerMinute caps how often buffering assist may pause a room
+	maxAutoPausesPerMinute = 3
+	// bufferingResumeDelay debounces resuming after clients stop buffering
+	bufferingResumeDelay = time.Second
+)
+
+// buffering tracks clients that reported buffering and pauses the room
+// while too many of them are stuck, see model.RoomSettings.BufferingAssist
+type buffering struct {
+	lock sync.Mutex
+	// clients maps a buffering client to the time it started buffering
+	clients map[*Client]time.Time
+	// paused is set when playback was paused by buffering assist
+	paused bool
+	// causedBy are the names of the users the room was paused for
+	causedBy   string
+	autoPauses []time.Time
+	resume     *time.Timer
+}
+
+func (r *Room) SetClientBuffering(cli *Client, buffering bool) {
+	if !r.Settings.BufferingAssist {
+		return
+	}
+	b := &r.buffering
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.clients == nil {
+		b.clients = make(map[*Client]time.Time)
+	}
+	if buffering {
+		if _, ok := b.clients[cli]; ok {
+			return
+		}
+		b.clients[cli] = time.Now()
+		if b.resume != nil {
+			b.resume.Stop()
+			b.resume = nil
+		}
+		time.AfterFunc(r.bufferingThreshold(), r.checkBuffering)
+		return
+	}
+	if _, ok := b.clients[cli]; !ok {
+		return
+	}
+	delete(b.clients, cli)
+	r.scheduleBufferingResume()
+}
+
+func (r *Room) bufferingThreshold() time.Duration {
+	return time.Duration(r.Settings.BufferingAssistThreshold * float64(time.Second))
+}
+
+// removeBufferingClient forgets a client that left the room
+func (r *Room) removeBufferingClient(cli *Client) {
+	b := &r.buffering
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.clients[cli]; !ok {
+		return
+	}
+	delete(b.clients, cli)
+	r.scheduleBufferingResume()
+}
+
+// resetBuffering drops all buffering state, used when the current movie changes
+func (r *Room) resetBuffering() {
+	b := &r.buffering
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clients = nil
+	b.paused = false
+	b.causedBy = ""
+	if b.resume != nil {
+		b.resume.Stop()
+		b.resume = nil
+	}
+}
+
+// stuckClients returns the names of users with a client buffering longer
+// than the threshold and whether they should pause the room, a room admin
+// pauses it alone, the others when they are more than the ratio of the
+// users online. It must be called with the lock held.
+func (r *Room) stuckClients() ([]string, bool) {
+	var (
+		users     = make(map[string]string)
+		admin     bool
+		threshold = r.bufferingThreshold()
+		now       = time.Now()
+	)
+	for cli, since := range r.buffering.clients {
+		if now.Sub(since) < threshold {
+			continue
+		}
+		if _, ok := users[cli.u.ID]; ok {
+			continue
+		}
+		users[cli.u.ID] = cli.u.Username
+		if !admin && r.HasPermission(cli.u.ID, roomAdminPermissions) {
+			admin = true
+		}
+	}
+	if len(users) == 0 {
+		return nil, false
+	}
+	names := make([]string, 0, len(users))
+	for _, name := range users {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	// PeopleNum counts users, not clients
+	online := r.PeopleNum()
+	return names, admin || online == 0 || float64(len(users)) > r.Settings.BufferingAssistRatio*float64(online)
+}
+
+func (r *Room) checkBuffering() {
+	if r.Closed() || !r.Settings.BufferingAssist {
+		return
+	}
+	// broadcast once the lock is released, the hub may block
+	if msg := r.pauseForBuffering(); msg != nil {
+		_ = r.Broadcast(msg)
+	}
+}
+
+// pauseForBuffering pauses the room if too many clients are stuck and
+// returns the PAUSE to broadcast, nil if the room was not paused
+func (r *Room) pauseForBuffering() *ElementMessage {
+	b := &r.buffering
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.paused {
+		return nil
+	}
+	names, ok := r.stuckClients()
+	if !ok {
+		return nil
+	}
+	c := r.current.Current()
+	if c.Movie.ID == "" || c.Movie.Base.Live || !c.Status.Playing {
+		return nil
+	}
+	now := time.Now()
+	recent := b.autoPauses[:0]
+	for _, t := range b.autoPauses {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	b.autoPauses = recent
+	if len(b.autoPauses) >= maxAutoPausesPerMinute {
+		return nil
+	}
+	b.autoPauses = append(b.autoPauses, now)
+	b.paused = true
+	b.causedBy = strings.Join(names, ", ")
+	log.Infof("room %s: paused for buffering of %s", r.ID, b.causedBy)
+	status := r.current.SetStatus(false, c.Status.Seek, c.Status.Rate, 0)
+	r.trackWatchTime(false)
+	r.logActivity(Activity{Type: ActivityPaused})
+	// the server paused, the message tells the viewers who it waits for
+	return &ElementMessage{
+		Type:    pb.ElementMessageType_PAUSE,
+		Sender:  SystemSender,
+		Message: "buffering: " + b.causedBy,
+		Seek:    status.Seek,
+		Rate:    status.Rate,
+	}
+}
+
+// scheduleBufferingResume must be called with the lock held
+func (r *Room) scheduleBufferingResume() {
+	b := &r.buffering
+	if !b.paused {
+		return
+	}
+	if _, stuck := r.stuckClients(); stuck {
+		return
+	}
+	if b.resume != nil {
+		b.resume.Reset(bufferingResumeDelay)
+		return
+	}
+	b.resume = time.AfterFunc(bufferingResumeDelay, r.resumeBuffering)
+}
+
+func (r *Room) resumeBuffering() {
+	if msg := r.playAfterBuffering(); msg != nil {
+		_ = r.Broadcast(msg)
+	}
+}
+
+// playAfterBuffering resumes the room paused by buffering assist and
+// returns the PLAY to broadcast, nil if the room was not resumed
+func (r *Room) playAfterBuffering() *ElementMessage {
+	b := &r.buffering
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.resume = nil
+	if !b.paused {
+		return nil
+	}
+	if _, stuck := r.stuckClients(); stuck {
+		return nil
+	}
+	b.paused = false
+	b.causedBy = ""
+	if r.Closed() {
+		return nil
+	}
+	c := r.current.Current()
+	// someone changed the status in the meantime
+	if c.Status.Playing || c.Movie.Base.Live {
+		return nil
+	}
+	status := r.current.SetStatus(true, c.Status.Seek, c.Status.Rate, 0)
+	r.trackWatchTime(true)
+	r.logActivity(Activity{Type: ActivityPlayed})
+	return &ElementMessage{
+		Type:    pb.ElementMessageType_PLAY,
+		Sender:  SystemSender,
+		Message: "buffering",
+		Seek:    status.Seek,
+		Rate:    status.Rate,
+	}
+}
@@ -0,0 +1,151 @@
+package op
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+func TestValidateBufferingAssistRatio(t *testing.T) {
+	tests := []struct {
+		assist bool
+		ratio  float64
+		valid  bool
+	}{
+		{false, 0, true},
+		{true, 0, false},
+		{true, -0.5, false},
+		{false, -0.5, false},
+		{true, 0.5, true},
+		{true, 1, true},
+		{true, 1.5, false},
+	}
+	for _, tt := range tests {
+		s := model.RoomSettings{BufferingAssist: tt.assist, BufferingAssistRatio: tt.ratio}
+		err := ValidateRoomSettings(&s)
+		if tt.valid && err != nil || !tt.valid && !errors.Is(err, ErrInvalidBufferingAssistRatio) {
+			t.Errorf("ValidateRoomSettings(assist %v, ratio %v) = %v", tt.assist, tt.ratio, err)
+		}
+	}
+}
+
+// waitFor waits for a message of type want queued for c, skipping others
+func waitFor(t *testing.T, c *Client, want pb.ElementMessageType, timeout time.Duration) *ElementMessage {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-c.GetReadChan():
+			if em, ok := msg.(*PreparedMessage).Message.(*ElementMessage); ok && em.Type == want {
+				return em
+			}
+		case <-deadline:
+			t.Fatalf("%v was not broadcast", want)
+			return nil
+		}
+	}
+}
+
+func TestBufferingAssist(t *testing.T) {
+	useTestDB(t)
+	r := newRoom(&model.Room{Settings: model.RoomSettings{
+		BufferingAssist:      true,
+		BufferingAssistRatio: 0.5,
+	}})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{{ID: "a", Position: 1}})
+	})
+	a, b := newTestClient("a"), newTestClient("b")
+	for _, c := range []*Client{a, b} {
+		c.u.Username = "user " + c.u.ID
+		if err := r.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer r.close()
+	r.SetCurrentMovie(&model.Movie{ID: "a"}, true)
+
+	// one of two clients is not more than half of the room
+	r.SetClientBuffering(a, true)
+	time.Sleep(50 * time.Millisecond)
+	if !r.current.Status().Playing {
+		t.Fatal("paused for one of two clients buffering")
+	}
+	r.SetClientBuffering(b, true)
+	pause := waitFor(t, a, pb.ElementMessageType_PAUSE, time.Second)
+	if pause.Sender != SystemSender || pause.Message != "buffering: user a, user b" {
+		t.Fatalf("paused by %q with %q, want %q naming the buffering users", pause.Sender, pause.Message, SystemSender)
+	}
+	if r.current.Status().Playing {
+		t.Fatal("still playing while the room is buffering")
+	}
+
+	r.SetClientBuffering(a, false)
+	r.SetClientBuffering(b, false)
+	waitFor(t, a, pb.ElementMessageType_PLAY, bufferingResumeDelay*2)
+	if !r.current.Status().Playing {
+		t.Fatal("not resumed once the clients stopped buffering")
+	}
+}
+
+func TestStuckClients(t *testing.T) {
+	useTestDB(t)
+	newUser := func(name string, conf ...db.CreateUserConfig) *User {
+		u, err := CreateUser(name, "password", conf...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Value()
+	}
+	member := newUser("member")
+	siteAdmin := newUser("site admin", db.WithRole(model.RoleAdmin))
+	roomAdmin := newUser("room admin")
+	m, err := db.CreateRoom("buffering", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FirstOrCreateRoomUserRelation(m.ID, roomAdmin.ID, db.WithRoomUserRelationStatus(model.RoomUserStatusActive), db.WithRoomUserRelationPermissions(roomAdminPermissions)); err != nil {
+		t.Fatal(err)
+	}
+	r := newRoom(m)
+	r.Settings.BufferingAssistRatio = 0.5
+	defer r.close()
+	clients := make(map[*User][]*Client)
+	for _, u := range []*User{member, member, siteAdmin, roomAdmin} {
+		c := newClient(u, r, nil)
+		if err := r.hub.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+		clients[u] = append(clients[u], c)
+	}
+
+	tests := []struct {
+		name      string
+		buffering []*Client
+		names     []string
+		stuck     bool
+	}{
+		// both clients of one of three users are not more than half of them
+		{"clients of one user", clients[member], []string{"member"}, false},
+		{"site admin", clients[siteAdmin], []string{"site admin"}, false},
+		{"room admin", clients[roomAdmin], []string{"room admin"}, true},
+		{"two users", append(clients[member][:1:1], clients[siteAdmin]...), []string{"member", "site admin"}, true},
+	}
+	for _, tt := range tests {
+		r.buffering.lock.Lock()
+		r.buffering.clients = make(map[*Client]time.Time)
+		for _, c := range tt.buffering {
+			r.buffering.clients[c] = time.Now().Add(-time.Minute)
+		}
+		names, stuck := r.stuckClients()
+		r.buffering.lock.Unlock()
+		if !slices.Equal(names, tt.names) || stuck != tt.stuck {
+			t.Errorf("%s: stuckClients() = %v, %v, want %v, %v", tt.name, names, stuck, tt.names, tt.stuck)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+const (
+	maxChapters       = 64
+	maxChapterNameLen = 64
+	// chapterSkipInterval is how often a room with viewers checks for chapters to skip
+	chapterSkipInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrInvalidChapter     = errors.New("invalid chapter")
+	ErrChaptersOutOfOrder = errors.New("chapters must be sorted by start")
+	ErrChaptersOverlap    = errors.New("chapters must not overlap")
+	ErrTooManyChapters    = fmt.Errorf("a movie can have at most %d chapters", maxChapters)
+	ErrChapterOutOfBounds = errors.New("chapter is outside of the movie")
+)
+
+// validateChapters checks the chapters of a movie, duration is 0 if unknown
+func validateChapters(chapters []model.Chapter, duration float64) error {
+	if len(chapters) > maxChapters {
+		return ErrTooManyChapters
+	}
+	for i, c := range chapters {
+		switch {
+		case c.Name == "" || len(c.Name) > maxChapterNameLen:
+			return fmt.Errorf("chapter %d: %w: name must be 1 to %d bytes", i, ErrInvalidChapter, maxChapterNameLen)
+		case c.Start < 0 || (c.End != 0 && c.End <= c.Start):
+			return fmt.Errorf("chapter %d: %w: end must be after start", i, ErrInvalidChapter)
+		case !c.Action.Valid():
+			return fmt.Errorf("chapter %d: %w: unknown action %s", i, ErrInvalidChapter, c.Action)
+		case duration > 0 && (c.Start >= duration || c.End > duration):
+			return fmt.Errorf("chapter %d: %w", i, ErrChapterOutOfBounds)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := chapters[i-1]
+		if c.Start <= prev.Start {
+			return fmt.Errorf("chapter %d: %w", i, ErrChaptersOutOfOrder)
+		}
+		if prev.End > c.Start {
+			return fmt.Errorf("chapter %d: %w", i, ErrChaptersOverlap)
+		}
+	}
+	return nil
+}
+
+// chapterSkipTarget returns where to seek to skip the chapter playing at
+// seek, false if that chapter is not marked to be skipped
+func chapterSkipTarget(chapters []model.Chapter, duration, seek float64) (float64, bool) {
+	for i, c := range chapters {
+		if seek < c.Start {
+			break
+		}
+		end := c.End
+		if end == 0 {
+			if i+1 < len(chapters) {
+				end = chapters[i+1].Start
+			} else {
+				end = duration
+			}
+		}
+		if seek < end {
+			return end, c.Action == model.ChapterActionSkip
+		}
+	}
+	return 0, false
+}
+
+// chapterSkipLoop skips chapters while the room has a hub, it stops once the hub is closed
+func (r *Room) chapterSkipLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(chapterSkipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.Settings.AutoSkipChapters {
+				r.checkChapterSkip()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (r *Room) checkChapterSkip() {
+	c := r.current.Current()
+	if c.Movie.ID == "" || c.Movie.Base.Live || !c.Status.Playing {
+		return
+	}
+	target, ok := chapterSkipTarget(c.Movie.Base.Chapters, c.Movie.Base.Duration, c.Status.Seek)
+	if !ok || target <= 0 {
+		return
+	}
+	_ = r.ForceSeek(target)
+}
+
+// updateCurrentChapters carries chapter edits over to the current movie and
+// broadcasts CHANGE_CURRENT, the playback status is kept
+func (r *Room) updateCurrentChapters(movieID string, chapters []model.Chapter) {
+	changed := false
+	r.current.updateMovie(movieID, func(base *model.BaseMovie) {
+		if !slices.Equal(base.Chapters, chapters) {
+			base.Chapters = slices.Clone(chapters)
+			changed = true
+		}
+	})
+	if changed {
+		_ = r.Broadcast(&ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_CURRENT,
+			Sender: SystemSender,
+		})
+	}
+}
+
+// onlyChaptersChanged reports whether b differs from a in nothing but the chapters
+func onlyChaptersChanged(a, b *model.BaseMovie) bool {
+	x, y := *a, *b
+	x.Chapters, y.Chapters = nil, nil
+	return reflect.DeepEqual(x, y)
+}
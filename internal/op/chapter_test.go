@@ -0,0 +1,71 @@
+package op
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestValidateChapters(t *testing.T) {
+	valid := []model.Chapter{
+		{Name: "intro", Start: 0, End: 90, Action: model.ChapterActionSkip},
+		{Name: "part 1", Start: 90},
+		{Name: "credits", Start: 1200, Action: model.ChapterActionNone},
+	}
+	if err := validateChapters(valid, 1300); err != nil {
+		t.Fatalf("validateChapters() = %v, want nil", err)
+	}
+	for _, c := range []struct {
+		chapters []model.Chapter
+		want     error
+	}{
+		{[]model.Chapter{{Name: "a", Start: 10}, {Name: "b", Start: 5}}, ErrChaptersOutOfOrder},
+		{[]model.Chapter{{Name: "a", Start: 0, End: 20}, {Name: "b", Start: 10}}, ErrChaptersOverlap},
+		{[]model.Chapter{{Name: "a", Start: 10, End: 5}}, ErrInvalidChapter},
+		{[]model.Chapter{{Start: 0}}, ErrInvalidChapter},
+		{[]model.Chapter{{Name: "a", Action: "jump"}}, ErrInvalidChapter},
+		{[]model.Chapter{{Name: "a", Start: 2000}}, ErrChapterOutOfBounds},
+	} {
+		if err := validateChapters(c.chapters, 1300); !errors.Is(err, c.want) {
+			t.Fatalf("validateChapters(%+v) = %v, want %v", c.chapters, err, c.want)
+		}
+	}
+}
+
+func TestChapterSkipTarget(t *testing.T) {
+	chapters := []model.Chapter{
+		{Name: "intro", Start: 10, Action: model.ChapterActionSkip},
+		{Name: "main", Start: 90},
+		{Name: "credits", Start: 1200, Action: model.ChapterActionSkip},
+	}
+	for _, c := range []struct {
+		seek   float64
+		target float64
+		skip   bool
+	}{
+		{5, 0, false},
+		{10, 90, true},
+		{89, 90, true},
+		{90, 0, false},
+		{1250, 1300, true},
+	} {
+		target, skip := chapterSkipTarget(chapters, 1300, c.seek)
+		if skip != c.skip || (skip && target != c.target) {
+			t.Fatalf("chapterSkipTarget(%v) = %v %v, want %v %v", c.seek, target, skip, c.target, c.skip)
+		}
+	}
+}
+
+func TestOnlyChaptersChanged(t *testing.T) {
+	a := model.BaseMovie{Name: "a", Headers: map[string]string{"a": "b"}}
+	b := a
+	b.Chapters = []model.Chapter{{Name: "intro"}}
+	if !onlyChaptersChanged(&a, &b) {
+		t.Fatal("onlyChaptersChanged() = false for a chapter edit")
+	}
+	b.Url = "https://example.com/b.mp4"
+	if onlyChaptersChanged(&a, &b) {
+		t.Fatal("onlyChaptersChanged() = true for an url edit")
+	}
+}
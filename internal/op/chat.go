@@ -0,0 +1,164 @@
+package op
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+const (
+	// chatHistoryTrimEvery is how many recorded messages the history of a
+	// room may grow over its limit before the oldest are deleted
+	chatHistoryTrimEvery = 64
+	// danmakuExportBatch is how many messages an export loads at a time
+	danmakuExportBatch = 500
+)
+
+// chatHistoryEnabled reports whether the chat of the room is kept
+func (r *Room) chatHistoryEnabled() bool {
+	return settings.ChatHistory.Get() && r.Settings.ChatHistory
+}
+
+// RecordChat keeps the chat message aligned to the position of the current
+// movie when chat history is enabled on the server and in the room,
+// messages sent while nothing is playing are not kept
+func (r *Room) RecordChat(u *User, message string) error {
+	if !r.chatHistoryEnabled() {
+		return nil
+	}
+	c := r.current.Current()
+	if c.Movie.ID == "" {
+		return nil
+	}
+	err := db.CreateChatMessage(&model.ChatMessage{
+		RoomID:  r.ID,
+		MovieID: c.Movie.ID,
+		UserID:  u.ID,
+		Message: message,
+		Seek:    c.Status.Seek,
+	})
+	if err != nil {
+		return err
+	}
+	limit := settings.ChatHistoryLimit.Get()
+	if limit > 0 && r.chatRecorded.Add(1)%chatHistoryTrimEvery == 0 {
+		if err := db.TrimChatMessages(r.ID, int(limit)); err != nil {
+			log.Warnf("room %s: trim chat history error: %v", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// ClearChatHistory deletes the kept chat of the room, later exports only
+// contain messages sent after it
+func (r *Room) ClearChatHistory() error {
+	return db.DeleteChatMessages(r.ID)
+}
+
+// ExportDanmaku writes the kept chat of the movie to w as a bilibili xml
+// danmaku file, the messages are loaded in batches so large histories are
+// streamed, with settings.ChatHistoryRedact the messages of deleted and
+// banned users are left out
+func (r *Room) ExportDanmaku(w io.Writer, movieID string) error {
+	bw := bufio.NewWriter(w)
+	dw := &danmakuWriter{w: bw}
+	dw.header(movieID)
+	var redacted map[string]bool
+	if settings.ChatHistoryRedact.Get() {
+		redacted = make(map[string]bool)
+	}
+	err := db.EachChatMessages(r.ID, movieID, danmakuExportBatch, func(messages []*model.ChatMessage) error {
+		for _, m := range messages {
+			if redacted != nil {
+				hide, err := chatUserRedacted(redacted, m.UserID)
+				if err != nil {
+					return err
+				}
+				if hide {
+					continue
+				}
+			}
+			dw.message(m)
+		}
+		return dw.err
+	})
+	if err != nil {
+		return err
+	}
+	dw.footer()
+	if dw.err != nil {
+		return dw.err
+	}
+	return bw.Flush()
+}
+
+// chatUserRedacted reports whether the user was deleted or banned,
+// the results are cached in seen for the rest of the export
+func chatUserRedacted(seen map[string]bool, userID string) (bool, error) {
+	if hide, ok := seen[userID]; ok {
+		return hide, nil
+	}
+	e, err := LoadOrInitUserByID(userID)
+	var notFound *ErrUserNotFound
+	switch {
+	case errors.As(err, &notFound):
+		seen[userID] = true
+	case err != nil:
+		return false, err
+	default:
+		seen[userID] = e.Value().IsBanned()
+	}
+	return seen[userID], nil
+}
+
+// danmakuWriter writes the bilibili xml danmaku format most local players
+// load, the first error is kept and stops further writes
+type danmakuWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (d *danmakuWriter) write(s string) {
+	if d.err == nil {
+		_, d.err = d.w.WriteString(s)
+	}
+}
+
+func (d *danmakuWriter) header(movieID string) {
+	d.write(xml.Header)
+	d.write("<i>\n<chatserver>synctv</chatserver>\n<chatid>")
+	d.escape(movieID)
+	d.write("</chatid>\n")
+}
+
+func (d *danmakuWriter) escape(s string) {
+	if d.err == nil {
+		d.err = xml.EscapeText(d.w, []byte(s))
+	}
+}
+
+// message writes a scrolling white danmaku at the seek of the message, the
+// sender is a hash of the user id as in bilibili files
+func (d *danmakuWriter) message(m *model.ChatMessage) {
+	d.write(fmt.Sprintf(`<d p="%s,1,25,16777215,%d,0,%08x,%d">`,
+		strconv.FormatFloat(m.Seek, 'f', 3, 64),
+		m.CreatedAt.Unix(),
+		crc32.ChecksumIEEE([]byte(m.UserID)),
+		m.ID,
+	))
+	d.escape(m.Message)
+	d.write("</d>\n")
+}
+
+func (d *danmakuWriter) footer() {
+	d.write("</i>\n")
+}
@@ -0,0 +1,67 @@
+package op
+
+import (
+	"bufio"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestDanmakuWriter(t *testing.T) {
+	var b strings.Builder
+	bw := bufio.NewWriter(&b)
+	d := &danmakuWriter{w: bw}
+	d.header("movie")
+	d.message(&model.ChatMessage{
+		ID:        7,
+		CreatedAt: time.Unix(1700000000, 0),
+		UserID:    "a",
+		Message:   `<b>hi</b> & "bye"`,
+		Seek:      12.3456,
+	})
+	d.footer()
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		ChatID string `xml:"chatid"`
+		D      []struct {
+			P    string `xml:"p,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"d"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &file); err != nil {
+		t.Fatalf("export is not valid xml: %v\n%s", err, b.String())
+	}
+	if file.ChatID != "movie" || len(file.D) != 1 {
+		t.Fatalf("export = %+v", file)
+	}
+	if want := "12.346,1,25,16777215,1700000000,0,e8b7be43,7"; file.D[0].P != want {
+		t.Fatalf("p = %s, want %s", file.D[0].P, want)
+	}
+	if want := `<b>hi</b> & "bye"`; file.D[0].Text != want {
+		t.Fatalf("text = %q, want %q", file.D[0].Text, want)
+	}
+}
+
+func TestRecordChatDisabled(t *testing.T) {
+	r := newRoom(&model.Room{Settings: model.RoomSettings{ChatHistory: true}})
+	movie := &model.Movie{ID: "a"}
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{movie})
+	})
+	r.SetCurrentMovie(movie, true)
+	// the server setting is off by default, so nothing reaches the database
+	if err := r.RecordChat(&User{User: model.User{ID: "u"}}, "hi"); err != nil {
+		t.Fatalf("RecordChat() = %v", err)
+	}
+	if n := r.chatRecorded.Load(); n != 0 {
+		t.Fatalf("chatRecorded = %d, want 0", n)
+	}
+}
@@ -1,6 +1,8 @@
 package op
 
 import (
+	"context"
+	"errors"
 	"io"
 	"sync"
 	"sync/atomic"
@@ -10,13 +12,30 @@ import (
 )
 
 type Client struct {
-	u       *User
-	r       *Room
-	c       chan Message
-	wg      sync.WaitGroup
-	conn    *websocket.Conn
-	timeOut time.Duration
-	closed  uint32
+	// id identifies the connection, it is assigned when the client is registered
+	id string
+	u  *User
+	r  *Room
+	// hub is set when the client is registered
+	hub  *Hub
+	c    chan Message
+	exit chan struct{}
+	// closeLock is held for reading by Send, Close takes it for writing
+	// before closing c so no Send can write to a closed channel
+	closeLock sync.RWMutex
+	conn      *websocket.Conn
+	// timeOut bounds how long Send waits for a full buffer
+	timeOut     time.Duration
+	closed      uint32
+	closeCode   int
+	closeReason string
+	// lastPong is the unix milli time of the last pong of the connection
+	lastPong atomic.Int64
+	// lastSeq is the sequence of the last broadcast written to the client
+	lastSeq atomic.Uint64
+	// rtc is the peer connection status and seek messages are sent on, see
+	// Room.RegClientWithOffer
+	rtc atomic.Pointer[rtcPeer]
 }
 
 func newClient(user *User, room *Room, conn *websocket.Conn) *Client {
@@ -24,11 +43,16 @@ func newClient(user *User, room *Room, conn *websocket.Conn) *Client {
 		r:       room,
 		u:       user,
 		c:       make(chan Message, 128),
+		exit:    make(chan struct{}),
 		conn:    conn,
 		timeOut: 10 * time.Second,
 	}
 }
 
+func (c *Client) ID() string {
+	return c.id
+}
+
 func (c *Client) User() *User {
 	return c.u
 }
@@ -41,25 +65,74 @@ func (c *Client) Broadcast(msg Message, conf ...BroadcastConf) error {
 	return c.r.hub.Broadcast(msg, conf...)
 }
 
+// Send queues the message for the client, queued messages are written in order
 func (c *Client) Send(msg Message) error {
-	c.wg.Add(1)
-	defer c.wg.Done()
+	return c.send(context.Background(), msg)
+}
+
+// send is Send giving up once ctx is done
+func (c *Client) send(ctx context.Context, msg Message) error {
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
 	if c.Closed() {
 		return ErrAlreadyClosed
 	}
-	c.c <- msg
-	return nil
+	if p := c.rtc.Load(); p != nil && p.sendState(msg) {
+		return nil
+	}
+	select {
+	case c.c <- msg:
+		return nil
+	case <-c.exit:
+		return ErrAlreadyClosed
+	default:
+	}
+	t := time.NewTimer(c.timeOut)
+	defer t.Stop()
+	select {
+	case c.c <- msg:
+		return nil
+	case <-c.exit:
+		return ErrAlreadyClosed
+	case <-t.C:
+		return ErrSendTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// closeWriteTimeout bounds writing the queued messages and the close frame
+// to a stuck peer once the client is closed
+const closeWriteTimeout = time.Second
+
+// Close closes the client with a normal closure
 func (c *Client) Close() error {
+	return c.CloseWithReason(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithReason closes the client, the writer still writes the queued
+// messages and then sends a close frame with the code and reason to the
+// peer, see WriteLoop and CloseCodeRoomClosed for the application codes
+func (c *Client) CloseWithReason(code int, reason string) error {
 	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
 		return ErrAlreadyClosed
 	}
-	c.wg.Wait()
+	close(c.exit)
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	c.closeCode = code
+	c.closeReason = reason
 	close(c.c)
 	return nil
 }
 
+// CloseCode returns the code and reason the client was closed with
+func (c *Client) CloseCode() (int, string) {
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	return c.closeCode, c.closeReason
+}
+
 func (c *Client) Closed() bool {
 	return atomic.LoadUint32(&c.closed) == 1
 }
@@ -68,10 +141,103 @@ func (c *Client) GetReadChan() <-chan Message {
 	return c.c
 }
 
+// WriteLoop calls write with the queued messages of the registered client
+// in order until write fails or the client is closed and every queued
+// message was written, then it sends the close frame of the client.
+// The peer connection of the client is closed when it returns, closing
+// the hub waits for it to return.
+func (c *Client) WriteLoop(write func(Message) error) error {
+	h := c.hub
+	if h == nil {
+		return errors.New("client not registered")
+	}
+	h.closeLock.RLock()
+	if h.Closed() {
+		h.closeLock.RUnlock()
+		// a no-op if closing the hub closed the client already
+		_ = c.CloseWithReason(CloseCodeRoomClosed, CloseReasonRoomClosed)
+		c.writeClose(time.Now().Add(closeWriteTimeout))
+		return ErrAlreadyClosed
+	}
+	h.wg.Add(1)
+	h.closeLock.RUnlock()
+	defer h.wg.Done()
+	defer c.closeRTC()
+	var deadline time.Time
+	for msg := range c.c {
+		// a closed client only has closeWriteTimeout left to drain
+		if deadline.IsZero() && c.Closed() {
+			deadline = time.Now().Add(closeWriteTimeout)
+			if c.conn != nil {
+				_ = c.conn.SetWriteDeadline(deadline)
+			}
+		}
+		if err := write(msg); err != nil {
+			return err
+		}
+		if pm, ok := msg.(*PreparedMessage); ok && pm.seq != 0 {
+			c.lastSeq.Store(pm.seq)
+		}
+	}
+	if deadline.IsZero() {
+		deadline = time.Now().Add(closeWriteTimeout)
+	}
+	c.writeClose(deadline)
+	return nil
+}
+
+// writeClose sends the close frame with the code and reason the client
+// was closed with and lets the data channels send what they buffered
+func (c *Client) writeClose(deadline time.Time) {
+	if p := c.rtc.Load(); p != nil {
+		defer p.flush(deadline)
+	}
+	if c.conn == nil {
+		return
+	}
+	code, reason := c.CloseCode()
+	_ = c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		deadline,
+	)
+}
+
 func (c *Client) NextWriter(messageType int) (io.WriteCloser, error) {
 	return c.conn.NextWriter(messageType)
 }
 
+// WritePreparedMessage writes the prepared frame of the message, it must
+// only be called by the writer of the connection
+func (c *Client) WritePreparedMessage(msg *PreparedMessage) error {
+	pm, err := msg.Prepared()
+	if err != nil {
+		return err
+	}
+	return c.conn.WritePreparedMessage(pm)
+}
+
+// NextReader returns ErrMessageTooLarge when the peer exceeded the read limit
 func (c *Client) NextReader() (int, io.Reader, error) {
-	return c.conn.NextReader()
+	t, r, err := c.conn.NextReader()
+	if err != nil {
+		return t, r, readErr(err)
+	}
+	return t, &clientReader{r: r}, nil
+}
+
+type clientReader struct {
+	r io.Reader
+}
+
+func (r *clientReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	return n, readErr(err)
+}
+
+func readErr(err error) error {
+	if errors.Is(err, websocket.ErrReadLimit) || websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		return ErrMessageTooLarge
+	}
+	return err
 }
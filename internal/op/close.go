@@ -0,0 +1,36 @@
+package op
+
+// Application close codes sent to clients in the websocket close frame,
+// frontends use them to tell the user why they were disconnected and to
+// decide whether reconnecting makes sense
+const (
+	// CloseCodeRoomClosed is sent when the room is deleted, banned or
+	// evicted from the cache, reconnecting may succeed
+	CloseCodeRoomClosed = 4000 + iota
+	// CloseCodeKicked is sent when the user was kicked or removed, the reason
+	// names who kicked the user, do not reconnect automatically
+	CloseCodeKicked
+	// CloseCodeBanned is sent when the user was banned from the room or
+	// the site, do not reconnect
+	CloseCodeBanned
+	// CloseCodePasswordChanged is sent when the user or room password
+	// changed, the client must log in again before reconnecting
+	CloseCodePasswordChanged
+	// CloseCodeBackpressure is sent when the client did not keep up with
+	// the messages sent to it, reconnecting is safe
+	CloseCodeBackpressure
+	// CloseCodeReplaced is sent when the user connected again elsewhere and
+	// only one client per user is allowed, do not reconnect automatically
+	CloseCodeReplaced
+)
+
+const (
+	CloseReasonRoomClosed      = "room closed"
+	CloseReasonKicked          = "kicked"
+	CloseReasonUserDeleted     = "user deleted"
+	CloseReasonBanned          = "banned"
+	CloseReasonPasswordChanged = "password changed"
+	CloseReasonRoomPassword    = "room password changed"
+	CloseReasonBackpressure    = "too slow to receive messages"
+	CloseReasonReplaced        = "replaced by a new connection"
+)
@@ -0,0 +1,303 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+	"google.golang.org/protobuf/proto"
+)
+
+func checkCloseCode(t *testing.T, c *Client, code int, reason string) {
+	t.Helper()
+	if !c.Closed() {
+		t.Fatal("client is not closed")
+	}
+	if gotCode, gotReason := c.CloseCode(); gotCode != code || gotReason != reason {
+		t.Fatalf("CloseCode() = %d %q, want %d %q", gotCode, gotReason, code, reason)
+	}
+}
+
+func TestCloseCodeRoomClosed(t *testing.T) {
+	h := newHub("test")
+	c := newTestClient("a")
+	if err := h.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkCloseCode(t, c, CloseCodeRoomClosed, CloseReasonRoomClosed)
+}
+
+func TestCloseCodeCloseUser(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	a1, a2, b := newTestClient("a"), newTestClient("a"), newTestClient("b")
+	for _, c := range []*Client{a1, a2, b} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.CloseUser("a", CloseCodePasswordChanged, CloseReasonPasswordChanged); err != nil {
+		t.Fatal(err)
+	}
+	checkCloseCode(t, a1, CloseCodePasswordChanged, CloseReasonPasswordChanged)
+	checkCloseCode(t, a2, CloseCodePasswordChanged, CloseReasonPasswordChanged)
+	if b.Closed() {
+		t.Fatal("other user was closed")
+	}
+}
+
+func TestCloseCodeReplaced(t *testing.T) {
+	r := newRoom(&model.Room{}, WithSingleClientPerUser(true))
+	h := r.hub
+	defer h.Close()
+	a1, a2, b := newTestClient("a"), newTestClient("a"), newTestClient("b")
+	for _, c := range []*Client{a1, b, a2} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCloseCode(t, a1, CloseCodeReplaced, CloseReasonReplaced)
+	if a2.Closed() || b.Closed() {
+		t.Fatal("replacing client or other user was closed")
+	}
+	if err := h.UnRegClient(a1); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.PeopleNum(); n != 2 {
+		t.Fatalf("PeopleNum() = %d, want 2", n)
+	}
+}
+
+func TestCloseCodeBackpressure(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	c := newTestClient("a")
+	c.timeOut = 10 * time.Millisecond
+	if err := h.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	// nobody drains the client
+	for i := 0; i <= cap(c.c); i++ {
+		if err := h.SendToUser("a", &ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+			break
+		}
+	}
+	checkCloseCode(t, c, CloseCodeBackpressure, CloseReasonBackpressure)
+}
+
+func TestCloseCodeOnlyFirst(t *testing.T) {
+	c := newTestClient("a")
+	if err := c.CloseWithReason(CloseCodeBanned, CloseReasonBanned); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != ErrAlreadyClosed {
+		t.Fatalf("Close() = %v, want %v", err, ErrAlreadyClosed)
+	}
+	checkCloseCode(t, c, CloseCodeBanned, CloseReasonBanned)
+}
+
+func TestCloseCodeKicked(t *testing.T) {
+	r := newRoom(&model.Room{})
+	defer r.hub.Close()
+	a, b := newTestClient("a"), newTestClient("b")
+	for _, c := range []*Client{a, b} {
+		if err := r.hub.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.KickUser("c", ""); err != ErrUserNotConnected {
+		t.Fatalf("KickUser() = %v, want %v", err, ErrUserNotConnected)
+	}
+	if err := r.KickUser("a", "kicked by host"); err != nil {
+		t.Fatal(err)
+	}
+	checkCloseCode(t, a, CloseCodeKicked, "kicked by host")
+	if err := r.KickUser("b", ""); err != nil {
+		t.Fatal(err)
+	}
+	checkCloseCode(t, b, CloseCodeKicked, CloseReasonKicked)
+}
+
+func TestCloseClientsFilter(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	host, member := newTestClient("host"), newTestClient("member")
+	for _, c := range []*Client{host, member} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := h.CloseClients(func(c *Client) bool {
+		return c.u.ID != "host"
+	}, CloseCodePasswordChanged, CloseReasonRoomPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCloseCode(t, member, CloseCodePasswordChanged, CloseReasonRoomPassword)
+	if host.Closed() {
+		t.Fatal("host was closed")
+	}
+}
+
+func newTestRoom() *Room {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	return r
+}
+
+func TestCloseAll(t *testing.T) {
+	rooms := make([]*Room, closeAllWorkers*2)
+	for i := range rooms {
+		rooms[i] = newTestRoom()
+	}
+	if err := CloseAll(context.Background(), rooms); err != nil {
+		t.Fatalf("CloseAll() = %v", err)
+	}
+	for i, r := range rooms {
+		if !r.Closed() {
+			t.Fatalf("room %d is not closed", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := CloseAll(ctx, []*Room{newTestRoom()}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CloseAll() of a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+// writeTestMessage writes a message like the websocket handler does
+func writeTestMessage(c *Client, msg Message) error {
+	if pm, ok := msg.(*PreparedMessage); ok {
+		return c.WritePreparedMessage(pm)
+	}
+	wc, err := c.NextWriter(msg.MessageType())
+	if err != nil {
+		return err
+	}
+	if err := msg.Encode(wc); err != nil {
+		return err
+	}
+	return wc.Close()
+}
+
+// serveTestClient registers a client for a real websocket connection with
+// reg, its writer starts once start is closed
+func serveTestClient(t *testing.T, reg func(*Client) error, start <-chan struct{}) (*Client, *websocket.Conn) {
+	t.Helper()
+	clients := make(chan *Client, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		c := newClient(&User{User: model.User{ID: "u"}}, nil, conn)
+		if err := reg(c); err != nil {
+			t.Error(err)
+			return
+		}
+		clients <- c
+		<-start
+		_ = c.WriteLoop(func(msg Message) error {
+			return writeTestMessage(c, msg)
+		})
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return <-clients, conn
+}
+
+// readUntilClose returns the messages of type typ read from conn and the
+// close frame that ended the connection
+func readUntilClose(t *testing.T, conn *websocket.Conn, typ pb.ElementMessageType) ([]*pb.ElementMessage, *websocket.CloseError) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msgs []*pb.ElementMessage
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) {
+				t.Fatalf("ReadMessage() = %v, want a close frame", err)
+			}
+			return msgs, ce
+		}
+		em := new(pb.ElementMessage)
+		if err := proto.Unmarshal(data, em); err != nil {
+			t.Fatal(err)
+		}
+		if em.Type == typ {
+			msgs = append(msgs, em)
+		}
+	}
+}
+
+func chatTexts(msgs []*pb.ElementMessage) []string {
+	texts := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		texts = append(texts, m.Message)
+	}
+	return texts
+}
+
+func TestCloseWritesQueuedMessages(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	start := make(chan struct{})
+	c, conn := serveTestClient(t, h.RegClient, start)
+	for _, m := range []string{"a", "b", "c"} {
+		if err := c.Send(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.CloseWithReason(CloseCodeKicked, CloseReasonKicked); err != nil {
+		t.Fatal(err)
+	}
+	close(start)
+	msgs, ce := readUntilClose(t, conn, pb.ElementMessageType_CHAT_MESSAGE)
+	if got := chatTexts(msgs); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("got messages %v before the close frame, want [a b c]", got)
+	}
+	if ce.Code != CloseCodeKicked || ce.Text != CloseReasonKicked {
+		t.Fatalf("close frame = %d %q, want %d %q", ce.Code, ce.Text, CloseCodeKicked, CloseReasonKicked)
+	}
+}
+
+func TestHubCloseWritesNotice(t *testing.T) {
+	h := newHub("test")
+	start := make(chan struct{})
+	close(start)
+	_, conn := serveTestClient(t, h.RegClient, start)
+	if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msgs, ce := readUntilClose(t, conn, pb.ElementMessageType_CHAT_MESSAGE)
+	if got := chatTexts(msgs); !reflect.DeepEqual(got, []string{"bye"}) {
+		t.Fatalf("got messages %v before the close frame, want [bye]", got)
+	}
+	if ce.Code != CloseCodeRoomClosed || ce.Text != CloseReasonRoomClosed {
+		t.Fatalf("close frame = %d %q, want %d %q", ce.Code, ce.Text, CloseCodeRoomClosed, CloseReasonRoomClosed)
+	}
+}
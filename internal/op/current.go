@@ -47,17 +47,55 @@ func (c *current) Current() Current {
 	return c.current
 }
 
+// Progress returns the completion ratio of the current movie in [0, 1].
+// It returns 0 if no movie is set, the movie is live or its duration is unknown.
+func (c *current) Progress() float64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.current.UpdateSeek()
+	return c.current.Progress()
+}
+
 func (c *current) SetMovie(movie *model.Movie, play bool) {
+	c.switchMovie(movie, play, 0)
+}
+
+// switchMovie sets the movie starting at seek and returns what was playing before
+func (c *current) switchMovie(movie *model.Movie, play bool, seek float64) Current {
+	prev, _ := c.switchMovieIf(nil, movie, play, seek)
+	return prev
+}
+
+// switchMovieIf is switchMovie done only if cond reports true for what is
+// playing, checked under the same lock, a nil cond always switches
+func (c *current) switchMovieIf(cond func(Current) bool, movie *model.Movie, play bool, seek float64) (Current, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	c.current.UpdateSeek()
+	if cond != nil && !cond(c.current) {
+		return c.current, false
+	}
+	prev := c.current
 	if movie == nil {
 		c.current.Movie = model.Movie{}
 	} else {
 		c.current.Movie = *movie
 	}
-	c.current.SetSeek(0, 0)
+	c.current.SetSeek(seek, 0)
 	c.current.Status.Playing = play
+	return prev, true
+}
+
+// updateMovie applies f if id is the current movie and reports whether it was
+func (c *current) updateMovie(id string, f func(*model.BaseMovie)) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.current.Movie.ID != id {
+		return false
+	}
+	f(&c.current.Movie.Base)
+	return true
 }
 
 func (c *current) Status() Status {
@@ -81,6 +119,33 @@ func (c *current) SetSeekRate(seek, rate, timeDiff float64) Status {
 	return c.current.SetSeekRate(seek, rate, timeDiff)
 }
 
+func (c *current) SetSeek(seek, timeDiff float64) Status {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.current.SetSeek(seek, timeDiff)
+}
+
+// SeekRelative moves the seek by delta from the position at the time of the
+// call, the result is clamped to the movie duration when it is known
+func (c *current) SeekRelative(delta float64) (Status, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.current.Movie.ID == "" {
+		return Status{}, ErrNoCurrentMovie
+	}
+	if c.current.Movie.Base.Live {
+		return Status{}, ErrCannotSeekLive
+	}
+	c.current.UpdateSeek()
+	seek := max(c.current.Status.Seek+delta, 0)
+	if d := c.current.Movie.Base.Duration; d > 0 {
+		seek = min(seek, d)
+	}
+	return c.current.SetSeek(seek, 0), nil
+}
+
 func (c *Current) UpdateSeek() {
 	if c.Movie.Base.Live {
 		c.Status.lastUpdate = time.Now()
@@ -92,6 +157,20 @@ func (c *Current) UpdateSeek() {
 	c.Status.lastUpdate = time.Now()
 }
 
+func (c *Current) Progress() float64 {
+	if c.Movie.ID == "" || c.Movie.Base.Live || c.Movie.Base.Duration <= 0 {
+		return 0
+	}
+	p := c.Status.Seek / c.Movie.Base.Duration
+	if p < 0 {
+		return 0
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
 func (c *Current) setLiveStatus() Status {
 	c.Status.Playing = true
 	c.Status.Rate = 1.0
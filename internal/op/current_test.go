@@ -0,0 +1,159 @@
+package op
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+func TestSyncMessageExtrapolatesSeek(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.current.SetMovie(&model.Movie{ID: "a"}, false)
+	r.current.SetStatus(true, 10, 2, 0)
+
+	const elapsed = 3
+	r.current.lock.Lock()
+	r.current.current.Status.lastUpdate = time.Now().Add(-elapsed * time.Second)
+	r.current.lock.Unlock()
+
+	msg := r.NewSyncMessage().message()
+	if msg.Type != pb.ElementMessageType_SYNC {
+		t.Fatalf("type = %v, want %v", msg.Type, pb.ElementMessageType_SYNC)
+	}
+	if want := 10.0 + elapsed*2; math.Abs(msg.Seek-want) > 0.1 {
+		t.Fatalf("seek = %f, want %f", msg.Seek, want)
+	}
+	if !msg.Playing || msg.Rate != 2 {
+		t.Fatalf("playing = %v rate = %f, want true 2", msg.Playing, msg.Rate)
+	}
+	if d := time.Since(time.UnixMilli(msg.Time)); d < 0 || d > time.Second {
+		t.Fatalf("time is %v off", d)
+	}
+}
+
+func TestRoomAllowedRates(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.current.SetMovie(&model.Movie{ID: "a"}, false)
+	if _, err := r.SetSeekRate(0, 0, 0); err != ErrRateNotAllowed {
+		t.Fatalf("SetSeekRate(rate 0) = %v, want %v", err, ErrRateNotAllowed)
+	}
+	if _, err := r.SetSeekRate(0, 3, 0); err != nil {
+		t.Fatalf("SetSeekRate(rate 3) = %v, want nil", err)
+	}
+	r.Settings.AllowedRates = []float64{0.5, 1, 1.5, 2}
+	if _, err := r.SetStatus(true, 0, 3, 0); err != ErrRateNotAllowed {
+		t.Fatalf("SetStatus(rate 3) = %v, want %v", err, ErrRateNotAllowed)
+	}
+	s, err := r.SetStatus(true, 0, 1.5, 0)
+	if err != nil {
+		t.Fatalf("SetStatus(rate 1.5) = %v, want nil", err)
+	}
+	if s.Rate != 1.5 {
+		t.Fatalf("rate = %v, want 1.5", s.Rate)
+	}
+}
+
+func TestPlaybackLock(t *testing.T) {
+	r := newRoom(&model.Room{CreatorID: "host"})
+	r.current.SetMovie(&model.Movie{ID: "a"}, false)
+	var (
+		member = &User{User: model.User{ID: "member", Role: model.RoleUser}}
+		host   = &User{User: model.User{ID: "host", Role: model.RoleUser}}
+		admin  = &User{User: model.User{ID: "admin", Role: model.RoleAdmin}}
+	)
+	if err := r.SetPlaybackLocked(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := member.SetStatus(r, true, 1, 1, 0); err != ErrPlaybackLocked {
+		t.Fatalf("SetStatus() = %v, want %v", err, ErrPlaybackLocked)
+	}
+	if _, err := member.SetSeekRate(r, 1, 1, 0); err != ErrPlaybackLocked {
+		t.Fatalf("SetSeekRate() = %v, want %v", err, ErrPlaybackLocked)
+	}
+	for _, u := range []*User{host, admin} {
+		if _, err := u.SetSeekRate(r, 1, 1, 0); err != nil {
+			t.Fatalf("SetSeekRate() by %s = %v, want nil", u.ID, err)
+		}
+	}
+	if !r.NewSyncMessage().message().Locked {
+		t.Fatal("sync message is not locked")
+	}
+	if err := r.SetPlaybackLocked(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := member.SetStatus(r, true, 1, 1, 0); err != nil {
+		t.Fatalf("SetStatus() after unlock = %v, want nil", err)
+	}
+}
+
+func TestMaxSeekDelta(t *testing.T) {
+	r := newRoom(&model.Room{CreatorID: "host"})
+	r.Settings.MaxSeekDelta = 30
+	r.current.SetMovie(&model.Movie{ID: "a"}, false)
+	r.current.SetSeek(100, 0)
+	var (
+		member = &User{User: model.User{ID: "member", Role: model.RoleUser}}
+		host   = &User{User: model.User{ID: "host", Role: model.RoleUser}}
+	)
+	if _, err := member.SetSeekRate(r, 200, 1, 0); !errors.Is(err, ErrSeekTooLarge) {
+		t.Fatalf("SetSeekRate() = %v, want %v", err, ErrSeekTooLarge)
+	}
+	if _, err := member.SetStatus(r, true, 110, 1, 0); err != nil {
+		t.Fatalf("SetStatus() with a small seek = %v, want nil", err)
+	}
+	if _, err := host.SetSeekRate(r, 1000, 1, 0); err != nil {
+		t.Fatalf("SetSeekRate() by host = %v, want nil", err)
+	}
+	r.Settings.MaxSeekDelta = 0
+	if _, err := member.SetSeekRate(r, 0, 1, 0); err != nil {
+		t.Fatalf("SetSeekRate() without limit = %v, want nil", err)
+	}
+}
+
+func TestSeekRelative(t *testing.T) {
+	c := newCurrent()
+	if _, err := c.SeekRelative(5); err != ErrNoCurrentMovie {
+		t.Fatalf("SeekRelative() = %v, want %v", err, ErrNoCurrentMovie)
+	}
+	c.SetMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Duration: 100}}, false)
+	c.SetStatus(false, 10, 1, 0)
+	for _, tc := range []struct{ delta, want float64 }{
+		{5, 15},
+		{-20, 0},
+		{200, 100},
+	} {
+		status, err := c.SeekRelative(tc.delta)
+		if err != nil || status.Seek != tc.want {
+			t.Fatalf("SeekRelative(%g) = %g %v, want %g", tc.delta, status.Seek, err, tc.want)
+		}
+	}
+	c.SetMovie(&model.Movie{ID: "b", Base: model.BaseMovie{Live: true}}, true)
+	if _, err := c.SeekRelative(5); err != ErrCannotSeekLive {
+		t.Fatalf("SeekRelative() of a live movie = %v, want %v", err, ErrCannotSeekLive)
+	}
+}
+
+func TestWithAllowedRates(t *testing.T) {
+	r := newRoom(&model.Room{}, WithAllowedRates([]float64{1, 2}))
+	r.current.SetMovie(&model.Movie{ID: "a"}, false)
+	if _, err := r.SetSeekRate(0, 1.5, 0); err != ErrRateNotAllowed {
+		t.Fatalf("SetSeekRate(rate 1.5) = %v, want %v", err, ErrRateNotAllowed)
+	}
+	if _, err := r.SetSeekRate(0, 2, 0); err != nil {
+		t.Fatalf("SetSeekRate(rate 2) = %v, want nil", err)
+	}
+	// the rates of the room settings take precedence
+	r.Settings.AllowedRates = []float64{1.5}
+	if _, err := r.SetSeekRate(0, 1.5, 0); err != nil {
+		t.Fatalf("SetSeekRate(rate 1.5) = %v, want nil", err)
+	}
+	other := newRoom(&model.Room{})
+	other.current.SetMovie(&model.Movie{ID: "a"}, false)
+	if _, err := other.SetSeekRate(0, 1.5, 0); err != nil {
+		t.Fatalf("SetSeekRate(rate 1.5) of another room = %v, want nil", err)
+	}
+}
@@ -0,0 +1,46 @@
+package op
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/zijiren233/gencontainer/synccache"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points the db package at a fresh in memory sqlite database
+// migrated like the server does, for tests that need persistence
+func useTestDB(t *testing.T) {
+	t.Helper()
+	if conf.Conf == nil {
+		conf.Conf = conf.DefaultConfig()
+	}
+	conf.Conf.Database.Type = conf.DatabaseTypeSqlite3
+	if userCache == nil {
+		userCache = synccache.NewSyncCache[string, *User](time.Minute)
+	}
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	d, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{
+		TranslateError:                           true,
+		Logger:                                   logger.Discard,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		IgnoreRelationshipsWhenMigrating:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(d, conf.DatabaseTypeSqlite3); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := d.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// RoomDebug is a snapshot of a room's runtime state for troubleshooting.
+// Password hashes and movie headers are never included.
+type RoomDebug struct {
+	ID               string           `json:"id"`
+	Name             string           `json:"name"`
+	Status           model.RoomStatus `json:"status"`
+	CreatorID        string           `json:"creatorId"`
+	Version          uint32           `json:"version"`
+	StateVersion     uint32           `json:"stateVersion"`
+	Closed           bool             `json:"closed"`
+	NeedPwd          bool             `json:"needPassword"`
+	PeopleNum        int64            `json:"peopleNum"`
+	MovieCount       int              `json:"movieCount"`
+	Current          CurrentDebug     `json:"current"`
+	Clients          []ClientDebug    `json:"clients"`
+	Channels         []ChannelDebug   `json:"channels"`
+	Buffering        int              `json:"buffering"`
+	Whispers         uint64           `json:"whispers"`
+	Broadcasts       int64            `json:"broadcasts"`
+	BroadcastLatency BroadcastLatency `json:"broadcastLatency"`
+	Seq              uint64           `json:"seq"`
+	Banned           int64            `json:"banned"`
+	Orphans          int              `json:"orphans"`
+	Webhooks         int              `json:"webhooks"`
+	DeadLetters      uint64           `json:"webhookDeadLetters"`
+	GeneratedAt      int64            `json:"generatedAt"`
+}
+
+type CurrentDebug struct {
+	MovieID    string  `json:"movieId"`
+	Live       bool    `json:"live"`
+	Seek       float64 `json:"seek"`
+	Rate       float64 `json:"rate"`
+	Playing    bool    `json:"playing"`
+	LastUpdate int64   `json:"lastUpdate"`
+}
+
+type ClientDebug struct {
+	UserID     string `json:"userId"`
+	Username   string `json:"username"`
+	QueueDepth int    `json:"queueDepth"`
+	QueueCap   int    `json:"queueCap"`
+	Closed     bool   `json:"closed"`
+	LastPong   int64  `json:"lastPong"`
+	LastSeq    uint64 `json:"lastSeq"`
+	// RTC is set for clients with a peer connection
+	RTC bool `json:"rtc"`
+}
+
+type ChannelDebug struct {
+	MovieID       string           `json:"movieId"`
+	InPublication bool             `json:"inPublication"`
+	Closed        bool             `json:"closed"`
+	Transcode     *TranscodeStatus `json:"transcode,omitempty"`
+}
+
+// RoomSummary is the per room entry of DebugDumpRooms
+type RoomSummary struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatorID  string `json:"creatorId"`
+	Closed     bool   `json:"closed"`
+	PeopleNum  int64  `json:"peopleNum"`
+	MovieCount int    `json:"movieCount"`
+	Expired    bool   `json:"expired"`
+	LastActive int64  `json:"lastActive"`
+	LastRead   int64  `json:"lastRead"`
+	// TotalWatchTime is in milliseconds
+	TotalWatchTime int64 `json:"totalWatchTime"`
+}
+
+func (h *Hub) debugClients() []ClientDebug {
+	clients := h.ActiveClients()
+	list := make([]ClientDebug, len(clients))
+	for i, c := range clients {
+		list[i] = ClientDebug{
+			UserID:     c.u.ID,
+			Username:   c.u.Username,
+			QueueDepth: len(c.c),
+			QueueCap:   cap(c.c),
+			Closed:     c.Closed(),
+			LastPong:   c.lastPong.Load(),
+			LastSeq:    c.lastSeq.Load(),
+			RTC:        c.rtc.Load() != nil,
+		}
+	}
+	return list
+}
+
+func (m *movies) debugChannels() []ChannelDebug {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	var list []ChannelDebug
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		c := e.Value.channel.Load()
+		if c == nil {
+			continue
+		}
+		d := ChannelDebug{
+			MovieID:       e.Value.Movie.ID,
+			InPublication: c.InPublication(),
+			Closed:        c.Closed(),
+		}
+		if s, ok := e.Value.TranscodeStatus(); ok {
+			d.Transcode = &s
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// DebugDump returns a snapshot of the room, it only takes read locks
+func (r *Room) DebugDump() RoomDebug {
+	c := r.current.Current()
+	d := RoomDebug{
+		ID:           r.ID,
+		Name:         r.Name,
+		Status:       r.Status,
+		CreatorID:    r.CreatedBy(),
+		Version:      r.Version(),
+		StateVersion: r.StateVersion(),
+		Closed:       r.Closed(),
+		NeedPwd:      r.NeedPassword(),
+		PeopleNum:    r.PeopleNum(),
+		MovieCount:   r.GetMoviesCount(),
+		Current: CurrentDebug{
+			MovieID:    c.Movie.ID,
+			Live:       c.Movie.Base.Live,
+			Seek:       c.Status.Seek,
+			Rate:       c.Status.Rate,
+			Playing:    c.Status.Playing,
+			LastUpdate: c.Status.lastUpdate.UnixMilli(),
+		},
+		Channels:         r.movies.debugChannels(),
+		Whispers:         r.WhisperCount(),
+		Broadcasts:       r.TotalBroadcasts(),
+		BroadcastLatency: r.BroadcastLatency(),
+		Seq:              r.hub.seq.Load(),
+		Banned:           db.GetAllRoomUsersRelationCount(r.ID, db.WhereRoomUserStatus(model.RoomUserStatusBanned)),
+		Orphans:          r.OrphanedChannels(),
+		Webhooks:         len(r.Webhooks()),
+		DeadLetters:      r.WebhookDeadLetters(),
+		GeneratedAt:      time.Now().UnixMilli(),
+	}
+	d.Clients = r.hub.debugClients()
+	r.buffering.lock.Lock()
+	d.Buffering = len(r.buffering.clients)
+	r.buffering.lock.Unlock()
+	return d
+}
+
+// DebugDumpRooms returns summary stats of all loaded rooms
+func DebugDumpRooms() []RoomSummary {
+	var list []RoomSummary
+	roomCache.Range(func(_ string, e *RoomEntry) bool {
+		r := e.Value()
+		list = append(list, RoomSummary{
+			ID:             r.ID,
+			Name:           r.Name,
+			CreatorID:      r.CreatedBy(),
+			Closed:         r.Closed(),
+			PeopleNum:      r.PeopleNum(),
+			MovieCount:     r.GetMoviesCount(),
+			Expired:        e.IsExpired(),
+			LastActive:     r.lastActive.Load(),
+			LastRead:       r.lastRead.Load(),
+			TotalWatchTime: r.TotalWatchTime().Milliseconds(),
+		})
+		return true
+	})
+	return list
+}
+
+// DebugDumpRoom returns the snapshot of a loaded room without touching its expiration
+func DebugDumpRoom(id string) (RoomDebug, error) {
+	e, ok := roomCache.Load(id)
+	if !ok {
+		return RoomDebug{}, errors.New("room not loaded")
+	}
+	return e.Value().DebugDump(), nil
+}
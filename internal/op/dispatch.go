@@ -0,0 +1,150 @@
+package op
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+// maxMessageTimeDiff caps how late a message may claim to arrive, in seconds
+const maxMessageTimeDiff = 1.5
+
+// MessageContext is a decoded inbound message on its way to its handler
+type MessageContext struct {
+	Client *Client
+	Msg    *pb.ElementMessage
+	// TimeDiff is how many seconds the message took to arrive, from Msg.Time
+	TimeDiff float64
+}
+
+func newMessageContext(cli *Client, msg *pb.ElementMessage) *MessageContext {
+	var timeDiff float64
+	if msg.Time != 0 {
+		timeDiff = time.Since(time.UnixMilli(msg.Time)).Seconds()
+	}
+	return &MessageContext{
+		Client:   cli,
+		Msg:      msg,
+		TimeDiff: min(max(timeDiff, 0), maxMessageTimeDiff),
+	}
+}
+
+func (ctx *MessageContext) User() *User {
+	return ctx.Client.u
+}
+
+func (ctx *MessageContext) Room() *Room {
+	return ctx.Client.r
+}
+
+// Send sends em to the client of the message as sent by its user
+func (ctx *MessageContext) Send(em *pb.ElementMessage) error {
+	em.Sender = ctx.Client.u.Username
+	return ctx.Client.Send((*ElementMessage)(em))
+}
+
+// SendError sends an ERROR message to the client of the message
+func (ctx *MessageContext) SendError(message string) error {
+	return ctx.Send(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_ERROR,
+		Message: message,
+	})
+}
+
+// Broadcast broadcasts em to the room as sent by the user of the message
+func (ctx *MessageContext) Broadcast(em *pb.ElementMessage, conf ...BroadcastConf) error {
+	em.Sender = ctx.Client.u.Username
+	return ctx.Client.Broadcast((*ElementMessage)(em), conf...)
+}
+
+// MessageHandler handles a message, an error closes the connection of the client
+type MessageHandler func(ctx *MessageContext) error
+
+// Middleware wraps the handling of every message, it may return without
+// calling next to drop the message
+type Middleware func(next MessageHandler) MessageHandler
+
+// Dispatcher routes inbound messages by type through its middlewares
+type Dispatcher struct {
+	lock        sync.RWMutex
+	middlewares []Middleware
+	handlers    map[pb.ElementMessageType]MessageHandler
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[pb.ElementMessageType]MessageHandler),
+	}
+}
+
+// Use appends middlewares, they run in the order they were added
+func (d *Dispatcher) Use(mw ...Middleware) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.middlewares = append(d.middlewares, mw...)
+}
+
+// Handle sets the handler of a message type, replacing the previous one
+func (d *Dispatcher) Handle(t pb.ElementMessageType, h MessageHandler) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.handlers[t] = h
+}
+
+// Dispatch runs the middlewares of the dispatcher, then extra, then the
+// handler of the message type, messages without a handler are ignored
+func (d *Dispatcher) Dispatch(ctx *MessageContext, extra ...Middleware) error {
+	d.lock.RLock()
+	h, ok := d.handlers[ctx.Msg.Type]
+	mws := slices.Clone(d.middlewares)
+	d.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+	for i := len(extra) - 1; i >= 0; i-- {
+		h = extra[i](h)
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h(ctx)
+}
+
+var messageDispatcher = NewDispatcher()
+
+// HandleMessage sets the handler of a message type for all rooms
+func HandleMessage(t pb.ElementMessageType, h MessageHandler) {
+	messageDispatcher.Handle(t, h)
+}
+
+// UseMessageMiddleware appends middlewares that run for the messages of all rooms
+func UseMessageMiddleware(mw ...Middleware) {
+	messageDispatcher.Use(mw...)
+}
+
+// Use appends middlewares that run for the messages of this hub only,
+// after the ones added with UseMessageMiddleware
+func (h *Hub) Use(mw ...Middleware) {
+	h.middlewareLock.Lock()
+	defer h.middlewareLock.Unlock()
+	h.middlewares = append(h.middlewares, mw...)
+}
+
+func (h *Hub) dispatch(ctx *MessageContext) error {
+	h.middlewareLock.RLock()
+	mws := slices.Clone(h.middlewares)
+	h.middlewareLock.RUnlock()
+	return messageDispatcher.Dispatch(ctx, mws...)
+}
+
+// Use appends middlewares for the messages of this room, see Hub.Use
+func (r *Room) Use(mw ...Middleware) {
+	r.hub.Use(mw...)
+}
+
+// Dispatch hands a decoded message of the client to its handler
+func (c *Client) Dispatch(msg *pb.ElementMessage) error {
+	return c.r.hub.dispatch(newMessageContext(c, msg))
+}
@@ -0,0 +1,77 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+func TestDispatcherOrder(t *testing.T) {
+	d := NewDispatcher()
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx *MessageContext) error {
+				calls = append(calls, name)
+				return next(ctx)
+			}
+		}
+	}
+	d.Use(mw("a"), mw("b"))
+	d.Handle(pb.ElementMessageType_CHAT_MESSAGE, func(ctx *MessageContext) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	ctx := &MessageContext{Msg: &pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE}}
+	if err := d.Dispatch(ctx, mw("hub")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "hub", "handler"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+
+	calls = nil
+	if err := d.Dispatch(&MessageContext{Msg: &pb.ElementMessage{Type: pb.ElementMessageType_PLAY}}); err != nil || len(calls) != 0 {
+		t.Fatalf("Dispatch() of a type without handler = %v, calls %v", err, calls)
+	}
+}
+
+func TestDispatcherDrop(t *testing.T) {
+	d := NewDispatcher()
+	d.Use(func(next MessageHandler) MessageHandler {
+		return func(ctx *MessageContext) error {
+			return nil
+		}
+	})
+	d.Handle(pb.ElementMessageType_CHAT_MESSAGE, func(ctx *MessageContext) error {
+		t.Fatal("handler called for a dropped message")
+		return nil
+	})
+	_ = d.Dispatch(&MessageContext{Msg: &pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE}})
+}
+
+func TestMessageTimeDiff(t *testing.T) {
+	for _, c := range []struct {
+		sent time.Time
+		want float64
+	}{
+		{time.Time{}, 0},
+		{time.Now().Add(time.Hour), 0},
+		{time.Now().Add(-time.Hour), maxMessageTimeDiff},
+	} {
+		msg := &pb.ElementMessage{}
+		if !c.sent.IsZero() {
+			msg.Time = c.sent.UnixMilli()
+		}
+		if d := newMessageContext(nil, msg).TimeDiff; d != c.want {
+			t.Fatalf("TimeDiff = %v, want %v", d, c.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package op
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
 	log "github.com/sirupsen/logrus"
 	pb "github.com/synctv-org/synctv/proto/message"
 	"github.com/synctv-org/synctv/utils"
@@ -20,20 +22,157 @@ type clients struct {
 }
 
 type Hub struct {
-	id        string
-	clients   rwmap.RWMap[string, *clients]
-	broadcast chan *broadcastMessage
-	exit      chan struct{}
-	closed    uint32
-	wg        sync.WaitGroup
+	id      string
+	clients rwmap.RWMap[string, *clients]
+	// clientsByID indexes the registered clients by their connection id
+	clientsByID rwmap.RWMap[string, *Client]
+	broadcast   chan *broadcastMessage
+	exit        chan struct{}
+	// served is closed once the serve loop returned
+	served chan struct{}
+	closed uint32
+	// closeLock is held for reading by every operation that must not
+	// race with Close, Close takes it for writing once exit is closed
+	closeLock sync.RWMutex
+	// wg tracks the serve and ping loops and the client writers, see
+	// Client.WriteLoop, it is only added to while holding closeLock
+	wg sync.WaitGroup
+	// messageCount is the number of messages ever broadcast
+	messageCount atomic.Uint64
+	// seq is the sequence of the last broadcast, only the serve loop changes it
+	seq atomic.Uint64
+	// keepAlive is called on every ping while clients are connected
+	keepAlive func()
+	// middlewares run for the inbound messages of this hub, see Use
+	middlewares    []Middleware
+	middlewareLock sync.RWMutex
+	// workers is how many goroutines fan a broadcast out to the clients,
+	// see WithBroadcastWorkers
+	workers int
+	// singleClient closes the other clients of a user that registers a
+	// client, see WithSingleClientPerUser
+	singleClient bool
+	// maxMessageSize is the read limit of the client connections, see
+	// WithMaxMessageSize
+	maxMessageSize int64
+	// batchWindow is set by WithBroadcastBatchWindow, 0 sends every
+	// broadcast on its own
+	batchWindow time.Duration
+	// rtcAPI and rtcConfig create the peer connections of the clients, see
+	// WithWebRTC
+	rtcAPI    *webrtc.API
+	rtcConfig webrtc.Configuration
+	// broadcastLatency tracks the time from Broadcast to the message
+	// being queued for every client
+	broadcastLatency broadcastLatency
 
 	once utils.Once
 }
 
+// hubCloseTimeout bounds how long Close waits for the serve and ping loops
+// and the client writers
+const hubCloseTimeout = 5 * time.Second
+
 type broadcastMessage struct {
 	data         Message
 	ignoreClient []*Client
 	ignoreId     []string
+	queuedAt     time.Time
+	// ctx stops the fan-out to further clients, see BroadcastContext
+	ctx context.Context
+	// done is closed once the fan-out returned, cut is set before
+	// if a client did not get the message because ctx was done
+	done chan struct{}
+	cut  atomic.Bool
+}
+
+// WithBroadcastWorkers fans broadcasts out to the clients of the room with up
+// to n goroutines, so a slow client only holds back the clients of its worker,
+// values below 2 send to the clients one after another
+func WithBroadcastWorkers(n int) RoomConf {
+	return func(r *Room) {
+		r.hub.workers = max(n, 1)
+	}
+}
+
+// WithSingleClientPerUser makes registering a client close the other clients
+// of the same user in the room with CloseCodeReplaced
+func WithSingleClientPerUser(single bool) RoomConf {
+	return func(r *Room) {
+		r.hub.singleClient = single
+	}
+}
+
+// defaultMaxMessageSize is the bytes a websocket message from a client may
+// have unless a room sets WithMaxMessageSize
+const defaultMaxMessageSize = 4096
+
+// WithMaxMessageSize limits the websocket messages of the clients of the room
+// to bytes, it applies to clients that join after the room was configured,
+// larger messages end the connection with ErrMessageTooLarge
+func WithMaxMessageSize(bytes int64) RoomConf {
+	return func(r *Room) {
+		if bytes > 0 {
+			r.hub.maxMessageSize = bytes
+		}
+	}
+}
+
+// broadcastBatchMax is how many broadcasts a batch holds before it is
+// flushed early, it fits the message set of a frame in a uint64
+const broadcastBatchMax = 64
+
+// WithBroadcastBatchWindow holds the broadcasts of a hub for up to d after the
+// first one and writes them to each client as a single BATCH message, so
+// bursts of status events cost a write per client instead of one per event.
+// Messages keep their order and seq inside the batch, a batch of one is sent
+// as is. BroadcastContext and non element messages flush the batch and are
+// sent alone, 0 disables batching.
+func WithBroadcastBatchWindow(d time.Duration) RoomConf {
+	return func(r *Room) {
+		r.hub.batchWindow = max(d, 0)
+	}
+}
+
+type broadcastLatency struct {
+	count atomic.Uint64
+	total atomic.Int64
+	last  atomic.Int64
+	max   atomic.Int64
+}
+
+func (l *broadcastLatency) record(d time.Duration) {
+	l.count.Add(1)
+	l.total.Add(int64(d))
+	l.last.Store(int64(d))
+	for {
+		m := l.max.Load()
+		if int64(d) <= m || l.max.CompareAndSwap(m, int64(d)) {
+			return
+		}
+	}
+}
+
+type BroadcastLatency struct {
+	Count   uint64        `json:"count"`
+	Last    time.Duration `json:"last"`
+	Average time.Duration `json:"average"`
+	Max     time.Duration `json:"max"`
+}
+
+// BroadcastLatency returns how long broadcasts took from Broadcast until
+// every client had the message queued
+func (h *Hub) BroadcastLatency() BroadcastLatency {
+	l := &h.broadcastLatency
+	s := BroadcastLatency{
+		Count: l.count.Load(),
+		Last:  time.Duration(l.last.Load()),
+		Max:   time.Duration(l.max.Load()),
+	}
+	if s.Count > 0 {
+		s.Average = time.Duration(l.total.Load() / int64(s.Count))
+	}
+	return s
 }
 
 type BroadcastConf func(*broadcastMessage)
@@ -52,14 +191,22 @@ func WithIgnoreId(id ...string) BroadcastConf {
 
 func newHub(id string) *Hub {
 	return &Hub{
-		id:        id,
-		broadcast: make(chan *broadcastMessage, 128),
-		exit:      make(chan struct{}),
+		id:             id,
+		broadcast:      make(chan *broadcastMessage, 128),
+		exit:           make(chan struct{}),
+		served:         make(chan struct{}),
+		workers:        1,
+		maxMessageSize: defaultMaxMessageSize,
 	}
 }
 
 func (h *Hub) Start() error {
 	h.once.Do(func() {
+		if h.Closed() {
+			close(h.served)
+			return
+		}
+		h.wg.Add(2)
 		go h.serve()
 		go h.ping()
 	})
@@ -67,35 +214,193 @@ func (h *Hub) Start() error {
 }
 
 func (h *Hub) serve() error {
+	defer h.wg.Done()
+	defer close(h.served)
+	var (
+		batch []*broadcastMessage
+		// flush fires batchWindow after the first message of the batch
+		flush <-chan time.Time
+	)
+	flushBatch := func() {
+		h.flushBatch(batch)
+		batch = nil
+		flush = nil
+	}
+	receive := func(message *broadcastMessage) {
+		// the serve loop is the single point every broadcast passes,
+		// so the sequence order is the order the clients get them in
+		seq := h.seq.Add(1)
+		if pm, ok := message.data.(*PreparedMessage); ok {
+			pm.seq = seq
+		}
+		h.devMessage(message.data)
+		if h.batchWindow <= 0 || !message.batchable() {
+			flushBatch()
+			h.deliver(message)
+			return
+		}
+		batch = append(batch, message)
+		if len(batch) == 1 {
+			flush = time.After(h.batchWindow)
+		}
+		if len(batch) == broadcastBatchMax {
+			flushBatch()
+		}
+	}
 	for {
 		select {
 		case message := <-h.broadcast:
-			h.devMessage(message.data)
-			h.clients.Range(func(id string, clients *clients) bool {
-				clients.lock.RLock()
-				defer clients.lock.RUnlock()
-				for c := range clients.m {
-					if utils.In(message.ignoreId, c.u.ID) {
-						continue
-					}
-					if utils.In(message.ignoreClient, c) {
-						continue
-					}
-					if err := c.Send(message.data); err != nil {
-						c.Close()
-					}
-				}
-
-				return true
-			})
+			receive(message)
+		case <-flush:
+			flushBatch()
 		case <-h.exit:
+			// broadcasts queued before the close and the batch still
+			// reach the clients before they are closed
+			for len(h.broadcast) > 0 {
+				receive(<-h.broadcast)
+			}
+			flushBatch()
 			log.Debugf("hub: %s, closed", h.id)
 			return nil
 		}
 	}
 }
 
+// deliver fans the message out on its own
+func (h *Hub) deliver(message *broadcastMessage) {
+	h.fanOut(message)
+	h.broadcastLatency.record(time.Since(message.queuedAt))
+	if message.done != nil {
+		close(message.done)
+	}
+}
+
+// flushBatch fans the batched messages out as one frame per client
+func (h *Hub) flushBatch(batch []*broadcastMessage) {
+	switch len(batch) {
+	case 0:
+		return
+	case 1:
+		h.deliver(batch[0])
+		return
+	}
+	frames := &batchFrames{batch: batch, frames: make(map[uint64]*broadcastMessage)}
+	h.fanOutFunc(func(c *Client) {
+		if frame := frames.get(c); frame != nil {
+			sendBroadcast(c, frame)
+		}
+	})
+	for _, message := range batch {
+		h.broadcastLatency.record(time.Since(message.queuedAt))
+	}
+}
+
+// batchable reports whether the message may wait in a batch, BroadcastContext
+// callers wait for their message so it is never held back
+func (message *broadcastMessage) batchable() bool {
+	_, ok := message.data.(*PreparedMessage)
+	return ok && message.done == nil
+}
+
+// batchFrames builds the frame of a batch for every set of its messages the
+// clients get, clients getting the same messages share the frame
+type batchFrames struct {
+	batch  []*broadcastMessage
+	lock   sync.Mutex
+	frames map[uint64]*broadcastMessage
+}
+
+// get returns the frame for the client, nil if every message ignores it
+func (f *batchFrames) get(c *Client) *broadcastMessage {
+	var set uint64
+	for i, message := range f.batch {
+		if !message.ignores(c) {
+			set |= 1 << i
+		}
+	}
+	if set == 0 {
+		return nil
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if frame, ok := f.frames[set]; ok {
+		return frame
+	}
+	var messages []*PreparedMessage
+	for i, message := range f.batch {
+		if set&(1<<i) != 0 {
+			messages = append(messages, message.data.(*PreparedMessage))
+		}
+	}
+	var data Message = messages[0]
+	if len(messages) > 1 {
+		data = NewPreparedMessage(&batchMessage{messages: messages})
+	}
+	frame := &broadcastMessage{data: data, ctx: context.Background()}
+	f.frames[set] = frame
+	return frame
+}
+
+func (message *broadcastMessage) ignores(c *Client) bool {
+	return utils.In(message.ignoreId, c.u.ID) || utils.In(message.ignoreClient, c)
+}
+
+func sendBroadcast(c *Client, message *broadcastMessage) {
+	if message.ctx.Err() != nil {
+		message.cut.Store(true)
+		return
+	}
+	if err := c.send(message.ctx, message.data); err != nil {
+		if message.ctx.Err() != nil {
+			message.cut.Store(true)
+			return
+		}
+		c.CloseWithReason(CloseCodeBackpressure, CloseReasonBackpressure)
+	}
+}
+
+// fanOut queues the message for the clients and returns once every client
+// has it, so the next message is never queued before it and per client
+// order is kept with any number of workers
+func (h *Hub) fanOut(message *broadcastMessage) {
+	h.fanOutFunc(func(c *Client) {
+		if !message.ignores(c) {
+			sendBroadcast(c, message)
+		}
+	})
+}
+
+// fanOutFunc calls send for every client with the workers of the hub
+func (h *Hub) fanOutFunc(send func(*Client)) {
+	workers := h.workers
+	if workers <= 1 {
+		h.clients.Range(func(id string, clients *clients) bool {
+			clients.lock.RLock()
+			defer clients.lock.RUnlock()
+			for c := range clients.m {
+				send(c)
+			}
+			return true
+		})
+		return
+	}
+	targets := h.ActiveClients()
+	workers = min(workers, len(targets))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(targets); j += workers {
+				send(targets[j])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
 func (h *Hub) ping() {
+	defer h.wg.Done()
 	ticker := time.NewTicker(time.Second * 5)
 	defer ticker.Stop()
 	var (
@@ -106,6 +411,9 @@ func (h *Hub) ping() {
 		select {
 		case <-ticker.C:
 			current = h.PeopleNum()
+			if current > 0 && h.keepAlive != nil {
+				h.keepAlive()
+			}
 			if current != pre {
 				if err := h.Broadcast(&ElementMessage{
 					Type:      pb.ElementMessageType_CHANGE_PEOPLE,
@@ -132,52 +440,165 @@ func (h *Hub) devMessage(msg Message) {
 	}
 }
 
+// Wait blocks until the hub is closed and its serve and ping loops and client
+// writers returned, unlike Close it does not give up after hubCloseTimeout
+func (h *Hub) Wait() {
+	<-h.exit
+	h.waitInFlight()
+	h.wg.Wait()
+}
+
+// waitInFlight waits for the operations that started before the hub was
+// closed, later ones see it closed, so nothing is added to wg afterwards
+func (h *Hub) waitInFlight() {
+	h.closeLock.Lock()
+	defer h.closeLock.Unlock()
+}
+
 func (h *Hub) Closed() bool {
 	return atomic.LoadUint32(&h.closed) == 1
 }
 
 var (
-	ErrAlreadyClosed = fmt.Errorf("already closed")
+	ErrAlreadyClosed   = fmt.Errorf("already closed")
+	ErrMessageTooLarge = errors.New("message too large")
+	ErrSendTimeout     = errors.New("send timeout")
+	ErrClientNotFound  = errors.New("client not found")
 )
 
+// Close stops the hub and closes all registered clients.
+// Broadcast, RegClient and SendToUser calls that start after Close
+// always return ErrAlreadyClosed.
 func (h *Hub) Close() error {
 	if !atomic.CompareAndSwapUint32(&h.closed, 0, 1) {
 		return ErrAlreadyClosed
 	}
 	close(h.exit)
+	// the lock is not held while waiting for the loops, the ping loop
+	// broadcasts and would block on it until the timeout
+	h.waitInFlight()
+	// the serve loop sends what was queued before the close, Done keeps a
+	// hub that was never started from starting now
+	if h.once.Done() {
+		select {
+		case <-h.served:
+		case <-time.After(hubCloseTimeout):
+			log.Warnf("hub: %s, wait for serve loop timeout", h.id)
+		}
+	}
+
+	// close clients so that a serve loop still blocked on a slow client
+	// returns and the writers stop
+	h.clients.Range(func(id string, clients *clients) bool {
+		clients.lock.RLock()
+		defer clients.lock.RUnlock()
+		for c := range clients.m {
+			c.CloseWithReason(CloseCodeRoomClosed, CloseReasonRoomClosed)
+		}
+		return true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(hubCloseTimeout):
+		log.Warnf("hub: %s, wait for serve loop and writers timeout", h.id)
+	}
+
 	h.clients.Range(func(id string, clients *clients) bool {
 		h.clients.Delete(id)
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
 		for c := range clients.m {
 			delete(clients.m, c)
-			c.Close()
+			h.clientsByID.Delete(c.id)
 		}
 		return true
 	})
-	h.wg.Wait()
-	close(h.broadcast)
 	return nil
 }
 
+// Broadcast queues the message for all clients of the hub.
+// Messages are delivered to every client in the order Broadcast accepted
+// them: a single serve loop moves them to the per client queue which is
+// written in order, so all clients see concurrent broadcasts in the same order
+// and the messages of one caller in its call order.
+// The serve loop stamps every element message with the next sequence of the
+// hub, clients see strictly increasing but not contiguous sequences, as the
+// messages they are ignored by are skipped. Unicasts carry no sequence.
+// With WithBroadcastBatchWindow the message may reach the clients inside a
+// BATCH message together with the broadcasts around it.
 func (h *Hub) Broadcast(data Message, conf ...BroadcastConf) error {
-	h.wg.Add(1)
-	defer h.wg.Done()
-	if h.Closed() {
+	return h.queueBroadcast(newBroadcastMessage(context.Background(), data, conf))
+}
+
+// BroadcastContext is Broadcast returning once every client has the message,
+// once ctx is done the message is not queued for further clients and
+// ctx.Err() is returned, clients that already got it keep it
+func (h *Hub) BroadcastContext(ctx context.Context, data Message, conf ...BroadcastConf) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	msg := newBroadcastMessage(ctx, data, conf)
+	msg.done = make(chan struct{})
+	if err := h.queueBroadcast(msg); err != nil {
+		return err
+	}
+	select {
+	case <-msg.done:
+		if msg.cut.Load() {
+			return ctx.Err()
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-h.exit:
 		return ErrAlreadyClosed
 	}
-	h.once.Done()
-	msg := &broadcastMessage{data: data}
+}
+
+func newBroadcastMessage(ctx context.Context, data Message, conf []BroadcastConf) *broadcastMessage {
+	// element messages are the same for every client, sync messages are
+	// encoded when written and must not be prepared
+	if em, ok := data.(*ElementMessage); ok {
+		data = NewPreparedMessage(em)
+	}
+	msg := &broadcastMessage{data: data, queuedAt: time.Now(), ctx: ctx}
 	for _, c := range conf {
 		c(msg)
 	}
+	return msg
+}
+
+func (h *Hub) queueBroadcast(msg *broadcastMessage) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
+	if h.Closed() {
+		return ErrAlreadyClosed
+	}
 	select {
 	case h.broadcast <- msg:
+		h.messageCount.Add(1)
 		return nil
+	case <-msg.ctx.Done():
+		return msg.ctx.Err()
 	case <-h.exit:
 		return ErrAlreadyClosed
 	}
 }
 
+// MessageCount returns the number of messages broadcast since the hub was created
+func (h *Hub) MessageCount() int64 {
+	return int64(h.messageCount.Load())
+}
+
 func (h *Hub) RegClient(cli *Client) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
 	if h.Closed() {
 		return ErrAlreadyClosed
 	}
@@ -193,11 +614,31 @@ func (h *Hub) RegClient(cli *Client) error {
 	} else if _, ok := c.m[cli]; ok {
 		return errors.New("client already exists")
 	}
+	if h.singleClient {
+		// the replaced clients are unregistered once their connection ends
+		for old := range c.m {
+			old.CloseWithReason(CloseCodeReplaced, CloseReasonReplaced)
+		}
+	}
 	c.m[cli] = struct{}{}
+	cli.hub = h
+	if cli.id == "" {
+		cli.id = utils.SortUUID()
+	}
+	h.clientsByID.Store(cli.id, cli)
+	if cli.conn != nil {
+		cli.conn.SetReadLimit(h.maxMessageSize)
+		cli.conn.SetPongHandler(func(string) error {
+			cli.lastPong.Store(time.Now().UnixMilli())
+			return nil
+		})
+	}
 	return nil
 }
 
 func (h *Hub) UnRegClient(cli *Client) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
 	if h.Closed() {
 		return ErrAlreadyClosed
 	}
@@ -214,17 +655,46 @@ func (h *Hub) UnRegClient(cli *Client) error {
 		return errors.New("client not found")
 	}
 	delete(c.m, cli)
+	h.clientsByID.CompareAndDelete(cli.id, cli)
 	if len(c.m) == 0 {
 		h.clients.CompareAndDelete(cli.u.ID, c)
 	}
+	cli.closeRTC()
 	return nil
 }
 
+// ConnectionCount returns how many clients of the user are registered
+func (h *Hub) ConnectionCount(userID string) int {
+	c, ok := h.clients.Load(userID)
+	if !ok {
+		return 0
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.m)
+}
+
 func (h *Hub) PeopleNum() int64 {
 	return h.clients.Len()
 }
 
+// ActiveClients returns a snapshot of all registered clients
+func (h *Hub) ActiveClients() []*Client {
+	var list []*Client
+	h.clients.Range(func(_ string, clients *clients) bool {
+		clients.lock.RLock()
+		defer clients.lock.RUnlock()
+		for c := range clients.m {
+			list = append(list, c)
+		}
+		return true
+	})
+	return list
+}
+
 func (h *Hub) SendToUser(userID string, data Message) (err error) {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
 	if h.Closed() {
 		return ErrAlreadyClosed
 	}
@@ -236,8 +706,61 @@ func (h *Hub) SendToUser(userID string, data Message) (err error) {
 	defer cli.lock.RUnlock()
 	for c := range cli.m {
 		if err = c.Send(data); err != nil {
-			c.Close()
+			c.CloseWithReason(CloseCodeBackpressure, CloseReasonBackpressure)
 		}
 	}
 	return
 }
+
+// Unicast sends data to the client with the connection id, a client that
+// can not keep up is closed like on broadcasts
+func (h *Hub) Unicast(clientID string, data Message) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
+	if h.Closed() {
+		return ErrAlreadyClosed
+	}
+	c, ok := h.clientsByID.Load(clientID)
+	if !ok {
+		return ErrClientNotFound
+	}
+	if err := c.Send(data); err != nil {
+		c.CloseWithReason(CloseCodeBackpressure, CloseReasonBackpressure)
+		return err
+	}
+	return nil
+}
+
+// CloseClients closes the connections matched by filter with the code and reason
+func (h *Hub) CloseClients(filter func(*Client) bool, code int, reason string) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
+	if h.Closed() {
+		return ErrAlreadyClosed
+	}
+	for _, c := range h.ActiveClients() {
+		if filter(c) {
+			c.CloseWithReason(code, reason)
+		}
+	}
+	return nil
+}
+
+// CloseUser closes all connections of the user with the code and reason
+func (h *Hub) CloseUser(userID string, code int, reason string) error {
+	h.closeLock.RLock()
+	defer h.closeLock.RUnlock()
+	if h.Closed() {
+		return ErrAlreadyClosed
+	}
+	cli, ok := h.clients.Load(userID)
+	if !ok {
+		return nil
+	}
+	cli.lock.RLock()
+	defer cli.lock.RUnlock()
+	for c := range cli.m {
+		c.CloseWithReason(code, reason)
+	}
+	return nil
+}
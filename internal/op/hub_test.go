@@ -0,0 +1,741 @@
+package op
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestClient(id string) *Client {
+	return newClient(&User{User: model.User{ID: id}}, nil, nil)
+}
+
+func TestHubCloseConcurrent(t *testing.T) {
+	h := newHub("test")
+	var (
+		wg      sync.WaitGroup
+		drained sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c := newTestClient(fmt.Sprintf("%d-%d", i, j))
+				if err := h.RegClient(c); err != nil {
+					if err != ErrAlreadyClosed {
+						t.Errorf("RegClient() = %v", err)
+					}
+					return
+				}
+				// leave every other client undrained to exercise full buffers
+				if j%2 == 0 {
+					drained.Add(1)
+					go func() {
+						defer drained.Done()
+						for range c.GetReadChan() {
+						}
+					}()
+				}
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY})
+				if err != nil {
+					if err != ErrAlreadyClosed {
+						t.Errorf("Broadcast() = %v", err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := h.Close(); err != nil {
+			t.Errorf("Close() = %v", err)
+		}
+	}()
+	wg.Wait()
+	drained.Wait()
+
+	if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY}); err != ErrAlreadyClosed {
+		t.Fatalf("Broadcast() after Close = %v, want %v", err, ErrAlreadyClosed)
+	}
+	if err := h.RegClient(newTestClient("late")); err != ErrAlreadyClosed {
+		t.Fatalf("RegClient() after Close = %v, want %v", err, ErrAlreadyClosed)
+	}
+	if err := h.Close(); err != ErrAlreadyClosed {
+		t.Fatalf("Close() twice = %v, want %v", err, ErrAlreadyClosed)
+	}
+}
+
+func TestHubMessageCount(t *testing.T) {
+	h := newHub("test")
+	// drain without the ping loop so only our broadcasts are counted
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-h.broadcast:
+			case <-done:
+				return
+			}
+		}
+	}()
+	const n = 10000
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+				t.Errorf("Broadcast() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if c := h.MessageCount(); c != n {
+		t.Fatalf("MessageCount() = %d, want %d", c, n)
+	}
+}
+
+func TestUserConnectionCount(t *testing.T) {
+	u := &User{User: model.User{ID: "a"}}
+	a, b := storeTestRoom("count-a", time.Minute), storeTestRoom("count-b", time.Minute)
+	defer roomCache.Delete(a.ID)
+	defer roomCache.Delete(b.ID)
+	c1, c2, c3 := newClient(u, nil, nil), newClient(u, nil, nil), newClient(u, nil, nil)
+	for _, c := range []*Client{c1, c2} {
+		if err := a.hub.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.hub.RegClient(c3); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.hub.ConnectionCount(u.ID); n != 2 {
+		t.Fatalf("Hub.ConnectionCount() = %d, want 2", n)
+	}
+	// the count does not live on the cached user
+	if n := (&User{User: model.User{ID: "a"}}).ConnectionCount(); n != 3 {
+		t.Fatalf("ConnectionCount() = %d, want 3", n)
+	}
+	if err := a.hub.UnRegClient(c1); err != nil {
+		t.Fatal(err)
+	}
+	if n := u.ConnectionCount(); n != 2 {
+		t.Fatalf("ConnectionCount() = %d, want 2", n)
+	}
+	if err := b.hub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := u.ConnectionCount(); n != 1 {
+		t.Fatalf("ConnectionCount() = %d, want 1", n)
+	}
+	if err := a.hub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := u.ConnectionCount(); n != 0 {
+		t.Fatalf("ConnectionCount() = %d, want 0", n)
+	}
+}
+
+func TestHubBroadcastOrder(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprint("workers=", workers), func(t *testing.T) {
+			testHubBroadcastOrder(t, workers)
+		})
+	}
+}
+
+func testHubBroadcastOrder(t *testing.T, workers int) {
+	const (
+		senders  = 8
+		messages = 200
+		clients  = 4
+	)
+	h := newHub("test")
+	h.workers = workers
+	defer h.Close()
+	received := make([][]*ElementMessage, clients)
+	var drained sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		c := newTestClient(fmt.Sprint(i))
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+		drained.Add(1)
+		go func(i int) {
+			defer drained.Done()
+			for m := range c.GetReadChan() {
+				pm, ok := m.(*PreparedMessage)
+				if !ok {
+					continue
+				}
+				em, ok := pm.Message.(*ElementMessage)
+				if !ok || em.Type != pb.ElementMessageType_CHAT_MESSAGE {
+					continue
+				}
+				received[i] = append(received[i], em)
+				if len(received[i]) == senders*messages {
+					return
+				}
+			}
+		}(i)
+	}
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				if err := h.Broadcast(&ElementMessage{
+					Type:   pb.ElementMessageType_CHAT_MESSAGE,
+					Sender: fmt.Sprint(s),
+					Seek:   float64(i),
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	drained.Wait()
+	for i, msgs := range received {
+		if len(msgs) != senders*messages {
+			t.Fatalf("client %d received %d messages, want %d", i, len(msgs), senders*messages)
+		}
+		next := make(map[string]float64)
+		for j, m := range msgs {
+			if m.Seek != next[m.Sender] {
+				t.Fatalf("client %d got message %v of sender %s, want %v", i, m.Seek, m.Sender, next[m.Sender])
+			}
+			next[m.Sender]++
+			if m != received[0][j] {
+				t.Fatalf("client %d diverges from client 0 at message %d", i, j)
+			}
+		}
+	}
+	if l := h.BroadcastLatency(); l.Count == 0 || l.Max < l.Average {
+		t.Fatalf("BroadcastLatency() = %+v", l)
+	}
+}
+
+func TestHubBroadcastSeq(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprint("workers=", workers), func(t *testing.T) {
+			testHubBroadcastSeq(t, workers)
+		})
+	}
+}
+
+func testHubBroadcastSeq(t *testing.T, workers int) {
+	const (
+		senders  = 6
+		messages = 200
+		clients  = 4
+	)
+	types := []pb.ElementMessageType{
+		pb.ElementMessageType_CHANGE_CURRENT,
+		pb.ElementMessageType_CHANGE_MOVIES,
+		pb.ElementMessageType_CHAT_MESSAGE,
+		pb.ElementMessageType_PLAY,
+	}
+	h := newHub("test")
+	h.workers = workers
+	defer h.Close()
+	seqs := make([][]uint64, clients)
+	var drained sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		c := newTestClient(fmt.Sprint(i))
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+		drained.Add(1)
+		go func(i int) {
+			defer drained.Done()
+			for m := range c.GetReadChan() {
+				pm, ok := m.(*PreparedMessage)
+				if !ok {
+					continue
+				}
+				var buf bytes.Buffer
+				if err := pm.Encode(&buf); err != nil {
+					t.Error(err)
+					return
+				}
+				var em pb.ElementMessage
+				if err := proto.Unmarshal(buf.Bytes(), &em); err != nil {
+					t.Error(err)
+					return
+				}
+				if em.Seq != pm.Seq() {
+					t.Errorf("client %d decoded seq %d, want %d", i, em.Seq, pm.Seq())
+				}
+				seqs[i] = append(seqs[i], em.Seq)
+				if len(seqs[i]) == senders*messages {
+					return
+				}
+			}
+		}(i)
+	}
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				if err := h.Broadcast(&ElementMessage{
+					Type:   types[(s+i)%len(types)],
+					Sender: fmt.Sprint(s),
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	drained.Wait()
+	for i, list := range seqs {
+		if len(list) != senders*messages {
+			t.Fatalf("client %d received %d messages, want %d", i, len(list), senders*messages)
+		}
+		for j := 1; j < len(list); j++ {
+			if list[j] <= list[j-1] {
+				t.Fatalf("client %d got seq %d after %d", i, list[j], list[j-1])
+			}
+		}
+	}
+}
+
+func TestHubWait(t *testing.T) {
+	h := newHub("test")
+	_ = h.Start()
+	done := make(chan struct{})
+	go func() {
+		h.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Wait() returned before Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return after Close")
+	}
+
+	// a room whose hub never started has nothing to wait for
+	newRoom(&model.Room{}).Wait()
+}
+
+func TestHubUnicast(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	a, b := newTestClient("a"), newTestClient("a")
+	for _, c := range []*Client{a, b} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.ID() == "" || a.ID() == b.ID() {
+		t.Fatalf("client ids %q and %q are not unique", a.ID(), b.ID())
+	}
+	if err := h.Unicast(b.ID(), &ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+		t.Fatalf("Unicast() = %v", err)
+	}
+	if len(b.c) != 1 || len(a.c) != 0 {
+		t.Fatalf("queued %d and %d messages, want only the target to get one", len(a.c), len(b.c))
+	}
+	if err := h.UnRegClient(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Unicast(b.ID(), &ElementMessage{}); err != ErrClientNotFound {
+		t.Fatalf("Unicast() after UnRegClient = %v, want %v", err, ErrClientNotFound)
+	}
+}
+
+func TestRoomInitHooks(t *testing.T) {
+	defer func(hooks []func(*Room)) { roomInitHooks = hooks }(roomInitHooks)
+	roomInitHooks = nil
+	var order []int
+	WithRoomInitHook(func(r *Room) {
+		order = append(order, 1)
+		// using the room from a hook must not run the hooks again
+		r.start()
+	})()
+	WithRoomInitHook(func(*Room) { order = append(order, 2) })()
+	r := newRoom(&model.Room{})
+	r.start()
+	r.start()
+	defer r.hub.Close()
+	if !reflect.DeepEqual(order, []int{1, 2}) {
+		t.Fatalf("hooks ran %v, want [1 2]", order)
+	}
+}
+
+func TestPreparedMessageCompression(t *testing.T) {
+	msg := NewPreparedMessage(&ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: strings.Repeat("synctv ", 512),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ug := websocket.Upgrader{EnableCompression: true}
+		conn, err := ug.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		c := newClient(&User{}, nil, conn)
+		for i := 0; i < 2; i++ {
+			if err := c.WritePreparedMessage(msg); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	for _, compress := range []bool{true, false} {
+		d := websocket.Dialer{EnableCompression: compress}
+		conn, _, err := d.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("compress %v: %v", compress, err)
+			}
+			var got pb.ElementMessage
+			if err := proto.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if typ != websocket.BinaryMessage || got.Message != msg.Message.(*ElementMessage).Message {
+				t.Fatalf("compress %v: got message type %d %q", compress, typ, got.Message)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestHubBroadcastContext(t *testing.T) {
+	h := newHub("test")
+	defer h.Close()
+	fast, slow := newTestClient("fast"), newTestClient("slow")
+	for _, c := range []*Client{fast, slow} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.BroadcastContext(context.Background(), &ElementMessage{}, WithIgnoreClient(slow)); err != nil {
+		t.Fatalf("BroadcastContext() = %v", err)
+	}
+	if len(fast.c) != 1 {
+		t.Fatalf("fast client has %d messages, want 1", len(fast.c))
+	}
+
+	// a full queue blocks the fan-out until the deadline
+	for len(slow.c) < cap(slow.c) {
+		slow.c <- &ElementMessage{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.BroadcastContext(ctx, &ElementMessage{}); err != context.DeadlineExceeded {
+		t.Fatalf("BroadcastContext() with a stuck client = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if slow.Closed() {
+		t.Fatal("client was closed for backpressure after the context ended")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := h.BroadcastContext(ctx, &ElementMessage{}); err != context.Canceled {
+		t.Fatalf("BroadcastContext() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHubBroadcastBatch(t *testing.T) {
+	h := newHub("test")
+	h.batchWindow = time.Hour
+	defer h.Close()
+	a, b := newTestClient("a"), newTestClient("b")
+	for _, c := range []*Client{a, b} {
+		if err := h.RegClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		var conf []BroadcastConf
+		if i == 1 {
+			conf = append(conf, WithIgnoreId("b"))
+		}
+		if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: fmt.Sprint(i)}, conf...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// BroadcastContext flushes the batch and is sent alone
+	if err := h.BroadcastContext(context.Background(), &ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+		t.Fatal(err)
+	}
+	decode := func(c *Client) *pb.ElementMessage {
+		var buf bytes.Buffer
+		if err := (<-c.GetReadChan()).Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var em pb.ElementMessage
+		if err := proto.Unmarshal(buf.Bytes(), &em); err != nil {
+			t.Fatal(err)
+		}
+		return &em
+	}
+	for c, want := range map[*Client][]string{a: {"0", "1", "2"}, b: {"0", "2"}} {
+		batch := decode(c)
+		if batch.Type != pb.ElementMessageType_BATCH {
+			t.Fatalf("client %s got %v, want a batch", c.u.ID, batch.Type)
+		}
+		var got []string
+		var seq uint64
+		for _, em := range batch.Batch {
+			if em.Seq <= seq {
+				t.Fatalf("client %s got seq %d after %d", c.u.ID, em.Seq, seq)
+			}
+			seq = em.Seq
+			got = append(got, em.Message)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("client %s got %v, want %v", c.u.ID, got, want)
+		}
+		if em := decode(c); em.Type != pb.ElementMessageType_PLAY || em.Seq <= seq {
+			t.Fatalf("client %s got %v seq %d after the batch", c.u.ID, em.Type, em.Seq)
+		}
+	}
+}
+
+func TestHubCloseFlushesBatch(t *testing.T) {
+	h := newHub("test")
+	h.batchWindow = time.Hour
+	c := newTestClient("a")
+	if err := h.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := <-c.GetReadChan()
+	if !ok {
+		t.Fatal("the batch was dropped on close")
+	}
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var em pb.ElementMessage
+	if err := proto.Unmarshal(buf.Bytes(), &em); err != nil {
+		t.Fatal(err)
+	}
+	if em.Type != pb.ElementMessageType_BATCH || len(em.Batch) != 2 {
+		t.Fatalf("got %v with %d messages, want the batch of 2", em.Type, len(em.Batch))
+	}
+}
+
+func TestBroadcastBatchWindowRoomConf(t *testing.T) {
+	defer func(conf []RoomConf) { roomConfs = conf }(roomConfs)
+	roomConfs = nil
+	WithRoomConf(func(r *Room) {
+		if r.ID == "batched" {
+			WithBroadcastBatchWindow(time.Second)(r)
+		}
+	})()
+	if w := newRoom(&model.Room{ID: "batched"}).hub.batchWindow; w != time.Second {
+		t.Fatalf("batch window = %v, want %v", w, time.Second)
+	}
+	if w := newRoom(&model.Room{ID: "other"}).hub.batchWindow; w != 0 {
+		t.Fatalf("batch window of another room = %v, want 0", w)
+	}
+	// confs passed with the room apply after the registered ones
+	if w := newRoom(&model.Room{ID: "batched"}, WithBroadcastBatchWindow(-1)).hub.batchWindow; w != 0 {
+		t.Fatalf("batch window = %v, want 0", w)
+	}
+}
+
+func BenchmarkHubBroadcast(b *testing.B) {
+	for _, window := range []time.Duration{0, time.Millisecond} {
+		b.Run(fmt.Sprint("window=", window), func(b *testing.B) {
+			benchmarkHubBroadcast(b, window)
+		})
+	}
+}
+
+func benchmarkHubBroadcast(b *testing.B, window time.Duration) {
+	const clients = 1000
+	h := newHub("bench")
+	h.batchWindow = window
+	var (
+		drained sync.WaitGroup
+		frames  atomic.Int64
+	)
+	for i := 0; i < clients; i++ {
+		c := newTestClient(fmt.Sprint(i))
+		if err := h.RegClient(c); err != nil {
+			b.Fatal(err)
+		}
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			// every frame is a write to the connection
+			for m := range c.GetReadChan() {
+				_ = m.Encode(io.Discard)
+				frames.Add(1)
+			}
+		}()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := h.Broadcast(&ElementMessage{
+			Type: pb.ElementMessageType_CHANGE_SEEK,
+			Seek: float64(i),
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := h.BroadcastContext(context.Background(), &ElementMessage{Type: pb.ElementMessageType_SYNC}); err != nil {
+		b.Fatal(err)
+	}
+	_ = h.Close()
+	drained.Wait()
+	b.StopTimer()
+	b.ReportMetric(float64(frames.Load())/float64(b.N*clients), "writes/msg")
+}
+
+func TestHubCloseWaitsForWriters(t *testing.T) {
+	h := newHub("test")
+	c := newTestClient("a")
+	if err := h.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	entered, returned := make(chan struct{}), make(chan error, 1)
+	go func() {
+		returned <- c.WriteLoop(func(Message) error {
+			once.Do(func() { close(entered) })
+			// a writer that broadcasts while the hub closes, like the ping loop
+			<-h.exit
+			_ = h.Broadcast(&PingMessage{})
+			return nil
+		})
+	}()
+	if err := h.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+		t.Fatal(err)
+	}
+	<-entered
+
+	start := time.Now()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= hubCloseTimeout {
+		t.Fatalf("Close() took %v, it waited for the timeout", d)
+	}
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Fatalf("WriteLoop() = %v", err)
+		}
+	default:
+		t.Fatal("Close() returned before the writer")
+	}
+	if err := c.WriteLoop(func(Message) error { return nil }); err != ErrAlreadyClosed {
+		t.Fatalf("WriteLoop() on a closed hub = %v, want %v", err, ErrAlreadyClosed)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	if s := newRoom(&model.Room{}).hub.maxMessageSize; s != defaultMaxMessageSize {
+		t.Fatalf("max message size = %d, want %d", s, defaultMaxMessageSize)
+	}
+	r := newRoom(&model.Room{}, WithMaxMessageSize(16))
+	defer r.close()
+	errs := make(chan error, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		c := newClient(&User{User: model.User{ID: "u"}}, r, conn)
+		if err := r.hub.RegClient(c); err != nil {
+			t.Error(err)
+			return
+		}
+		for i := 0; i < 2; i++ {
+			_, rd, err := c.NextReader()
+			if err == nil {
+				_, err = io.ReadAll(rd)
+			}
+			errs <- err
+		}
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, size := range []int{16, 17} {
+		if err := conn.WriteMessage(websocket.BinaryMessage, bytes.Repeat([]byte{'a'}, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("read of a message at the limit = %v, want nil", err)
+	}
+	if err := <-errs; err != ErrMessageTooLarge {
+		t.Fatalf("read of a message over the limit = %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+func TestBroadcastWorkersRoomConf(t *testing.T) {
+	if w := newRoom(&model.Room{}).hub.workers; w != 1 {
+		t.Fatalf("workers = %d, want 1", w)
+	}
+	if w := newRoom(&model.Room{}, WithBroadcastWorkers(4)).hub.workers; w != 4 {
+		t.Fatalf("workers = %d, want 4", w)
+	}
+	if w := newRoom(&model.Room{}, WithBroadcastWorkers(0)).hub.workers; w != 1 {
+		t.Fatalf("workers = %d, want 1", w)
+	}
+}
@@ -1,10 +1,16 @@
 package op
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/synctv-org/synctv/internal/settings"
 	pb "github.com/synctv-org/synctv/proto/message"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -33,6 +39,100 @@ func (em *ElementMessage) Encode(w io.Writer) error {
 	return err
 }
 
+const (
+	// elementMessageTypeField is the field number of type in pb.ElementMessage
+	elementMessageTypeField protowire.Number = 1
+	// elementMessageSeqField is the field number of seq in pb.ElementMessage
+	elementMessageSeqField protowire.Number = 16
+	// elementMessageBatchField is the field number of batch in pb.ElementMessage
+	elementMessageBatchField protowire.Number = 17
+)
+
+// PreparedMessage is a message encoded once and written to every client as
+// the same prepared frame, so a broadcast is marshaled and compressed once
+// per compression setting instead of once per client
+type PreparedMessage struct {
+	Message
+	// seq is set by the hub before the message is queued for any client
+	seq  uint64
+	once sync.Once
+	data []byte
+	pm   *websocket.PreparedMessage
+	err  error
+}
+
+func NewPreparedMessage(msg Message) *PreparedMessage {
+	return &PreparedMessage{Message: msg}
+}
+
+func (m *PreparedMessage) prepare() {
+	m.once.Do(func() {
+		var buf bytes.Buffer
+		if m.err = m.Message.Encode(&buf); m.err != nil {
+			return
+		}
+		m.data = buf.Bytes()
+		if m.seq != 0 {
+			// the last occurrence of a field wins, so appending the seq
+			// overrides it without touching the shared message
+			m.data = protowire.AppendTag(m.data, elementMessageSeqField, protowire.VarintType)
+			m.data = protowire.AppendVarint(m.data, m.seq)
+		}
+		m.pm, m.err = websocket.NewPreparedMessage(m.MessageType(), m.data)
+	})
+}
+
+// Seq returns the sequence the hub broadcast the message with, 0 if it was not broadcast
+func (m *PreparedMessage) Seq() uint64 {
+	return m.seq
+}
+
+// Prepared returns the prepared frame, the message is encoded on first use
+func (m *PreparedMessage) Prepared() (*websocket.PreparedMessage, error) {
+	m.prepare()
+	return m.pm, m.err
+}
+
+func (m *PreparedMessage) Encode(w io.Writer) error {
+	m.prepare()
+	if m.err != nil {
+		return m.err
+	}
+	_, err := w.Write(m.data)
+	return err
+}
+
+// batchMessage is a BATCH element message carrying the broadcasts of a batch
+// window in their order, see WithBroadcastBatchWindow
+type batchMessage struct {
+	messages []*PreparedMessage
+}
+
+func (bm *batchMessage) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (bm *batchMessage) String() string {
+	return fmt.Sprintf("Batch of %d", len(bm.messages))
+}
+
+// Encode writes the encoded messages as the batch field, so the messages
+// keep the seq they were prepared with and are not marshaled again
+func (bm *batchMessage) Encode(w io.Writer) error {
+	b := protowire.AppendTag(nil, elementMessageTypeField, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(pb.ElementMessageType_BATCH))
+	for _, m := range bm.messages {
+		m.prepare()
+		if m.err != nil {
+			return m.err
+		}
+		b = protowire.AppendTag(b, elementMessageBatchField, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.data)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
 type PingMessage struct{}
 
 func (pm *PingMessage) MessageType() int {
@@ -46,3 +146,37 @@ func (pm *PingMessage) String() string {
 func (pm *PingMessage) Encode(w io.Writer) error {
 	return nil
 }
+
+// SyncMessage carries the room status to a newly registered client.
+// The seek is extrapolated when the message is written, not when it is queued.
+type SyncMessage struct {
+	room *Room
+	// receiver is the id of the client the message is for, see Client.NewSyncMessage
+	receiver string
+}
+
+func (sm *SyncMessage) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (sm *SyncMessage) String() string {
+	return "Sync"
+}
+
+func (sm *SyncMessage) Encode(w io.Writer) error {
+	return sm.message().Encode(w)
+}
+
+func (sm *SyncMessage) message() *ElementMessage {
+	status := sm.room.current.Status()
+	return &ElementMessage{
+		Type:      pb.ElementMessageType_SYNC,
+		Seek:      status.Seek,
+		Rate:      status.Rate,
+		Playing:   status.Playing,
+		Time:      time.Now().UnixMilli(),
+		PreBuffer: settings.SyncPreBuffer.Get(),
+		Locked:    sm.room.PlaybackLocked(),
+		Receiver:  sm.receiver,
+	}
+}
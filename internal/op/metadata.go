@@ -0,0 +1,127 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+// metadataFetchTimeout bounds a single metadata fetch
+const metadataFetchTimeout = 30 * time.Second
+
+// movieMetadata is the part of a movie a MetadataFetcher may change
+type movieMetadata struct {
+	Name     string
+	Duration float64
+	Poster   string
+}
+
+func (m movieMetadata) validate() error {
+	switch {
+	case m.Name == "":
+		return errors.New("name is empty")
+	case len(m.Name) > 128:
+		return errors.New("name too long")
+	case m.Duration < 0:
+		return ErrInvalidMovieDuration
+	case len(m.Poster) > 8192:
+		return errors.New("poster url too long")
+	}
+	return nil
+}
+
+func (m movieMetadata) apply(base *model.BaseMovie) {
+	base.Name = m.Name
+	base.Duration = m.Duration
+	base.Poster = m.Poster
+}
+
+func metadataOf(base *model.BaseMovie) movieMetadata {
+	return movieMetadata{
+		Name:     base.Name,
+		Duration: base.Duration,
+		Poster:   base.Poster,
+	}
+}
+
+// WithMetadataFetcher runs f in the background for every movie added to the
+// room, live and vendor movies are skipped
+func WithMetadataFetcher(f MetadataFetcher) RoomConf {
+	return func(r *Room) {
+		r.metadataFetcher = f
+	}
+}
+
+// fetchMetadata runs the MetadataFetcher on a copy of the movie in the background,
+// failures are only logged so they never affect adding the movie
+func (r *Room) fetchMetadata(m *model.Movie) {
+	fetch := r.metadataFetcher
+	if fetch == nil || m.Base.Live || m.Base.VendorInfo.Vendor != "" {
+		return
+	}
+	movie := *m
+	movie.Base.Headers = maps.Clone(m.Base.Headers)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metadataFetchTimeout)
+		defer cancel()
+		if err := fetch(ctx, &movie); err != nil {
+			log.Warnf("room %s: fetch metadata of movie %s error: %v", r.ID, movie.ID, err)
+			return
+		}
+		changed, err := r.setMovieMetadata(movie.ID, metadataOf(&movie.Base))
+		if err != nil {
+			log.Warnf("room %s: save metadata of movie %s error: %v", r.ID, movie.ID, err)
+			return
+		}
+		if !changed || r.Closed() {
+			return
+		}
+		_ = r.Broadcast(&ElementMessage{
+			Type: pb.ElementMessageType_CHANGE_MOVIES,
+		})
+	}()
+}
+
+func (r *Room) setMovieMetadata(id string, meta movieMetadata) (bool, error) {
+	changed, err := r.movies.SetMetadata(id, meta)
+	if err != nil || !changed {
+		return false, err
+	}
+	if r.current.updateMovie(id, meta.apply) {
+		_ = r.Broadcast(&ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_CURRENT,
+			Sender: SystemSender,
+		})
+	}
+	return true, nil
+}
+
+// SetMetadata stores the metadata of the movie, false if it did not change
+func (m *movies) SetMetadata(id string, meta movieMetadata) (bool, error) {
+	if err := meta.validate(); err != nil {
+		return false, err
+	}
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return false, err
+	}
+	prev := metadataOf(&movie.Movie.Base)
+	if prev == meta {
+		return false, nil
+	}
+	meta.apply(&movie.Movie.Base)
+	if err := db.SaveMovie(&movie.Movie); err != nil {
+		prev.apply(&movie.Movie.Base)
+		return false, err
+	}
+	return true, nil
+}
@@ -1,8 +1,11 @@
 package op
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/url"
 	"sync/atomic"
 	"time"
@@ -12,6 +15,7 @@ import (
 	"github.com/synctv-org/synctv/internal/conf"
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/internal/vendor"
 	"github.com/synctv-org/synctv/utils"
 	"github.com/zijiren233/livelib/av"
 	"github.com/zijiren233/livelib/container/flv"
@@ -27,12 +31,17 @@ type Movie struct {
 	alistCache    atomic.Pointer[cache.AlistMovieCache]
 	bilibiliCache atomic.Pointer[cache.BilibiliMovieCache]
 	embyCache     atomic.Pointer[cache.EmbyMovieCache]
+	// pullCancel stops the puller of a proxied http flv live stream
+	pullCancel      atomic.Pointer[context.CancelFunc]
+	transcodeStatus atomic.Pointer[TranscodeStatus]
+	// timesPlayed counts how often the movie became the current movie
+	timesPlayed atomic.Int64
 }
 
 func (m *Movie) AlistCache() *cache.AlistMovieCache {
 	c := m.alistCache.Load()
 	if c == nil {
-		c = cache.NewAlistMovieCache(&m.Movie)
+		c = cache.NewAlistMovieCache(&m.Movie, m.backendResolver(model.VendorAlist))
 		if !m.alistCache.CompareAndSwap(nil, c) {
 			return m.AlistCache()
 		}
@@ -43,7 +52,7 @@ func (m *Movie) AlistCache() *cache.AlistMovieCache {
 func (m *Movie) BilibiliCache() *cache.BilibiliMovieCache {
 	c := m.bilibiliCache.Load()
 	if c == nil {
-		c = cache.NewBilibiliMovieCache(&m.Movie)
+		c = cache.NewBilibiliMovieCache(&m.Movie, m.backendResolver(model.VendorBilibili))
 		if !m.bilibiliCache.CompareAndSwap(nil, c) {
 			return m.BilibiliCache()
 		}
@@ -54,7 +63,7 @@ func (m *Movie) BilibiliCache() *cache.BilibiliMovieCache {
 func (m *Movie) EmbyCache() *cache.EmbyMovieCache {
 	c := m.embyCache.Load()
 	if c == nil {
-		c = cache.NewEmbyMovieCache(&m.Movie)
+		c = cache.NewEmbyMovieCache(&m.Movie, m.backendResolver(model.VendorEmby))
 		if !m.embyCache.CompareAndSwap(nil, c) {
 			return m.EmbyCache()
 		}
@@ -62,6 +71,36 @@ func (m *Movie) EmbyCache() *cache.EmbyMovieCache {
 	return c
 }
 
+// backendResolver prefers the backend the room pinned for the vendor,
+// it is consulted on every resolution so changes apply to the next refresh
+func (m *Movie) backendResolver(vendorName model.VendorName) cache.BackendResolver {
+	return func(backend string) string {
+		r, ok := roomCache.Load(m.Movie.RoomID)
+		if !ok {
+			return backend
+		}
+		if b := r.Value().vendorBackend(vendorName); b != "" && vendor.HasBackend(vendorName, b) {
+			return b
+		}
+		return backend
+	}
+}
+
+// resetVendorCache drops the resolved vendor data of the movie, the next
+// resolution picks the backend again
+func (m *Movie) resetVendorCache(vendorName model.VendorName) {
+	switch vendorName {
+	case model.VendorAlist:
+		m.alistCache.Store(nil)
+	case model.VendorBilibili:
+		if bmc := m.bilibiliCache.Swap(nil); bmc != nil {
+			bmc.NoSharedMovie.Clear()
+		}
+	case model.VendorEmby:
+		m.embyCache.Store(nil)
+	}
+}
+
 func (m *Movie) Channel() (*rtmps.Channel, error) {
 	err := m.initChannel()
 	if err != nil {
@@ -122,27 +161,13 @@ func (m *Movie) initChannel() error {
 		case "http", "https":
 			c := m.compareAndSwapInitChannel()
 			c.InitHlsPlayer(hls.WithGenTsNameFunc(genTsName))
-			go func() {
-				for {
-					if c.Closed() {
-						return
-					}
-					r := resty.New().R()
-					for k, v := range m.Movie.Base.Headers {
-						r.SetHeader(k, v)
-					}
-					// r.SetHeader("User-Agent", UserAgent)
-					resp, err := r.Get(m.Movie.Base.Url)
-					if err != nil {
-						time.Sleep(time.Second)
-						continue
-					}
-					if err := c.PushStart(flv.NewReader(resp.RawBody())); err != nil {
-						time.Sleep(time.Second)
-					}
-					resp.RawBody().Close()
-				}
-			}()
+			ctx, cancel := context.WithCancel(context.Background())
+			if !m.pullCancel.CompareAndSwap(nil, &cancel) {
+				// the channel is already being pulled
+				cancel()
+				return nil
+			}
+			go m.pullFlv(ctx, c)
 		default:
 			return errors.New("unsupported scheme")
 		}
@@ -152,8 +177,101 @@ func (m *Movie) initChannel() error {
 	return nil
 }
 
+// pullFlv pushes the http flv stream of the movie into the channel until ctx
+// is canceled, the stream goes through the transcoder if the movie has a profile
+func (m *Movie) pullFlv(ctx context.Context, c *rtmps.Channel) {
+	var (
+		profile  = m.Movie.Base.TranscodeProfile
+		restarts transcodeRestarts
+	)
+	for {
+		if c.Closed() || ctx.Err() != nil {
+			return
+		}
+		r := resty.New().R().SetContext(ctx).SetDoNotParseResponse(true)
+		for k, v := range m.Movie.Base.Headers {
+			r.SetHeader(k, v)
+		}
+		// r.SetHeader("User-Agent", UserAgent)
+		resp, err := r.Get(m.Movie.Base.Url)
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		if profile == "" {
+			if err := c.PushStart(flv.NewReader(resp.RawBody())); err != nil {
+				time.Sleep(time.Second)
+			}
+			resp.RawBody().Close()
+			continue
+		}
+		start := time.Now()
+		err = m.pushTranscoded(ctx, c, resp.RawBody(), restarts.count)
+		if c.Closed() || ctx.Err() != nil {
+			return
+		}
+		if !restarts.crashed(time.Since(start)) {
+			m.setTranscodeStatus(TranscodeStateFailed, restarts.count-1, err)
+			return
+		}
+		m.setTranscodeStatus(TranscodeStateRestarting, restarts.count, err)
+		time.Sleep(time.Second)
+	}
+}
+
+// pushTranscoded pushes body through the transcoder into the channel, body is closed
+func (m *Movie) pushTranscoded(ctx context.Context, c *rtmps.Channel, body io.ReadCloser, restarts int) error {
+	defer body.Close()
+	out, err := getTranscoder().Transcode(ctx, body, m.Movie.Base.TranscodeProfile)
+	if err != nil {
+		return err
+	}
+	m.setTranscodeStatus(TranscodeStateRunning, restarts, nil)
+	err = c.PushStart(flv.NewReader(out))
+	// unblock the transcoder reading the upstream before waiting for it
+	body.Close()
+	if cerr := out.Close(); cerr != nil {
+		err = cerr
+	}
+	return err
+}
+
+// ValidateMovie checks a movie the way AddMovie would before it is added to a room
+func ValidateMovie(m *model.BaseMovie) error {
+	return (&Movie{Movie: model.Movie{Base: *m}}).Validate()
+}
+
+// Validate checks the movie is playable with the current server settings,
+// it is called whenever a movie is added or edited
 func (movie *Movie) Validate() error {
 	m := movie.Movie.Base
+	switch {
+	case m.Name == "":
+		return errors.New("movie name is empty")
+	case len(m.Type) > 32:
+		return errors.New("movie type too long")
+	case m.Url == "" && m.VendorInfo.Vendor == "" && !m.RtmpSource:
+		return errors.New("movie url is empty")
+	case m.Duration < 0:
+		return ErrInvalidMovieDuration
+	}
+	if err := checkMovieFields(&m); err != nil {
+		return err
+	}
+	if (m.ExternalSystem == "") != (m.ExternalID == "") {
+		return errors.New("external system and external id must be set together")
+	}
+	if err := validateChapters(m.Chapters, m.Duration); err != nil {
+		return err
+	}
+	if m.TranscodeProfile != "" {
+		if !m.Live || !m.Proxy {
+			return errors.New("transcoding is only supported for proxied live movies")
+		}
+		if err := checkTranscodeProfile(m.TranscodeProfile, conf.Conf.Transcode.Profiles); err != nil {
+			return err
+		}
+	}
 	if m.VendorInfo.Vendor != "" {
 		err := movie.validateVendorMovie()
 		if err != nil {
@@ -180,6 +298,9 @@ func (movie *Movie) Validate() error {
 		}
 		switch u.Scheme {
 		case "rtmp":
+			if m.TranscodeProfile != "" {
+				return errors.New("transcoding is only supported for http flv sources")
+			}
 		case "http", "https":
 		default:
 			return errors.New("unsupported scheme")
@@ -233,26 +354,55 @@ func (movie *Movie) validateVendorMovie() error {
 	default:
 		return fmt.Errorf("vendor not implement validate")
 	}
+}
 
-	return nil
+// WithMovieURLRewriter rewrites the urls the clients of the room receive
+// for its movies, see Room.RewriteMovieURL
+func WithMovieURLRewriter(f MovieURLRewriter) RoomConf {
+	return func(r *Room) {
+		r.movieURLRewriter = f
+	}
+}
+
+// RewriteMovieURL returns the url of the movie as clients should receive it,
+// the rewriter works on a copy so the stored movie keeps its original url
+func (r *Room) RewriteMovieURL(movie *model.Movie) string {
+	if r.movieURLRewriter == nil {
+		return movie.Base.Url
+	}
+	m := *movie
+	m.Base.Headers = maps.Clone(movie.Base.Headers)
+	return r.movieURLRewriter(&m)
 }
 
 func (m *Movie) Terminate() error {
-	c := m.channel.Swap(nil)
-	if c != nil {
-		err := c.Close()
-		if err != nil {
-			return err
+	_, err := m.terminate()
+	return err
+}
+
+// terminate releases everything the movie holds even if closing the channel
+// fails, the channel is returned in that case so it can be retried later
+func (m *Movie) terminate() (*rtmps.Channel, error) {
+	var (
+		orphan *rtmps.Channel
+		err    error
+	)
+	if cancel := m.pullCancel.Swap(nil); cancel != nil {
+		(*cancel)()
+	}
+	m.transcodeStatus.Store(nil)
+	if c := m.channel.Swap(nil); c != nil {
+		if err = c.Close(); err != nil && !errors.Is(err, rtmps.ErrClosed) {
+			orphan = c
+			err = fmt.Errorf("close channel of movie %s: %w", m.Movie.ID, err)
+		} else {
+			err = nil
 		}
 	}
 	bmc := m.bilibiliCache.Swap(nil)
 	if bmc != nil {
 		bmc.NoSharedMovie.Clear()
 	}
-	return nil
-}
-
-func (m *Movie) Update(movie *model.BaseMovie) error {
-	m.Movie.Base = *movie
-	return m.Terminate()
+	cache.InvalidateProxySegments(m.Movie.ID)
+	return orphan, err
 }
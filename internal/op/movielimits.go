@@ -0,0 +1,189 @@
+package op
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// MovieFieldLimits caps the size of the movie fields clients render
+type MovieFieldLimits struct {
+	// NameRunes is the length of the name in runes
+	NameRunes int
+	// URLBytes is the length of the url in bytes
+	URLBytes int
+	// Headers is the number of headers
+	Headers          int
+	HeaderKeyBytes   int
+	HeaderValueBytes int
+}
+
+var DefaultMovieFieldLimits = MovieFieldLimits{
+	NameRunes:        256,
+	URLBytes:         8192,
+	Headers:          32,
+	HeaderKeyBytes:   256,
+	HeaderValueBytes: 4096,
+}
+
+var movieFieldLimits = DefaultMovieFieldLimits
+
+func WithMovieFieldLimits(l MovieFieldLimits) InitConfig {
+	return func() {
+		movieFieldLimits = l
+	}
+}
+
+// MovieLimits returns the limits movies are validated with
+func MovieLimits() MovieFieldLimits {
+	return movieFieldLimits
+}
+
+// ErrMovieFieldTooLong reports a movie field over its limit
+type ErrMovieFieldTooLong struct {
+	Field string
+	Limit int
+}
+
+func (e *ErrMovieFieldTooLong) Error() string {
+	return fmt.Sprintf("movie %s exceeds the limit of %d", e.Field, e.Limit)
+}
+
+// ErrMovieFieldInvalidUTF8 reports a movie field that is not valid utf-8
+type ErrMovieFieldInvalidUTF8 struct {
+	Field string
+}
+
+func (e *ErrMovieFieldInvalidUTF8) Error() string {
+	return fmt.Sprintf("movie %s is not valid utf-8", e.Field)
+}
+
+func stripControl(s string) string {
+	if !strings.ContainsFunc(s, unicode.IsControl) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sanitizeMovie strips control characters from the text fields of the movie,
+// it is applied before a pushed or edited movie is validated
+func sanitizeMovie(m *model.BaseMovie) {
+	m.Name = stripControl(m.Name)
+	m.Url = stripControl(m.Url)
+	m.Type = stripControl(m.Type)
+	if len(m.Headers) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		headers[stripControl(k)] = stripControl(v)
+	}
+	m.Headers = headers
+}
+
+// checkMovieFields checks the text fields of the movie against the movie field limits
+func checkMovieFields(m *model.BaseMovie) error {
+	l := movieFieldLimits
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"name", m.Name},
+		{"url", m.Url},
+		{"type", m.Type},
+	} {
+		if !utf8.ValidString(f.value) {
+			return &ErrMovieFieldInvalidUTF8{Field: f.name}
+		}
+	}
+	if utf8.RuneCountInString(m.Name) > l.NameRunes {
+		return &ErrMovieFieldTooLong{Field: "name", Limit: l.NameRunes}
+	}
+	if len(m.Url) > l.URLBytes {
+		return &ErrMovieFieldTooLong{Field: "url", Limit: l.URLBytes}
+	}
+	if len(m.Headers) > l.Headers {
+		return &ErrMovieFieldTooLong{Field: "headers", Limit: l.Headers}
+	}
+	for k, v := range m.Headers {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return &ErrMovieFieldInvalidUTF8{Field: "headers"}
+		}
+		if len(k) > l.HeaderKeyBytes {
+			return &ErrMovieFieldTooLong{Field: "header key", Limit: l.HeaderKeyBytes}
+		}
+		if len(v) > l.HeaderValueBytes {
+			return &ErrMovieFieldTooLong{Field: "header value", Limit: l.HeaderValueBytes}
+		}
+	}
+	return nil
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a rune
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func truncateRunes(s string, n int) string {
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
+
+func sanitizeStoredText(s string) string {
+	return stripControl(strings.ToValidUTF8(s, ""))
+}
+
+// truncateMovieFields fits a movie stored before the limits into them,
+// headers over the count are dropped in key order, it reports whether
+// anything was changed
+func truncateMovieFields(m *model.BaseMovie) bool {
+	l := movieFieldLimits
+	name := truncateRunes(sanitizeStoredText(m.Name), l.NameRunes)
+	u := truncateBytes(sanitizeStoredText(m.Url), l.URLBytes)
+	typ := sanitizeStoredText(m.Type)
+	changed := name != m.Name || u != m.Url || typ != m.Type
+	m.Name, m.Url, m.Type = name, u, typ
+	if len(m.Headers) == 0 {
+		return changed
+	}
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	headers := make(map[string]string, min(len(keys), l.Headers))
+	for _, k := range keys {
+		if len(headers) == l.Headers {
+			changed = true
+			break
+		}
+		nk := truncateBytes(sanitizeStoredText(k), l.HeaderKeyBytes)
+		nv := truncateBytes(sanitizeStoredText(m.Headers[k]), l.HeaderValueBytes)
+		if nk != k || nv != m.Headers[k] {
+			changed = true
+		}
+		headers[nk] = nv
+	}
+	m.Headers = headers
+	return changed
+}
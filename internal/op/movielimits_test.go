@@ -0,0 +1,63 @@
+package op
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestCheckMovieFields(t *testing.T) {
+	valid := model.BaseMovie{Name: strings.Repeat("😀", 256), Url: "https://example.com/a.mp4"}
+	if err := checkMovieFields(&valid); err != nil {
+		t.Fatalf("checkMovieFields() = %v, want nil", err)
+	}
+	headers := make(map[string]string)
+	for i := 0; i <= DefaultMovieFieldLimits.Headers; i++ {
+		headers[strings.Repeat("k", i+1)] = "v"
+	}
+	for field, f := range map[string]func(*model.BaseMovie){
+		"name":         func(m *model.BaseMovie) { m.Name += "a" },
+		"url":          func(m *model.BaseMovie) { m.Url += strings.Repeat("a", 8192) },
+		"headers":      func(m *model.BaseMovie) { m.Headers = headers },
+		"header value": func(m *model.BaseMovie) { m.Headers = map[string]string{"a": strings.Repeat("v", 4097)} },
+	} {
+		m := valid
+		f(&m)
+		var tooLong *ErrMovieFieldTooLong
+		if err := checkMovieFields(&m); !errors.As(err, &tooLong) || tooLong.Field != field {
+			t.Fatalf("checkMovieFields() = %v, want %s too long", err, field)
+		}
+	}
+	m := valid
+	m.Name = "a\xff"
+	var invalid *ErrMovieFieldInvalidUTF8
+	if err := checkMovieFields(&m); !errors.As(err, &invalid) || invalid.Field != "name" {
+		t.Fatalf("checkMovieFields() = %v, want invalid name", err)
+	}
+}
+
+func TestSanitizeMovie(t *testing.T) {
+	m := model.BaseMovie{Name: "a\x00b\nc", Headers: map[string]string{"k\r": "v\n"}}
+	sanitizeMovie(&m)
+	if m.Name != "abc" || m.Headers["k"] != "v" {
+		t.Fatalf("sanitizeMovie() = %q %v", m.Name, m.Headers)
+	}
+}
+
+func TestTruncateMovieFields(t *testing.T) {
+	m := model.BaseMovie{Name: strings.Repeat("😀", 300) + "\xff", Url: "https://example.com/a.mp4"}
+	if !truncateMovieFields(&m) {
+		t.Fatal("truncateMovieFields() = false, want true")
+	}
+	if err := checkMovieFields(&m); err != nil {
+		t.Fatalf("truncated movie is invalid: %v", err)
+	}
+	if truncateMovieFields(&m) {
+		t.Fatal("truncating again changed the movie")
+	}
+	if s := truncateBytes("a😀", 3); s != "a" {
+		t.Fatalf("truncateBytes() = %q, want a", s)
+	}
+}
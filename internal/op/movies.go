@@ -2,9 +2,14 @@ package op
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/maruel/natural"
+	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/utils"
@@ -12,23 +17,206 @@ import (
 	rtmps "github.com/zijiren233/livelib/server"
 )
 
+type externalKey struct {
+	system string
+	id     string
+}
+
 type movies struct {
-	roomID string
-	lock   sync.RWMutex
-	list   dllist.Dllist[*Movie]
-	once   sync.Once
+	roomID   string
+	lock     sync.RWMutex
+	list     dllist.Dllist[*Movie]
+	external map[externalKey]*Movie
+	once     sync.Once
+	closed   bool
+	orphans  orphans
+	// lastPosition is the largest position handed out or restored,
+	// new movies are always placed after it
+	lastPosition uint
 }
 
 func (m *movies) init() {
 	m.once.Do(func() {
-		for _, m2 := range db.GetAllMoviesByRoomID(m.roomID) {
-			m.list.PushBack(&Movie{
-				Movie: *m2,
-			})
-		}
+		m.restore(db.GetAllMoviesByRoomID(m.roomID))
 	})
 }
 
+func (m *movies) restore(ms []*model.Movie) {
+	m.external = make(map[externalKey]*Movie)
+	for _, m2 := range ms {
+		if truncateMovieFields(&m2.Base) {
+			log.Warnf("room %s: movie %s exceeds the movie field limits, truncated", m.roomID, m2.ID)
+		}
+		movie := &Movie{
+			Movie: *m2,
+		}
+		m.list.PushBack(movie)
+		m.indexExternal(movie)
+		if m2.Position > m.lastPosition {
+			m.lastPosition = m2.Position
+		}
+	}
+}
+
+// nextPosition must be called with the write lock held
+func (m *movies) nextPosition() uint {
+	p := uint(time.Now().UnixMilli())
+	if p <= m.lastPosition {
+		p = m.lastPosition + 1
+	}
+	m.lastPosition = p
+	return p
+}
+
+// movieIDGenerator allocates the ids of added movies, nil leaves them to the model
+var movieIDGenerator func() string
+
+// WithMovieIDGenerator allocates the ids of added movies with fn instead of
+// random sortable uuids, e.g. to derive them from a cluster wide counter,
+// the ids must be 32 lowercase hex characters
+func WithMovieIDGenerator(fn func() string) InitConfig {
+	return func() {
+		movieIDGenerator = fn
+	}
+}
+
+// nextID returns the id for a movie added without one, it is empty when no
+// generator is set, nextID must be called with the write lock held
+func (m *movies) nextID() (string, error) {
+	if movieIDGenerator == nil {
+		return "", nil
+	}
+	id := movieIDGenerator()
+	if !validMovieID(id) {
+		return "", ErrInvalidMovieID
+	}
+	if err := m.checkID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+var (
+	ErrMovieIDExists  = errors.New("movie id already exists")
+	ErrInvalidMovieID = errors.New("movie id must be 32 lowercase hex characters")
+)
+
+// validMovieID reports whether id has the format of generated movie ids
+func validMovieID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrMovieNotFound is returned by movie lookups, ID is the missing movie id
+type ErrMovieNotFound struct {
+	ID string
+}
+
+func (e *ErrMovieNotFound) Error() string {
+	return fmt.Sprintf("movie %s not found", e.ID)
+}
+
+// ErrDeleteMovies reports the movies of a batch delete that were not deleted,
+// the other movies of the batch were deleted
+type ErrDeleteMovies struct {
+	Deleted []string
+	Failed  map[string]error
+}
+
+func (e *ErrDeleteMovies) Error() string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for i, id := range ids {
+		ids[i] = fmt.Sprintf("%s: %v", id, e.Failed[id])
+	}
+	return fmt.Sprintf("failed to delete movies: %s", strings.Join(ids, "; "))
+}
+
+func (e *ErrDeleteMovies) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// terminate must be called with the lock held, a channel that failed
+// to close is handed to the orphan reaper
+func (m *movies) terminate(movie *Movie) error {
+	c, err := movie.terminate()
+	if c != nil {
+		m.orphans.add(m.roomID, c)
+	}
+	return err
+}
+
+// terminateAll attempts to tear down every movie and collects the failures
+func (m *movies) terminateAll() error {
+	var errs []error
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		if err := m.terminate(e.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *movies) checkID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := m.getMovieByID(id); err == nil {
+		return ErrMovieIDExists
+	}
+	return nil
+}
+
+func externalKeyOf(movie *model.BaseMovie) (externalKey, bool) {
+	if movie.ExternalSystem == "" || movie.ExternalID == "" {
+		return externalKey{}, false
+	}
+	return externalKey{
+		system: movie.ExternalSystem,
+		id:     movie.ExternalID,
+	}, true
+}
+
+func (m *movies) indexExternal(movie *Movie) {
+	if k, ok := externalKeyOf(&movie.Movie.Base); ok {
+		m.external[k] = movie
+	}
+}
+
+func (m *movies) unindexExternal(movie *Movie) {
+	if k, ok := externalKeyOf(&movie.Movie.Base); ok && m.external[k] == movie {
+		delete(m.external, k)
+	}
+}
+
+var ErrExternalMovieExists = errors.New("movie with the same external id already exists")
+
+func (m *movies) checkExternal(movie *model.BaseMovie, self *Movie) error {
+	k, ok := externalKeyOf(movie)
+	if !ok {
+		return nil
+	}
+	if e, ok := m.external[k]; ok && e != self {
+		return ErrExternalMovieExists
+	}
+	return nil
+}
+
 func (m *movies) Len() int {
 	m.init()
 	m.lock.RLock()
@@ -40,12 +228,31 @@ func (m *movies) AddMovie(mo *model.Movie) error {
 	m.init()
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	mo.Position = uint(time.Now().UnixMilli())
+	if m.closed {
+		return ErrAlreadyClosed
+	}
+	err := m.checkID(mo.ID)
+	if err != nil {
+		return err
+	}
+	if mo.ID == "" {
+		mo.ID, err = m.nextID()
+		if err != nil {
+			return err
+		}
+	}
+	sanitizeMovie(&mo.Base)
+	mo.Position = m.nextPosition()
 	movie := &Movie{
 		Movie: *mo,
 	}
 
-	err := movie.Validate()
+	err = movie.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = m.checkExternal(&mo.Base, nil)
 	if err != nil {
 		return err
 	}
@@ -56,7 +263,10 @@ func (m *movies) AddMovie(mo *model.Movie) error {
 	}
 
 	movie.Movie.ID = mo.ID
+	movie.Movie.CreatedAt = mo.CreatedAt
+	movie.Movie.UpdatedAt = mo.UpdatedAt
 	m.list.PushBack(movie)
+	m.indexExternal(movie)
 	return nil
 }
 
@@ -64,18 +274,51 @@ func (m *movies) AddMovies(mos []*model.Movie) error {
 	m.init()
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	if m.closed {
+		return ErrAlreadyClosed
+	}
 	inited := make([]*Movie, 0, len(mos))
+	batch := make(map[externalKey]struct{}, len(mos))
+	ids := make(map[string]struct{}, len(mos))
 	for _, mo := range mos {
-		mo.Position = uint(time.Now().UnixMilli())
+		err := m.checkID(mo.ID)
+		if err != nil {
+			return err
+		}
+		if mo.ID == "" {
+			mo.ID, err = m.nextID()
+			if err != nil {
+				return err
+			}
+		}
+		if mo.ID != "" {
+			if _, ok := ids[mo.ID]; ok {
+				return ErrMovieIDExists
+			}
+			ids[mo.ID] = struct{}{}
+		}
+		sanitizeMovie(&mo.Base)
+		mo.Position = m.nextPosition()
 		movie := &Movie{
 			Movie: *mo,
 		}
 
-		err := movie.Validate()
+		err = movie.Validate()
 		if err != nil {
 			return err
 		}
 
+		err = m.checkExternal(&mo.Base, nil)
+		if err != nil {
+			return err
+		}
+		if k, ok := externalKeyOf(&mo.Base); ok {
+			if _, ok := batch[k]; ok {
+				return ErrExternalMovieExists
+			}
+			batch[k] = struct{}{}
+		}
+
 		inited = append(inited, movie)
 	}
 
@@ -86,7 +329,10 @@ func (m *movies) AddMovies(mos []*model.Movie) error {
 
 	for i, mo := range inited {
 		mo.Movie.ID = mos[i].ID
+		mo.Movie.CreatedAt = mos[i].CreatedAt
+		mo.Movie.UpdatedAt = mos[i].UpdatedAt
 		m.list.PushBack(mo)
+		m.indexExternal(mo)
 	}
 
 	return nil
@@ -109,16 +355,111 @@ func (m *movies) Update(movieId string, movie *model.BaseMovie) error {
 	defer m.lock.Unlock()
 	for e := m.list.Front(); e != nil; e = e.Next() {
 		if e.Value.Movie.ID == movieId {
-			err := e.Value.Update(movie)
+			sanitizeMovie(movie)
+			err := ValidateMovie(movie)
+			if err != nil {
+				return err
+			}
+			err = m.checkExternal(movie, e.Value)
 			if err != nil {
 				return err
 			}
+			m.unindexExternal(e.Value)
+			// chapter edits must not interrupt playback
+			restart := !onlyChaptersChanged(&e.Value.Movie.Base, movie)
+			e.Value.Movie.Base = *movie
+			if restart {
+				if err := m.terminate(e.Value); err != nil {
+					log.Warnf("room %s: %v", m.roomID, err)
+				}
+			}
+			m.indexExternal(e.Value)
 			return db.SaveMovie(&e.Value.Movie)
 		}
 	}
 	return nil
 }
 
+var ErrCannotChangeRtmpSourceURL = errors.New("cannot change the url of a rtmp source")
+
+// SetURL validates the url like a newly pushed movie before storing it
+func (m *movies) SetURL(id, url string) error {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return err
+	}
+	if movie.Movie.Base.Live && movie.Movie.Base.RtmpSource {
+		return ErrCannotChangeRtmpSourceURL
+	}
+	if movie.Movie.Base.VendorInfo.Vendor != "" {
+		return errors.New("vendor movies resolve their url from the vendor")
+	}
+	if url == "" {
+		return errors.New("url is empty")
+	}
+	if len(url) > 8192 {
+		return errors.New("url too long")
+	}
+	base := movie.Movie.Base
+	base.Url = url
+	if err := (&Movie{Movie: model.Movie{Base: base}}).Validate(); err != nil {
+		return err
+	}
+	prev := movie.Movie.Base.Url
+	movie.Movie.Base.Url = url
+	if err := db.SaveMovie(&movie.Movie); err != nil {
+		movie.Movie.Base.Url = prev
+		return err
+	}
+	// live proxies and caches still use the old url
+	if err := m.terminate(movie); err != nil {
+		log.Warnf("room %s: %v", m.roomID, err)
+	}
+	return nil
+}
+
+// SetType changes the type of the movie, false if it did not change
+func (m *movies) SetType(id, typ string) (bool, error) {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return false, err
+	}
+	typ = stripControl(typ)
+	if movie.Movie.Base.Type == typ {
+		return false, nil
+	}
+	base := movie.Movie.Base
+	base.Type = typ
+	if err := (&Movie{Movie: model.Movie{Base: base}}).Validate(); err != nil {
+		return false, err
+	}
+	prev := movie.Movie.Base.Type
+	movie.Movie.Base.Type = typ
+	if err := db.SaveMovie(&movie.Movie); err != nil {
+		movie.Movie.Base.Type = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// IDs returns the ids of the movies in list order
+func (m *movies) IDs() []string {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	ids := make([]string, 0, m.list.Len())
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		ids = append(ids, e.Value.Movie.ID)
+	}
+	return ids
+}
+
 func (m *movies) Clear() error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -126,21 +467,26 @@ func (m *movies) Clear() error {
 	if err != nil {
 		return err
 	}
-	for e := m.list.Front(); e != nil; e = e.Next() {
-		e.Value.Terminate()
+	// the movies are gone either way, failed channels are retried by the reaper
+	if err := m.terminateAll(); err != nil {
+		log.Warnf("room %s: %v", m.roomID, err)
 	}
 	m.list.Clear()
+	m.external = make(map[externalKey]*Movie)
 	return nil
 }
 
 func (m *movies) Close() error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	for e := m.list.Front(); e != nil; e = e.Next() {
-		e.Value.Terminate()
+	m.closed = true
+	err := m.terminateAll()
+	if err != nil {
+		log.Warnf("room %s: %v", m.roomID, err)
 	}
 	m.list.Clear()
-	return nil
+	m.external = make(map[externalKey]*Movie)
+	return err
 }
 
 func (m *movies) DeleteMovieByID(id string) error {
@@ -155,11 +501,73 @@ func (m *movies) DeleteMovieByID(id string) error {
 
 	for e := m.list.Front(); e != nil; e = e.Next() {
 		if e.Value.Movie.ID == id {
-			m.list.Remove(e).Terminate()
+			movie := m.list.Remove(e)
+			m.unindexExternal(movie)
+			if err := m.terminate(movie); err != nil {
+				log.Warnf("room %s: %v", m.roomID, err)
+			}
 			return nil
 		}
 	}
-	return errors.New("movie not found")
+	return &ErrMovieNotFound{ID: id}
+}
+
+// IndexOf returns the zero-based position of the movie in the given order and the total count
+func (m *movies) IndexOf(sort model.PlaylistSort, id string) (int, int, error) {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	ms := m.ordered(sort)
+	for i, movie := range ms {
+		if movie.Movie.ID == id {
+			return i, len(ms), nil
+		}
+	}
+	return 0, len(ms), &ErrMovieNotFound{ID: id}
+}
+
+// ordered returns the movies in the given order with pinned movies first,
+// ties keep the manual order, it must be called with the lock held
+func (m *movies) ordered(sort model.PlaylistSort) []*Movie {
+	ms := make([]*Movie, 0, m.list.Len())
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		ms = append(ms, e.Value)
+	}
+	switch sort {
+	case model.PlaylistSortCreatedAt:
+		slices.SortStableFunc(ms, func(a, b *Movie) int {
+			return a.Movie.CreatedAt.Compare(b.Movie.CreatedAt)
+		})
+	case model.PlaylistSortName:
+		slices.SortStableFunc(ms, func(a, b *Movie) int {
+			return compareMovieNames(a.Movie.Base.Name, b.Movie.Base.Name)
+		})
+	}
+	slices.SortStableFunc(ms, func(a, b *Movie) int {
+		switch {
+		case a.Movie.Pinned == b.Movie.Pinned:
+			return 0
+		case a.Movie.Pinned:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return ms
+}
+
+// compareMovieNames orders names case insensitively, numbers are compared
+// by value so episode 2 comes before episode 10
+func compareMovieNames(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	switch {
+	case natural.Less(a, b):
+		return -1
+	case natural.Less(b, a):
+		return 1
+	default:
+		return 0
+	}
 }
 
 func (m *movies) GetMovieByID(id string) (*Movie, error) {
@@ -175,7 +583,102 @@ func (m *movies) getMovieByID(id string) (*Movie, error) {
 			return e.Value, nil
 		}
 	}
-	return nil, errors.New("movie not found")
+	return nil, &ErrMovieNotFound{ID: id}
+}
+
+func (m *movies) SetCreator(id, userID string) error {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return err
+	}
+	err = db.SetMovieCreatorID(m.roomID, id, userID)
+	if err != nil {
+		return err
+	}
+	movie.Movie.CreatorID = userID
+	return nil
+}
+
+func (m *movies) SetPinned(id string, pinned bool) error {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return err
+	}
+	if movie.Movie.Pinned == pinned {
+		return nil
+	}
+	err = db.SetMoviePinned(m.roomID, id, pinned)
+	if err != nil {
+		return err
+	}
+	movie.Movie.Pinned = pinned
+	return nil
+}
+
+// SetVisibility stores the visibility of the movie, false if it did not change
+func (m *movies) SetVisibility(id string, visibility model.MovieVisibility) (bool, error) {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return false, err
+	}
+	if movie.Movie.Visibility == visibility ||
+		movie.Movie.Visibility.Public() && visibility.Public() {
+		return false, nil
+	}
+	err = db.SetMovieVisibility(m.roomID, id, visibility)
+	if err != nil {
+		return false, err
+	}
+	movie.Movie.Visibility = visibility
+	return true, nil
+}
+
+// Duration returns the duration of the movie in seconds, 0 if unknown
+func (m *movies) Duration(id string) (float64, error) {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return 0, err
+	}
+	return movie.Movie.Base.Duration, nil
+}
+
+func (m *movies) SetDuration(id string, duration float64) error {
+	m.init()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	movie, err := m.getMovieByID(id)
+	if err != nil {
+		return err
+	}
+	err = db.SetMovieDuration(m.roomID, id, duration)
+	if err != nil {
+		return err
+	}
+	movie.Movie.Base.Duration = duration
+	return nil
+}
+
+func (m *movies) FindMovieByExternalID(system, id string) (*Movie, error) {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	movie, ok := m.external[externalKey{system: system, id: id}]
+	if !ok {
+		return nil, &ErrMovieNotFound{ID: id}
+	}
+	return movie, nil
 }
 
 func (m *movies) getMovieElementByID(id string) (*dllist.Element[*Movie], error) {
@@ -185,25 +688,32 @@ func (m *movies) getMovieElementByID(id string) (*dllist.Element[*Movie], error)
 			return e, nil
 		}
 	}
-	return nil, errors.New("movie not found")
+	return nil, &ErrMovieNotFound{ID: id}
 }
 
+// SwapMoviePositions swaps two movies in the playlist.
+// Swapping a movie with itself is a no-op, and if either movie is missing
+// neither the database nor the in-memory list is touched.
 func (m *movies) SwapMoviePositions(id1, id2 string) error {
 	m.init()
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	err := db.SwapMoviePositions(m.roomID, id1, id2)
+	movie1, err := m.getMovieElementByID(id1)
 	if err != nil {
 		return err
 	}
 
-	movie1, err := m.getMovieElementByID(id1)
+	if id1 == id2 {
+		return nil
+	}
+
+	movie2, err := m.getMovieElementByID(id2)
 	if err != nil {
 		return err
 	}
 
-	movie2, err := m.getMovieElementByID(id2)
+	err = db.SwapMoviePositions(m.roomID, id1, id2)
 	if err != nil {
 		return err
 	}
@@ -214,21 +724,36 @@ func (m *movies) SwapMoviePositions(id1, id2 string) error {
 	return nil
 }
 
-func (m *movies) GetMoviesWithPage(page, pageSize int) []*Movie {
+// GetMoviesByKindWithPage pages over the movies of the given kind and returns the filtered total
+func (m *movies) GetMoviesByKindWithPage(sort model.PlaylistSort, kind model.MediaKind, page, pageSize int) ([]*Movie, int) {
+	return m.GetFilteredMoviesWithPage(sort, func(movie *model.Movie) bool {
+		return movie.Base.MediaKind == kind
+	}, page, pageSize)
+}
+
+// GetFilteredMoviesWithPage pages over the movies keep returns true for and
+// returns the filtered total, keep is called with the lock held
+func (m *movies) GetFilteredMoviesWithPage(sort model.PlaylistSort, keep func(*model.Movie) bool, page, pageSize int) ([]*Movie, int) {
 	m.init()
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	start, end := utils.GetPageItemsRange(m.list.Len(), page, pageSize)
-	ms := make([]*Movie, 0, end-start)
-	i := 0
-	for e := m.list.Front(); e != nil; e = e.Next() {
-		if i >= start && i < end {
-			ms = append(ms, e.Value)
-		} else if i >= end {
-			return ms
+	var filtered []*Movie
+	for _, movie := range m.ordered(sort) {
+		if keep(&movie.Movie) {
+			filtered = append(filtered, movie)
 		}
-		i++
 	}
-	return ms
+	start, end := utils.GetPageItemsRange(len(filtered), page, pageSize)
+	return filtered[start:end], len(filtered)
+}
+
+func (m *movies) GetMoviesWithPage(sort model.PlaylistSort, page, pageSize int) []*Movie {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ms := m.ordered(sort)
+	start, end := utils.GetPageItemsRange(len(ms), page, pageSize)
+	return ms[start:end]
 }
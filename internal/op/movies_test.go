@@ -0,0 +1,463 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/utils"
+)
+
+func newTestMovies(ms ...*model.Movie) *movies {
+	m := &movies{}
+	m.once.Do(func() {
+		m.restore(ms)
+	})
+	return m
+}
+
+func TestNextPositionAfterRestore(t *testing.T) {
+	future := uint(time.Now().Add(time.Hour).UnixMilli())
+	m := newTestMovies(
+		&model.Movie{ID: "a", Position: future - 1},
+		&model.Movie{ID: "b", Position: future},
+	)
+	m.lock.Lock()
+	p := m.nextPosition()
+	m.lock.Unlock()
+	if p <= future {
+		t.Fatalf("nextPosition() = %d, want > %d", p, future)
+	}
+}
+
+func TestNextPositionConcurrent(t *testing.T) {
+	m := newTestMovies()
+	const n = 1000
+	var (
+		wg        sync.WaitGroup
+		positions = make(chan uint, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.lock.Lock()
+			defer m.lock.Unlock()
+			positions <- m.nextPosition()
+		}()
+	}
+	wg.Wait()
+	close(positions)
+	seen := make(map[uint]struct{}, n)
+	for p := range positions {
+		if _, ok := seen[p]; ok {
+			t.Fatalf("position %d allocated twice", p)
+		}
+		seen[p] = struct{}{}
+	}
+}
+
+func TestCheckID(t *testing.T) {
+	m := newTestMovies(&model.Movie{ID: "a"})
+	if err := m.checkID("a"); err != ErrMovieIDExists {
+		t.Fatalf("checkID() = %v, want %v", err, ErrMovieIDExists)
+	}
+	if err := m.checkID("b"); err != nil {
+		t.Fatalf("checkID() = %v, want nil", err)
+	}
+}
+
+func TestNextID(t *testing.T) {
+	defer func(fn func() string) { movieIDGenerator = fn }(movieIDGenerator)
+	m := newTestMovies(&model.Movie{ID: fmt.Sprintf("%032x", 1)})
+	movieIDGenerator = nil
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if id, err := m.nextID(); id != "" || err != nil {
+		t.Fatalf("nextID() without a generator = %q, %v", id, err)
+	}
+	var n uint64
+	WithMovieIDGenerator(func() string {
+		n++
+		return fmt.Sprintf("%032x", n)
+	})()
+	if _, err := m.nextID(); err != ErrMovieIDExists {
+		t.Fatalf("nextID() of a taken id = %v, want %v", err, ErrMovieIDExists)
+	}
+	if id, err := m.nextID(); err != nil || id != fmt.Sprintf("%032x", 2) {
+		t.Fatalf("nextID() = %q, %v", id, err)
+	}
+	movieIDGenerator = func() string { return "1" }
+	if _, err := m.nextID(); err != ErrInvalidMovieID {
+		t.Fatalf("nextID() of an invalid id = %v, want %v", err, ErrInvalidMovieID)
+	}
+}
+
+func movieIDs(m *movies) []string {
+	var ids []string
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		ids = append(ids, e.Value.Movie.ID)
+	}
+	return ids
+}
+
+func TestSwapMovieSameID(t *testing.T) {
+	m := newTestMovies(
+		&model.Movie{ID: "a", Position: 1},
+		&model.Movie{ID: "b", Position: 2},
+	)
+	if err := m.SwapMoviePositions("a", "a"); err != nil {
+		t.Fatalf("SwapMoviePositions() = %v, want nil", err)
+	}
+	if got := movieIDs(m); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("list = %v, want [a b]", got)
+	}
+}
+
+func TestSwapMovieNotFound(t *testing.T) {
+	m := newTestMovies(
+		&model.Movie{ID: "a", Position: 1},
+		&model.Movie{ID: "b", Position: 2},
+	)
+	for _, ids := range [][2]string{{"a", "c"}, {"c", "a"}, {"c", "c"}} {
+		if err := m.SwapMoviePositions(ids[0], ids[1]); err == nil {
+			t.Fatalf("SwapMoviePositions(%q, %q) = nil, want error", ids[0], ids[1])
+		}
+	}
+	if got := movieIDs(m); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("list = %v, want [a b]", got)
+	}
+	if p, _ := m.getMovieByID("a"); p.Movie.Position != 1 {
+		t.Fatalf("position = %d, want 1", p.Movie.Position)
+	}
+}
+
+func TestRewriteMovieURL(t *testing.T) {
+	movie := &model.Movie{
+		Base: model.BaseMovie{
+			Url:     "http://origin/a.mp4",
+			Headers: map[string]string{"a": "b"},
+		},
+	}
+	if u := newRoom(&model.Room{}).RewriteMovieURL(movie); u != movie.Base.Url {
+		t.Fatalf("RewriteMovieURL() = %s, want %s", u, movie.Base.Url)
+	}
+	r := newRoom(&model.Room{}, WithMovieURLRewriter(func(m *model.Movie) string {
+		m.Base.Url = "http://cdn/a.mp4?sign=x"
+		m.Base.Headers["a"] = "c"
+		return m.Base.Url
+	}))
+	if u := r.RewriteMovieURL(movie); u != "http://cdn/a.mp4?sign=x" {
+		t.Fatalf("RewriteMovieURL() = %s", u)
+	}
+	if movie.Base.Url != "http://origin/a.mp4" || movie.Base.Headers["a"] != "b" {
+		t.Fatal("stored movie was mutated")
+	}
+}
+
+func TestRoomMovieDuration(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{
+			{ID: "a", Base: model.BaseMovie{Duration: 90.5}},
+			{ID: "b"},
+		})
+	})
+	if d, ok := r.MovieDuration("a"); !ok || d != 90500*time.Millisecond {
+		t.Fatalf("MovieDuration(a) = %v %v, want 1m30.5s true", d, ok)
+	}
+	for _, id := range []string{"b", "c"} {
+		if _, ok := r.MovieDuration(id); ok {
+			t.Fatalf("MovieDuration(%s) ok, want unknown", id)
+		}
+	}
+	if err := r.SetMovieDuration("a", 0); err != ErrInvalidMovieDuration {
+		t.Fatalf("SetMovieDuration() = %v, want %v", err, ErrInvalidMovieDuration)
+	}
+}
+
+func TestSetMovieURLRejected(t *testing.T) {
+	m := newTestMovies(
+		&model.Movie{ID: "live", Base: model.BaseMovie{Live: true, RtmpSource: true}},
+		&model.Movie{ID: "a", Base: model.BaseMovie{Name: "a", Url: "https://example.com/a.mp4"}},
+	)
+	if err := m.SetURL("live", "https://example.com/b.flv"); err != ErrCannotChangeRtmpSourceURL {
+		t.Fatalf("SetURL() = %v, want %v", err, ErrCannotChangeRtmpSourceURL)
+	}
+	if err := m.SetURL("a", "ftp://example.com/b.mp4"); err == nil {
+		t.Fatal("SetURL() accepted an unsupported scheme")
+	}
+	if p, _ := m.getMovieByID("a"); p.Movie.Base.Url != "https://example.com/a.mp4" {
+		t.Fatalf("url = %s, want it unchanged", p.Movie.Base.Url)
+	}
+}
+
+func TestSetCurrentMovieType(t *testing.T) {
+	r := newRoom(&model.Room{})
+	movie := &model.Movie{ID: "a", Base: model.BaseMovie{Name: "a", Url: "https://example.com/a", Type: "mp4"}}
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{movie})
+	})
+	if err := r.SetCurrentMovieType("m3u8"); err != ErrNoCurrentMovie {
+		t.Fatalf("SetCurrentMovieType() = %v, want %v", err, ErrNoCurrentMovie)
+	}
+	r.SetCurrentMovie(movie, false)
+	if err := r.SetCurrentMovieType("mp4\n"); err != nil {
+		t.Fatalf("SetCurrentMovieType() of the same type = %v", err)
+	}
+	if err := r.SetCurrentMovieType(strings.Repeat("a", 33)); err == nil {
+		t.Fatal("SetCurrentMovieType() accepted a type that is too long")
+	}
+	if typ := r.current.Current().Movie.Base.Type; typ != "mp4" {
+		t.Fatalf("current type = %s, want it unchanged", typ)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	m := newTestMovies(&model.Movie{ID: "a", Base: model.BaseMovie{Name: "a", Duration: 10}})
+	if changed, err := m.SetMetadata("a", movieMetadata{Name: "a", Duration: 10}); err != nil || changed {
+		t.Fatalf("SetMetadata() = %v %v, want unchanged", changed, err)
+	}
+	for _, meta := range []movieMetadata{{}, {Name: "a", Duration: -1}} {
+		if _, err := m.SetMetadata("a", meta); err == nil {
+			t.Fatalf("SetMetadata(%+v) accepted invalid metadata", meta)
+		}
+	}
+	if _, err := m.SetMetadata("b", movieMetadata{Name: "b"}); err == nil {
+		t.Fatal("SetMetadata() accepted a missing movie")
+	}
+}
+
+func TestValidateMovie(t *testing.T) {
+	valid := model.BaseMovie{Name: "a", Url: "https://example.com/a.mp4"}
+	if err := ValidateMovie(&valid); err != nil {
+		t.Fatalf("ValidateMovie() = %v, want nil", err)
+	}
+	for _, f := range []func(*model.BaseMovie){
+		func(m *model.BaseMovie) { m.Name = "" },
+		func(m *model.BaseMovie) { m.Name = strings.Repeat("a", 257) },
+		func(m *model.BaseMovie) { m.Url = "" },
+		func(m *model.BaseMovie) { m.Duration = -1 },
+		func(m *model.BaseMovie) { m.ExternalID = "1" },
+	} {
+		m := valid
+		f(&m)
+		if err := ValidateMovie(&m); err == nil {
+			t.Fatalf("ValidateMovie(%+v) = nil, want error", m)
+		}
+	}
+}
+
+func TestValidMovieID(t *testing.T) {
+	if !validMovieID(utils.SortUUID()) {
+		t.Fatal("generated id is invalid")
+	}
+	for _, id := range []string{"", "a", strings.Repeat("A", 32), strings.Repeat("g", 32), strings.Repeat("a", 33)} {
+		if validMovieID(id) {
+			t.Fatalf("validMovieID(%q) = true", id)
+		}
+	}
+	r := newRoom(&model.Room{})
+	if err := r.AddMovieWithID(&model.Movie{}, "abc"); err != ErrInvalidMovieID {
+		t.Fatalf("AddMovieWithID() = %v, want %v", err, ErrInvalidMovieID)
+	}
+}
+
+func TestMaxMovieDuration(t *testing.T) {
+	r := newRoom(&model.Room{})
+	long := &model.Movie{Base: model.BaseMovie{Duration: 24 * 60 * 60}}
+	if err := r.checkMovieDuration(long); err != nil {
+		t.Fatalf("checkMovieDuration() without a max = %v, want nil", err)
+	}
+	r.Settings.MaxMovieDuration = 60
+	var tooLong *ErrMovieTooLong
+	if err := r.checkMovieDuration(long); !errors.As(err, &tooLong) || tooLong.Max != time.Minute {
+		t.Fatalf("checkMovieDuration() = %v, want ErrMovieTooLong", err)
+	}
+	if err := r.checkMovieDuration(&model.Movie{}); err != nil {
+		t.Fatalf("checkMovieDuration() of unknown duration = %v, want nil", err)
+	}
+	if err := r.SetMaxMovieDuration(-time.Second); err != ErrInvalidMaxMovieDuration {
+		t.Fatalf("SetMaxMovieDuration() = %v, want %v", err, ErrInvalidMaxMovieDuration)
+	}
+}
+
+func TestPlaylistSortCreatedAtPushed(t *testing.T) {
+	useTestDB(t)
+	m := &movies{roomID: "room"}
+	m.once.Do(func() {
+		m.restore([]*model.Movie{{ID: "old", RoomID: "room", Position: 1, CreatedAt: time.Now().Add(-time.Hour), Base: model.BaseMovie{Name: "old"}}})
+	})
+	if err := m.AddMovie(&model.Movie{RoomID: "room", Base: model.BaseMovie{Name: "one", Url: "https://example.com/1.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddMovies([]*model.Movie{{RoomID: "room", Base: model.BaseMovie{Name: "two", Url: "https://example.com/2.mp4"}}}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, movie := range m.GetMoviesWithPage(model.PlaylistSortCreatedAt, 1, 10) {
+		got = append(got, movie.Movie.Base.Name)
+	}
+	// pushed movies sort by the time they were stored, after the old one
+	if !reflect.DeepEqual(got, []string{"old", "one", "two"}) {
+		t.Fatalf("GetMoviesWithPage(createdAt) = %v, want [old one two]", got)
+	}
+}
+
+func TestPlaylistSort(t *testing.T) {
+	now := time.Now()
+	m := newTestMovies(
+		&model.Movie{ID: "a", CreatedAt: now.Add(2 * time.Second), Base: model.BaseMovie{Name: "ep 10"}},
+		&model.Movie{ID: "b", CreatedAt: now, Base: model.BaseMovie{Name: "Ep 2"}},
+		&model.Movie{ID: "c", CreatedAt: now, Base: model.BaseMovie{Name: "ep 2"}},
+	)
+	for sort, want := range map[model.PlaylistSort][]string{
+		model.PlaylistSortManual:    {"a", "b", "c"},
+		model.PlaylistSortCreatedAt: {"b", "c", "a"},
+		model.PlaylistSortName:      {"b", "c", "a"},
+	} {
+		var got []string
+		for _, movie := range m.GetMoviesWithPage(sort, 1, 10) {
+			got = append(got, movie.Movie.ID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetMoviesWithPage(%s) = %v, want %v", sort, got, want)
+		}
+	}
+	if id := nextMovieID(m, model.PlaylistSortName, "c"); id != "a" {
+		t.Fatalf("Next(name, c) = %q, want a", id)
+	}
+	if _, ok := m.Next(model.PlaylistSortManual, "c"); ok {
+		t.Fatal("Next() of the last movie ok, want none")
+	}
+	if movieIDs(m)[0] != "a" {
+		t.Fatal("sorting changed the manual order")
+	}
+}
+
+// nextMovieID returns the id of the movie after id, empty if there is none
+func nextMovieID(m *movies, sort model.PlaylistSort, id string) string {
+	next, ok := m.Next(sort, id)
+	if !ok {
+		return ""
+	}
+	return next.Movie.ID
+}
+
+func TestCopyMovieTo(t *testing.T) {
+	src, target := newRoom(&model.Room{}), newRoom(&model.Room{})
+	src.movies.once.Do(func() {
+		src.movies.restore([]*model.Movie{
+			{ID: "live", Base: model.BaseMovie{Name: "live", Live: true, RtmpSource: true}},
+		})
+	})
+	target.movies.once.Do(func() {
+		target.movies.restore(nil)
+	})
+	var notFound *ErrMovieNotFound
+	if err := src.CopyMovieTo("a", target); !errors.As(err, &notFound) {
+		t.Fatalf("CopyMovieTo(a) = %v, want ErrMovieNotFound", err)
+	}
+	// the copy is no longer an rtmp source and has no url to play
+	if err := src.CopyMovieTo("live", target); err == nil {
+		t.Fatal("CopyMovieTo(live) accepted a copy without url")
+	}
+	if target.GetMoviesCount() != 0 {
+		t.Fatal("invalid copy was added")
+	}
+	if m, _ := src.GetMovieByID("live"); !m.Movie.Base.RtmpSource {
+		t.Fatal("source movie was modified")
+	}
+}
+
+func TestPinnedMoviesFirst(t *testing.T) {
+	m := newTestMovies(
+		&model.Movie{ID: "a", Base: model.BaseMovie{Name: "a"}},
+		&model.Movie{ID: "b", Base: model.BaseMovie{Name: "b"}},
+		&model.Movie{ID: "c", Pinned: true, Base: model.BaseMovie{Name: "c"}},
+	)
+	for _, sort := range []model.PlaylistSort{model.PlaylistSortManual, model.PlaylistSortName} {
+		var got []string
+		for _, movie := range m.GetMoviesWithPage(sort, 1, 10) {
+			got = append(got, movie.Movie.ID)
+		}
+		if !reflect.DeepEqual(got, []string{"c", "a", "b"}) {
+			t.Fatalf("GetMoviesWithPage(%s) = %v, want [c a b]", sort, got)
+		}
+	}
+	if id := nextMovieID(m, model.PlaylistSortManual, "c"); id != "a" {
+		t.Fatalf("Next(c) = %q, want a", id)
+	}
+	if err := m.SetPinned("d", true); err == nil {
+		t.Fatal("SetPinned() of a missing movie = nil, want error")
+	}
+}
+
+func TestMovieVisibility(t *testing.T) {
+	r := newRoom(&model.Room{CreatorID: "host"})
+	public := &model.Movie{ID: "a", CreatorID: "host"}
+	staged := &model.Movie{ID: "b", CreatorID: "host", Visibility: model.MovieVisibilityCreator}
+	own := &model.Movie{ID: "c", CreatorID: "member", Visibility: model.MovieVisibilityCreator}
+
+	host := &User{User: model.User{ID: "host"}}
+	member := &User{User: model.User{ID: "member"}}
+	for _, tc := range []struct {
+		u    *User
+		m    *model.Movie
+		want bool
+	}{
+		{host, staged, true},
+		{member, public, true},
+		{member, staged, false},
+		{member, own, true},
+	} {
+		if got := tc.u.CanSeeMovie(r, tc.m); got != tc.want {
+			t.Fatalf("CanSeeMovie(%s, %s) = %v, want %v", tc.u.ID, tc.m.ID, got, tc.want)
+		}
+	}
+
+	m := newTestMovies(public, staged, own)
+	if id := nextMovieID(m, model.PlaylistSortManual, "a"); id != "" {
+		t.Fatalf("Next(a) = %q, want staged movies skipped", id)
+	}
+	if id := nextMovieID(m, model.PlaylistSortManual, ""); id != "a" {
+		t.Fatalf("Next() = %q, want a", id)
+	}
+}
+
+func TestWithMetadataFetcher(t *testing.T) {
+	r, u := newAuditRoom(t)
+	WithMetadataFetcher(func(ctx context.Context, m *model.Movie) error {
+		m.Base.Name = "fetched"
+		m.Base.Duration = 60
+		return nil
+	})(r)
+	if err := u.AddMovieToRoom(r, &model.BaseMovie{Name: "a", Url: "https://example.com/a.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	id := r.movies.IDs()[0]
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m, err := r.GetMovieByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the fetch stores the metadata under the movies lock
+		r.movies.lock.RLock()
+		meta := metadataOf(&m.Movie.Base)
+		r.movies.lock.RUnlock()
+		if meta.Name == "fetched" && meta.Duration == 60 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metadata = %+v, want the fetched metadata", meta)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,12 +1,27 @@
 package op
 
 import (
+	"context"
 	"time"
 
+	"github.com/synctv-org/synctv/internal/model"
 	"github.com/zijiren233/gencontainer/synccache"
 )
 
-func Init(size int) error {
+// MovieURLRewriter returns the url clients receive for a movie,
+// e.g. to sign urls per request or to point them at a CDN
+type MovieURLRewriter func(movie *model.Movie) string
+
+// MetadataFetcher fills in the metadata of a newly added movie,
+// e.g. by probing its url, only Name, Duration and Poster are kept
+type MetadataFetcher func(ctx context.Context, movie *model.Movie) error
+
+type InitConfig func()
+
+func Init(size int, conf ...InitConfig) error {
+	for _, c := range conf {
+		c()
+	}
 	roomCache = synccache.NewSyncCache[string, *Room](time.Minute*5, synccache.WithDeletedCallback[string, *Room](func(v *Room) {
 		v.close()
 	}))
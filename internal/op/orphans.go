@@ -0,0 +1,79 @@
+package op
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	rtmps "github.com/zijiren233/livelib/server"
+)
+
+const (
+	// orphanReapInterval is how often channels that failed to close are retried
+	orphanReapInterval = 30 * time.Second
+	// orphanMaxAttempts is how often a channel is retried before it is given up
+	orphanMaxAttempts = 10
+)
+
+type orphan struct {
+	c        io.Closer
+	roomID   string
+	attempts int
+}
+
+// orphans tracks live channels of removed movies that failed to close,
+// they are no longer reachable through the movie list
+type orphans struct {
+	lock sync.Mutex
+	list []orphan
+	reap *time.Timer
+}
+
+func (o *orphans) add(roomID string, c io.Closer) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.list = append(o.list, orphan{c: c, roomID: roomID, attempts: 1})
+	o.schedule()
+}
+
+// schedule must be called with the lock held
+func (o *orphans) schedule() {
+	if o.reap == nil && len(o.list) > 0 {
+		o.reap = time.AfterFunc(orphanReapInterval, o.reapOnce)
+	}
+}
+
+func (o *orphans) reapOnce() {
+	o.lock.Lock()
+	list := o.list
+	o.list = nil
+	o.reap = nil
+	o.lock.Unlock()
+
+	var retry []orphan
+	for _, v := range list {
+		err := v.c.Close()
+		if err == nil || errors.Is(err, rtmps.ErrClosed) {
+			continue
+		}
+		v.attempts++
+		if v.attempts >= orphanMaxAttempts {
+			log.Errorf("room %s: give up closing channel after %d attempts: %v", v.roomID, v.attempts, err)
+			continue
+		}
+		retry = append(retry, v)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.list = append(o.list, retry...)
+	o.schedule()
+}
+
+func (o *orphans) Len() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.list)
+}
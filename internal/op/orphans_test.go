@@ -0,0 +1,76 @@
+package op
+
+import (
+	"errors"
+	"testing"
+
+	rtmps "github.com/zijiren233/livelib/server"
+)
+
+type flakyCloser struct {
+	fails int
+	calls int
+}
+
+func (c *flakyCloser) Close() error {
+	c.calls++
+	if c.calls <= c.fails {
+		return errors.New("busy")
+	}
+	return nil
+}
+
+type closedCloser struct{}
+
+func (closedCloser) Close() error {
+	return rtmps.ErrClosed
+}
+
+func TestOrphansReap(t *testing.T) {
+	var o orphans
+	flaky := &flakyCloser{fails: 1}
+	o.add("room", flaky)
+	o.add("room", closedCloser{})
+	o.add("room", &flakyCloser{fails: orphanMaxAttempts})
+	o.reap.Stop()
+
+	o.reapOnce()
+	if n := o.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	o.reapOnce()
+	if n := o.Len(); n != 1 {
+		t.Fatalf("Len() = %d, want 1", n)
+	}
+	if flaky.calls != 2 {
+		t.Fatalf("calls = %d, want 2", flaky.calls)
+	}
+	for i := 0; i < orphanMaxAttempts; i++ {
+		o.reapOnce()
+	}
+	if n := o.Len(); n != 0 {
+		t.Fatalf("Len() = %d, want 0 after giving up", n)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.reap != nil {
+		t.Fatal("reaper is still scheduled")
+	}
+}
+
+func TestErrDeleteMovies(t *testing.T) {
+	err := error(&ErrDeleteMovies{
+		Deleted: []string{"a"},
+		Failed: map[string]error{
+			"c": &ErrMovieNotFound{ID: "c"},
+			"b": &ErrMovieNotFound{ID: "b"},
+		},
+	})
+	if want := "failed to delete movies: b: movie b not found; c: movie c not found"; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+	var nf *ErrMovieNotFound
+	if !errors.As(err, &nf) {
+		t.Fatal("errors.As(*ErrMovieNotFound) = false")
+	}
+}
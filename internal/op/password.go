@@ -0,0 +1,92 @@
+package op
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxPasswordAttempts is how many wrong room passwords a user may send per window
+	maxPasswordAttempts   = 5
+	passwordAttemptWindow = time.Minute
+)
+
+var (
+	ErrWrongPassword           = errors.New("wrong password")
+	ErrTooManyPasswordAttempts = errors.New("too many wrong passwords, try again later")
+)
+
+type passwordAttempt struct {
+	count int
+	since time.Time
+}
+
+// passwordAttempts counts wrong room passwords per user
+type passwordAttempts struct {
+	lock sync.Mutex
+	m    map[string]*passwordAttempt
+}
+
+// allow reports whether the user may try another password
+func (p *passwordAttempts) allow(userID string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	a, ok := p.m[userID]
+	if !ok {
+		return true
+	}
+	if time.Since(a.since) >= passwordAttemptWindow {
+		delete(p.m, userID)
+		return true
+	}
+	return a.count < maxPasswordAttempts
+}
+
+func (p *passwordAttempts) fail(userID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.m == nil {
+		p.m = make(map[string]*passwordAttempt)
+	}
+	a, ok := p.m[userID]
+	if !ok || time.Since(a.since) >= passwordAttemptWindow {
+		a = &passwordAttempt{since: time.Now()}
+		p.m[userID] = a
+	}
+	a.count++
+}
+
+func (p *passwordAttempts) reset(userID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.m, userID)
+}
+
+// CheckPasswordOf verifies the room password of the user, the creator needs none,
+// wrong passwords are limited per user like RegClientWithPassword
+func (r *Room) CheckPasswordOf(userID, password string) error {
+	if r.CreatedBy() == userID {
+		return nil
+	}
+	if !r.passwordAttempts.allow(userID) {
+		return ErrTooManyPasswordAttempts
+	}
+	if !r.CheckPassword(password) {
+		r.passwordAttempts.fail(userID)
+		return ErrWrongPassword
+	}
+	r.passwordAttempts.reset(userID)
+	return nil
+}
+
+// RegClientWithPassword registers a client of the user only if the password
+// is right, wrong passwords are limited per user
+func (r *Room) RegClientWithPassword(user *User, conn *websocket.Conn, password string) (*Client, error) {
+	if err := r.CheckPasswordOf(user.ID, password); err != nil {
+		return nil, err
+	}
+	return r.NewClient(user, conn)
+}
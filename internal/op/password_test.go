@@ -0,0 +1,87 @@
+package op
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegClientWithPassword(t *testing.T) {
+	// the creator joining is recorded for takeovers
+	useTestDB(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("pwd"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRoom(&model.Room{CreatorID: "host"})
+	r.HashedPassword = hash
+	defer r.close()
+	var (
+		member = &User{User: model.User{ID: "member"}}
+		host   = &User{User: model.User{ID: "host"}}
+	)
+	if _, err := r.RegClientWithPassword(host, nil, ""); err != nil {
+		t.Fatalf("RegClientWithPassword() by creator = %v, want nil", err)
+	}
+	for i := 0; i < maxPasswordAttempts; i++ {
+		if _, err := r.RegClientWithPassword(member, nil, "wrong"); err != ErrWrongPassword {
+			t.Fatalf("RegClientWithPassword() = %v, want %v", err, ErrWrongPassword)
+		}
+	}
+	if _, err := r.RegClientWithPassword(member, nil, "pwd"); err != ErrTooManyPasswordAttempts {
+		t.Fatalf("RegClientWithPassword() = %v, want %v", err, ErrTooManyPasswordAttempts)
+	}
+	if r.UserOnline(member.ID) {
+		t.Fatal("client registered without the password")
+	}
+	r.passwordAttempts.reset(member.ID)
+	if _, err := r.RegClientWithPassword(member, nil, "pwd"); err != nil {
+		t.Fatalf("RegClientWithPassword() = %v, want nil", err)
+	}
+	if !r.UserOnline(member.ID) {
+		t.Fatal("client not registered")
+	}
+}
+
+func TestPasswordTooLong(t *testing.T) {
+	long := strings.Repeat("a", model.MaxPasswordLength+1)
+	r := newRoom(&model.Room{})
+	if err := r.SetPassword(long); err != model.ErrPasswordTooLong {
+		t.Fatalf("Room.SetPassword() = %v, want %v", err, model.ErrPasswordTooLong)
+	}
+	u := &User{}
+	if err := u.SetPassword(long); err != model.ErrPasswordTooLong {
+		t.Fatalf("User.SetPassword() = %v, want %v", err, model.ErrPasswordTooLong)
+	}
+	// passwords set before the limit was enforced were hashed truncated
+	// by bcrypt, they must keep working
+	hashed, err := bcrypt.GenerateFromPassword([]byte(long[:model.MaxPasswordLength]), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.HashedPassword = hashed
+	u.HashedPassword = hashed
+	if !r.CheckPassword(long) || !u.CheckPassword(long) {
+		t.Fatal("CheckPassword() = false for a password set before the limit")
+	}
+}
+
+func TestConstantTimeAuth(t *testing.T) {
+	plain := newRoom(&model.Room{})
+	constant := newRoom(&model.Room{}, WithConstantTimeAuth(true))
+	if !plain.CheckPassword("x") || !constant.CheckPassword("x") {
+		t.Fatal("CheckPassword() = false for a room without password")
+	}
+	// the dummy hash is generated on first use
+	start := time.Now()
+	constant.CheckPassword("x")
+	if d := time.Since(start); d < time.Millisecond {
+		t.Fatalf("CheckPassword() with constant time auth took %v, want a bcrypt compare", d)
+	}
+	if plain.constantTimeAuth {
+		t.Fatal("constant time auth leaked to another room")
+	}
+}
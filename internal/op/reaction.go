@@ -0,0 +1,102 @@
+package op
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/settings"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+const (
+	// reactionWindow is how long reactions are collected before one REACTIONS broadcast
+	reactionWindow = time.Second
+	// maxUserReactions is how many reactions a user may send per window
+	maxUserReactions    = 5
+	maxAllowedReactions = 32
+	maxReactionLen      = 32
+)
+
+// defaultReactions is used when the room did not configure its own set
+var defaultReactions = []string{"🔥", "😂", "👍", "❤️", "😮", "👏"}
+
+var (
+	ErrReactionsDisabled  = errors.New("reactions are disabled")
+	ErrReactionNotAllowed = errors.New("reaction not allowed")
+	ErrTooManyReactions   = errors.New("too many reactions")
+)
+
+// reactions aggregates reactions over reactionWindow so hype moments cost
+// one broadcast per window instead of one per reaction
+type reactions struct {
+	lock   sync.Mutex
+	counts map[string]int64
+	// users counts the reactions of every user in the current window
+	users map[string]int
+	flush *time.Timer
+}
+
+func (r *Room) allowedReactions() []string {
+	if len(r.Settings.AllowedReactions) == 0 {
+		return defaultReactions
+	}
+	return r.Settings.AllowedReactions
+}
+
+// React counts the reaction of the user towards the next REACTIONS broadcast,
+// reactions can be turned off server wide and by the room settings
+func (r *Room) React(user *User, emoji string) error {
+	if !settings.EnableReactions.Get() || r.Settings.DisableReactions {
+		return ErrReactionsDisabled
+	}
+	if !slices.Contains(r.allowedReactions(), emoji) {
+		return ErrReactionNotAllowed
+	}
+	rs := &r.reactions
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.users[user.ID] >= maxUserReactions {
+		return ErrTooManyReactions
+	}
+	if rs.counts == nil {
+		rs.counts = make(map[string]int64)
+		rs.users = make(map[string]int)
+	}
+	rs.users[user.ID]++
+	rs.counts[emoji]++
+	if rs.flush == nil {
+		rs.flush = time.AfterFunc(reactionWindow, r.flushReactions)
+	}
+	return nil
+}
+
+// take returns the counts of the window and starts a new one
+func (rs *reactions) take() []*pb.ReactionCount {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.flush = nil
+	list := make([]*pb.ReactionCount, 0, len(rs.counts))
+	for emoji, count := range rs.counts {
+		list = append(list, &pb.ReactionCount{Emoji: emoji, Count: count})
+	}
+	rs.counts = nil
+	rs.users = nil
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Emoji < list[j].Emoji
+	})
+	return list
+}
+
+func (r *Room) flushReactions() {
+	list := r.reactions.take()
+	if len(list) == 0 || r.Closed() {
+		return
+	}
+	_ = r.Broadcast(&ElementMessage{
+		Type:      pb.ElementMessageType_REACTIONS,
+		Reactions: list,
+	})
+}
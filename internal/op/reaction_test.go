@@ -0,0 +1,49 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestReactionsAggregate(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.Settings.AllowedReactions = []string{"🔥", "😂"}
+	var (
+		a = &User{User: model.User{ID: "a"}}
+		b = &User{User: model.User{ID: "b"}}
+	)
+	for i := 0; i < maxUserReactions; i++ {
+		if err := r.React(a, "🔥"); err != nil {
+			t.Fatalf("React() = %v, want nil", err)
+		}
+	}
+	if err := r.React(a, "😂"); err != ErrTooManyReactions {
+		t.Fatalf("React() = %v, want %v", err, ErrTooManyReactions)
+	}
+	if err := r.React(b, "👍"); err != ErrReactionNotAllowed {
+		t.Fatalf("React() = %v, want %v", err, ErrReactionNotAllowed)
+	}
+	if err := r.React(b, "😂"); err != nil {
+		t.Fatalf("React() = %v, want nil", err)
+	}
+
+	list := r.reactions.take()
+	if len(list) != 2 || list[0].Emoji != "🔥" || list[0].Count != 5 || list[1].Emoji != "😂" || list[1].Count != 1 {
+		t.Fatalf("take() = %v", list)
+	}
+	if err := r.React(a, "🔥"); err != nil {
+		t.Fatalf("React() in a new window = %v, want nil", err)
+	}
+}
+
+func TestReactionsDisabledByRoom(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.Settings.DisableReactions = true
+	if err := r.React(&User{User: model.User{ID: "a"}}, "🔥"); err != ErrReactionsDisabled {
+		t.Fatalf("React() = %v, want %v", err, ErrReactionsDisabled)
+	}
+	if list := r.reactions.take(); len(list) != 0 {
+		t.Fatalf("a disabled reaction was counted: %v", list)
+	}
+}
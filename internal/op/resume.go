@@ -0,0 +1,75 @@
+package op
+
+import (
+	"sync"
+)
+
+const (
+	// maxMoviePositions bounds how many movie positions a room remembers
+	maxMoviePositions = 1024
+	// resumeEndMargin is how many seconds before its end a movie counts as finished
+	resumeEndMargin = 5
+)
+
+// moviePositions remembers where the movies of a room were switched away
+// from, see SetCurrentMovieResume
+type moviePositions struct {
+	lock sync.Mutex
+	m    map[string]float64
+}
+
+// save stores the position of the movie that was playing, finished and
+// live movies and movies that were not started are forgotten
+func (p *moviePositions) save(prev Current) {
+	m := prev.Movie
+	if m.ID == "" {
+		return
+	}
+	seek := prev.Status.Seek
+	if m.Base.Live || seek <= 0 ||
+		m.Base.Duration > 0 && seek >= m.Base.Duration-resumeEndMargin {
+		p.forget(m.ID)
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.m == nil {
+		p.m = make(map[string]float64)
+	}
+	if _, ok := p.m[m.ID]; !ok && len(p.m) >= maxMoviePositions {
+		for id := range p.m {
+			delete(p.m, id)
+			break
+		}
+	}
+	p.m[m.ID] = seek
+}
+
+func (p *moviePositions) load(id string) float64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.m[id]
+}
+
+func (p *moviePositions) forget(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.m, id)
+}
+
+// MoviePosition returns where the movie was left when it was switched away
+// from, 0 if it was finished or never played
+func (r *Room) MoviePosition(id string) float64 {
+	return r.positions.load(id)
+}
+
+// SetCurrentMovieResume plays the movie from where it was left,
+// see SetCurrentMovieByID
+func (r *Room) SetCurrentMovieResume(id string, play bool) error {
+	m, err := r.movies.GetMovieByID(id)
+	if err != nil {
+		return err
+	}
+	r.setCurrentMovieAt(&m.Movie, play, r.positions.load(id), nil)
+	return nil
+}
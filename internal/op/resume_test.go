@@ -0,0 +1,53 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestSetCurrentMovieResume(t *testing.T) {
+	r := newRoom(&model.Room{})
+	a := &model.Movie{ID: "a", Base: model.BaseMovie{Duration: 100}}
+	b := &model.Movie{ID: "b", Base: model.BaseMovie{Duration: 100}}
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{a, b})
+	})
+	r.SetCurrentMovie(a, false)
+	r.current.SetSeek(40, 0)
+	r.SetCurrentMovie(b, false)
+	if p := r.MoviePosition("a"); p != 40 {
+		t.Fatalf("MoviePosition(a) = %v, want 40", p)
+	}
+
+	if err := r.SetCurrentMovieResume("a", false); err != nil {
+		t.Fatalf("SetCurrentMovieResume() = %v", err)
+	}
+	if seek := r.current.Status().Seek; seek != 40 {
+		t.Fatalf("seek = %v, want 40", seek)
+	}
+	if p := r.MoviePosition("a"); p != 0 {
+		t.Fatalf("MoviePosition(a) of the current movie = %v, want 0", p)
+	}
+	// b was switched away from before it started
+	if p := r.MoviePosition("b"); p != 0 {
+		t.Fatalf("MoviePosition(b) = %v, want 0", p)
+	}
+
+	// a finished movie starts over
+	r.current.SetSeek(99, 0)
+	r.SetCurrentMovie(b, false)
+	if p := r.MoviePosition("a"); p != 0 {
+		t.Fatalf("MoviePosition(a) after it finished = %v, want 0", p)
+	}
+	if err := r.SetCurrentMovieResume("a", false); err != nil {
+		t.Fatalf("SetCurrentMovieResume() = %v", err)
+	}
+	if seek := r.current.Status().Seek; seek != 0 {
+		t.Fatalf("seek = %v, want 0", seek)
+	}
+
+	if err := r.SetCurrentMovieResume("c", false); err == nil {
+		t.Fatal("SetCurrentMovieResume() of a missing movie = nil")
+	}
+}
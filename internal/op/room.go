@@ -1,52 +1,256 @@
 package op
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"hash/crc32"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
 	"github.com/synctv-org/synctv/utils"
 	rtmps "github.com/zijiren233/livelib/server"
 	"github.com/zijiren233/stream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Room struct {
 	model.Room
-	version  uint32
-	current  *current
-	initOnce utils.Once
-	hub      *Hub
-	movies   movies
+	version uint32
+	current *current
+	// startOnce starts the background loops once the first client registered
+	startOnce utils.Once
+	hub       *Hub
+	movies    movies
+	closed    uint32
+	// playbackLocked freezes the playback controls of regular members
+	playbackLocked uint32
+	// autoAdvance plays the next movie once the current one ended
+	autoAdvance     uint32
+	autoAdvanceLock sync.Mutex
+	autoAdvanceStop chan struct{}
+
+	buffering buffering
+	whispers  whispers
+	webhooks  webhooks
+	reactions reactions
+	// activities is the feed of what happened in the room, see ActivityLog
+	activities activityLog
+	// chatRecorded counts the chat messages kept, see RecordChat
+	chatRecorded atomic.Uint64
+	// positions are where the movies switched away from were left
+	positions moviePositions
+
+	passwordAttempts passwordAttempts
+	// creator is the id of the room creator, it changes when the room is
+	// taken over, see CreatedBy
+	creator atomic.Pointer[string]
+	// creatorLastSeen is the unix milli time the creator was last known
+	// online, it is kept in CreatorLastSeenAt across loads of the room
+	creatorLastSeen atomic.Int64
+	// creatorLock serializes takeovers and reclaims
+	creatorLock sync.Mutex
+	// vendorBackends is Settings.VendorBackends for the movie caches, which
+	// resolve backends outside of the handlers that change the settings
+	vendorBackends atomic.Pointer[map[string]string]
+	// tracer traces the room operations, see WithTracer
+	tracer trace.Tracer
+	// movieURLRewriter rewrites the movie urls sent to clients, see
+	// WithMovieURLRewriter
+	movieURLRewriter MovieURLRewriter
+	// metadataFetcher fills in the metadata of added movies, see
+	// WithMetadataFetcher
+	metadataFetcher MetadataFetcher
+	// allowedRates are the rates of the room when its settings allow any,
+	// see WithAllowedRates
+	allowedRates []float64
+	// constantTimeAuth compares a dummy hash when the room has no password,
+	// see WithConstantTimeAuth
+	constantTimeAuth bool
+
+	// stateVersion counts the changes of the settings, the movies and the
+	// current movie, version only changes with the password as it is part
+	// of the room tokens
+	stateVersion atomic.Uint32
+	// versionBroadcast broadcasts stateVersion as CHANGE_VERSION, see WithVersionBroadcast
+	versionBroadcast   bool
+	versionNotifyLock  sync.Mutex
+	versionNotifyTimer *time.Timer
+
+	// lastActive and lastRead are unix milli times, see touch and markRead
+	lastActive atomic.Int64
+	lastRead   atomic.Int64
+
+	// totalWatchMs is the finished playback time, playingSince is the
+	// unix milli time the playback in progress started, see TotalWatchTime
+	totalWatchMs atomic.Int64
+	playingSince atomic.Int64
+}
+
+// SystemSender is the sender of playback changes the server made on its own,
+// like auto-advance and buffering assist
+const SystemSender = "system"
+
+// versionNotifyDelay debounces version change broadcasts
+const versionNotifyDelay = 500 * time.Millisecond
+
+// roomInitHooks run once a room is started, see WithRoomInitHook
+var roomInitHooks []func(r *Room)
+
+// WithRoomInitHook runs fn when a room is started, before it serves its
+// first client, hooks run in registration order
+func WithRoomInitHook(fn func(r *Room)) InitConfig {
+	return func() {
+		roomInitHooks = append(roomInitHooks, fn)
+	}
+}
+
+// RoomConf configures a room when it is loaded, it may look at the room
+// to set up rooms differently, see WithRoomConf
+type RoomConf func(r *Room)
+
+// roomConfs are applied to every room when it is loaded
+var roomConfs []RoomConf
+
+// WithRoomConf applies conf to every room when it is loaded, before the
+// room is started, confs are applied in registration order
+func WithRoomConf(conf ...RoomConf) InitConfig {
+	return func() {
+		roomConfs = append(roomConfs, conf...)
+	}
+}
+
+// newRoom returns a room every method can be called on at once, the
+// background loops only run once the room is started by its first client,
+// so a room dropped by a racing load leaks nothing
+func newRoom(room *model.Room, conf ...RoomConf) *Room {
+	r := &Room{
+		Room:    *room,
+		version: crc32.ChecksumIEEE(room.HashedPassword),
+		current: newCurrent(),
+		hub:     newHub(room.ID),
+		movies: movies{
+			roomID: room.ID,
+		},
+		activities: activityLog{
+			size: defaultActivityLogSize,
+		},
+	}
+	creator := room.CreatorID
+	r.creator.Store(&creator)
+	r.creatorLastSeen.Store(initialCreatorLastSeen(room))
+	r.storeVendorBackends(room.Settings.VendorBackends)
+	// connected clients keep the room loaded even if they are idle
+	r.hub.keepAlive = r.touch
+	for _, c := range roomConfs {
+		c(r)
+	}
+	for _, c := range conf {
+		c(r)
+	}
+	return r
 }
 
-func (r *Room) lazyInitHub() {
-	r.initOnce.Do(func() {
-		r.hub = newHub(r.ID)
+// start runs the background loops of the room and the init hooks,
+// later calls do nothing
+func (r *Room) start() {
+	// started is only set for the call that ran the start, so hooks that
+	// use the room again can not run the hooks a second time
+	var started bool
+	r.startOnce.Do(func() {
+		go r.chapterSkipLoop(r.hub.exit)
+		started = true
 	})
+	if started {
+		for _, hook := range roomInitHooks {
+			hook(r)
+		}
+	}
 }
 
 func (r *Room) PeopleNum() int64 {
-	if r.hub == nil {
-		return 0
-	}
 	return r.hub.PeopleNum()
 }
 
-func (r *Room) Broadcast(data Message, conf ...BroadcastConf) error {
-	if r.hub == nil {
+func (r *Room) Broadcast(data Message, conf ...BroadcastConf) (err error) {
+	_, span := r.startSpan(context.Background(), "Broadcast")
+	defer func() { endSpan(span, err) }()
+	// a room that was never started has no clients and nothing serving
+	// the queue of its hub
+	if !r.startOnce.Did() {
 		return nil
 	}
 	return r.hub.Broadcast(data, conf...)
 }
 
-func (r *Room) SendToUser(user *User, data Message) error {
-	if r.hub == nil {
+// BroadcastContext is Broadcast bounded by ctx, see Hub.BroadcastContext
+func (r *Room) BroadcastContext(ctx context.Context, data Message, conf ...BroadcastConf) (err error) {
+	ctx, span := r.startSpan(ctx, "Broadcast")
+	defer func() { endSpan(span, err) }()
+	if !r.startOnce.Did() {
 		return nil
 	}
+	return r.hub.BroadcastContext(ctx, data, conf...)
+}
+
+// BroadcastLatency returns how long the broadcasts of the room took, see Hub.BroadcastLatency
+func (r *Room) BroadcastLatency() BroadcastLatency {
+	return r.hub.BroadcastLatency()
+}
+
+// TotalBroadcasts returns the number of messages broadcast to the room
+func (r *Room) TotalBroadcasts() int64 {
+	return r.hub.MessageCount()
+}
+
+// BroadcastToUser sends data to all connections of the user,
+// it returns *ErrUserNotFound if the user is not connected
+func (r *Room) BroadcastToUser(userID string, data Message) error {
+	if _, ok := r.hub.clients.Load(userID); !ok {
+		return &ErrUserNotFound{Name: userID}
+	}
+	return r.hub.SendToUser(userID, data)
+}
+
+// UnicastByClientID sends data to a single connection, see Client.ID
+func (r *Room) UnicastByClientID(clientID string, data Message) error {
+	return r.hub.Unicast(clientID, data)
+}
+
+// CloseUser disconnects all connections of the user from the room
+func (r *Room) CloseUser(userID string, code int, reason string) error {
+	return r.hub.CloseUser(userID, code, reason)
+}
+
+// KickUser disconnects the user from the room with CloseCodeKicked,
+// an empty reason uses CloseReasonKicked
+func (r *Room) KickUser(userID, reason string) error {
+	if _, ok := r.hub.clients.Load(userID); !ok {
+		return ErrUserNotConnected
+	}
+	if reason == "" {
+		reason = CloseReasonKicked
+	}
+	return r.hub.CloseUser(userID, CloseCodeKicked, reason)
+}
+
+func (r *Room) ActiveClients() []*Client {
+	return r.hub.ActiveClients()
+}
+
+func (r *Room) SendToUser(user *User, data Message) error {
 	return r.hub.SendToUser(user.ID, data)
 }
 
@@ -54,11 +258,32 @@ func (r *Room) GetChannel(channelName string) (*rtmps.Channel, error) {
 	return r.movies.GetChannel(channelName)
 }
 
-func (r *Room) close() {
-	if r.initOnce.Done() {
-		r.hub.Close()
-		r.movies.Close()
+// close stops the room, closing a closed room does nothing
+func (r *Room) close() error {
+	if !atomic.CompareAndSwapUint32(&r.closed, 0, 1) {
+		return nil
 	}
+	r.dispatchWebhook(model.WebhookEventRoomClosing, nil)
+	errs := []error{r.hub.Close(), r.movies.Close()}
+	r.webhooks.close()
+	return errors.Join(errs...)
+}
+
+// Wait blocks until the hub of the room stopped serving, which is once the
+// room is closed, it returns at once if the hub was never started
+func (r *Room) Wait() {
+	if r.startOnce.Did() {
+		r.hub.Wait()
+	}
+}
+
+// Rename changes the id of the room, see RenameRoom, the room is closed afterwards
+func (r *Room) Rename(newID string) error {
+	return RenameRoom(r.ID, newID)
+}
+
+func (r *Room) Closed() bool {
+	return atomic.LoadUint32(&r.closed) == 1
 }
 
 func (r *Room) Version() uint32 {
@@ -69,24 +294,144 @@ func (r *Room) CheckVersion(version uint32) bool {
 	return atomic.LoadUint32(&r.version) == version
 }
 
+func (r *Room) updateVersion(version uint32) {
+	if atomic.SwapUint32(&r.version, version) != version {
+		r.changed()
+	}
+}
+
+// StateVersion changes whenever the settings, the movies or the current
+// movie of the room change, clients compare it to decide whether to resync
+func (r *Room) StateVersion() uint32 {
+	return r.stateVersion.Load()
+}
+
+// WithVersionBroadcast broadcasts the state version of the room as
+// CHANGE_VERSION once its changes settle
+func WithVersionBroadcast(enabled bool) RoomConf {
+	return func(r *Room) {
+		r.versionBroadcast = enabled
+	}
+}
+
+// changed bumps the state version and notifies the clients of it
+func (r *Room) changed() {
+	r.stateVersion.Add(1)
+	r.notifyVersion()
+}
+
+// notifyVersion broadcasts the latest state version once changes settle
+func (r *Room) notifyVersion() {
+	if !r.versionBroadcast {
+		return
+	}
+	r.versionNotifyLock.Lock()
+	defer r.versionNotifyLock.Unlock()
+	if r.versionNotifyTimer != nil {
+		r.versionNotifyTimer.Reset(versionNotifyDelay)
+		return
+	}
+	r.versionNotifyTimer = time.AfterFunc(versionNotifyDelay, func() {
+		r.versionNotifyLock.Lock()
+		r.versionNotifyTimer = nil
+		r.versionNotifyLock.Unlock()
+		if r.Closed() {
+			return
+		}
+		_ = r.Broadcast(&ElementMessage{
+			Type:    pb.ElementMessageType_CHANGE_VERSION,
+			Version: r.StateVersion(),
+		})
+	})
+}
+
 func (r *Room) UpdateMovie(movieId string, movie *model.BaseMovie) error {
-	return r.movies.Update(movieId, movie)
+	return r.updateMovie(movieId, movie, "")
+}
+
+// updateMovie is UpdateMovie recorded in the movie history as made by
+// userID, empty for the server, so are deleteMovieByID and clearMovies
+func (r *Room) updateMovie(movieId string, movie *model.BaseMovie, userID string) error {
+	r.touch()
+	if err := r.movies.Update(movieId, movie); err != nil {
+		return err
+	}
+	r.updateCurrentChapters(movieId, movie.Chapters)
+	r.changed()
+	r.auditMovies(userID, model.MovieAuditEdited, movieId)
+	return nil
 }
 
 func (r *Room) AddMovie(m *model.Movie) error {
+	return r.AddMovieContext(context.Background(), m)
+}
+
+// AddMovieContext is AddMovie traced as a child of the span in ctx
+func (r *Room) AddMovieContext(ctx context.Context, m *model.Movie) (err error) {
+	r.touch()
+	_, span := r.startSpan(ctx, "AddMovie", attribute.String("user.id", m.CreatorID))
+	defer func() { endSpan(span, err) }()
 	m.RoomID = r.ID
-	return r.movies.AddMovie(m)
+	r.applyDefaultMovieHeaders(m)
+	if err := r.checkMovieDuration(m); err != nil {
+		return err
+	}
+	if err := r.movies.AddMovie(m); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("movie.id", m.ID))
+	r.changed()
+	r.movieAdded(m)
+	r.auditMovies(m.CreatorID, model.MovieAuditAdded, m.ID)
+	return nil
+}
+
+// AddMovieWithID adds the movie under a given id, e.g. to restore a playlist
+// with stable ids, it fails with ErrMovieIDExists if the id is taken
+func (r *Room) AddMovieWithID(m *model.Movie, id string) error {
+	if !validMovieID(id) {
+		return ErrInvalidMovieID
+	}
+	m.ID = id
+	return r.AddMovie(m)
 }
 
 func (r *Room) AddMovies(movies []*model.Movie) error {
+	r.touch()
 	for _, m := range movies {
 		m.RoomID = r.ID
+		r.applyDefaultMovieHeaders(m)
+		if err := r.checkMovieDuration(m); err != nil {
+			return err
+		}
+	}
+	if err := r.movies.AddMovies(movies); err != nil {
+		return err
+	}
+	r.changed()
+	audits := make([]*model.MovieAudit, len(movies))
+	for i, m := range movies {
+		r.movieAdded(m)
+		audits[i] = &model.MovieAudit{RoomID: r.ID, MovieID: m.ID, UserID: m.CreatorID, Action: model.MovieAuditAdded}
 	}
-	return r.movies.AddMovies(movies)
+	r.audit(audits)
+	return nil
+}
+
+// movieAdded notifies webhooks and starts the metadata fetch of a new movie
+func (r *Room) movieAdded(m *model.Movie) {
+	r.dispatchWebhook(model.WebhookEventMovieAdded, &WebhookMovieData{
+		MovieID: m.ID,
+		Name:    m.Base.Name,
+	})
+	a := Activity{Type: ActivityMovieAdded, UserID: m.CreatorID}
+	a.setMovie(m)
+	r.logActivity(a)
+	r.fetchMetadata(m)
 }
 
 func (r *Room) HasPermission(userID string, permission model.RoomUserPermission) bool {
-	if r.CreatorID == userID {
+	if r.CreatedBy() == userID {
 		return true
 	}
 
@@ -98,7 +443,8 @@ func (r *Room) HasPermission(userID string, permission model.RoomUserPermission)
 	return rur.HasPermission(permission)
 }
 
-func (r *Room) LoadOrCreateRoomUserRelation(userID string) (*model.RoomUserRelation, error) {
+// newRelationConf returns the status and permissions new members of the room get
+func (r *Room) newRelationConf() []db.CreateRoomUserRelationConfig {
 	var conf []db.CreateRoomUserRelationConfig
 	if r.Settings.JoinNeedReview {
 		conf = []db.CreateRoomUserRelationConfig{db.WithRoomUserRelationStatus(model.RoomUserStatusPending)}
@@ -108,11 +454,62 @@ func (r *Room) LoadOrCreateRoomUserRelation(userID string) (*model.RoomUserRelat
 	if r.Settings.UserDefaultPermissions != 0 {
 		conf = append(conf, db.WithRoomUserRelationPermissions(r.Settings.UserDefaultPermissions))
 	}
-	return db.FirstOrCreateRoomUserRelation(r.ID, userID, conf...)
+	return conf
+}
+
+func (r *Room) LoadOrCreateRoomUserRelation(userID string) (*model.RoomUserRelation, error) {
+	return db.FirstOrCreateRoomUserRelation(r.ID, userID, r.newRelationConf()...)
+}
+
+// ErrDuplicateRoomUsers lists the users of a batch that were already members
+// of the room or appeared more than once
+type ErrDuplicateRoomUsers struct {
+	Names []string
+}
+
+func (e *ErrDuplicateRoomUsers) Error() string {
+	return fmt.Sprintf("duplicate room users: %s", strings.Join(e.Names, ", "))
+}
+
+// splitUserBatch returns the ids of the users to add, users given more than
+// once are only added the first time and their names returned as duplicates
+func splitUserBatch(users []*User) (ids []string, names map[string]string, dups []string) {
+	names = make(map[string]string, len(users))
+	for _, u := range users {
+		if _, ok := names[u.ID]; ok {
+			dups = append(dups, u.Username)
+			continue
+		}
+		names[u.ID] = u.Username
+		ids = append(ids, u.ID)
+	}
+	return ids, names, dups
+}
+
+// AddUserBatch makes the users members of the room in a single transaction
+// with the status and permissions of LoadOrCreateRoomUserRelation, it returns
+// how many were added and *ErrDuplicateRoomUsers naming the users that were
+// members already
+func (r *Room) AddUserBatch(users []*User) (int, error) {
+	if len(users) == 0 {
+		return 0, nil
+	}
+	ids, names, dups := splitUserBatch(users)
+	existing, err := db.CreateRoomUserRelations(r.ID, ids, r.newRelationConf()...)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range existing {
+		dups = append(dups, names[id])
+	}
+	if len(dups) != 0 {
+		return len(ids) - len(existing), &ErrDuplicateRoomUsers{Names: dups}
+	}
+	return len(ids), nil
 }
 
 func (r *Room) GetRoomUserRelation(userID string) (model.RoomUserPermission, error) {
-	if r.CreatorID == userID {
+	if r.CreatedBy() == userID {
 		return model.PermissionAll, nil
 	}
 	ur, err := db.GetRoomUserRelation(r.ID, userID)
@@ -126,7 +523,71 @@ func (r *Room) NeedPassword() bool {
 	return len(r.HashedPassword) != 0
 }
 
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte(utils.SortUUID()), bcrypt.DefaultCost)
+	return h
+})
+
+// WithConstantTimeAuth makes password checks of a room without password
+// compare a dummy hash, so timing does not tell rooms with and without
+// password apart
+func WithConstantTimeAuth(enabled bool) RoomConf {
+	return func(r *Room) {
+		r.constantTimeAuth = enabled
+	}
+}
+
+func (r *Room) CheckPassword(password string) bool {
+	if !r.NeedPassword() {
+		if r.constantTimeAuth {
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), stream.StringToBytes(password))
+		}
+		return true
+	}
+	return r.Room.CheckPassword(password)
+}
+
+// AuthenticateToken returns the user if token is its current session token,
+// it lets clients reconnect to the room without the user password
+func (r *Room) AuthenticateToken(userID, token string) (*User, error) {
+	e, err := LoadOrInitUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	u := e.Value()
+	if !u.CheckSessionToken(token) {
+		return nil, ErrInvalidSessionToken
+	}
+	if u.IsBanned() {
+		return nil, errors.New("user banned")
+	}
+	if u.IsPending() {
+		return nil, errors.New("user is pending, need admin to approve")
+	}
+	if r.CreatedBy() == u.ID {
+		return u, nil
+	}
+	// the token does not replace the room password for users who never joined
+	rur, err := db.GetRoomUserRelation(r.ID, u.ID)
+	if err != nil {
+		if r.NeedPassword() {
+			return nil, errors.New("room password required")
+		}
+		return u, nil
+	}
+	if rur.Status == model.RoomUserStatusBanned {
+		return nil, errors.New("user banned from room")
+	}
+	return u, nil
+}
+
+// SetPassword returns model.ErrPasswordTooLong for passwords longer
+// than model.MaxPasswordLength, an empty password removes it
 func (r *Room) SetPassword(password string) error {
+	if err := model.CheckPasswordLength(password); err != nil {
+		return err
+	}
+	r.touch()
 	if r.CheckPassword(password) && r.NeedPassword() {
 		return errors.New("password is the same")
 	}
@@ -137,14 +598,29 @@ func (r *Room) SetPassword(password string) error {
 		if err != nil {
 			return err
 		}
-		atomic.StoreUint32(&r.version, crc32.ChecksumIEEE(hashedPassword))
+		r.updateVersion(crc32.ChecksumIEEE(hashedPassword))
 	}
 	r.HashedPassword = hashedPassword
-	return db.SetRoomHashedPassword(r.ID, hashedPassword)
+	if err := db.SetRoomHashedPassword(r.ID, hashedPassword); err != nil {
+		return err
+	}
+	if password != "" && r.hub != nil {
+		// members have to log in with the new password, the creator and admins do not
+		_ = r.hub.CloseClients(func(c *Client) bool {
+			return c.u.ID != r.CreatedBy() && !c.u.IsAdmin()
+		}, CloseCodePasswordChanged, CloseReasonRoomPassword)
+	}
+	return nil
 }
 
 func (r *Room) SetUserStatus(userID string, status model.RoomUserStatus) error {
-	return db.SetRoomUserStatus(r.ID, userID, status)
+	if err := db.SetRoomUserStatus(r.ID, userID, status); err != nil {
+		return err
+	}
+	if status == model.RoomUserStatusBanned {
+		_ = r.CloseUser(userID, CloseCodeBanned, CloseReasonBanned)
+	}
+	return nil
 }
 
 func (r *Room) SetUserPermission(userID string, permission model.RoomUserPermission) error {
@@ -163,23 +639,176 @@ func (r *Room) GetMoviesCount() int {
 	return r.movies.Len()
 }
 
+// IsEmpty reports whether the room has neither movies nor connected clients
+func (r *Room) IsEmpty() bool {
+	return r.PeopleNum() == 0 && r.GetMoviesCount() == 0
+}
+
 func (r *Room) DeleteMovieByID(id string) error {
-	return r.movies.DeleteMovieByID(id)
+	return r.deleteMovieByID(id, "")
+}
+
+func (r *Room) deleteMovieByID(id, userID string) error {
+	r.touch()
+	if err := r.movies.DeleteMovieByID(id); err != nil {
+		return err
+	}
+	r.changed()
+	r.auditMovies(userID, model.MovieAuditDeleted, id)
+	return nil
 }
 
 func (r *Room) ClearMovies() error {
-	return r.movies.Clear()
+	return r.clearMovies("")
+}
+
+func (r *Room) clearMovies(userID string) error {
+	r.touch()
+	ids := r.movies.IDs()
+	if err := r.movies.Clear(); err != nil {
+		return err
+	}
+	r.changed()
+	r.auditMovies(userID, model.MovieAuditDeleted, ids...)
+	return nil
+}
+
+// OrphanedChannels returns the number of channels of removed movies
+// that are waiting to be closed again
+func (r *Room) OrphanedChannels() int {
+	return r.movies.orphans.Len()
 }
 
 func (r *Room) GetMovieByID(id string) (*Movie, error) {
 	return r.movies.GetMovieByID(id)
 }
 
+// SetMovieCreator attributes a movie to another user,
+// it returns *ErrMovieNotFound or *ErrUserNotFound if either does not exist
+func (r *Room) SetMovieCreator(movieID, userID string) error {
+	if _, err := r.GetMovieByID(movieID); err != nil {
+		return err
+	}
+	if _, err := LoadOrInitUserByID(userID); err != nil {
+		return err
+	}
+	if err := r.movies.SetCreator(movieID, userID); err != nil {
+		return err
+	}
+	r.changed()
+	r.audit([]*model.MovieAudit{{RoomID: r.ID, MovieID: movieID, Action: model.MovieAuditCreatorChanged, Detail: userID}})
+	return nil
+}
+
+// CopyMovieTo adds a copy of the movie to the target room under a new id,
+// rtmp sources are bound to their room so a copy of one is no longer live,
+// errors of the target room validators are returned as is
+func (r *Room) CopyMovieTo(id string, target *Room) error {
+	m, err := r.GetMovieByID(id)
+	if err != nil {
+		return err
+	}
+	movie := &model.Movie{
+		CreatorID: m.Movie.CreatorID,
+		Base:      m.Movie.Base,
+	}
+	movie.Base.Headers = maps.Clone(m.Movie.Base.Headers)
+	movie.Base.Chapters = slices.Clone(m.Movie.Base.Chapters)
+	if m.Movie.Base.Subtitles != nil {
+		movie.Base.Subtitles = make(map[string]*model.Subtitle, len(m.Movie.Base.Subtitles))
+		for name, s := range m.Movie.Base.Subtitles {
+			sub := *s
+			movie.Base.Subtitles[name] = &sub
+		}
+	}
+	if movie.Base.RtmpSource {
+		movie.Base.RtmpSource = false
+		movie.Base.Live = false
+	}
+	return target.AddMovie(movie)
+}
+
+// PinMovie keeps the movie ahead of unpinned movies in listings and auto advance
+func (r *Room) PinMovie(id string) error {
+	return r.setPinned(id, true)
+}
+
+func (r *Room) UnpinMovie(id string) error {
+	return r.setPinned(id, false)
+}
+
+func (r *Room) setPinned(id string, pinned bool) error {
+	r.touch()
+	if err := r.movies.SetPinned(id, pinned); err != nil {
+		return err
+	}
+	r.changed()
+	return nil
+}
+
+var ErrInvalidMovieVisibility = errors.New("invalid movie visibility")
+
+// SetMovieVisibility stages the movie for the given audience, staged movies
+// still count against the movie limits of the room and are skipped by auto
+// advance, false if the visibility did not change
+func (r *Room) SetMovieVisibility(id string, visibility model.MovieVisibility) (bool, error) {
+	r.touch()
+	if !visibility.Valid() {
+		return false, ErrInvalidMovieVisibility
+	}
+	changed, err := r.movies.SetVisibility(id, visibility)
+	if changed {
+		r.changed()
+	}
+	return changed, err
+}
+
+func (r *Room) FindMovieByExternalID(system, id string) (*Movie, error) {
+	return r.movies.FindMovieByExternalID(system, id)
+}
+
 func (r *Room) Current() *Current {
 	c := r.current.Current()
 	return &c
 }
 
+var ErrNoCurrentMovie = errors.New("no current movie")
+
+// CurrentIndex returns the zero-based playlist index of the current movie and the playlist length
+func (r *Room) CurrentIndex() (int, int, error) {
+	id := r.current.Current().Movie.ID
+	if id == "" {
+		return 0, 0, ErrNoCurrentMovie
+	}
+	return r.movies.IndexOf(r.Settings.PlaylistSort, id)
+}
+
+// CurrentMovieProgress returns the completion ratio of the current movie in [0, 1]
+func (r *Room) CurrentMovieProgress() float64 {
+	return r.current.Progress()
+}
+
+// SetCurrentMovieType changes the type of the playing movie, e.g. once it
+// was detected from the source, clients get CHANGE_CURRENT to reload the player
+func (r *Room) SetCurrentMovieType(t string) error {
+	id := r.current.Current().Movie.ID
+	if id == "" {
+		return ErrNoCurrentMovie
+	}
+	changed, err := r.movies.SetType(id, t)
+	if err != nil || !changed {
+		return err
+	}
+	r.changed()
+	if r.current.updateMovie(id, func(m *model.BaseMovie) { m.Type = stripControl(t) }) {
+		return r.Broadcast(&ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_CURRENT,
+			Sender: SystemSender,
+		})
+	}
+	return nil
+}
+
 func (r *Room) SetCurrentMovieByID(id string, play bool) error {
 	m, err := r.movies.GetMovieByID(id)
 	if err != nil {
@@ -189,44 +818,466 @@ func (r *Room) SetCurrentMovieByID(id string, play bool) error {
 	return nil
 }
 
+// SetCurrentMovie sets the playing movie, nil clears it
 func (r *Room) SetCurrentMovie(movie *model.Movie, play bool) {
-	r.current.SetMovie(movie, play)
+	r.setCurrentMovie(movie, play, nil)
+}
+
+// setCurrentMovie is SetCurrentMovie recording by as the user who made the change,
+// nil means the server
+func (r *Room) setCurrentMovie(movie *model.Movie, play bool, by *User) {
+	r.setCurrentMovieAt(movie, play, 0, by)
+}
+
+// setCurrentMovieAt is setCurrentMovie starting the movie at seek
+func (r *Room) setCurrentMovieAt(movie *model.Movie, play bool, seek float64, by *User) {
+	r.setCurrentMovieIf(nil, movie, play, seek, by)
+}
+
+// setCurrentMovieIf is setCurrentMovieAt done only if cond reports true for
+// the current movie, see current.switchMovieIf, it reports whether it switched
+func (r *Room) setCurrentMovieIf(cond func(Current) bool, movie *model.Movie, play bool, seek float64, by *User) bool {
+	r.touch()
+	data := &WebhookMovieData{}
+	if movie != nil {
+		data.MovieID = movie.ID
+		data.Name = movie.Base.Name
+	}
+	_, span := r.startSpan(context.Background(), "SetCurrentMovie", attribute.String("movie.id", data.MovieID))
+	defer span.End()
+	prev, ok := r.current.switchMovieIf(cond, movie, play, seek)
+	if !ok {
+		return false
+	}
+	r.positions.save(prev)
+	if movie != nil {
+		r.positions.forget(movie.ID)
+	}
+	// the previous movie ended or was switched away from
+	r.trackWatchTime(false)
+	r.trackWatchTime(movie != nil && play)
+	if movie != nil {
+		if m, err := r.movies.GetMovieByID(movie.ID); err == nil {
+			m.timesPlayed.Add(1)
+		}
+	}
+	r.resetBuffering()
+	r.changed()
+	r.dispatchWebhook(model.WebhookEventCurrentChanged, data)
+	if by != nil {
+		r.logUserActivity(ActivityCurrentChanged, by, movie)
+	} else {
+		a := Activity{Type: ActivityCurrentChanged}
+		if movie != nil {
+			a.setMovie(movie)
+		}
+		r.logActivity(a)
+	}
+	return true
 }
 
 func (r *Room) SwapMoviePositions(id1, id2 string) error {
-	return r.movies.SwapMoviePositions(id1, id2)
+	r.touch()
+	if err := r.movies.SwapMoviePositions(id1, id2); err != nil {
+		return err
+	}
+	r.changed()
+	return nil
 }
 
+// GetMoviesWithPage pages over the movies in the playlist sort of the room
 func (r *Room) GetMoviesWithPage(page, pageSize int) []*Movie {
-	return r.movies.GetMoviesWithPage(page, pageSize)
+	return r.movies.GetMoviesWithPage(r.Settings.PlaylistSort, page, pageSize)
+}
+
+func (r *Room) GetMoviesByKindWithPage(kind model.MediaKind, page, pageSize int) ([]*Movie, int) {
+	return r.movies.GetMoviesByKindWithPage(r.Settings.PlaylistSort, kind, page, pageSize)
+}
+
+// GetFilteredMoviesWithPage pages over the movies keep returns true for in the
+// playlist sort of the room, keep must not call back into the room
+func (r *Room) GetFilteredMoviesWithPage(keep func(*model.Movie) bool, page, pageSize int) ([]*Movie, int) {
+	return r.movies.GetFilteredMoviesWithPage(r.Settings.PlaylistSort, keep, page, pageSize)
+}
+
+func (r *Room) PlaylistSort() model.PlaylistSort {
+	if r.Settings.PlaylistSort == "" {
+		return model.PlaylistSortManual
+	}
+	return r.Settings.PlaylistSort
+}
+
+// SetPlaylistSort changes the order the playlist is listed and auto advanced in,
+// the manual order is kept, clients are told to refetch the list with CHANGE_MOVIES
+func (r *Room) SetPlaylistSort(sort model.PlaylistSort) error {
+	if sort == "" || !sort.Valid() {
+		return ErrInvalidPlaylistSort
+	}
+	if sort == r.PlaylistSort() {
+		return nil
+	}
+	if err := db.SetRoomPlaylistSort(r.ID, sort); err != nil {
+		return err
+	}
+	r.Settings.PlaylistSort = sort
+	r.changed()
+	return r.Broadcast(&ElementMessage{
+		Type: pb.ElementMessageType_CHANGE_MOVIES,
+	})
 }
 
 func (r *Room) NewClient(user *User, conn *websocket.Conn) (*Client, error) {
-	r.lazyInitHub()
 	cli := newClient(user, r, conn)
-	err := r.hub.RegClient(cli)
+	err := r.RegClient(cli)
 	if err != nil {
 		return nil, err
 	}
 	return cli, nil
 }
 
-func (r *Room) RegClient(cli *Client) error {
-	r.lazyInitHub()
-	return r.hub.RegClient(cli)
+func (r *Room) NewSyncMessage() *SyncMessage {
+	return &SyncMessage{room: r}
+}
+
+// NewSyncMessage returns the sync message of the room of the client, its
+// receiver is the client id to offer WebRTC with, see Room.RegClientWithOffer
+func (c *Client) NewSyncMessage() *SyncMessage {
+	return &SyncMessage{room: c.r, receiver: c.id}
+}
+
+func (r *Room) RegClient(cli *Client) (err error) {
+	if ShuttingDown() {
+		return ErrShuttingDown
+	}
+	r.touch()
+	_, span := r.startSpan(context.Background(), "RegClient", attribute.String("user.id", cli.u.ID))
+	defer func() { endSpan(span, err) }()
+	r.start()
+	joined := !r.UserOnline(cli.u.ID)
+	err = r.hub.RegClient(cli)
+	if err != nil {
+		return err
+	}
+	r.touchCreator(cli.u.ID)
+	if joined {
+		r.dispatchWebhook(model.WebhookEventUserJoined, &WebhookUserData{
+			UserID:   cli.u.ID,
+			Username: cli.u.Username,
+		})
+		r.logUserActivity(ActivityUserJoined, cli.u, nil)
+	}
+	return nil
+}
+
+// UserOnline reports whether the user has a client connected to the room
+func (r *Room) UserOnline(id string) bool {
+	return r.hub.ConnectionCount(id) > 0
 }
 
 func (r *Room) UnregisterClient(cli *Client) error {
-	r.lazyInitHub()
-	return r.hub.UnRegClient(cli)
+	r.touch()
+	r.removeBufferingClient(cli)
+	r.touchCreator(cli.u.ID)
+	if err := r.hub.UnRegClient(cli); err != nil {
+		return err
+	}
+	if !r.UserOnline(cli.u.ID) {
+		r.dispatchWebhook(model.WebhookEventUserLeft, &WebhookUserData{
+			UserID:   cli.u.ID,
+			Username: cli.u.Username,
+		})
+		r.logUserActivity(ActivityUserLeft, cli.u, nil)
+	}
+	return nil
+}
+
+var ErrPlaybackLocked = errors.New("playback is locked")
+
+func (r *Room) PlaybackLocked() bool {
+	return atomic.LoadUint32(&r.playbackLocked) == 1
+}
+
+// SetPlaybackLocked locks or unlocks the playback controls and broadcasts
+// the new state as PLAYBACK_LOCK, see User.CanControlPlayback
+func (r *Room) SetPlaybackLocked(locked bool) error {
+	var v uint32
+	if locked {
+		v = 1
+	}
+	if atomic.SwapUint32(&r.playbackLocked, v) == v {
+		return nil
+	}
+	r.changed()
+	return r.Broadcast(&ElementMessage{
+		Type:   pb.ElementMessageType_PLAYBACK_LOCK,
+		Locked: locked,
+	})
+}
+
+var ErrRateNotAllowed = errors.New("rate not allowed")
+
+// WithAllowedRates limits the playback rates of the room to rates, the
+// allowed rates of the room settings take precedence when they are set
+func WithAllowedRates(rates []float64) RoomConf {
+	return func(r *Room) {
+		r.allowedRates = slices.Clone(rates)
+	}
+}
+
+// checkRate accepts any positive rate unless the room limits the allowed rates
+func (r *Room) checkRate(rate float64) error {
+	if r.current.Current().Movie.Base.Live {
+		return nil
+	}
+	if rate <= 0 {
+		return ErrRateNotAllowed
+	}
+	rates := r.Settings.AllowedRates
+	if len(rates) == 0 {
+		rates = r.allowedRates
+	}
+	if len(rates) == 0 {
+		return nil
+	}
+	for _, v := range rates {
+		if math.Abs(v-rate) < 1e-9 {
+			return nil
+		}
+	}
+	return ErrRateNotAllowed
+}
+
+var ErrSeekTooLarge = errors.New("seek too large")
+
+// checkSeekDelta rejects seeking further than Settings.MaxSeekDelta away from
+// the current position, pausing, resuming and small corrections always pass
+func (r *Room) checkSeekDelta(seek, rate, timeDiff float64) error {
+	maxDelta := r.Settings.MaxSeekDelta
+	if maxDelta <= 0 {
+		return nil
+	}
+	c := r.current.Current()
+	if c.Movie.Base.Live {
+		return nil
+	}
+	if c.Status.Playing {
+		seek += timeDiff * rate
+	}
+	if math.Abs(seek-c.Status.Seek) > maxDelta {
+		return fmt.Errorf("%w, seek at most %g seconds at once", ErrSeekTooLarge, maxDelta)
+	}
+	return nil
+}
+
+func (r *Room) SetStatus(playing bool, seek float64, rate float64, timeDiff float64) (Status, error) {
+	r.touch()
+	if err := r.checkRate(rate); err != nil {
+		return Status{}, err
+	}
+	status := r.current.SetStatus(playing, seek, rate, timeDiff)
+	r.trackWatchTime(status.Playing)
+	r.changed()
+	return status, nil
+}
+
+func (r *Room) SetSeekRate(seek float64, rate float64, timeDiff float64) (Status, error) {
+	r.touch()
+	if err := r.checkRate(rate); err != nil {
+		return Status{}, err
+	}
+	status := r.current.SetSeekRate(seek, rate, timeDiff)
+	r.changed()
+	return status, nil
+}
+
+var (
+	ErrInvalidSeek    = errors.New("seek must not be negative")
+	ErrCannotSeekLive = errors.New("cannot seek live movie")
+)
+
+// ForceSeek moves the current movie to seek without changing the play state,
+// it is meant for room admins and the server and is broadcast as FORCE_SEEK
+func (r *Room) ForceSeek(seek float64) error {
+	return r.ForceSeekContext(context.Background(), seek, "")
+}
+
+// ForceSeekContext is ForceSeek recording who initiated it,
+// an empty initiatorID means the server
+func (r *Room) ForceSeekContext(ctx context.Context, seek float64, initiatorID string) error {
+	r.touch()
+	if seek < 0 {
+		return ErrInvalidSeek
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c := r.current.Current()
+	if c.Movie.ID == "" {
+		return ErrNoCurrentMovie
+	}
+	if c.Movie.Base.Live {
+		return ErrCannotSeekLive
+	}
+	initiatedBy := SystemSender
+	if initiatorID != "" {
+		u, err := LoadOrInitUserByID(initiatorID)
+		if err != nil {
+			return err
+		}
+		initiatedBy = u.Value().Username
+	}
+	status := r.current.SetSeek(seek, 0)
+	r.changed()
+	log.Infof("room %s: force seek to %.3f by %q", r.ID, status.Seek, initiatedBy)
+	return r.Broadcast(&ElementMessage{
+		Type:    pb.ElementMessageType_FORCE_SEEK,
+		Sender:  initiatedBy,
+		Seek:    status.Seek,
+		Rate:    status.Rate,
+		Playing: status.Playing,
+	})
+}
+
+var ErrInvalidSeekDelta = errors.New("invalid seek delta")
+
+// SeekRelative seeks delta seconds forward or, if negative, back from the
+// current position and broadcasts the result as CHANGE_SEEK, the position is
+// read and written at once so concurrent relative seeks add up
+func (r *Room) SeekRelative(delta float64) error {
+	return r.seekRelative(delta, SystemSender)
+}
+
+func (r *Room) seekRelative(delta float64, sender string) error {
+	r.touch()
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return ErrInvalidSeekDelta
+	}
+	status, err := r.current.SeekRelative(delta)
+	if err != nil {
+		return err
+	}
+	r.changed()
+	return r.Broadcast(&ElementMessage{
+		Type:    pb.ElementMessageType_CHANGE_SEEK,
+		Sender:  sender,
+		Seek:    status.Seek,
+		Rate:    status.Rate,
+		Playing: status.Playing,
+	})
+}
+
+var ErrInvalidMovieDuration = errors.New("movie duration must be positive")
+
+// MovieDuration returns the duration of the movie, ok is false
+// if the movie does not exist or its duration is unknown
+func (r *Room) MovieDuration(id string) (time.Duration, bool) {
+	d, err := r.movies.Duration(id)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return time.Duration(d * float64(time.Second)), true
+}
+
+// SetMovieDuration records the duration of the movie once it was probed
+// and broadcasts it as MOVIE_DURATION
+func (r *Room) SetMovieDuration(id string, d time.Duration) error {
+	if d <= 0 {
+		return ErrInvalidMovieDuration
+	}
+	if err := r.movies.SetDuration(id, d.Seconds()); err != nil {
+		return err
+	}
+	r.current.updateMovie(id, func(m *model.BaseMovie) {
+		m.Duration = d.Seconds()
+	})
+	r.changed()
+	return r.Broadcast(&ElementMessage{
+		Type:     pb.ElementMessageType_MOVIE_DURATION,
+		Message:  id,
+		Duration: d.Seconds(),
+	})
+}
+
+// ErrMovieTooLong is returned when a movie lasts longer than the
+// max movie duration of the room
+type ErrMovieTooLong struct {
+	Duration time.Duration
+	Max      time.Duration
+}
+
+func (e *ErrMovieTooLong) Error() string {
+	return fmt.Sprintf("movie lasts %s, the room allows at most %s", e.Duration, e.Max)
+}
+
+// MaxMovieDuration returns how long movies added to the room may last, 0 is unlimited
+func (r *Room) MaxMovieDuration() time.Duration {
+	return time.Duration(r.Settings.MaxMovieDuration * float64(time.Second))
+}
+
+// SetMaxMovieDuration caps how long movies added to the room may last,
+// 0 removes the cap, movies already in the room are kept
+func (r *Room) SetMaxMovieDuration(d time.Duration) error {
+	if d < 0 {
+		return ErrInvalidMaxMovieDuration
+	}
+	if err := db.SetRoomMaxMovieDuration(r.ID, d.Seconds()); err != nil {
+		return err
+	}
+	r.Settings.MaxMovieDuration = d.Seconds()
+	r.changed()
+	return nil
 }
 
-func (r *Room) SetStatus(playing bool, seek float64, rate float64, timeDiff float64) Status {
-	return r.current.SetStatus(playing, seek, rate, timeDiff)
+// applyDefaultMovieHeaders adds the default movie headers of the room the
+// movie does not set, names are compared like http header names
+func (r *Room) applyDefaultMovieHeaders(m *model.Movie) {
+	defaults := r.Settings.DefaultMovieHeaders
+	if len(defaults) == 0 {
+		return
+	}
+	headers := make(map[string]string, len(defaults)+len(m.Base.Headers))
+	maps.Copy(headers, defaults)
+	for k, v := range m.Base.Headers {
+		for d := range defaults {
+			if strings.EqualFold(d, k) {
+				delete(headers, d)
+			}
+		}
+		headers[k] = v
+	}
+	m.Base.Headers = headers
 }
 
-func (r *Room) SetSeekRate(seek float64, rate float64, timeDiff float64) Status {
-	return r.current.SetSeekRate(seek, rate, timeDiff)
+// checkMovieDuration rejects movies longer than the max movie duration,
+// movies of unknown duration pass
+func (r *Room) checkMovieDuration(m *model.Movie) error {
+	max := r.MaxMovieDuration()
+	if max <= 0 || m.Base.Duration <= 0 {
+		return nil
+	}
+	d := time.Duration(m.Base.Duration * float64(time.Second))
+	if d > max {
+		return &ErrMovieTooLong{Duration: d, Max: max}
+	}
+	return nil
+}
+
+// SetMovieURL corrects the url of the movie, clients playing it are told
+// to reload it with CHANGE_CURRENT_URL
+func (r *Room) SetMovieURL(id, newURL string) error {
+	if err := r.movies.SetURL(id, newURL); err != nil {
+		return err
+	}
+	r.changed()
+	if !r.current.updateMovie(id, func(m *model.BaseMovie) {
+		m.Url = newURL
+	}) {
+		return nil
+	}
+	return r.Broadcast(&ElementMessage{
+		Type:    pb.ElementMessageType_CHANGE_CURRENT_URL,
+		Message: id,
+	})
 }
 
 func (r *Room) SetRoomStatus(status model.RoomStatus) error {
@@ -238,11 +1289,55 @@ func (r *Room) SetRoomStatus(status model.RoomStatus) error {
 	return nil
 }
 
+func (r *Room) SetHidden(hidden bool) error {
+	err := db.SetRoomHidden(r.ID, hidden)
+	if err != nil {
+		return err
+	}
+	r.Settings.Hidden = hidden
+	r.changed()
+	return nil
+}
+
+// SetHiddenAndBroadcast sets the visibility of the room and broadcasts it
+// as ROOM_VISIBILITY, nothing is broadcast if it did not change
+func (r *Room) SetHiddenAndBroadcast(hidden bool) error {
+	changed := r.Settings.Hidden != hidden
+	if err := r.SetHidden(hidden); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	return r.broadcastHidden(hidden)
+}
+
+func (r *Room) broadcastHidden(hidden bool) error {
+	return r.Broadcast(&ElementMessage{
+		Type:   pb.ElementMessageType_ROOM_VISIBILITY,
+		Hidden: hidden,
+	})
+}
+
 func (r *Room) SetSettings(settings model.RoomSettings) error {
+	r.touch()
 	err := db.SaveRoomSettings(r.ID, settings)
 	if err != nil {
 		return err
 	}
+	resorted := settings.PlaylistSort != r.Settings.PlaylistSort
+	hiddenChanged := settings.Hidden != r.Settings.Hidden
 	r.Settings = settings
-	return nil
+	r.setVendorBackends(settings.VendorBackends)
+	r.changed()
+	// the visibility is broadcast like SetHiddenAndBroadcast does
+	if hiddenChanged {
+		err = r.broadcastHidden(settings.Hidden)
+	}
+	if resorted {
+		err = errors.Join(err, r.Broadcast(&ElementMessage{
+			Type: pb.ElementMessageType_CHANGE_MOVIES,
+		}))
+	}
+	return err
 }
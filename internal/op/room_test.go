@@ -0,0 +1,400 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+func TestNewRoomUsable(t *testing.T) {
+	useTestDB(t)
+	defer func(hooks []func(*Room)) { roomInitHooks = hooks }(roomInitHooks)
+	roomInitHooks = nil
+	// hooks see the room while its first client registers
+	WithRoomInitHook(func(r *Room) {
+		r.Use(func(next MessageHandler) MessageHandler { return next })
+		if r.UserOnline("a") {
+			t.Error("client online before its registration finished")
+		}
+		_ = r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE})
+	})()
+
+	r := newRoom(&model.Room{ID: "room"})
+	// the movie list is loaded from the database on first use
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	if n := r.PeopleNum(); n != 0 {
+		t.Fatalf("PeopleNum() = %d, want 0", n)
+	}
+	if err := r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY}); err != nil {
+		t.Fatalf("Broadcast() = %v", err)
+	}
+	if err := r.BroadcastToUser("a", &ElementMessage{}); err == nil {
+		t.Fatal("BroadcastToUser() to an offline user = nil")
+	}
+	if err := r.UnicastByClientID("a", &ElementMessage{}); err != ErrClientNotFound {
+		t.Fatalf("UnicastByClientID() = %v, want %v", err, ErrClientNotFound)
+	}
+	if err := r.KickUser("a", ""); err != ErrUserNotConnected {
+		t.Fatalf("KickUser() = %v, want %v", err, ErrUserNotConnected)
+	}
+	if err := r.CloseUser("a", CloseCodeKicked, ""); err != nil {
+		t.Fatalf("CloseUser() = %v", err)
+	}
+	if err := r.SendToUser(&User{User: model.User{ID: "a"}}, &ElementMessage{}); err != nil {
+		t.Fatalf("SendToUser() = %v", err)
+	}
+	if err := r.SeekRelative(1); err != ErrNoCurrentMovie {
+		t.Fatalf("SeekRelative() = %v, want %v", err, ErrNoCurrentMovie)
+	}
+	r.SetCurrentMovie(nil, false)
+	_ = r.ActiveClients()
+	_ = r.BroadcastLatency()
+	_ = r.TotalBroadcasts()
+	_ = r.TotalWatchTime()
+	_ = r.ActivityLog(0)
+	_ = r.DebugDump()
+
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatalf("RegClient() = %v", err)
+	}
+	if !r.UserOnline("a") {
+		t.Fatal("UserOnline() = false after RegClient")
+	}
+	if err := r.UnregisterClient(c); err != nil {
+		t.Fatalf("UnregisterClient() = %v", err)
+	}
+
+	if err := r.close(); err != nil {
+		t.Fatalf("close() = %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return after close")
+	}
+}
+
+func TestApplyDefaultMovieHeaders(t *testing.T) {
+	r := newRoom(&model.Room{Settings: model.RoomSettings{
+		DefaultMovieHeaders: map[string]string{"Authorization": "room", "Referer": "https://example.com"},
+	}})
+	m := &model.Movie{Base: model.BaseMovie{Headers: map[string]string{"authorization": "movie"}}}
+	r.applyDefaultMovieHeaders(m)
+	want := map[string]string{"authorization": "movie", "Referer": "https://example.com"}
+	if !reflect.DeepEqual(m.Base.Headers, want) {
+		t.Fatalf("headers = %v, want %v", m.Base.Headers, want)
+	}
+	if r.Settings.DefaultMovieHeaders["Authorization"] != "room" {
+		t.Fatal("the default headers of the room were modified")
+	}
+
+	s := model.RoomSettings{DefaultMovieHeaders: map[string]string{"X-Token": "a\r\nb"}}
+	if err := ValidateRoomSettings(&s); !errors.Is(err, ErrInvalidDefaultMovieHeaders) {
+		t.Fatalf("ValidateRoomSettings() = %v, want %v", err, ErrInvalidDefaultMovieHeaders)
+	}
+}
+
+// startable fails the test if the room can no longer start its hub
+func startable(t *testing.T, r *Room) {
+	t.Helper()
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatalf("RegClient() = %v", err)
+	}
+	defer r.close()
+	if !r.UserOnline("a") {
+		t.Fatal("UserOnline() = false after RegClient")
+	}
+}
+
+func TestDebugDumpIdleRoom(t *testing.T) {
+	useTestDB(t)
+	r := newRoom(&model.Room{ID: "room"})
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	_ = r.DebugDump()
+	startable(t, r)
+}
+
+func TestWaitIdleRoom(t *testing.T) {
+	r := newRoom(&model.Room{ID: "room"})
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	// a room nobody joined has no hub serving, Wait returns at once
+	r.Wait()
+	startable(t, r)
+}
+
+func TestVersionBroadcast(t *testing.T) {
+	r := newRoom(&model.Room{}, WithVersionBroadcast(true))
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{{ID: "a", Position: 1}})
+	})
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	r.SetCurrentMovie(&model.Movie{ID: "a"}, false)
+	if _, err := r.SetStatus(true, 1, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetPlaybackLocked(true); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.StateVersion(); v != 3 {
+		t.Fatalf("StateVersion() = %d, want 3", v)
+	}
+	// the changes are debounced into a single broadcast
+	var versions []uint32
+	timeout := time.After(versionNotifyDelay * 3)
+	for done := false; !done; {
+		select {
+		case msg := <-c.GetReadChan():
+			if em, ok := msg.(*PreparedMessage).Message.(*ElementMessage); ok && em.Type == pb.ElementMessageType_CHANGE_VERSION {
+				versions = append(versions, em.Version)
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	if !reflect.DeepEqual(versions, []uint32{3}) {
+		t.Fatalf("broadcast versions %v, want [3]", versions)
+	}
+}
+
+func TestVersionBroadcastDisabled(t *testing.T) {
+	r := newRoom(&model.Room{})
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	if err := r.SetPlaybackLocked(true); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.StateVersion(); v != 1 {
+		t.Fatalf("StateVersion() = %d, want 1", v)
+	}
+	timeout := time.After(versionNotifyDelay * 2)
+	for {
+		select {
+		case msg := <-c.GetReadChan():
+			if em, ok := msg.(*PreparedMessage).Message.(*ElementMessage); ok && em.Type == pb.ElementMessageType_CHANGE_VERSION {
+				t.Fatal("CHANGE_VERSION broadcast without WithVersionBroadcast")
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestDebugDumpSnapshot(t *testing.T) {
+	useTestDB(t)
+	u, err := CreateUser("debug", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.CreateRoom("debug", "secret", 0, db.WithCreator(&u.Value().User))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"banned1", "banned2"} {
+		if _, err := db.FirstOrCreateRoomUserRelation(m.ID, id, db.WithRoomUserRelationStatus(model.RoomUserStatusBanned)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := newRoom(m)
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	c := newTestClient(u.Value().ID)
+	c.u.Username = "debug"
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	written := make(chan struct{}, 16)
+	go c.WriteLoop(func(Message) error {
+		written <- struct{}{}
+		return nil
+	})
+	if err := r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE}); err != nil {
+		t.Fatal(err)
+	}
+	seq := r.hub.seq.Load()
+	for c.lastSeq.Load() != seq || seq == 0 {
+		select {
+		case <-written:
+			seq = r.hub.seq.Load()
+		case <-time.After(time.Second):
+			t.Fatal("the broadcast was not written")
+		}
+	}
+	c.lastPong.Store(1000)
+
+	d := r.DebugDump()
+	if d.GeneratedAt == 0 {
+		t.Fatal("GeneratedAt is not set")
+	}
+	d.GeneratedAt = 0
+	d.BroadcastLatency = BroadcastLatency{}
+	d.Current.LastUpdate = 0
+	want := RoomDebug{
+		ID:           m.ID,
+		Name:         "debug",
+		Status:       m.Status,
+		CreatorID:    u.Value().ID,
+		Version:      r.Version(),
+		StateVersion: r.StateVersion(),
+		NeedPwd:      true,
+		PeopleNum:    1,
+		Current:      CurrentDebug{Rate: 1},
+		Clients: []ClientDebug{{
+			UserID:   u.Value().ID,
+			Username: "debug",
+			QueueCap: cap(c.c),
+			LastPong: 1000,
+			LastSeq:  seq,
+		}},
+		Broadcasts: r.TotalBroadcasts(),
+		Seq:        seq,
+		Banned:     2,
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Fatalf("DebugDump() = %+v\nwant %+v", d, want)
+	}
+}
+
+func TestForceSeek(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{
+			{ID: "a", Position: 1, Base: model.BaseMovie{Duration: 100}},
+			{ID: "live", Position: 2, Base: model.BaseMovie{Live: true}},
+		})
+	})
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	if err := r.ForceSeek(10); !errors.Is(err, ErrNoCurrentMovie) {
+		t.Fatalf("ForceSeek() without a movie = %v, want %v", err, ErrNoCurrentMovie)
+	}
+	r.SetCurrentMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Duration: 100}}, true)
+	if err := r.ForceSeek(-1); !errors.Is(err, ErrInvalidSeek) {
+		t.Fatalf("ForceSeek(-1) = %v, want %v", err, ErrInvalidSeek)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.ForceSeekContext(ctx, 10, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ForceSeekContext() canceled = %v, want %v", err, context.Canceled)
+	}
+
+	r.lastActive.Store(0)
+	if err := r.ForceSeek(42); err != nil {
+		t.Fatal(err)
+	}
+	if r.LastActive().IsZero() {
+		t.Fatal("ForceSeek() did not mark the room active")
+	}
+	status := r.current.Status()
+	if status.Seek < 42 || status.Seek > 43 || !status.Playing {
+		t.Fatalf("status = %+v, want playing at 42", status)
+	}
+	deadline := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case msg := <-c.GetReadChan():
+			em, ok := msg.(*PreparedMessage).Message.(*ElementMessage)
+			if !ok || em.Type != pb.ElementMessageType_FORCE_SEEK {
+				continue
+			}
+			if em.Seek != 42 || !em.Playing || em.Sender != SystemSender {
+				t.Fatalf("FORCE_SEEK = %+v, want playing at 42 by %s", em, SystemSender)
+			}
+			done = true
+		case <-deadline:
+			t.Fatal("FORCE_SEEK was not broadcast")
+		}
+	}
+
+	r.SetCurrentMovie(&model.Movie{ID: "live", Base: model.BaseMovie{Live: true}}, true)
+	if err := r.ForceSeek(10); !errors.Is(err, ErrCannotSeekLive) {
+		t.Fatalf("ForceSeek() of a live movie = %v, want %v", err, ErrCannotSeekLive)
+	}
+}
+
+func TestSetHiddenBroadcast(t *testing.T) {
+	useTestDB(t)
+	m, err := db.CreateRoom("hidden", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRoom(m)
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	c := newTestClient("a")
+	if err := r.RegClient(c); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	visibility := func() []bool {
+		var list []bool
+		for {
+			select {
+			case msg := <-c.GetReadChan():
+				if em, ok := msg.(*PreparedMessage).Message.(*ElementMessage); ok && em.Type == pb.ElementMessageType_ROOM_VISIBILITY {
+					list = append(list, em.Hidden)
+				}
+			case <-time.After(100 * time.Millisecond):
+				return list
+			}
+		}
+	}
+	visibility()
+
+	if err := r.SetHiddenAndBroadcast(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetHiddenAndBroadcast(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := visibility(); !reflect.DeepEqual(got, []bool{true}) {
+		t.Fatalf("SetHiddenAndBroadcast() broadcast %v, want [true]", got)
+	}
+
+	s := r.Settings
+	s.Hidden = false
+	if err := r.SetSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	s.ChatHistory = !s.ChatHistory
+	if err := r.SetSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := visibility(); !reflect.DeepEqual(got, []bool{false}) {
+		t.Fatalf("SetSettings() broadcast %v, want [false]", got)
+	}
+	if m, err := db.GetRoomByID(r.ID); err != nil || m.Settings.Hidden {
+		t.Fatalf("saved room = %+v, %v, want it visible", m, err)
+	}
+}
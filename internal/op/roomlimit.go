@@ -0,0 +1,155 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+// createRoomWindow is the window of settings.CreateRoomRateLimit
+const createRoomWindow = time.Hour
+
+var (
+	ErrCreateRoomRateLimited = errors.New("creating rooms too often, please try again later")
+	ErrRoomCapacityReached   = errors.New("the maximum number of rooms is reached")
+)
+
+// ErrRoomNameRejected is returned when the room name policy refuses a name
+type ErrRoomNameRejected struct {
+	Name string
+	Err  error
+}
+
+func (e *ErrRoomNameRejected) Error() string {
+	return fmt.Sprintf("room name %q rejected: %v", e.Name, e.Err)
+}
+
+func (e *ErrRoomNameRejected) Unwrap() error {
+	return e.Err
+}
+
+// RoomNamePolicy decides which names new rooms may use, Check returns the
+// name the room is created with so a policy may normalize it
+type RoomNamePolicy interface {
+	Check(name string) (string, error)
+}
+
+type RoomNamePolicyFunc func(name string) (string, error)
+
+func (f RoomNamePolicyFunc) Check(name string) (string, error) {
+	return f(name)
+}
+
+// settingsRoomNamePolicy applies settings.RoomNamePattern and settings.ReservedRoomNames
+type settingsRoomNamePolicy struct{}
+
+func (settingsRoomNamePolicy) Check(name string) (string, error) {
+	return name, ValidateRoomName(name)
+}
+
+var roomNamePolicy RoomNamePolicy = settingsRoomNamePolicy{}
+
+// WithRoomNamePolicy replaces the default policy, which only applies the room settings
+func WithRoomNamePolicy(p RoomNamePolicy) InitConfig {
+	return func() {
+		roomNamePolicy = p
+	}
+}
+
+func checkRoomName(name string) (string, error) {
+	normalized, err := roomNamePolicy.Check(name)
+	if err != nil {
+		return "", &ErrRoomNameRejected{Name: name, Err: err}
+	}
+	return normalized, nil
+}
+
+// createRoomLimiter counts the rooms each identity created within createRoomWindow
+type createRoomLimiter struct {
+	lock  sync.Mutex
+	m     map[string][]time.Time
+	swept time.Time
+}
+
+var createRoomLimits createRoomLimiter
+
+// take reserves a creation for identity unless it already made limit
+// creations within the window, a limit of 0 or less is unlimited
+func (l *createRoomLimiter) take(identity string, limit int64, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.m == nil {
+		l.m = make(map[string][]time.Time)
+	}
+	if now.Sub(l.swept) >= createRoomWindow {
+		for k, ts := range l.m {
+			if len(expireBefore(ts, now.Add(-createRoomWindow))) == 0 {
+				delete(l.m, k)
+			}
+		}
+		l.swept = now
+	}
+	ts := expireBefore(l.m[identity], now.Add(-createRoomWindow))
+	if int64(len(ts)) >= limit {
+		l.m[identity] = ts
+		return false
+	}
+	l.m[identity] = append(ts, now)
+	return true
+}
+
+// release gives back the latest reservation of identity, the creation failed
+func (l *createRoomLimiter) release(identity string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	ts := l.m[identity]
+	if len(ts) == 0 {
+		return
+	}
+	if len(ts) == 1 {
+		delete(l.m, identity)
+		return
+	}
+	l.m[identity] = ts[:len(ts)-1]
+}
+
+// expireBefore drops the sorted times before t
+func expireBefore(ts []time.Time, t time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(t) {
+		i++
+	}
+	return ts[i:]
+}
+
+// createRoomLock serializes creations while settings.MaxRoomCount is set,
+// so concurrent creations can not go over it
+var createRoomLock sync.Mutex
+
+func checkRoomCapacity() error {
+	if max := settings.MaxRoomCount.Get(); max > 0 && db.GetAllRoomsCount() >= max {
+		return ErrRoomCapacityReached
+	}
+	return nil
+}
+
+// CreateRoomAs creates a room limited by settings.CreateRoomRateLimit,
+// identity is what the limit is counted by, such as the user id or client ip
+func CreateRoomAs(identity, name, password string, maxCount int64, conf ...db.CreateRoomConfig) (*RoomEntry, error) {
+	if !createRoomLimits.take(identity, settings.CreateRoomRateLimit.Get(), time.Now()) {
+		return nil, ErrCreateRoomRateLimited
+	}
+	r, err := CreateRoom(name, password, maxCount, conf...)
+	if err != nil {
+		createRoomLimits.release(identity)
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,115 @@
+package op
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+func TestCreateRoomLimiter(t *testing.T) {
+	var l createRoomLimiter
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if !l.take("a", 2, now) {
+			t.Fatalf("take() #%d = false, want true", i)
+		}
+	}
+	if l.take("a", 2, now) {
+		t.Fatal("take() over the limit = true")
+	}
+	if !l.take("b", 2, now) {
+		t.Fatal("take() of another identity = false")
+	}
+	l.release("a")
+	if !l.take("a", 2, now) {
+		t.Fatal("take() after release = false")
+	}
+	if !l.take("a", 2, now.Add(createRoomWindow+time.Second)) {
+		t.Fatal("take() after the window = false")
+	}
+	if !l.take("a", 0, now) {
+		t.Fatal("take() without limit = false")
+	}
+}
+
+func TestRoomNamePolicy(t *testing.T) {
+	defer func() { roomNamePolicy = settingsRoomNamePolicy{} }()
+	errBad := errors.New("bad")
+	WithRoomNamePolicy(RoomNamePolicyFunc(func(name string) (string, error) {
+		if strings.HasPrefix(name, "bot") {
+			return "", errBad
+		}
+		return strings.ToLower(name), nil
+	}))()
+	if name, err := checkRoomName("Movie"); err != nil || name != "movie" {
+		t.Fatalf("checkRoomName() = %q %v, want movie", name, err)
+	}
+	_, err := CreateRoom("bot1", "", 0)
+	var rejected *ErrRoomNameRejected
+	if !errors.As(err, &rejected) || !errors.Is(err, errBad) {
+		t.Fatalf("CreateRoom() = %v, want the policy error", err)
+	}
+}
+
+func TestRenameRoomInvalidID(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.ID = strings.Repeat("a", 32)
+	for _, id := range []string{"", "room", strings.Repeat("A", 32)} {
+		if err := r.Rename(id); err != ErrInvalidRoomID {
+			t.Fatalf("Rename(%q) = %v, want %v", id, err, ErrInvalidRoomID)
+		}
+	}
+	if err := r.Rename(r.ID); err != nil {
+		t.Fatalf("Rename() to the same id = %v, want nil", err)
+	}
+}
+
+func TestWithRoomIDValidator(t *testing.T) {
+	defer WithRoomIDValidator(nil)()
+	errBad := errors.New("bad room id")
+	WithRoomIDValidator(func(id string) error {
+		if id != "custom-room" {
+			return errBad
+		}
+		return nil
+	})()
+	r := newRoom(&model.Room{})
+	r.ID = strings.Repeat("a", 32)
+	if err := r.Rename(strings.Repeat("b", 32)); err != errBad {
+		t.Fatalf("Rename() = %v, want the validator error", err)
+	}
+	if _, err := LoadOrInitRoomByID(strings.Repeat("b", 32)); err != errBad {
+		t.Fatalf("LoadOrInitRoomByID() = %v, want the validator error", err)
+	}
+	if err := ValidateRoomID("custom-room"); err != nil {
+		t.Fatalf("ValidateRoomID() = %v, want nil", err)
+	}
+}
+
+func TestRoomNamePatternCached(t *testing.T) {
+	useTestDB(t)
+	defer func() { _ = settings.RoomNamePattern.Set("") }()
+	if err := settings.RoomNamePattern.Set("^[a-z]+$"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRoomName("movie"); err != nil {
+		t.Fatalf("ValidateRoomName() = %v, want nil", err)
+	}
+	reg := roomNameRegexp.Load()
+	if err := ValidateRoomName("Movie"); err != ErrRoomNameNotAllowed {
+		t.Fatalf("ValidateRoomName() = %v, want %v", err, ErrRoomNameNotAllowed)
+	}
+	if roomNameRegexp.Load() != reg {
+		t.Fatal("the unchanged pattern was compiled again")
+	}
+	if err := settings.RoomNamePattern.Set("^[A-Z]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRoomName("Movie"); err != nil {
+		t.Fatalf("ValidateRoomName() after the pattern changed = %v, want nil", err)
+	}
+}
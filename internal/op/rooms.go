@@ -1,14 +1,18 @@
 package op
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"hash/crc32"
-	"time"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
 	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/internal/vendor"
 	"github.com/zijiren233/gencontainer/synccache"
 )
 
@@ -20,7 +24,162 @@ func RangeRoomCache(f func(key string, value *synccache.Entry[*Room]) bool) {
 	roomCache.Range(f)
 }
 
+var (
+	ErrRoomNameNotAllowed = errors.New("room name does not match the allowed pattern")
+	ErrRoomNameReserved   = errors.New("room name is reserved")
+)
+
+// compiledPattern is a setting pattern with its compiled regexp
+type compiledPattern struct {
+	pattern string
+	reg     *regexp.Regexp
+}
+
+// roomNameRegexp caches settings.RoomNamePattern, it is only compiled
+// again once the setting changed
+var roomNameRegexp atomic.Pointer[compiledPattern]
+
+func roomNamePattern() (*regexp.Regexp, error) {
+	p := settings.RoomNamePattern.Get()
+	if p == "" {
+		return nil, nil
+	}
+	if c := roomNameRegexp.Load(); c != nil && c.pattern == p {
+		return c.reg, nil
+	}
+	reg, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	roomNameRegexp.Store(&compiledPattern{pattern: p, reg: reg})
+	return reg, nil
+}
+
+// ValidateRoomName checks the name against the operator configured
+// pattern and reserved names, see settings.RoomNamePattern
+func ValidateRoomName(name string) error {
+	reg, err := roomNamePattern()
+	if err != nil {
+		return err
+	}
+	if reg != nil && !reg.MatchString(name) {
+		return ErrRoomNameNotAllowed
+	}
+	for _, reserved := range strings.Split(settings.ReservedRoomNames.Get(), ",") {
+		reserved = strings.TrimSpace(reserved)
+		if reserved != "" && strings.EqualFold(reserved, name) {
+			return ErrRoomNameReserved
+		}
+	}
+	return nil
+}
+
+var (
+	ErrInvalidBufferingAssistRatio     = errors.New("buffering assist ratio must be above 0 and at most 1")
+	ErrInvalidBufferingAssistThreshold = errors.New("buffering assist threshold must not be negative")
+	ErrInvalidAllowedRates             = errors.New("allowed rates must be positive and at most 16")
+	ErrInvalidMaxSeekDelta             = errors.New("max seek delta must not be negative")
+	ErrInvalidMaxMovieDuration         = errors.New("max movie duration must not be negative")
+	ErrInvalidPlaylistSort             = errors.New("invalid playlist sort")
+	ErrInvalidDefaultMovieHeaders      = errors.New("default movie headers must not contain control characters")
+	ErrInvalidAllowedReactions         = fmt.Errorf("allowed reactions must be at most %d emoji of at most %d bytes", maxAllowedReactions, maxReactionLen)
+)
+
+// ErrInvalidField points at the field of a request or template that failed
+// validation, Field uses the json names joined by dots
+type ErrInvalidField struct {
+	Field string
+	Err   error
+}
+
+func (e *ErrInvalidField) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *ErrInvalidField) Unwrap() error {
+	return e.Err
+}
+
+// invalidField nests err under field, a nil err stays nil
+func invalidField(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var f *ErrInvalidField
+	if errors.As(err, &f) {
+		return &ErrInvalidField{Field: field + "." + f.Field, Err: f.Err}
+	}
+	return &ErrInvalidField{Field: field, Err: err}
+}
+
+func ValidateRoomSettings(s *model.RoomSettings) error {
+	// a ratio of 0 pauses on the first client that buffers, it is only
+	// rejected with buffering assist on so settings without it may leave it out
+	if s.BufferingAssistRatio < 0 || s.BufferingAssistRatio > 1 || (s.BufferingAssist && s.BufferingAssistRatio == 0) {
+		return invalidField("bufferingAssistRatio", ErrInvalidBufferingAssistRatio)
+	}
+	if s.BufferingAssistThreshold < 0 {
+		return invalidField("bufferingAssistThreshold", ErrInvalidBufferingAssistThreshold)
+	}
+	if len(s.AllowedRates) > 16 {
+		return invalidField("allowedRates", ErrInvalidAllowedRates)
+	}
+	for i, r := range s.AllowedRates {
+		if r <= 0 {
+			return invalidField(fmt.Sprintf("allowedRates[%d]", i), ErrInvalidAllowedRates)
+		}
+	}
+	if len(s.AllowedReactions) > maxAllowedReactions {
+		return invalidField("allowedReactions", ErrInvalidAllowedReactions)
+	}
+	for i, e := range s.AllowedReactions {
+		if e == "" || len(e) > maxReactionLen {
+			return invalidField(fmt.Sprintf("allowedReactions[%d]", i), ErrInvalidAllowedReactions)
+		}
+	}
+	if s.MaxSeekDelta < 0 {
+		return invalidField("maxSeekDelta", ErrInvalidMaxSeekDelta)
+	}
+	if s.MaxMovieDuration < 0 {
+		return invalidField("maxMovieDuration", ErrInvalidMaxMovieDuration)
+	}
+	if !s.PlaylistSort.Valid() {
+		return invalidField("playlistSort", ErrInvalidPlaylistSort)
+	}
+	if err := checkDefaultMovieHeaders(s.DefaultMovieHeaders); err != nil {
+		return invalidField("defaultMovieHeaders", err)
+	}
+	return invalidField("vendorBackends", vendor.ValidateBackendPreference(s.VendorBackends))
+}
+
+// checkDefaultMovieHeaders applies the movie header limits to the default
+// headers, control characters are rejected as they are not stripped later
+func checkDefaultMovieHeaders(headers map[string]string) error {
+	for k, v := range headers {
+		if stripControl(k) != k || stripControl(v) != v {
+			return ErrInvalidDefaultMovieHeaders
+		}
+	}
+	return checkMovieFields(&model.BaseMovie{Headers: headers})
+}
+
+// CreateRoom checks the name with the room name policy and the server
+// room limit, it is not rate limited, see CreateRoomAs
 func CreateRoom(name, password string, maxCount int64, conf ...db.CreateRoomConfig) (*RoomEntry, error) {
+	if ShuttingDown() {
+		return nil, ErrShuttingDown
+	}
+	name, err := checkRoomName(name)
+	if err != nil {
+		return nil, err
+	}
+	if settings.MaxRoomCount.Get() > 0 {
+		createRoomLock.Lock()
+		defer createRoomLock.Unlock()
+		if err := checkRoomCapacity(); err != nil {
+			return nil, err
+		}
+	}
 	r, err := db.CreateRoom(name, password, maxCount, conf...)
 	if err != nil {
 		return nil, err
@@ -51,6 +210,9 @@ func checkRoomCreatorStatus(creatorID string) error {
 }
 
 func LoadOrInitRoom(room *model.Room) (*RoomEntry, error) {
+	if ShuttingDown() {
+		return nil, ErrShuttingDown
+	}
 	switch room.Status {
 	case model.RoomStatusBanned:
 		return nil, ErrRoomBanned
@@ -63,14 +225,15 @@ func LoadOrInitRoom(room *model.Room) (*RoomEntry, error) {
 		return nil, err
 	}
 
-	i, _ := roomCache.LoadOrStore(room.ID, &Room{
-		Room:    *room,
-		version: crc32.ChecksumIEEE(room.HashedPassword),
-		current: newCurrent(),
-		movies: movies{
-			roomID: room.ID,
-		},
-	}, time.Duration(settings.RoomTTL.Get())*time.Hour)
+	hooks, err := db.GetRoomWebhooks(room.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	i, loaded := roomCache.LoadOrStore(room.ID, newRoom(room), roomTTL())
+	if !loaded {
+		i.Value().webhooks.restore(hooks)
+	}
 	return i, nil
 }
 
@@ -91,6 +254,51 @@ func CompareAndDeleteRoom(room *RoomEntry) error {
 	return nil
 }
 
+var ErrInvalidRoomID = errors.New("room id must be 32 lowercase hex characters")
+
+// validateRoomID accepts the format of generated room ids
+func validateRoomID(id string) error {
+	if !validMovieID(id) {
+		return ErrInvalidRoomID
+	}
+	return nil
+}
+
+var roomIDValidator = validateRoomID
+
+// ValidateRoomID checks id with the validator set by WithRoomIDValidator
+func ValidateRoomID(id string) error {
+	return roomIDValidator(id)
+}
+
+// WithRoomIDValidator replaces the check of the room ids rooms are renamed
+// to and loaded by, its error is returned for invalid ids. The default only
+// accepts generated ids, 32 lowercase hex characters, and is kept for nil.
+func WithRoomIDValidator(validate func(id string) error) InitConfig {
+	return func() {
+		if validate == nil {
+			validate = validateRoomID
+		}
+		roomIDValidator = validate
+	}
+}
+
+// RenameRoom changes the id of the room, a loaded room is closed so its
+// clients, room tokens and rtmp publishers have to reconnect with the new id,
+// the room is loaded again under the new id on the next access
+func RenameRoom(roomID, newID string) error {
+	if err := ValidateRoomID(newID); err != nil {
+		return err
+	}
+	if roomID == newID {
+		return nil
+	}
+	if err := db.SetRoomID(roomID, newID); err != nil {
+		return err
+	}
+	return CloseRoomById(roomID)
+}
+
 func CloseRoomById(roomID string) error {
 	r, loaded := roomCache.LoadAndDelete(roomID)
 	if loaded {
@@ -113,7 +321,7 @@ func LoadRoomByID(id string) (*RoomEntry, error) {
 		return nil, errors.New("room not found")
 	}
 
-	err := checkRoomCreatorStatus(r2.Value().CreatorID)
+	err := checkRoomCreatorStatus(r2.Value().CreatedBy())
 	if err != nil {
 		if errors.Is(err, ErrRoomCreatorBanned) || errors.Is(err, ErrorRoomCreatorPending) {
 			CompareAndCloseRoom(r2)
@@ -121,24 +329,24 @@ func LoadRoomByID(id string) (*RoomEntry, error) {
 		return nil, err
 	}
 
-	r2.SetExpiration(time.Now().Add(time.Duration(settings.RoomTTL.Get()) * time.Hour))
+	r2.Value().markRead()
 	return r2, nil
 }
 
 func LoadOrInitRoomByID(id string) (*RoomEntry, error) {
-	if len(id) != 32 {
-		return nil, errors.New("room id is not 32 bit")
+	if err := ValidateRoomID(id); err != nil {
+		return nil, err
 	}
 	i, loaded := roomCache.Load(id)
 	if loaded {
-		err := checkRoomCreatorStatus(i.Value().CreatorID)
+		err := checkRoomCreatorStatus(i.Value().CreatedBy())
 		if err != nil {
 			if errors.Is(err, ErrRoomCreatorBanned) || errors.Is(err, ErrorRoomCreatorPending) {
 				CompareAndCloseRoom(i)
 			}
 			return nil, err
 		}
-		i.SetExpiration(time.Now().Add(time.Duration(settings.RoomTTL.Get()) * time.Hour))
+		i.Value().markRead()
 		return i, nil
 	}
 	room, err := db.GetRoomByID(id)
@@ -156,6 +364,19 @@ func PeopleNum(roomID string) int64 {
 	return 0
 }
 
+// LoadedRoomsByCreator returns the loaded rooms created by the user,
+// db.GetAllRoomsByUserID also lists the rooms that are not loaded
+func LoadedRoomsByCreator(creatorID string) []*Room {
+	var rooms []*Room
+	roomCache.Range(func(_ string, e *RoomEntry) bool {
+		if r := e.Value(); r.CreatedBy() == creatorID {
+			rooms = append(rooms, r)
+		}
+		return true
+	})
+	return rooms
+}
+
 func SetRoomStatusByID(roomID string, status model.RoomStatus) error {
 	err := db.SetRoomStatus(roomID, status)
 	if err != nil {
@@ -167,3 +388,80 @@ func SetRoomStatusByID(roomID string, status model.RoomStatus) error {
 	}
 	return nil
 }
+
+// closeAllWorkers bounds how many rooms CloseAll closes at once
+const closeAllWorkers = 16
+
+// CloseAll closes the rooms concurrently and waits until their hubs stopped,
+// once ctx is done the remaining rooms are left open and ctx.Err() is
+// returned along with the errors of the rooms that failed to close
+func CloseAll(ctx context.Context, rooms []*Room) error {
+	_, errs := closeRooms(ctx, rooms, (*Room).closeAndWait)
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// closeRooms runs closeRoom for the rooms with up to closeAllWorkers at once
+// and returns how many of them it succeeded for, rooms not started before
+// ctx is done are skipped
+func closeRooms(ctx context.Context, rooms []*Room, closeRoom func(*Room, context.Context) error) (int, []error) {
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		closed int
+		errs   []error
+	)
+	jobs := make(chan *Room)
+	for i := 0; i < min(closeAllWorkers, len(rooms)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				err := closeRoom(r, ctx)
+				lock.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("room %s: %w", r.ID, err))
+				} else {
+					closed++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, r := range rooms {
+		select {
+		case jobs <- r:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return closed, errs
+}
+
+// closeAndWait removes the room from the cache, closes it and waits for its hub
+func (r *Room) closeAndWait(ctx context.Context) error {
+	if roomCache != nil {
+		if e, ok := roomCache.Load(r.ID); ok && e.Value() == r {
+			roomCache.CompareAndDelete(r.ID, e)
+		}
+	}
+	if err := r.close(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
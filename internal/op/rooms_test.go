@@ -0,0 +1,42 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestLoadedRoomsByCreator(t *testing.T) {
+	useTestDB(t)
+	a := newRoom(&model.Room{ID: "creator-a", CreatorID: "a"})
+	roomCache.Store(a.ID, a, time.Minute)
+	b := newRoom(&model.Room{ID: "creator-b", CreatorID: "b"})
+	roomCache.Store(b.ID, b, time.Minute)
+	defer roomCache.Delete(a.ID)
+	defer roomCache.Delete(b.ID)
+
+	rooms := LoadedRoomsByCreator("a")
+	if len(rooms) != 1 || rooms[0] != a {
+		t.Fatalf("LoadedRoomsByCreator(a) = %v, want [%s]", rooms, a.ID)
+	}
+	if rooms := LoadedRoomsByCreator("c"); len(rooms) != 0 {
+		t.Fatalf("LoadedRoomsByCreator(c) = %d rooms, want none", len(rooms))
+	}
+	a.movies.once.Do(func() {
+		a.movies.restore(nil)
+	})
+	if d := a.DebugDump(); d.CreatorID != "a" {
+		t.Fatalf("DebugDump().CreatorID = %q, want a", d.CreatorID)
+	}
+	// closing the creator unloads only its rooms
+	if err := CloseUserById("a"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Closed() || b.Closed() {
+		t.Fatalf("Closed() = %v %v, want only the room of a closed", a.Closed(), b.Closed())
+	}
+	if rooms := LoadedRoomsByCreator("a"); len(rooms) != 0 {
+		t.Fatalf("LoadedRoomsByCreator(a) = %d rooms after closing a, want none", len(rooms))
+	}
+}
@@ -0,0 +1,326 @@
+package op
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	log "github.com/sirupsen/logrus"
+	pb "github.com/synctv-org/synctv/proto/message"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// RTCStateLabel is the label of the data channel status and seek messages
+	// are sent on, the peer opens it unordered and without retransmits
+	RTCStateLabel = "state"
+	// RTCReliableLabel is the label of the data channel every other message
+	// is sent on when the client has no websocket
+	RTCReliableLabel = "reliable"
+)
+
+// rtcConnectTimeout bounds gathering the candidates of an answer and a
+// client without websocket opening its reliable channel
+const rtcConnectTimeout = 10 * time.Second
+
+// rtcMaxBuffered is how many bytes may wait on the state channel, later
+// state messages are dropped until it drained as a newer one follows anyway
+const rtcMaxBuffered = 64 << 10
+
+var ErrRTCNotOpen = errors.New("webrtc data channel is not open")
+
+// WithWebRTC sets the api and configuration, such as the ICE servers, the
+// peer connections of the clients of the room are created with, a nil api
+// uses the pion defaults
+func WithWebRTC(api *webrtc.API, config webrtc.Configuration) RoomConf {
+	return func(r *Room) {
+		r.hub.rtcAPI = api
+		r.hub.rtcConfig = config
+	}
+}
+
+// rtcPeer is the server side of the peer connection of a client
+type rtcPeer struct {
+	pc       *webrtc.PeerConnection
+	state    atomic.Pointer[webrtc.DataChannel]
+	reliable atomic.Pointer[webrtc.DataChannel]
+	// opened is closed once the reliable channel opened
+	opened     chan struct{}
+	openedOnce sync.Once
+}
+
+func (h *Hub) newRTCPeer(cli *Client) (*rtcPeer, error) {
+	var (
+		pc  *webrtc.PeerConnection
+		err error
+	)
+	if h.rtcAPI != nil {
+		pc, err = h.rtcAPI.NewPeerConnection(h.rtcConfig)
+	} else {
+		pc, err = webrtc.NewPeerConnection(h.rtcConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &rtcPeer{pc: pc, opened: make(chan struct{})}
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		switch dc.Label() {
+		case RTCStateLabel:
+			dc.OnOpen(func() {
+				p.state.Store(dc)
+			})
+		case RTCReliableLabel:
+			dc.OnOpen(func() {
+				p.reliable.Store(dc)
+				p.openedOnce.Do(func() {
+					close(p.opened)
+				})
+			})
+		default:
+			_ = dc.Close()
+			return
+		}
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			cli.receiveRTC(msg.Data)
+		})
+	})
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		switch s {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			// a client without websocket ends with its peer, the others
+			// fall back to the websocket
+			if cli.conn == nil {
+				_ = cli.Close()
+			} else if cli.rtc.CompareAndSwap(p, nil) {
+				p.close()
+			}
+		}
+	})
+	return p, nil
+}
+
+// answer answers the offer with every candidate gathered, the peer does not
+// need to trickle them
+func (p *rtcPeer) answer(offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := p.pc.SetRemoteDescription(offer); err != nil {
+		return nil, err
+	}
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+	gathered := webrtc.GatheringCompletePromise(p.pc)
+	if err := p.pc.SetLocalDescription(answer); err != nil {
+		return nil, err
+	}
+	t := time.NewTimer(rtcConnectTimeout)
+	defer t.Stop()
+	select {
+	case <-gathered:
+	case <-t.C:
+		return nil, errors.New("webrtc: gather candidates timeout")
+	}
+	return p.pc.LocalDescription(), nil
+}
+
+// flush waits until the data channels sent what they buffered or the
+// deadline passed, closing the peer connection drops the rest
+func (p *rtcPeer) flush(deadline time.Time) {
+	for _, dc := range []*webrtc.DataChannel{p.state.Load(), p.reliable.Load()} {
+		for dc != nil && dc.BufferedAmount() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func (p *rtcPeer) close() {
+	if err := p.pc.Close(); err != nil {
+		log.Debugf("rtc: close peer connection error: %v", err)
+	}
+}
+
+// sendState sends status and seek messages on the state channel, it reports
+// whether the message was taken, which it is when it was dropped as well
+func (p *rtcPeer) sendState(msg Message) bool {
+	dc := p.state.Load()
+	if dc == nil || !rtcStateMessage(msg) {
+		return false
+	}
+	if dc.BufferedAmount() > rtcMaxBuffered {
+		return true
+	}
+	data, err := messageBytes(msg)
+	if err != nil {
+		return false
+	}
+	_ = dc.Send(data)
+	return true
+}
+
+// writeReliable is the WriteLoop write of clients without websocket
+func (p *rtcPeer) writeReliable(msg Message) error {
+	switch msg.MessageType() {
+	case websocket.BinaryMessage, websocket.TextMessage:
+	default:
+		// pings keep websockets alive, data channels have their own heartbeat
+		return nil
+	}
+	dc := p.reliable.Load()
+	if dc == nil {
+		return ErrRTCNotOpen
+	}
+	data, err := messageBytes(msg)
+	if err != nil {
+		return err
+	}
+	return dc.Send(data)
+}
+
+func rtcStateMessage(msg Message) bool {
+	if pm, ok := msg.(*PreparedMessage); ok {
+		msg = pm.Message
+	}
+	em, ok := msg.(*ElementMessage)
+	if !ok {
+		return false
+	}
+	switch em.Type {
+	case pb.ElementMessageType_PLAY,
+		pb.ElementMessageType_PAUSE,
+		pb.ElementMessageType_CHECK_SEEK,
+		pb.ElementMessageType_TOO_FAST,
+		pb.ElementMessageType_TOO_SLOW,
+		pb.ElementMessageType_CHANGE_RATE,
+		pb.ElementMessageType_CHANGE_SEEK,
+		pb.ElementMessageType_FORCE_SEEK:
+		return true
+	}
+	return false
+}
+
+// messageBytes encodes msg, prepared messages are encoded once for every client
+func messageBytes(msg Message) ([]byte, error) {
+	if pm, ok := msg.(*PreparedMessage); ok {
+		pm.prepare()
+		return pm.data, pm.err
+	}
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// attachRTC makes p carry the state messages of the client, a peer the
+// client had is closed
+func (c *Client) attachRTC(p *rtcPeer) error {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	if c.Closed() {
+		return ErrAlreadyClosed
+	}
+	if old := c.rtc.Swap(p); old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// closeRTC closes the peer connection of the client if it has one
+func (c *Client) closeRTC() {
+	if p := c.rtc.Swap(nil); p != nil {
+		p.close()
+	}
+}
+
+// receiveRTC dispatches a message of the peer like the websocket handler does
+func (c *Client) receiveRTC(data []byte) {
+	if c.Closed() {
+		return
+	}
+	if int64(len(data)) > c.r.hub.maxMessageSize {
+		log.Warnf("rtc: room %s user %s message too large", c.r.Name, c.u.Username)
+		_ = c.CloseWithReason(websocket.CloseMessageTooBig, ErrMessageTooLarge.Error())
+		return
+	}
+	var msg pb.ElementMessage
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		_ = c.Send(&ElementMessage{
+			Type:    pb.ElementMessageType_ERROR,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := c.Dispatch(&msg); err != nil {
+		log.Errorf("rtc: room %s user %s handle message error: %v", c.r.Name, c.u.Username, err)
+		_ = c.Close()
+	}
+}
+
+// RegClientWithOffer answers the WebRTC offer of the user. Status and seek
+// messages are then sent on the RTCStateLabel data channel of the peer.
+// With the id of a websocket client of the user the peer joins that client,
+// which stays the one logical client of the connection and keeps the other
+// messages on the websocket. Without it, a client is registered whose other
+// messages go over the RTCReliableLabel channel. Closing or kicking the
+// client closes the peer connection.
+func (r *Room) RegClientWithOffer(user *User, clientID string, offer webrtc.SessionDescription) (*Client, *webrtc.SessionDescription, error) {
+	if ShuttingDown() {
+		return nil, nil, ErrShuttingDown
+	}
+	var cli *Client
+	if clientID != "" {
+		c, ok := r.hub.clientsByID.Load(clientID)
+		if !ok || c.u.ID != user.ID {
+			return nil, nil, ErrClientNotFound
+		}
+		cli = c
+	} else {
+		cli = newClient(user, r, nil)
+	}
+	p, err := r.hub.newRTCPeer(cli)
+	if err != nil {
+		return nil, nil, err
+	}
+	answer, err := p.answer(offer)
+	if err != nil {
+		p.close()
+		return nil, nil, err
+	}
+	if err := cli.attachRTC(p); err != nil {
+		p.close()
+		return nil, nil, err
+	}
+	if clientID == "" {
+		if err := r.RegClient(cli); err != nil {
+			cli.closeRTC()
+			return nil, nil, err
+		}
+		go r.serveRTC(cli, p)
+	}
+	return cli, answer, nil
+}
+
+// serveRTC writes the queued messages of a client without websocket to the
+// reliable channel once the peer opened it
+func (r *Room) serveRTC(cli *Client, p *rtcPeer) {
+	defer func() {
+		_ = r.UnregisterClient(cli)
+		_ = cli.Close()
+	}()
+	t := time.NewTimer(rtcConnectTimeout)
+	defer t.Stop()
+	select {
+	case <-p.opened:
+	case <-cli.exit:
+	case <-t.C:
+		log.Debugf("rtc: room %s user %s open reliable channel timeout", r.Name, cli.u.Username)
+		_ = cli.Close()
+	}
+	if err := cli.WriteLoop(p.writeReliable); err != nil {
+		log.Debugf("rtc: room %s user %s write message error: %v", r.Name, cli.u.Username, err)
+	}
+}
@@ -0,0 +1,239 @@
+package op
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+	"google.golang.org/protobuf/proto"
+)
+
+// loopbackRTC connects the peers of a test over the loopback interface
+func loopbackRTC() *webrtc.API {
+	var s webrtc.SettingEngine
+	s.SetIncludeLoopbackCandidate(true)
+	s.SetInterfaceFilter(func(name string) bool { return name == "lo" })
+	s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	return webrtc.NewAPI(webrtc.WithSettingEngine(s))
+}
+
+type rtcTestMessage struct {
+	label string
+	msg   *pb.ElementMessage
+}
+
+// rtcTestPeer is the browser side of a peer connection
+type rtcTestPeer struct {
+	pc       *webrtc.PeerConnection
+	channels map[string]*webrtc.DataChannel
+	received chan rtcTestMessage
+}
+
+func (p *rtcTestPeer) next(t *testing.T) rtcTestMessage {
+	t.Helper()
+	select {
+	case m := <-p.received:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message on the data channels")
+		return rtcTestMessage{}
+	}
+}
+
+// dialRTC offers a peer connection to the room like a browser would and
+// waits for the server to have its channels open
+func dialRTC(t *testing.T, r *Room, user *User, clientID string) (*Client, *rtcTestPeer) {
+	t.Helper()
+	pc, err := loopbackRTC().NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	peer := &rtcTestPeer{
+		pc:       pc,
+		channels: make(map[string]*webrtc.DataChannel),
+		received: make(chan rtcTestMessage, 16),
+	}
+	ordered := false
+	var retransmits uint16
+	labels := []string{RTCStateLabel}
+	if clientID == "" {
+		labels = append(labels, RTCReliableLabel)
+	}
+	for _, label := range labels {
+		init := &webrtc.DataChannelInit{}
+		if label == RTCStateLabel {
+			init.Ordered = &ordered
+			init.MaxRetransmits = &retransmits
+		}
+		dc, err := pc.CreateDataChannel(label, init)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc.OnMessage(func(m webrtc.DataChannelMessage) {
+			em := new(pb.ElementMessage)
+			if err := proto.Unmarshal(m.Data, em); err != nil {
+				t.Error(err)
+				return
+			}
+			peer.received <- rtcTestMessage{label: dc.Label(), msg: em}
+		})
+		peer.channels[label] = dc
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	c, answer, err := r.RegClientWithOffer(user, clientID, *pc.LocalDescription())
+	if err != nil {
+		t.Fatalf("RegClientWithOffer() = %v", err)
+	}
+	if err := pc.SetRemoteDescription(*answer); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p := c.rtc.Load()
+		if p != nil && p.state.Load() != nil && (clientID != "" || p.reliable.Load() != nil) {
+			return c, peer
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("data channels did not open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitRTCClosed(t *testing.T, p *rtcPeer) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.pc.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer connection is %s, want closed", p.pc.ConnectionState())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newRTCRoom(t *testing.T) *Room {
+	r := newRoom(&model.Room{ID: "rtc"}, WithWebRTC(loopbackRTC(), webrtc.Configuration{}))
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	t.Cleanup(func() { r.close() })
+	return r
+}
+
+func TestRegClientWithOffer(t *testing.T) {
+	r := newRTCRoom(t)
+	user := &User{User: model.User{ID: "u"}}
+	defer func(d *Dispatcher) {
+		messageDispatcher = d
+	}(messageDispatcher)
+	messageDispatcher = NewDispatcher()
+	inbound := make(chan *pb.ElementMessage, 1)
+	messageDispatcher.Handle(pb.ElementMessageType_CHAT_MESSAGE, func(ctx *MessageContext) error {
+		inbound <- ctx.Msg
+		return nil
+	})
+	c, peer := dialRTC(t, r, user, "")
+	if n := r.hub.ConnectionCount(user.ID); n != 1 {
+		t.Fatalf("ConnectionCount() = %d, want 1", n)
+	}
+
+	if err := r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_PLAY, Seek: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if m := peer.next(t); m.label != RTCStateLabel || m.msg.Type != pb.ElementMessageType_PLAY {
+		t.Fatalf("got %s on %s, want PLAY on %s", m.msg.Type, m.label, RTCStateLabel)
+	}
+	if err := r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := peer.next(t); m.label != RTCReliableLabel || m.msg.Message != "hi" {
+		t.Fatalf("got %s %q on %s, want the chat message on %s", m.msg.Type, m.msg.Message, m.label, RTCReliableLabel)
+	}
+
+	data, err := proto.Marshal(&pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.channels[RTCReliableLabel].Send(data); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-inbound:
+		if m.Message != "hello" {
+			t.Fatalf("dispatched %q, want hello", m.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message of the peer was not dispatched")
+	}
+
+	p := c.rtc.Load()
+	if err := r.hub.CloseUser(user.ID, CloseCodeKicked, CloseReasonKicked); err != nil {
+		t.Fatal(err)
+	}
+	waitRTCClosed(t, p)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.UserOnline(user.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("kicked client is still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegClientWithOfferJoinsClient(t *testing.T) {
+	r := newRTCRoom(t)
+	start := make(chan struct{})
+	close(start)
+	ws, conn := serveTestClient(t, r.RegClient, start)
+	c, peer := dialRTC(t, r, &User{User: model.User{ID: ws.u.ID}}, ws.ID())
+	if c != ws {
+		t.Fatal("the peer did not join the websocket client")
+	}
+	if n := r.hub.ConnectionCount(ws.u.ID); n != 1 {
+		t.Fatalf("ConnectionCount() = %d, want 1", n)
+	}
+
+	if err := r.Broadcast(&ElementMessage{Type: pb.ElementMessageType_CHANGE_SEEK, Seek: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if m := peer.next(t); m.label != RTCStateLabel || m.msg.Type != pb.ElementMessageType_CHANGE_SEEK {
+		t.Fatalf("got %s on %s, want CHANGE_SEEK on %s", m.msg.Type, m.label, RTCStateLabel)
+	}
+	// queued before the kick, so the websocket still writes it
+	if err := r.hub.BroadcastContext(context.Background(), &ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := c.rtc.Load()
+	if err := r.hub.CloseUser(ws.u.ID, CloseCodeKicked, CloseReasonKicked); err != nil {
+		t.Fatal(err)
+	}
+	msgs, ce := readUntilClose(t, conn, pb.ElementMessageType_CHAT_MESSAGE)
+	if got := chatTexts(msgs); len(got) != 1 || got[0] != "hi" {
+		t.Fatalf("got chat messages %v on the websocket, want [hi]", got)
+	}
+	if ce.Code != CloseCodeKicked {
+		t.Fatalf("close code = %d, want %d", ce.Code, CloseCodeKicked)
+	}
+	waitRTCClosed(t, p)
+}
+
+func TestRegClientWithOfferUnknownClient(t *testing.T) {
+	r := newRTCRoom(t)
+	_, _, err := r.RegClientWithOffer(&User{User: model.User{ID: "u"}}, "missing", webrtc.SessionDescription{})
+	if err != ErrClientNotFound {
+		t.Fatalf("RegClientWithOffer() = %v, want %v", err, ErrClientNotFound)
+	}
+}
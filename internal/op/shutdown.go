@@ -0,0 +1,103 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/vendor"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+var (
+	shutdownOnce sync.Once
+	shuttingDown atomic.Bool
+)
+
+// ShuttingDown reports whether Shutdown was called
+func ShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// ShutdownReport is how the rooms were closed by Shutdown
+type ShutdownReport struct {
+	// Clean rooms stopped and delivered their queued webhooks in time
+	Clean int
+	// Forced rooms were closed without waiting for them
+	Forced int
+}
+
+// Shutdown closes every room for a restart and is safe to call from several
+// places, only the first call shuts down, the others return an empty report
+// at once. New rooms and clients are refused from then on. The rooms are
+// closed closeAllWorkers at a time: each first gets a MAINTENANCE message
+// whose time is when the server expects to be back, 0 if eta is unknown,
+// then it is closed and the webhooks it queued are delivered. Rooms that did
+// not finish before ctx is done are closed without waiting. The vendor
+// backend connections are closed last, ctx.Err() is returned if the deadline
+// was hit.
+func Shutdown(ctx context.Context, eta time.Duration) (ShutdownReport, error) {
+	var (
+		report ShutdownReport
+		err    error
+		first  bool
+	)
+	shutdownOnce.Do(func() {
+		first = true
+		report, err = shutdown(ctx, eta)
+	})
+	if !first {
+		return ShutdownReport{}, nil
+	}
+	return report, err
+}
+
+func shutdown(ctx context.Context, eta time.Duration) (ShutdownReport, error) {
+	shuttingDown.Store(true)
+	var rooms []*Room
+	if roomCache != nil {
+		roomCache.Range(func(_ string, e *RoomEntry) bool {
+			rooms = append(rooms, e.Value())
+			return true
+		})
+	}
+	notice := &ElementMessage{
+		Type:    pb.ElementMessageType_MAINTENANCE,
+		Sender:  SystemSender,
+		Message: "server is restarting",
+	}
+	if eta > 0 {
+		notice.Time = time.Now().Add(eta).UnixMilli()
+	}
+	clean, errs := closeRooms(ctx, rooms, func(r *Room, ctx context.Context) error {
+		// the notice is queued for every client before the hub closes them,
+		// their writers drain the queue before the close frame and
+		// closeAndWait waits for the writers, so it is written first
+		if err := r.BroadcastContext(ctx, notice); err != nil {
+			return err
+		}
+		if err := r.closeAndWait(ctx); err != nil {
+			return err
+		}
+		return r.webhooks.wait(ctx)
+	})
+	for _, err := range errs {
+		log.Warnf("shutdown: %v", err)
+	}
+	// rooms that failed or were never started are closed right away
+	for _, r := range rooms {
+		_ = r.close()
+	}
+	report := ShutdownReport{Clean: clean, Forced: len(rooms) - clean}
+	log.Infof("shutdown: %d rooms closed cleanly, %d forcibly", report.Clean, report.Forced)
+
+	if err := vendor.Close(); err != nil {
+		log.Warnf("shutdown: close vendor backends: %v", err)
+	}
+	return report, ctx.Err()
+}
@@ -0,0 +1,64 @@
+package op
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+	pb "github.com/synctv-org/synctv/proto/message"
+	"github.com/zijiren233/gencontainer/synccache"
+)
+
+func TestShutdown(t *testing.T) {
+	defer func(c *synccache.SyncCache[string, *Room]) {
+		roomCache = c
+		shuttingDown.Store(false)
+	}(roomCache)
+	roomCache = synccache.NewSyncCache[string, *Room](time.Minute)
+
+	var rooms []*Room
+	for _, id := range []string{"a", "b"} {
+		r := newRoom(&model.Room{ID: id})
+		r.movies.once.Do(func() {
+			r.movies.restore(nil)
+		})
+		roomCache.LoadOrStore(id, r, time.Minute)
+		rooms = append(rooms, r)
+	}
+	// b was never joined, so it has no running hub
+	start := make(chan struct{})
+	close(start)
+	_, conn := serveTestClient(t, rooms[0].RegClient, start)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := shutdown(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("shutdown() = %v", err)
+	}
+	if report != (ShutdownReport{Clean: 2}) {
+		t.Fatalf("report = %+v, want 2 clean rooms", report)
+	}
+	notices, ce := readUntilClose(t, conn, pb.ElementMessageType_MAINTENANCE)
+	if len(notices) != 1 {
+		t.Fatalf("got %d maintenance notices before the close frame, want 1", len(notices))
+	}
+	if d := time.Until(time.UnixMilli(notices[0].Time)); d <= 0 || d > time.Minute {
+		t.Fatalf("notice eta is %v away", d)
+	}
+	if ce.Code != CloseCodeRoomClosed || ce.Text != CloseReasonRoomClosed {
+		t.Fatalf("close frame = %d %q, want %d %q", ce.Code, ce.Text, CloseCodeRoomClosed, CloseReasonRoomClosed)
+	}
+	for _, r := range rooms {
+		if !r.Closed() {
+			t.Fatalf("room %s is open", r.ID)
+		}
+	}
+	if err := rooms[1].RegClient(newTestClient("v")); err != ErrShuttingDown {
+		t.Fatalf("RegClient() = %v, want %v", err, ErrShuttingDown)
+	}
+	if _, err := LoadOrInitRoom(&model.Room{ID: "c"}); err != ErrShuttingDown {
+		t.Fatalf("LoadOrInitRoom() = %v, want %v", err, ErrShuttingDown)
+	}
+}
@@ -0,0 +1,136 @@
+package op
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+// roomAdminPermissions are the permissions that make a room member an admin
+const roomAdminPermissions = model.PermissionEditRoom | model.PermissionEditUser
+
+var (
+	ErrTakeoverDisabled    = errors.New("room takeover is disabled")
+	ErrCreatorNotAbsent    = errors.New("room creator has not been absent long enough")
+	ErrNotLongestTenured   = errors.New("only the longest tenured room admin can take over the room")
+	ErrAlreadyCreator      = errors.New("already the room creator")
+	ErrNotPreviousCreator  = errors.New("not the previous room creator")
+	ErrReclaimGraceExpired = errors.New("reclaim grace period has expired")
+)
+
+// CreatedBy returns the id of the room creator, it is read instead of
+// CreatorID, which is not updated when the room is taken over
+func (r *Room) CreatedBy() string {
+	return *r.creator.Load()
+}
+
+// initialCreatorLastSeen is when the creator was last in the room as
+// recorded in the database, rooms that did not record it yet count from
+// their last update
+func initialCreatorLastSeen(room *model.Room) int64 {
+	switch {
+	case room.CreatorLastSeenAt > 0:
+		return room.CreatorLastSeenAt
+	case !room.UpdatedAt.IsZero():
+		return room.UpdatedAt.UnixMilli()
+	default:
+		return time.Now().UnixMilli()
+	}
+}
+
+// touchCreator records that the creator joined or left the room now, it is
+// stored so the absence still counts after the room is loaded again
+func (r *Room) touchCreator(userID string) {
+	if userID != r.CreatedBy() {
+		return
+	}
+	now := time.Now().UnixMilli()
+	r.creatorLastSeen.Store(now)
+	if err := db.SetRoomCreatorLastSeen(r.ID, now); err != nil {
+		log.Warnf("room %s: record creator last seen error: %v", r.ID, err)
+	}
+}
+
+func (r *Room) creatorOnline() bool {
+	return r.UserOnline(r.CreatedBy())
+}
+
+// CreatorAbsentFor returns how long the creator has been offline, 0 if online
+func (r *Room) CreatorAbsentFor() time.Duration {
+	if r.creatorOnline() {
+		return 0
+	}
+	return time.Since(time.UnixMilli(r.creatorLastSeen.Load()))
+}
+
+// ClaimRoot makes u the room creator when the creator has been absent longer
+// than settings.RoomCreatorTakeoverHours and u is the longest tenured room admin
+func (r *Room) ClaimRoot(u *User) error {
+	hours := settings.RoomCreatorTakeoverHours.Get()
+	if hours <= 0 {
+		return ErrTakeoverDisabled
+	}
+	r.creatorLock.Lock()
+	defer r.creatorLock.Unlock()
+	if r.CreatedBy() == u.ID {
+		return ErrAlreadyCreator
+	}
+	if r.CreatorAbsentFor() < time.Duration(hours)*time.Hour {
+		return ErrCreatorNotAbsent
+	}
+	admins, err := db.GetRoomAdminRelations(r.ID, roomAdminPermissions)
+	if err != nil {
+		return err
+	}
+	for _, a := range admins {
+		if a.UserID == r.CreatedBy() {
+			continue
+		}
+		if a.UserID != u.ID {
+			return ErrNotLongestTenured
+		}
+		return r.transferCreator(u)
+	}
+	return ErrNotLongestTenured
+}
+
+// ReclaimRoot gives the room back to the creator it was taken over from,
+// within settings.RoomCreatorReclaimHours of the takeover
+func (r *Room) ReclaimRoot(u *User) error {
+	r.creatorLock.Lock()
+	defer r.creatorLock.Unlock()
+	if r.CreatedBy() == u.ID {
+		return ErrAlreadyCreator
+	}
+	if r.PreviousCreatorID != u.ID {
+		return ErrNotPreviousCreator
+	}
+	if time.Since(time.UnixMilli(r.CreatorTransferredAt)) > time.Duration(settings.RoomCreatorReclaimHours.Get())*time.Hour {
+		return ErrReclaimGraceExpired
+	}
+	return r.transferCreator(u)
+}
+
+// transferCreator must be called with creatorLock held
+func (r *Room) transferCreator(u *User) error {
+	from, now := r.CreatedBy(), time.Now()
+	if err := db.TransferRoomCreator(r.ID, from, u.ID, now.UnixMilli()); err != nil {
+		return err
+	}
+	to := u.ID
+	r.creator.Store(&to)
+	r.PreviousCreatorID = from
+	r.CreatorTransferredAt = now.UnixMilli()
+	r.creatorLastSeen.Store(now.UnixMilli())
+	log.Infof("room %s: creator transferred from %s to %s", r.Name, GetUserName(from), u.Username)
+	r.logUserActivity(ActivityCreatorChanged, u, nil)
+	return r.Broadcast(&ElementMessage{
+		Type:   pb.ElementMessageType_CHANGE_CREATOR,
+		Sender: u.Username,
+	})
+}
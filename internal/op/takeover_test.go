@@ -0,0 +1,118 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+)
+
+// newTakeoverRoom creates a room whose creator was last seen absent ago and
+// an admin that joined after the creator
+func newTakeoverRoom(t *testing.T, absent time.Duration) (*Room, *User, *User) {
+	t.Helper()
+	useTestDB(t)
+	creator, err := CreateUser("creator", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := CreateUser("admin", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.CreateRoom("takeover", "", 0, db.WithCreator(&creator.Value().User))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FirstOrCreateRoomUserRelation(m.ID, admin.Value().ID, db.WithRoomUserRelationStatus(model.RoomUserStatusActive), db.WithRoomUserRelationPermissions(roomAdminPermissions)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRoomCreatorLastSeen(m.ID, time.Now().Add(-absent).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	// load the room again so the absence comes from the database
+	m, err = db.GetRoomByID(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRoom(m)
+	return r, creator.Value(), admin.Value()
+}
+
+func setTakeoverHours(t *testing.T, hours int64) {
+	t.Helper()
+	if err := settings.RoomCreatorTakeoverHours.Set(hours); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = settings.RoomCreatorTakeoverHours.Set(0) })
+}
+
+func TestClaimRoot(t *testing.T) {
+	r, creator, admin := newTakeoverRoom(t, 48*time.Hour)
+	if err := r.ClaimRoot(admin); err != ErrTakeoverDisabled {
+		t.Fatalf("ClaimRoot() = %v, want %v", err, ErrTakeoverDisabled)
+	}
+	setTakeoverHours(t, 24)
+	if err := r.ClaimRoot(creator); err != ErrAlreadyCreator {
+		t.Fatalf("ClaimRoot() by creator = %v, want %v", err, ErrAlreadyCreator)
+	}
+	if err := r.ClaimRoot(admin); err != nil {
+		t.Fatalf("ClaimRoot() = %v, want nil", err)
+	}
+	if got := r.CreatedBy(); got != admin.ID {
+		t.Fatalf("CreatedBy() = %q, want %q", got, admin.ID)
+	}
+	m, err := db.GetRoomByID(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CreatorID != admin.ID || m.PreviousCreatorID != creator.ID {
+		t.Fatalf("stored creator = %q previous %q, want %q previous %q", m.CreatorID, m.PreviousCreatorID, admin.ID, creator.ID)
+	}
+	log := r.ActivityLog(0)
+	if len(log) == 0 || log[len(log)-1].Type != ActivityCreatorChanged || log[len(log)-1].UserID != admin.ID {
+		t.Fatalf("ActivityLog() = %+v, want a %s entry by %s", log, ActivityCreatorChanged, admin.ID)
+	}
+
+	if err := r.ReclaimRoot(admin); err != ErrAlreadyCreator {
+		t.Fatalf("ReclaimRoot() by creator = %v, want %v", err, ErrAlreadyCreator)
+	}
+	if err := r.ReclaimRoot(creator); err != nil {
+		t.Fatalf("ReclaimRoot() = %v, want nil", err)
+	}
+	if got := r.CreatedBy(); got != creator.ID {
+		t.Fatalf("CreatedBy() after reclaim = %q, want %q", got, creator.ID)
+	}
+}
+
+func TestClaimRootCreatorNotAbsent(t *testing.T) {
+	r, _, admin := newTakeoverRoom(t, time.Hour)
+	setTakeoverHours(t, 24)
+	if err := r.ClaimRoot(admin); err != ErrCreatorNotAbsent {
+		t.Fatalf("ClaimRoot() = %v, want %v", err, ErrCreatorNotAbsent)
+	}
+}
+
+func TestClaimRootNotLongestTenured(t *testing.T) {
+	r, _, _ := newTakeoverRoom(t, 48*time.Hour)
+	setTakeoverHours(t, 24)
+	late, err := CreateUser("late", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FirstOrCreateRoomUserRelation(r.ID, late.Value().ID, db.WithRoomUserRelationStatus(model.RoomUserStatusActive), db.WithRoomUserRelationPermissions(roomAdminPermissions)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ClaimRoot(late.Value()); err != ErrNotLongestTenured {
+		t.Fatalf("ClaimRoot() = %v, want %v", err, ErrNotLongestTenured)
+	}
+}
+
+func TestReclaimRootNotPreviousCreator(t *testing.T) {
+	r, _, admin := newTakeoverRoom(t, 48*time.Hour)
+	if err := r.ReclaimRoot(admin); err != ErrNotPreviousCreator {
+		t.Fatalf("ReclaimRoot() = %v, want %v", err, ErrNotPreviousCreator)
+	}
+}
@@ -0,0 +1,77 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+// RoomTemplate describes a preconfigured room, it can be defined in code
+// or loaded from JSON
+type RoomTemplate struct {
+	// Settings also carry the default permissions of new members
+	Settings model.RoomSettings `json:"settings"`
+	// Movies seed the playlist, they are not attributed to any user
+	Movies []*model.BaseMovie `json:"movies,omitempty"`
+}
+
+// Validate returns *ErrInvalidField for the first offending field
+func (t *RoomTemplate) Validate() error {
+	if err := ValidateRoomSettings(&t.Settings); err != nil {
+		return invalidField("settings", err)
+	}
+	for i, m := range t.Movies {
+		if err := validateTemplateMovie(m); err != nil {
+			return invalidField(fmt.Sprintf("movies[%d]", i), err)
+		}
+	}
+	return nil
+}
+
+func validateTemplateMovie(m *model.BaseMovie) error {
+	if m == nil {
+		return errors.New("movie is nil")
+	}
+	if m.Name == "" {
+		return invalidField("name", errors.New("empty name"))
+	}
+	// vendor movies are played with the credentials of their creator
+	if m.VendorInfo.Vendor != "" {
+		return invalidField("vendorInfo", errors.New("vendor movies are not supported in templates"))
+	}
+	if !m.MediaKind.Valid() {
+		return invalidField("mediaKind", errors.New("invalid media kind"))
+	}
+	// the same checks a pushed movie goes through
+	return ValidateMovie(m)
+}
+
+// CreateRoomFromTemplate creates a room owned by the user with the settings
+// and playlist of the template
+func (u *User) CreateRoomFromTemplate(name, password string, tmpl *RoomTemplate) (*RoomEntry, error) {
+	if err := tmpl.Validate(); err != nil {
+		return nil, err
+	}
+	room, err := u.CreateRoom(name, password, db.WithSetting(tmpl.Settings))
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Movies) == 0 {
+		return room, nil
+	}
+	movies := make([]*model.Movie, len(tmpl.Movies))
+	for i, m := range tmpl.Movies {
+		base := *m
+		if base.MediaKind == model.MediaKindUnknown {
+			base.MediaKind = base.InferMediaKind()
+		}
+		movies[i] = &model.Movie{Base: base}
+	}
+	if err := room.Value().AddMovies(movies); err != nil {
+		_ = CompareAndDeleteRoom(room)
+		return nil, err
+	}
+	return room, nil
+}
@@ -0,0 +1,86 @@
+package op
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestRoomTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tmpl  RoomTemplate
+		field string
+	}{
+		{
+			name:  "rate",
+			tmpl:  RoomTemplate{Settings: model.RoomSettings{AllowedRates: []float64{1, -1}}},
+			field: "settings.allowedRates[1]",
+		},
+		{
+			name:  "ratio",
+			tmpl:  RoomTemplate{Settings: model.RoomSettings{BufferingAssistRatio: 2}},
+			field: "settings.bufferingAssistRatio",
+		},
+		{
+			name: "name",
+			tmpl: RoomTemplate{Movies: []*model.BaseMovie{
+				{Name: "a", Url: "https://example.com/a.mp4"},
+				{Url: "https://example.com/b.mp4"},
+			}},
+			field: "movies[1].name",
+		},
+		{
+			name: "url",
+			tmpl: RoomTemplate{Movies: []*model.BaseMovie{
+				{Name: "a", Url: "ftp://example.com/a.mp4"},
+			}},
+			field: "movies[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tmpl.Validate()
+			var f *ErrInvalidField
+			if !errors.As(err, &f) {
+				t.Fatalf("Validate() = %v, want *ErrInvalidField", err)
+			}
+			if f.Field != tt.field {
+				t.Fatalf("Field = %q, want %q", f.Field, tt.field)
+			}
+		})
+	}
+
+	ok := RoomTemplate{
+		Settings: model.RoomSettings{Hidden: true, AllowedRates: []float64{1, 1.5}},
+		Movies:   []*model.BaseMovie{{Name: "a", Url: "https://example.com/a.mp4"}},
+	}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestRoomTemplateJSON(t *testing.T) {
+	tmpl := RoomTemplate{
+		Settings: model.RoomSettings{
+			Hidden:                 true,
+			CanSendChat:            true,
+			UserDefaultPermissions: model.PermissionCreateMovie,
+		},
+		Movies: []*model.BaseMovie{{Name: "a", Url: "https://example.com/a.mp4"}},
+	}
+	data, err := json.Marshal(&tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got RoomTemplate
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tmpl) {
+		t.Fatalf("round trip = %+v, want %+v", got, tmpl)
+	}
+}
@@ -0,0 +1,40 @@
+package op
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/synctv-org/synctv/internal/op"
+
+// WithTracer traces the operations of the room with t instead of the
+// tracer of the global otel tracer provider
+func WithTracer(t trace.Tracer) RoomConf {
+	return func(r *Room) {
+		r.tracer = t
+	}
+}
+
+// startSpan starts the span of a room operation as a child of the span in ctx
+func (r *Room) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	t := r.tracer
+	if t == nil {
+		t = otel.Tracer(tracerName)
+	}
+	return t.Start(ctx, "room."+name, trace.WithAttributes(
+		append([]attribute.KeyValue{attribute.String("room.id", r.ID)}, attrs...)...,
+	))
+}
+
+// endSpan records err, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,55 @@
+package op
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/model"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// recordingTracer records the name and the parent of every span it starts
+type recordingTracer struct {
+	embedded.Tracer
+	mu      sync.Mutex
+	names   []string
+	parents []trace.SpanContext
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.names = append(t.names, name)
+	t.parents = append(t.parents, trace.SpanContextFromContext(ctx))
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{byte(len(t.names))},
+	}))
+	return ctx, trace.SpanFromContext(ctx)
+}
+
+func TestStartSpanParent(t *testing.T) {
+	tracer := &recordingTracer{}
+	r := newRoom(&model.Room{ID: "traced"}, WithTracer(tracer))
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{2},
+		SpanID:  trace.SpanID{2},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+	if err := r.BroadcastContext(ctx, &ElementMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.names) != 1 || tracer.names[0] != "room.Broadcast" {
+		t.Fatalf("spans = %v, want [room.Broadcast]", tracer.names)
+	}
+	if !tracer.parents[0].Equal(parent) {
+		t.Fatalf("parent = %v, want %v", tracer.parents[0], parent)
+	}
+	// spans of other rooms go to the global tracer provider
+	newRoom(&model.Room{ID: "other"}).Broadcast(&ElementMessage{})
+	if len(tracer.names) != 1 {
+		t.Fatalf("spans = %v, want only the traced room", tracer.names)
+	}
+}
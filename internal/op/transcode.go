@@ -0,0 +1,168 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/conf"
+)
+
+const (
+	// maxTranscodeRestarts bounds how often a crashing transcode is restarted in a row
+	maxTranscodeRestarts = 5
+	// transcodeStableRun resets the restart count once a transcode ran this long
+	transcodeStableRun = time.Minute
+	// transcodeWaitDelay bounds waiting for ffmpeg pipes after it exited
+	transcodeWaitDelay = time.Second
+)
+
+var (
+	ErrUnknownTranscodeProfile    = errors.New("unknown transcode profile")
+	ErrTranscodeProfileNotAllowed = errors.New("transcode profile is not allowed")
+)
+
+// transcodeProfiles maps the profile names movies may use to the ffmpeg output options
+var transcodeProfiles = map[string][]string{
+	"h264-source": {"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-c:a", "aac"},
+	"h264-720p":   {"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-vf", "scale=-2:720", "-c:a", "aac"},
+	"h264-480p":   {"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-vf", "scale=-2:480", "-c:a", "aac"},
+}
+
+// Transcoder re-encodes a live flv stream with a transcode profile
+type Transcoder interface {
+	// Transcode returns the re-encoded flv stream of in, transcoding stops
+	// when ctx is canceled or the returned stream is closed
+	Transcode(ctx context.Context, in io.Reader, profile string) (io.ReadCloser, error)
+}
+
+var transcoder Transcoder
+
+func WithTranscoder(t Transcoder) InitConfig {
+	return func() {
+		transcoder = t
+	}
+}
+
+func getTranscoder() Transcoder {
+	if transcoder != nil {
+		return transcoder
+	}
+	return &FFmpegTranscoder{Path: conf.Conf.Transcode.FFmpegPath}
+}
+
+// checkTranscodeProfile reports whether profile is known and in the allow-list of the server
+func checkTranscodeProfile(profile string, allowed []string) error {
+	if _, ok := transcodeProfiles[profile]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTranscodeProfile, profile)
+	}
+	if !slices.Contains(allowed, profile) {
+		return fmt.Errorf("%w: %s", ErrTranscodeProfileNotAllowed, profile)
+	}
+	return nil
+}
+
+// FFmpegTranscoder transcodes by piping the stream through an ffmpeg process
+type FFmpegTranscoder struct {
+	// Path of the ffmpeg binary, looked up in PATH when empty
+	Path string
+}
+
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, in io.Reader, profile string) (io.ReadCloser, error) {
+	opts, ok := transcodeProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTranscodeProfile, profile)
+	}
+	path := t.Path
+	if path == "" {
+		path = "ffmpeg"
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", "flv", "-i", "pipe:0"}
+	args = append(args, opts...)
+	args = append(args, "-f", "flv", "pipe:1")
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = in
+	// the copy from in may block on the upstream after ffmpeg exited
+	cmd.WaitDelay = transcodeWaitDelay
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &ffmpegStream{ReadCloser: out, cmd: cmd}, nil
+}
+
+type ffmpegStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close stops ffmpeg, the error of a process that exited on its own is returned
+func (s *ffmpegStream) Close() error {
+	_ = s.cmd.Process.Kill()
+	err := s.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !exitErr.Exited() {
+		// killed by us
+		return nil
+	}
+	return err
+}
+
+type TranscodeState string
+
+const (
+	TranscodeStateRunning    TranscodeState = "running"
+	TranscodeStateRestarting TranscodeState = "restarting"
+	TranscodeStateFailed     TranscodeState = "failed"
+)
+
+type TranscodeStatus struct {
+	Profile  string         `json:"profile"`
+	State    TranscodeState `json:"state"`
+	Restarts int            `json:"restarts"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// TranscodeStatus returns the status of the live transcode of the movie,
+// false if the movie is not being transcoded
+func (m *Movie) TranscodeStatus() (TranscodeStatus, bool) {
+	s := m.transcodeStatus.Load()
+	if s == nil {
+		return TranscodeStatus{}, false
+	}
+	return *s, true
+}
+
+func (m *Movie) setTranscodeStatus(state TranscodeState, restarts int, err error) {
+	s := &TranscodeStatus{
+		Profile:  m.Movie.Base.TranscodeProfile,
+		State:    state,
+		Restarts: restarts,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	m.transcodeStatus.Store(s)
+}
+
+// transcodeRestarts counts consecutive transcode crashes of a puller
+type transcodeRestarts struct {
+	count int
+}
+
+// crashed records a transcode run that ended after ran and reports whether
+// it may be restarted
+func (r *transcodeRestarts) crashed(ran time.Duration) bool {
+	if ran >= transcodeStableRun {
+		r.count = 0
+	}
+	r.count++
+	return r.count <= maxTranscodeRestarts
+}
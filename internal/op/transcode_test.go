@@ -0,0 +1,47 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTranscodeProfile(t *testing.T) {
+	allowed := []string{"h264-720p"}
+	if err := checkTranscodeProfile("h264-720p", allowed); err != nil {
+		t.Fatalf("checkTranscodeProfile() = %v, want nil", err)
+	}
+	if err := checkTranscodeProfile("h264-480p", allowed); !errors.Is(err, ErrTranscodeProfileNotAllowed) {
+		t.Fatalf("checkTranscodeProfile() = %v, want %v", err, ErrTranscodeProfileNotAllowed)
+	}
+	if err := checkTranscodeProfile("vp9", []string{"vp9"}); !errors.Is(err, ErrUnknownTranscodeProfile) {
+		t.Fatalf("checkTranscodeProfile() = %v, want %v", err, ErrUnknownTranscodeProfile)
+	}
+}
+
+func TestTranscodeRestarts(t *testing.T) {
+	var r transcodeRestarts
+	for i := 0; i < maxTranscodeRestarts; i++ {
+		if !r.crashed(time.Second) {
+			t.Fatalf("restart %d refused", i+1)
+		}
+	}
+	if r.crashed(time.Second) {
+		t.Fatal("restart allowed after the limit")
+	}
+	if !r.crashed(transcodeStableRun) {
+		t.Fatal("restart refused after a stable run")
+	}
+}
+
+func TestFFmpegTranscoderErrors(t *testing.T) {
+	tr := &FFmpegTranscoder{Path: "/nonexistent/ffmpeg"}
+	if _, err := tr.Transcode(context.Background(), strings.NewReader(""), "vp9"); !errors.Is(err, ErrUnknownTranscodeProfile) {
+		t.Fatalf("Transcode() = %v, want %v", err, ErrUnknownTranscodeProfile)
+	}
+	if _, err := tr.Transcode(context.Background(), strings.NewReader(""), "h264-source"); err == nil {
+		t.Fatal("Transcode() started a missing binary")
+	}
+}
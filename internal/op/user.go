@@ -1,8 +1,17 @@
 package op
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"hash/crc32"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"sync"
 	"sync/atomic"
 
 	"github.com/synctv-org/synctv/internal/cache"
@@ -20,6 +29,24 @@ type User struct {
 	alistCache    atomic.Pointer[cache.AlistUserCache]
 	bilibiliCache atomic.Pointer[cache.BilibiliUserCache]
 	embyCache     atomic.Pointer[cache.EmbyUserCache]
+	// sessionTokenHash is the hash of the current session token, empty if
+	// the user has none yet, see RotateSessionToken
+	sessionTokenHash atomic.Pointer[string]
+	// sessionToken is the current session token if it was issued since the
+	// user was loaded, only its hash is stored
+	sessionToken atomic.Pointer[string]
+}
+
+// ConnectionCount returns how many clients of the user are connected to rooms,
+// it is counted from the hubs of the loaded rooms so it does not depend on
+// the user staying cached
+func (u *User) ConnectionCount() int {
+	var n int
+	roomCache.Range(func(_ string, e *RoomEntry) bool {
+		n += e.Value().hub.ConnectionCount(u.ID)
+		return true
+	})
+	return n
 }
 
 func (u *User) AlistCache() *cache.AlistUserCache {
@@ -55,6 +82,17 @@ func (u *User) EmbyCache() *cache.EmbyUserCache {
 	return c
 }
 
+// ClearVendors deletes all vendor credentials of the user and drops their caches
+func (u *User) ClearVendors() error {
+	if err := db.DeleteUserVendors(u.ID); err != nil {
+		return err
+	}
+	u.alistCache.Store(nil)
+	u.bilibiliCache.Store(nil)
+	u.embyCache.Store(nil)
+	return nil
+}
+
 func (u *User) Version() uint32 {
 	return atomic.LoadUint32(&u.version)
 }
@@ -63,7 +101,50 @@ func (u *User) CheckVersion(version uint32) bool {
 	return atomic.LoadUint32(&u.version) == version
 }
 
+var ErrInvalidSessionToken = errors.New("invalid session token")
+
+// SessionToken returns the session token of the user, only its hash is
+// stored so it is empty when the token was issued before the user was
+// loaded, RotateSessionToken issues one that can be read again
+func (u *User) SessionToken() string {
+	if t := u.sessionToken.Load(); t != nil {
+		return *t
+	}
+	return ""
+}
+
+// HasSessionToken reports whether the user has a session token
+func (u *User) HasSessionToken() bool {
+	h := u.sessionTokenHash.Load()
+	return h != nil && *h != ""
+}
+
+func (u *User) CheckSessionToken(token string) bool {
+	h := u.sessionTokenHash.Load()
+	if h == nil || *h == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(*h), []byte(model.HashSessionToken(token))) == 1
+}
+
+// RotateSessionToken replaces the session token, the previous one stops working
+func (u *User) RotateSessionToken() (string, error) {
+	token := model.NewSessionToken()
+	hash := model.HashSessionToken(token)
+	if err := db.SetUserSessionTokenHash(u.ID, hash); err != nil {
+		return "", err
+	}
+	u.sessionTokenHash.Store(&hash)
+	u.sessionToken.Store(&token)
+	return token, nil
+}
+
+// SetPassword returns model.ErrPasswordTooLong for passwords longer
+// than model.MaxPasswordLength
 func (u *User) SetPassword(password string) error {
+	if err := model.CheckPasswordLength(password); err != nil {
+		return err
+	}
 	if u.CheckPassword(password) {
 		return errors.New("password is the same")
 	}
@@ -73,7 +154,14 @@ func (u *User) SetPassword(password string) error {
 	}
 	atomic.StoreUint32(&u.version, crc32.ChecksumIEEE(hashedPassword))
 	u.HashedPassword = hashedPassword
-	return db.SetUserHashedPassword(u.ID, hashedPassword)
+	if err := db.SetUserHashedPassword(u.ID, hashedPassword); err != nil {
+		return err
+	}
+	if _, err := u.RotateSessionToken(); err != nil {
+		return err
+	}
+	closeUserClients(u.ID, CloseCodePasswordChanged, CloseReasonPasswordChanged)
+	return nil
 }
 
 func (u *User) CreateRoom(name, password string, conf ...db.CreateRoomConfig) (*RoomEntry, error) {
@@ -93,12 +181,11 @@ func (u *User) CreateRoom(name, password string, conf ...db.CreateRoomConfig) (*
 		}
 	}
 
-	var maxCount int64
-	if !u.IsAdmin() {
-		maxCount = settings.UserMaxRoomCount.Get()
+	conf = append(conf, db.WithCreator(&u.User))
+	if u.IsAdmin() {
+		return CreateRoom(name, password, 0, conf...)
 	}
-
-	return CreateRoom(name, password, maxCount, append(conf, db.WithCreator(&u.User))...)
+	return CreateRoomAs(u.ID, name, password, settings.UserMaxRoomCount.Get(), conf...)
 }
 
 func (u *User) NewMovie(movie *model.BaseMovie) (*model.Movie, error) {
@@ -115,6 +202,9 @@ func (u *User) NewMovie(movie *model.BaseMovie) (*model.Movie, error) {
 			return nil, errors.New("alist payload is nil")
 		}
 	}
+	if movie.MediaKind == model.MediaKindUnknown {
+		movie.MediaKind = movie.InferMediaKind()
+	}
 	return &model.Movie{
 		Base:      *movie,
 		CreatorID: u.ID,
@@ -122,14 +212,23 @@ func (u *User) NewMovie(movie *model.BaseMovie) (*model.Movie, error) {
 }
 
 func (u *User) AddMovieToRoom(room *Room, movie *model.BaseMovie) error {
+	return u.AddMovieToRoomContext(context.Background(), room, movie)
+}
+
+// AddMovieToRoomContext is AddMovieToRoom traced as a child of the span in ctx
+func (u *User) AddMovieToRoomContext(ctx context.Context, room *Room, movie *model.BaseMovie) error {
 	if !u.HasRoomPermission(room, model.PermissionCreateMovie) {
 		return model.ErrNoPermission
 	}
+	// chapters are set by room admins
+	if len(movie.Chapters) != 0 && !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
 	m, err := u.NewMovie(movie)
 	if err != nil {
 		return err
 	}
-	return room.AddMovie(m)
+	return room.AddMovieContext(ctx, m)
 }
 
 func (u *User) NewMovies(movies []*model.BaseMovie) ([]*model.Movie, error) {
@@ -148,6 +247,11 @@ func (u *User) AddMoviesToRoom(room *Room, movies []*model.BaseMovie) error {
 	if !u.HasRoomPermission(room, model.PermissionCreateMovie) {
 		return model.ErrNoPermission
 	}
+	for _, m := range movies {
+		if len(m.Chapters) != 0 && !u.HasRoomPermission(room, model.PermissionEditRoom) {
+			return model.ErrNoPermission
+		}
+	}
 	m, err := u.NewMovies(movies)
 	if err != nil {
 		return err
@@ -195,11 +299,29 @@ func (u *User) SetRoomPassword(room *Room, password string) error {
 	return room.SetPassword(password)
 }
 
+// KickUser disconnects a member from the room, the creator and admins can not be kicked
+func (u *User) KickUser(room *Room, userID string) error {
+	if !u.HasRoomPermission(room, model.PermissionEditUser) || userID == room.CreatedBy() {
+		return model.ErrNoPermission
+	}
+	e, err := LoadOrInitUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if e.Value().IsAdmin() {
+		return model.ErrNoPermission
+	}
+	return room.KickUser(userID, "kicked by "+u.Username)
+}
+
 func (u *User) SetRole(role model.Role) error {
 	if err := db.SetRoleByID(u.ID, role); err != nil {
 		return err
 	}
 	u.Role = role
+	if role == model.RoleBanned {
+		closeUserClients(u.ID, CloseCodeBanned, CloseReasonBanned)
+	}
 	return nil
 }
 
@@ -211,6 +333,88 @@ func (u *User) SetUsername(username string) error {
 	return nil
 }
 
+// MaxAvatarLength is the longest avatar url a user may set
+const MaxAvatarLength = 1024
+
+var (
+	ErrInvalidColor  = errors.New("color must be a hex string like #rrggbb")
+	ErrAvatarTooLong = errors.New("avatar too long")
+	ErrInvalidAvatar = errors.New("avatar must be a http or https url")
+	hexColorReg      = regexp.MustCompile(`^#([[:xdigit:]]{3}|[[:xdigit:]]{6})$`)
+)
+
+// ValidateColor accepts an empty color or a hex color like #rgb or #rrggbb
+func ValidateColor(color string) error {
+	if color != "" && !hexColorReg.MatchString(color) {
+		return ErrInvalidColor
+	}
+	return nil
+}
+
+// ValidateAvatar accepts an empty avatar or an absolute http or https url
+// of at most MaxAvatarLength bytes
+func ValidateAvatar(avatar string) error {
+	if avatar == "" {
+		return nil
+	}
+	if len(avatar) > MaxAvatarLength {
+		return ErrAvatarTooLong
+	}
+	u, err := url.Parse(avatar)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidAvatar
+	}
+	return nil
+}
+
+// SetColor sets the display color of the user, see ValidateColor
+func (u *User) SetColor(color string) error {
+	if err := ValidateColor(color); err != nil {
+		return err
+	}
+	if err := db.SetUserColorByID(u.ID, color); err != nil {
+		return err
+	}
+	u.Color = color
+	return nil
+}
+
+// SetAvatar sets the avatar url of the user, see ValidateAvatar
+func (u *User) SetAvatar(avatar string) error {
+	if err := ValidateAvatar(avatar); err != nil {
+		return err
+	}
+	if err := db.SetUserAvatarByID(u.ID, avatar); err != nil {
+		return err
+	}
+	u.Avatar = avatar
+	return nil
+}
+
+// BlockUser makes whispers from the user with the given name bounce
+func (u *User) BlockUser(name string) error {
+	b, err := LoadUserByUsername(name)
+	if err != nil {
+		return err
+	}
+	if b.Value().ID == u.ID {
+		return errors.New("cannot block yourself")
+	}
+	return db.BlockUser(u.ID, b.Value().ID)
+}
+
+func (u *User) UnblockUser(name string) error {
+	b, err := LoadUserByUsername(name)
+	if err != nil {
+		return err
+	}
+	return db.UnblockUser(u.ID, b.Value().ID)
+}
+
+func (u *User) HasBlocked(userID string) (bool, error) {
+	return db.IsUserBlocked(u.ID, userID)
+}
+
 func (u *User) UpdateMovie(room *Room, movieID string, movie *model.BaseMovie) error {
 	m, err := room.GetMovieByID(movieID)
 	if err != nil {
@@ -219,7 +423,10 @@ func (u *User) UpdateMovie(room *Room, movieID string, movie *model.BaseMovie) e
 	if m.Movie.CreatorID != u.ID && !u.HasRoomPermission(room, model.PermissionEditUser) {
 		return model.ErrNoPermission
 	}
-	return room.UpdateMovie(movieID, movie)
+	if !slices.Equal(m.Movie.Base.Chapters, movie.Chapters) && !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.updateMovie(movieID, movie, u.ID)
 }
 
 func (u *User) SetRoomSetting(room *Room, setting model.RoomSettings) error {
@@ -237,42 +444,259 @@ func (u *User) DeleteMovieByID(room *Room, movieID string) error {
 	if m.Movie.CreatorID != u.ID && !u.HasRoomPermission(room, model.PermissionEditUser) {
 		return model.ErrNoPermission
 	}
-	return room.DeleteMovieByID(movieID)
+	if err := room.deleteMovieByID(movieID, u.ID); err != nil {
+		return err
+	}
+	room.logUserActivity(ActivityMovieDeleted, u, &m.Movie)
+	return nil
 }
 
+// DeleteMoviesByID deletes every movie of the batch it can,
+// the ones that failed are reported with *ErrDeleteMovies
 func (u *User) DeleteMoviesByID(room *Room, movieIDs []string) error {
+	var (
+		deleted []string
+		failed  = make(map[string]error)
+	)
 	for _, id := range movieIDs {
-		m, err := room.GetMovieByID(id)
-		if err != nil {
-			return err
+		if _, ok := failed[id]; ok || slices.Contains(deleted, id) {
+			continue
 		}
-		if m.Movie.CreatorID != u.ID && !u.HasRoomPermission(room, model.PermissionEditUser) {
-			return model.ErrNoPermission
+		if err := u.DeleteMovieByID(room, id); err != nil {
+			failed[id] = err
+			continue
 		}
+		deleted = append(deleted, id)
 	}
-	for _, v := range movieIDs {
-		if err := room.DeleteMovieByID(v); err != nil {
-			return err
-		}
+	if len(failed) != 0 {
+		return &ErrDeleteMovies{Deleted: deleted, Failed: failed}
 	}
 	return nil
 }
 
+func (u *User) SetMoviePinned(room *Room, movieID string, pinned bool) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	if pinned {
+		return room.PinMovie(movieID)
+	}
+	return room.UnpinMovie(movieID)
+}
+
+func (u *User) SetMovieVisibility(room *Room, movieID string, visibility model.MovieVisibility) (bool, error) {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return false, model.ErrNoPermission
+	}
+	return room.SetMovieVisibility(movieID, visibility)
+}
+
+// MovieVisibleFunc returns whether the user sees a movie of the room,
+// the room permissions of the user are looked up once they are needed
+func (u *User) MovieVisibleFunc(room *Room) func(m *model.Movie) bool {
+	privileged := u.IsAdmin() || room.CreatedBy() == u.ID
+	admin := sync.OnceValue(func() bool {
+		return u.HasRoomPermission(room, roomAdminPermissions)
+	})
+	return func(m *model.Movie) bool {
+		switch {
+		case privileged, m.Visibility.Public(), m.CreatorID == u.ID:
+			return true
+		case m.Visibility == model.MovieVisibilityAdmins:
+			return admin()
+		default:
+			return false
+		}
+	}
+}
+
+// CanSeeMovie reports whether the movie is listed for the user, see model.MovieVisibility
+func (u *User) CanSeeMovie(room *Room, m *model.Movie) bool {
+	return u.MovieVisibleFunc(room)(m)
+}
+
+// MovieHistory returns the changes of a movie for moderation, see Room.MovieHistory
+func (u *User) MovieHistory(room *Room, movieID string) ([]*model.MovieAudit, error) {
+	if !u.HasRoomPermission(room, model.PermissionEditUser) {
+		return nil, model.ErrNoPermission
+	}
+	return room.MovieHistory(movieID)
+}
+
+// ExportDanmaku writes the kept chat of a movie the user can see, see Room.ExportDanmaku
+func (u *User) ExportDanmaku(room *Room, w io.Writer, movieID string) error {
+	m, err := room.GetMovieByID(movieID)
+	if err != nil {
+		return err
+	}
+	if !u.CanSeeMovie(room, &m.Movie) {
+		return &ErrMovieNotFound{ID: movieID}
+	}
+	return room.ExportDanmaku(w, movieID)
+}
+
+func (u *User) ClearChatHistory(room *Room) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.ClearChatHistory()
+}
+
 func (u *User) ClearMovies(room *Room) error {
 	if !u.HasRoomPermission(room, model.PermissionEditUser) {
 		return model.ErrNoPermission
 	}
-	return room.ClearMovies()
+	if err := room.clearMovies(u.ID); err != nil {
+		return err
+	}
+	room.logUserActivity(ActivityMoviesCleared, u, nil)
+	return nil
 }
 
 func (u *User) SetCurrentMovie(room *Room, movie *model.Movie, play bool) error {
+	if err := u.checkSetCurrentMovie(room, movie); err != nil {
+		return err
+	}
+	room.setCurrentMovie(movie, play, u)
+	return nil
+}
+
+func (u *User) checkSetCurrentMovie(room *Room, movie *model.Movie) error {
 	if !u.HasRoomPermission(room, model.PermissionEditCurrent) {
 		return model.ErrNoPermission
 	}
-	room.SetCurrentMovie(movie, play)
+	if !u.CanControlPlayback(room) {
+		return ErrPlaybackLocked
+	}
+	// staged movies do not exist for users that can not see them
+	if movie != nil && !u.CanSeeMovie(room, movie) {
+		return &ErrMovieNotFound{ID: movie.ID}
+	}
+	return nil
+}
+
+// SetCurrentMovieResume plays the movie from where it was left, see Room.SetCurrentMovieResume
+func (u *User) SetCurrentMovieResume(room *Room, movieID string, play bool) error {
+	m, err := room.GetMovieByID(movieID)
+	if err != nil {
+		return err
+	}
+	if err := u.checkSetCurrentMovie(room, &m.Movie); err != nil {
+		return err
+	}
+	room.setCurrentMovieAt(&m.Movie, play, room.MoviePosition(movieID), u)
+	return nil
+}
+
+// CanControlPlayback reports whether the user may change the playback,
+// admins and the room creator bypass the playback lock
+func (u *User) CanControlPlayback(room *Room) bool {
+	return !room.PlaybackLocked() || u.IsAdmin() || room.CreatedBy() == u.ID
+}
+
+func (u *User) SetStatus(room *Room, playing bool, seek, rate, timeDiff float64) (Status, error) {
+	if !u.CanControlPlayback(room) {
+		return Status{}, ErrPlaybackLocked
+	}
+	if err := u.checkSeekDelta(room, seek, rate, timeDiff); err != nil {
+		return Status{}, err
+	}
+	was := room.current.Status().Playing
+	status, err := room.SetStatus(playing, seek, rate, timeDiff)
+	if err != nil {
+		return Status{}, err
+	}
+	if status.Playing != was {
+		t := ActivityPaused
+		if status.Playing {
+			t = ActivityPlayed
+		}
+		room.logUserActivity(t, u, nil)
+	}
+	return status, nil
+}
+
+func (u *User) SetSeekRate(room *Room, seek, rate, timeDiff float64) (Status, error) {
+	if !u.CanControlPlayback(room) {
+		return Status{}, ErrPlaybackLocked
+	}
+	if err := u.checkSeekDelta(room, seek, rate, timeDiff); err != nil {
+		return Status{}, err
+	}
+	return room.SetSeekRate(seek, rate, timeDiff)
+}
+
+// checkSeekDelta applies Settings.MaxSeekDelta, admins and the creator may seek anywhere
+func (u *User) checkSeekDelta(room *Room, seek, rate, timeDiff float64) error {
+	if u.IsAdmin() || room.CreatedBy() == u.ID {
+		return nil
+	}
+	return room.checkSeekDelta(seek, rate, timeDiff)
+}
+
+func (u *User) SetAutoAdvance(room *Room, enabled bool) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	room.SetAutoAdvance(enabled)
 	return nil
 }
 
+func (u *User) SetPlaylistSort(room *Room, sort model.PlaylistSort) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.SetPlaylistSort(sort)
+}
+
+func (u *User) SetPlaybackLocked(room *Room, locked bool) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.SetPlaybackLocked(locked)
+}
+
+func (u *User) RoomWebhooks(room *Room) ([]*model.RoomWebhook, error) {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return nil, model.ErrNoPermission
+	}
+	return room.Webhooks(), nil
+}
+
+func (u *User) AddRoomWebhook(room *Room, url string, events []model.WebhookEvent) (*model.RoomWebhook, error) {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return nil, model.ErrNoPermission
+	}
+	return room.AddWebhook(url, events)
+}
+
+func (u *User) DeleteRoomWebhook(room *Room, id string) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.DeleteWebhook(id)
+}
+
+func (u *User) ForceSeek(room *Room, seek float64) error {
+	if !u.HasRoomPermission(room, model.PermissionEditRoom) {
+		return model.ErrNoPermission
+	}
+	return room.ForceSeekContext(context.Background(), seek, u.ID)
+}
+
+// SeekRelative is Room.SeekRelative, Settings.MaxSeekDelta caps delta
+// for regular members like it caps absolute seeks
+func (u *User) SeekRelative(room *Room, delta float64) error {
+	if !u.CanControlPlayback(room) {
+		return ErrPlaybackLocked
+	}
+	if limit := room.Settings.MaxSeekDelta; limit > 0 && math.Abs(delta) > limit &&
+		!u.IsAdmin() && room.CreatedBy() != u.ID {
+		return fmt.Errorf("%w, seek at most %g seconds at once", ErrSeekTooLarge, limit)
+	}
+	return room.seekRelative(delta, u.Username)
+}
+
 func (u *User) SetCurrentMovieByID(room *Room, movieID string, play bool) error {
 	m, err := room.GetMovieByID(movieID)
 	if err != nil {
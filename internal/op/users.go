@@ -2,6 +2,7 @@ package op
 
 import (
 	"errors"
+	"fmt"
 	"hash/crc32"
 	"time"
 
@@ -20,11 +21,48 @@ var (
 	ErrUserPending = errors.New("user pending, please wait for admin to approve")
 )
 
+// ErrUserNotFound is returned by user lookups, Name is the id or username looked up
+type ErrUserNotFound struct {
+	Name string
+}
+
+func (e *ErrUserNotFound) Error() string {
+	return fmt.Sprintf("user %s not found", e.Name)
+}
+
+// Is keeps errors.Is(err, db.ErrNotFound("user")) working
+func (e *ErrUserNotFound) Is(target error) bool {
+	return target == db.ErrNotFound("user")
+}
+
+func userNotFound(err error, name string) error {
+	if errors.Is(err, db.ErrNotFound("user")) {
+		return &ErrUserNotFound{Name: name}
+	}
+	return err
+}
+
 func LoadOrInitUser(u *model.User) (*UserEntry, error) {
-	i, _ := userCache.LoadOrStore(u.ID, &User{
+	// users created before session tokens existed get one on first load
+	if u.SessionTokenHash == "" {
+		u.IssuedSessionToken = model.NewSessionToken()
+		u.SessionTokenHash = model.HashSessionToken(u.IssuedSessionToken)
+		if err := db.SetUserSessionTokenHash(u.ID, u.SessionTokenHash); err != nil {
+			return nil, err
+		}
+	}
+	user := &User{
 		User:    *u,
 		version: crc32.ChecksumIEEE(u.HashedPassword),
-	}, time.Hour)
+	}
+	// the token is only kept in the atomics, which rotations update
+	hash, token := u.SessionTokenHash, u.IssuedSessionToken
+	user.SessionTokenHash, user.IssuedSessionToken = "", ""
+	user.sessionTokenHash.Store(&hash)
+	if token != "" {
+		user.sessionToken.Store(&token)
+	}
+	i, _ := userCache.LoadOrStore(u.ID, user, time.Hour)
 	return i, nil
 }
 
@@ -37,7 +75,7 @@ func LoadOrInitUserByID(id string) (*UserEntry, error) {
 
 	user, err := db.GetUserByID(id)
 	if err != nil {
-		return nil, err
+		return nil, userNotFound(err, id)
 	}
 
 	return LoadOrInitUser(user)
@@ -46,7 +84,7 @@ func LoadOrInitUserByID(id string) (*UserEntry, error) {
 func LoadUserByUsername(username string) (*UserEntry, error) {
 	u, err := db.GetUserByUsername(username)
 	if err != nil {
-		return nil, err
+		return nil, userNotFound(err, username)
 	}
 
 	return LoadOrInitUser(u)
@@ -64,6 +102,16 @@ func CreateOrLoadUser(username string, password string, conf ...db.CreateUserCon
 	return LoadOrInitUser(u)
 }
 
+// GetOrCreateUser is like CreateOrLoadUser but also reports whether the user was created
+func GetOrCreateUser(username string, password string, conf ...db.CreateUserConfig) (*UserEntry, bool, error) {
+	u, created, err := db.LoadOrCreateUser(username, password, conf...)
+	if err != nil {
+		return nil, false, err
+	}
+	e, err := LoadOrInitUser(u)
+	return e, created, err
+}
+
 func CreateUser(username string, password string, conf ...db.CreateUserConfig) (*UserEntry, error) {
 	if username == "" {
 		return nil, errors.New("username cannot be empty")
@@ -108,19 +156,23 @@ func CompareAndDeleteUser(user *UserEntry) error {
 func DeleteUserByID(id string) error {
 	err := db.DeleteUserByID(id)
 	if err != nil {
-		return err
+		return userNotFound(err, id)
 	}
+	closeUserClients(id, CloseCodeKicked, CloseReasonUserDeleted)
 	return CloseUserById(id)
 }
 
-func CloseUserById(id string) error {
-	userCache.Delete(id)
+// closeUserClients disconnects the user from every loaded room
+func closeUserClients(userID string, code int, reason string) {
 	roomCache.Range(func(key string, value *synccache.Entry[*Room]) bool {
-		if value.Value().CreatorID == id {
-			CompareAndCloseRoom(value)
-		}
+		_ = value.Value().CloseUser(userID, code, reason)
 		return true
 	})
+}
+
+func CloseUserById(id string) error {
+	userCache.Delete(id)
+	closeRoomsByCreator(id)
 	return nil
 }
 
@@ -128,15 +180,20 @@ func CompareAndCloseUser(user *UserEntry) error {
 	if !userCache.CompareAndDelete(user.Value().ID, user) {
 		return nil
 	}
-	roomCache.Range(func(key string, value *synccache.Entry[*Room]) bool {
-		if value.Value().CreatorID == user.Value().ID {
-			CompareAndCloseRoom(value)
-		}
-		return true
-	})
+	closeRoomsByCreator(user.Value().ID)
 	return nil
 }
 
+// closeRoomsByCreator unloads the rooms of the creator, a room that was
+// reloaded in the meantime is left alone
+func closeRoomsByCreator(creatorID string) {
+	for _, r := range LoadedRoomsByCreator(creatorID) {
+		if e, ok := roomCache.Load(r.ID); ok && e.Value() == r {
+			CompareAndCloseRoom(e)
+		}
+	}
+}
+
 func GetUserName(userID string) string {
 	u, err := LoadOrInitUserByID(userID)
 	if err != nil {
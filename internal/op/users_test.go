@@ -0,0 +1,145 @@
+package op
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestUserNotFound(t *testing.T) {
+	err := fmt.Errorf("load user: %w", userNotFound(db.ErrNotFound("user"), "alice"))
+
+	var nf *ErrUserNotFound
+	if !errors.As(err, &nf) {
+		t.Fatalf("errors.As(%v) = false, want true", err)
+	}
+	if nf.Name != "alice" {
+		t.Fatalf("Name = %q, want %q", nf.Name, "alice")
+	}
+	if !errors.Is(err, db.ErrNotFound("user")) {
+		t.Fatalf("errors.Is(%v, db.ErrNotFound) = false, want true", err)
+	}
+
+	other := errors.New("boom")
+	if got := userNotFound(other, "alice"); got != other {
+		t.Fatalf("userNotFound() = %v, want %v", got, other)
+	}
+}
+
+func TestCheckSessionToken(t *testing.T) {
+	u := &User{}
+	if u.CheckSessionToken("") {
+		t.Fatal("CheckSessionToken() = true without a token")
+	}
+	token := model.NewSessionToken()
+	if len(token) != 64 || token == model.NewSessionToken() {
+		t.Fatalf("NewSessionToken() = %q", token)
+	}
+	hash := model.HashSessionToken(token)
+	u.sessionTokenHash.Store(&hash)
+	if !u.CheckSessionToken(token) {
+		t.Fatal("CheckSessionToken() = false, want true")
+	}
+	if u.CheckSessionToken(token[:63]) || u.CheckSessionToken("") || u.CheckSessionToken(hash) {
+		t.Fatal("CheckSessionToken() accepted a wrong token")
+	}
+}
+
+func TestRotateSessionToken(t *testing.T) {
+	useTestDB(t)
+	e, err := CreateUser("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := e.Value()
+	// new users get a token on creation
+	old := u.SessionToken()
+	if old == "" || !u.CheckSessionToken(old) {
+		t.Fatalf("SessionToken() = %q for a new user, want a valid token", old)
+	}
+	token, err := u.RotateSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cached user checks the rotated token
+	if !u.CheckSessionToken(token) || u.CheckSessionToken(old) || u.SessionToken() != token {
+		t.Fatal("the cached user still checks the previous token")
+	}
+	stored, err := db.GetUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SessionTokenHash != model.HashSessionToken(token) {
+		t.Fatalf("stored %q, want the hash of the token", stored.SessionTokenHash)
+	}
+	// a user loaded again checks the token against the stored hash
+	userCache.Delete(u.ID)
+	e, err = LoadOrInitUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Value().CheckSessionToken(token) {
+		t.Fatal("CheckSessionToken() = false after the user was loaded again")
+	}
+	if e.Value().SessionToken() != "" {
+		t.Fatal("SessionToken() of a reloaded user is known, only the hash is stored")
+	}
+	// users without a token get one when they are loaded
+	if err := db.SetUserSessionTokenHash(u.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	userCache.Delete(u.ID)
+	e, err = LoadOrInitUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued := e.Value().SessionToken(); issued == "" || !e.Value().CheckSessionToken(issued) {
+		t.Fatalf("SessionToken() = %q after loading a user without token, want a valid token", issued)
+	}
+}
+
+func TestSplitUserBatch(t *testing.T) {
+	a := &User{User: model.User{ID: "a", Username: "alice"}}
+	b := &User{User: model.User{ID: "b", Username: "bob"}}
+	ids, names, dups := splitUserBatch([]*User{a, b, a})
+	if !reflect.DeepEqual(ids, []string{"a", "b"}) || names["b"] != "bob" {
+		t.Fatalf("splitUserBatch() ids = %v names = %v", ids, names)
+	}
+	if !reflect.DeepEqual(dups, []string{"alice"}) {
+		t.Fatalf("splitUserBatch() dups = %v, want [alice]", dups)
+	}
+}
+
+func TestSetColorAvatarValidation(t *testing.T) {
+	u := &User{}
+	for _, color := range []string{"red", "#12345", "#gggggg", "123456"} {
+		if err := u.SetColor(color); err != ErrInvalidColor {
+			t.Errorf("SetColor(%q) = %v, want %v", color, err, ErrInvalidColor)
+		}
+	}
+	for _, color := range []string{"", "#fff", "#A0b1C2"} {
+		if err := ValidateColor(color); err != nil {
+			t.Errorf("ValidateColor(%q) = %v", color, err)
+		}
+	}
+	for avatar, want := range map[string]error{
+		"ftp://example.com/a.png": ErrInvalidAvatar,
+		"/a.png":                  ErrInvalidAvatar,
+		"https://":                ErrInvalidAvatar,
+		"https://example.com/" + strings.Repeat("a", MaxAvatarLength): ErrAvatarTooLong,
+	} {
+		if err := u.SetAvatar(avatar); err != want {
+			t.Errorf("SetAvatar(%q) = %v, want %v", avatar, err, want)
+		}
+	}
+	for _, avatar := range []string{"", "https://example.com/a.png", "http://example.com/a.png"} {
+		if err := ValidateAvatar(avatar); err != nil {
+			t.Errorf("ValidateAvatar(%q) = %v", avatar, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package op
+
+import (
+	"maps"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func (r *Room) storeVendorBackends(backends map[string]string) map[string]string {
+	backends = maps.Clone(backends)
+	prev := r.vendorBackends.Swap(&backends)
+	if prev == nil {
+		return nil
+	}
+	return *prev
+}
+
+// vendorBackend returns the backend the room pinned for the vendor
+func (r *Room) vendorBackend(vendorName model.VendorName) string {
+	if b := r.vendorBackends.Load(); b != nil {
+		return (*b)[vendorName]
+	}
+	return ""
+}
+
+// setVendorBackends changes the pinned backends, movies of the vendors
+// whose pin changed resolve their data again as the caches never expire
+func (r *Room) setVendorBackends(backends map[string]string) {
+	prev := r.storeVendorBackends(backends)
+	var changed []model.VendorName
+	for _, v := range []model.VendorName{model.VendorAlist, model.VendorBilibili, model.VendorEmby} {
+		if prev[v] != backends[v] {
+			changed = append(changed, v)
+		}
+	}
+	if len(changed) != 0 {
+		r.movies.resetVendorCaches(changed...)
+	}
+}
+
+// resetVendorCaches drops the vendor data of every movie of the vendors
+func (m *movies) resetVendorCaches(vendors ...model.VendorName) {
+	m.init()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for e := m.list.Front(); e != nil; e = e.Next() {
+		for _, v := range vendors {
+			e.Value.resetVendorCache(v)
+		}
+	}
+}
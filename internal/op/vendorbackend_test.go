@@ -0,0 +1,54 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestSetVendorBackendsResetsCaches(t *testing.T) {
+	useTestDB(t)
+	m, err := db.CreateRoom("vendors", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRoom(m)
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{{ID: "a", RoomID: m.ID}})
+	})
+	movie, err := r.movies.GetMovieByID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emby, alist := movie.EmbyCache(), movie.AlistCache()
+
+	s := r.Settings
+	s.VendorBackends = map[string]string{model.VendorEmby: "pinned"}
+	if err := r.SetSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.vendorBackend(model.VendorEmby); got != "pinned" {
+		t.Fatalf("vendorBackend() = %q, want pinned", got)
+	}
+	if movie.EmbyCache() == emby {
+		t.Fatal("emby cache kept after its pin changed")
+	}
+	if movie.AlistCache() != alist {
+		t.Fatal("alist cache dropped though its pin did not change")
+	}
+
+	// the map handed in is copied, changing it later pins nothing
+	emby = movie.EmbyCache()
+	s.VendorBackends[model.VendorEmby] = "other"
+	if got := r.vendorBackend(model.VendorEmby); got != "pinned" {
+		t.Fatalf("vendorBackend() = %q after the caller changed its map, want pinned", got)
+	}
+	s.VendorBackends = map[string]string{model.VendorEmby: "pinned"}
+	if err := r.SetSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	if movie.EmbyCache() != emby {
+		t.Fatal("emby cache dropped though its pin did not change")
+	}
+}
@@ -0,0 +1,31 @@
+package op
+
+import "time"
+
+// trackWatchTime adds the time played so far to the total watch time once
+// playback stops, it must be called after the playing state may have changed
+func (r *Room) trackWatchTime(playing bool) {
+	now := time.Now().UnixMilli()
+	if playing {
+		r.playingSince.CompareAndSwap(0, now)
+		return
+	}
+	if since := r.playingSince.Swap(0); since != 0 {
+		r.totalWatchMs.Add(now - since)
+	}
+}
+
+// TotalWatchTime returns how long movies were played in the room,
+// including the playback in progress
+func (r *Room) TotalWatchTime() time.Duration {
+	ms := r.totalWatchMs.Load()
+	if since := r.playingSince.Load(); since != 0 {
+		ms += max(time.Now().UnixMilli()-since, 0)
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// TimesPlayed returns how often the movie was made the current movie
+func (m *Movie) TimesPlayed() int {
+	return int(m.timesPlayed.Load())
+}
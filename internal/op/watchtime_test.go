@@ -0,0 +1,43 @@
+package op
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestTotalWatchTime(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.totalWatchMs.Store(1000)
+	if d := r.TotalWatchTime(); d != time.Second {
+		t.Fatalf("TotalWatchTime() = %s, want 1s", d)
+	}
+	r.playingSince.Store(time.Now().Add(-time.Second).UnixMilli())
+	r.trackWatchTime(true)
+	r.trackWatchTime(false)
+	if d := r.TotalWatchTime(); d < 2*time.Second || d > 3*time.Second {
+		t.Fatalf("TotalWatchTime() = %s, want about 2s", d)
+	}
+	r.trackWatchTime(false)
+	if d := r.TotalWatchTime(); d > 3*time.Second {
+		t.Fatalf("pausing twice counted again: %s", d)
+	}
+}
+
+func TestTimesPlayed(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.movies.once.Do(func() {
+		r.movies.restore([]*model.Movie{{ID: "a"}})
+	})
+	movie := &model.Movie{ID: "a"}
+	r.SetCurrentMovie(movie, false)
+	r.SetCurrentMovie(movie, true)
+	m, _ := r.GetMovieByID("a")
+	if n := m.TimesPlayed(); n != 2 {
+		t.Fatalf("TimesPlayed() = %d, want 2", n)
+	}
+	if r.playingSince.Load() == 0 {
+		t.Fatal("playing the current movie did not start the watch time")
+	}
+}
@@ -0,0 +1,355 @@
+package op
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/synctv-org/synctv/internal/db"
+	"github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/settings"
+	"github.com/synctv-org/synctv/utils"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body keyed by the webhook secret
+	WebhookSignatureHeader = "X-Synctv-Signature"
+	WebhookEventHeader     = "X-Synctv-Event"
+
+	maxRoomWebhooks    = 10
+	maxWebhookURLLen   = 2048
+	webhookQueueSize   = 64
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 4
+	// webhookRetryDelay is doubled after every failed attempt
+	webhookRetryDelay = time.Second
+)
+
+var (
+	ErrInvalidWebhookURL   = errors.New("invalid webhook url")
+	ErrPrivateWebhookURL   = errors.New("webhook url must not target a private address")
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event")
+	ErrTooManyWebhooks     = fmt.Errorf("a room can have at most %d webhooks", maxRoomWebhooks)
+)
+
+// webhookClient refuses to connect to private addresses at dial time,
+// so redirects and dns changes after validation can not reach them either
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if settings.AllowWebhookToPrivate.Get() {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+					return ErrPrivateWebhookURL
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+type WebhookPayload struct {
+	Event  model.WebhookEvent `json:"event"`
+	RoomID string             `json:"roomId"`
+	Time   int64              `json:"time"`
+	Data   any                `json:"data,omitempty"`
+}
+
+type WebhookUserData struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+type WebhookMovieData struct {
+	MovieID string `json:"movieId"`
+	Name    string `json:"name"`
+}
+
+type webhookDelivery struct {
+	event model.WebhookEvent
+	body  []byte
+}
+
+// webhook delivers the events of one endpoint in order, a failing
+// endpoint only delays its own deliveries
+type webhook struct {
+	hook  *model.RoomWebhook
+	queue chan *webhookDelivery
+}
+
+type webhooks struct {
+	lock   sync.RWMutex
+	list   []*webhook
+	closed bool
+	// deadLetters counts deliveries that were dropped or failed all attempts
+	deadLetters atomic.Uint64
+	// running tracks the delivery loops, see wait
+	running sync.WaitGroup
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+func validateWebhookURL(raw string) error {
+	if len(raw) > maxWebhookURLLen {
+		return fmt.Errorf("%w: too long", ErrInvalidWebhookURL)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidWebhookURL
+	}
+	if settings.AllowWebhookToPrivate.Get() {
+		return nil
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookURL, err)
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip) {
+			return ErrPrivateWebhookURL
+		}
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []model.WebhookEvent) error {
+	if len(events) == 0 {
+		return fmt.Errorf("%w: no events", ErrInvalidWebhookEvent)
+	}
+	for _, e := range events {
+		if !e.Valid() {
+			return fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, e)
+		}
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of body keyed by secret
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ws *webhooks) newWebhook(hook *model.RoomWebhook) *webhook {
+	w := &webhook{
+		hook:  hook,
+		queue: make(chan *webhookDelivery, webhookQueueSize),
+	}
+	ws.running.Add(1)
+	go func() {
+		defer ws.running.Done()
+		w.run(&ws.deadLetters)
+	}()
+	return w
+}
+
+func (w *webhook) run(deadLetters *atomic.Uint64) {
+	for d := range w.queue {
+		if err := w.deliver(d); err != nil {
+			deadLetters.Add(1)
+			log.Warnf("webhook: %s, deliver %s to %s failed: %v", w.hook.ID, d.event, w.hook.URL, err)
+		}
+	}
+}
+
+func (w *webhook) deliver(d *webhookDelivery) error {
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := w.post(d)
+		if err == nil || attempt == webhookMaxAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *webhook) post(d *webhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", utils.UA)
+	req.Header.Set(WebhookEventHeader, string(d.event))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(w.hook.Secret, d.body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (ws *webhooks) restore(hooks []*model.RoomWebhook) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.closed {
+		return
+	}
+	for _, h := range hooks {
+		ws.list = append(ws.list, ws.newWebhook(h))
+	}
+}
+
+// close stops the webhooks once their queued deliveries are done
+func (ws *webhooks) close() {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.closed {
+		return
+	}
+	ws.closed = true
+	for _, w := range ws.list {
+		close(w.queue)
+	}
+	ws.list = nil
+}
+
+// wait blocks until the deliveries queued before close are done or ctx is done
+func (ws *webhooks) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ws.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatchWebhook queues the event for every webhook subscribed to it,
+// it never blocks, deliveries that do not fit in the queue count as dead letters
+func (r *Room) dispatchWebhook(event model.WebhookEvent, data any) {
+	ws := &r.webhooks
+	ws.lock.RLock()
+	defer ws.lock.RUnlock()
+	if ws.closed {
+		return
+	}
+	var d *webhookDelivery
+	for _, w := range ws.list {
+		if !w.hook.Subscribed(event) {
+			continue
+		}
+		if d == nil {
+			body, err := json.Marshal(&WebhookPayload{
+				Event:  event,
+				RoomID: r.ID,
+				Time:   time.Now().UnixMilli(),
+				Data:   data,
+			})
+			if err != nil {
+				log.Errorf("webhook: room %s, marshal %s error: %v", r.ID, event, err)
+				return
+			}
+			d = &webhookDelivery{event: event, body: body}
+		}
+		select {
+		case w.queue <- d:
+		default:
+			ws.deadLetters.Add(1)
+		}
+	}
+}
+
+func (r *Room) Webhooks() []*model.RoomWebhook {
+	ws := &r.webhooks
+	ws.lock.RLock()
+	defer ws.lock.RUnlock()
+	list := make([]*model.RoomWebhook, len(ws.list))
+	for i, w := range ws.list {
+		list[i] = w.hook
+	}
+	return list
+}
+
+// AddWebhook stores the webhook and starts delivering events to it,
+// the returned webhook holds the generated secret
+func (r *Room) AddWebhook(u string, events []model.WebhookEvent) (*model.RoomWebhook, error) {
+	if err := validateWebhookEvents(events); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookURL(u); err != nil {
+		return nil, err
+	}
+	ws := &r.webhooks
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.closed {
+		return nil, ErrAlreadyClosed
+	}
+	if len(ws.list) >= maxRoomWebhooks {
+		return nil, ErrTooManyWebhooks
+	}
+	hook := &model.RoomWebhook{
+		RoomID: r.ID,
+		URL:    u,
+		Events: events,
+	}
+	if err := db.CreateRoomWebhook(hook); err != nil {
+		return nil, err
+	}
+	ws.list = append(ws.list, ws.newWebhook(hook))
+	return hook, nil
+}
+
+func (r *Room) DeleteWebhook(id string) error {
+	ws := &r.webhooks
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if err := db.DeleteRoomWebhook(r.ID, id); err != nil {
+		return err
+	}
+	for i, w := range ws.list {
+		if w.hook.ID == id {
+			close(w.queue)
+			ws.list = append(ws.list[:i], ws.list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// WebhookDeadLetters returns how many webhook deliveries were given up
+func (r *Room) WebhookDeadLetters() uint64 {
+	return r.webhooks.deadLetters.Load()
+}
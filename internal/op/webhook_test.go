@@ -0,0 +1,160 @@
+package op
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/model"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	for u, want := range map[string]error{
+		"https://93.184.216.34/hook": nil,
+		"ftp://93.184.216.34/hook":   ErrInvalidWebhookURL,
+		"https:///hook":              ErrInvalidWebhookURL,
+		"http://127.0.0.1:8080/hook": ErrPrivateWebhookURL,
+		"http://10.1.2.3/hook":       ErrPrivateWebhookURL,
+		"http://169.254.169.254/":    ErrPrivateWebhookURL,
+		"http://[::1]/hook":          ErrPrivateWebhookURL,
+	} {
+		if err := validateWebhookURL(u); !errors.Is(err, want) {
+			t.Errorf("validateWebhookURL(%s) = %v, want %v", u, err, want)
+		}
+	}
+}
+
+func TestValidateWebhookEvents(t *testing.T) {
+	if err := validateWebhookEvents([]model.WebhookEvent{model.WebhookEventUserJoined, model.WebhookEventRoomClosing}); err != nil {
+		t.Fatalf("validateWebhookEvents() = %v, want nil", err)
+	}
+	for _, events := range [][]model.WebhookEvent{nil, {"user_kicked"}} {
+		if err := validateWebhookEvents(events); !errors.Is(err, ErrInvalidWebhookEvent) {
+			t.Fatalf("validateWebhookEvents(%v) = %v, want %v", events, err, ErrInvalidWebhookEvent)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	client := webhookClient
+	webhookClient = http.DefaultClient
+	defer func() { webhookClient = client }()
+
+	type request struct {
+		event, signature string
+		body             []byte
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{
+			event:     r.Header.Get(WebhookEventHeader),
+			signature: r.Header.Get(WebhookSignatureHeader),
+			body:      body,
+		}
+	}))
+	defer srv.Close()
+
+	r := newRoom(&model.Room{ID: "room"})
+	r.webhooks.restore([]*model.RoomWebhook{{
+		ID:     "hook",
+		URL:    srv.URL,
+		Secret: "secret",
+		Events: []model.WebhookEvent{model.WebhookEventMovieAdded},
+	}})
+	defer r.webhooks.close()
+
+	r.dispatchWebhook(model.WebhookEventUserJoined, nil)
+	r.movieAdded(&model.Movie{ID: "a", Base: model.BaseMovie{Name: "movie"}})
+	var req request
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	if req.event != string(model.WebhookEventMovieAdded) {
+		t.Fatalf("event = %s, want %s", req.event, model.WebhookEventMovieAdded)
+	}
+	if want := "sha256=" + SignWebhook("secret", req.body); req.signature != want {
+		t.Fatalf("signature = %s, want %s", req.signature, want)
+	}
+	var payload struct {
+		Event  model.WebhookEvent `json:"event"`
+		RoomID string             `json:"roomId"`
+		Data   WebhookMovieData   `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.RoomID != "room" || payload.Data.MovieID != "a" || payload.Data.Name != "movie" {
+		t.Fatalf("payload = %+v", payload)
+	}
+	if n := r.WebhookDeadLetters(); n != 0 {
+		t.Fatalf("WebhookDeadLetters() = %d, want 0", n)
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	r := newRoom(&model.Room{})
+	r.webhooks.list = []*webhook{{
+		hook:  &model.RoomWebhook{Events: []model.WebhookEvent{model.WebhookEventRoomClosing}},
+		queue: make(chan *webhookDelivery, 1),
+	}}
+	r.dispatchWebhook(model.WebhookEventRoomClosing, nil)
+	r.dispatchWebhook(model.WebhookEventRoomClosing, nil)
+	if n := r.WebhookDeadLetters(); n != 1 {
+		t.Fatalf("WebhookDeadLetters() = %d, want 1", n)
+	}
+}
+
+func TestWebhookCurrentCleared(t *testing.T) {
+	client := webhookClient
+	webhookClient = http.DefaultClient
+	defer func() { webhookClient = client }()
+
+	bodies := make(chan []byte, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	r := newRoom(&model.Room{ID: "room"})
+	r.movies.once.Do(func() {
+		r.movies.restore(nil)
+	})
+	r.webhooks.restore([]*model.RoomWebhook{{
+		ID:     "hook",
+		URL:    srv.URL,
+		Events: []model.WebhookEvent{model.WebhookEventCurrentChanged},
+	}})
+	defer r.webhooks.close()
+
+	r.SetCurrentMovie(&model.Movie{ID: "a", Base: model.BaseMovie{Name: "movie"}}, false)
+	// clearing the current movie, as POST /movie/current with an empty id does
+	r.SetCurrentMovie(nil, false)
+	for _, want := range []string{"a", ""} {
+		var body []byte
+		select {
+		case body = <-bodies:
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not delivered")
+		}
+		var payload struct {
+			Data WebhookMovieData `json:"data"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Data.MovieID != want {
+			t.Fatalf("movie id = %q, want %q", payload.Data.MovieID, want)
+		}
+	}
+	if c := r.Current(); c.Movie.ID != "" {
+		t.Fatalf("current movie = %q after clearing it", c.Movie.ID)
+	}
+}
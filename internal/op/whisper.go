@@ -0,0 +1,102 @@
+package op
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+const (
+	// whisperBurst whispers may be sent from one user to another within whisperWindow
+	whisperBurst  = 5
+	whisperWindow = 10 * time.Second
+)
+
+var (
+	ErrUserNotConnected = errors.New("user not connected")
+	ErrWhisperTooFast   = errors.New("whisper too fast")
+	ErrWhisperBlocked   = errors.New("user does not accept your whispers")
+	ErrWhisperToSelf    = errors.New("cannot whisper to yourself")
+)
+
+type whisperPair struct {
+	from, to string
+}
+
+// whispers rate limits private messages per sender and receiver pair,
+// their content is never kept, only the number of delivered whispers
+type whispers struct {
+	lock  sync.Mutex
+	sent  map[whisperPair][]time.Time
+	count uint64
+}
+
+func (w *whispers) allow(p whisperPair, now time.Time) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.sent == nil {
+		w.sent = make(map[whisperPair][]time.Time)
+	} else if len(w.sent) > 1024 {
+		for k, v := range w.sent {
+			if now.Sub(v[len(v)-1]) >= whisperWindow {
+				delete(w.sent, k)
+			}
+		}
+	}
+	recent := w.sent[p][:0]
+	for _, t := range w.sent[p] {
+		if now.Sub(t) < whisperWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= whisperBurst {
+		w.sent[p] = recent
+		return false
+	}
+	w.sent[p] = append(recent, now)
+	return true
+}
+
+// Whisper sends a private message to the connected user with the given name,
+// whispers are not part of the room chat
+func (r *Room) Whisper(from *User, to string, message string) error {
+	e, err := LoadUserByUsername(to)
+	if err != nil {
+		return err
+	}
+	target := e.Value()
+	if target.ID == from.ID {
+		return ErrWhisperToSelf
+	}
+	if _, ok := r.hub.clients.Load(target.ID); !ok {
+		return ErrUserNotConnected
+	}
+	if !r.whispers.allow(whisperPair{from: from.ID, to: target.ID}, time.Now()) {
+		return ErrWhisperTooFast
+	}
+	blocked, err := target.HasBlocked(from.ID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrWhisperBlocked
+	}
+	err = r.hub.SendToUser(target.ID, &ElementMessage{
+		Type:    pb.ElementMessageType_WHISPER,
+		Sender:  from.Username,
+		Message: message,
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&r.whispers.count, 1)
+	return nil
+}
+
+// WhisperCount returns the number of whispers delivered in the room
+func (r *Room) WhisperCount() uint64 {
+	return atomic.LoadUint64(&r.whispers.count)
+}
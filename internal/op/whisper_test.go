@@ -0,0 +1,26 @@
+package op
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhisperRateLimit(t *testing.T) {
+	var w whispers
+	now := time.Now()
+	p := whisperPair{from: "a", to: "b"}
+	for i := 0; i < whisperBurst; i++ {
+		if !w.allow(p, now) {
+			t.Fatalf("whisper %d not allowed", i)
+		}
+	}
+	if w.allow(p, now) {
+		t.Fatal("whisper over burst allowed")
+	}
+	if !w.allow(whisperPair{from: "b", to: "a"}, now) {
+		t.Fatal("other pair limited")
+	}
+	if !w.allow(p, now.Add(whisperWindow)) {
+		t.Fatal("whisper after window not allowed")
+	}
+}
@@ -2,6 +2,7 @@ package settings
 
 import (
 	"errors"
+	"regexp"
 
 	"github.com/synctv-org/synctv/internal/db"
 	"github.com/synctv-org/synctv/internal/model"
@@ -13,6 +14,35 @@ var (
 	CreateRoomNeedReview = NewBoolSetting("create_room_need_review", false, model.SettingGroupRoom)
 	// 48 hours
 	RoomTTL = NewInt64Setting("room_ttl", 48, model.SettingGroupRoom)
+	// hours the room creator must be offline before an admin may take the room over, 0 disables takeover
+	RoomCreatorTakeoverHours = NewInt64Setting("room_creator_takeover_hours", 0, model.SettingGroupRoom)
+	// hours after a takeover during which the previous creator may reclaim the room
+	RoomCreatorReclaimHours = NewInt64Setting("room_creator_reclaim_hours", 24, model.SettingGroupRoom)
+	// regexp that new room names must match, empty allows any name
+	RoomNamePattern = NewStringSetting("room_name_pattern", "", model.SettingGroupRoom, WithValidatorString(func(s string) error {
+		_, err := regexp.Compile(s)
+		return err
+	}))
+	// milliseconds late joiners are told to buffer ahead before they start playing
+	SyncPreBuffer = NewInt64Setting("sync_pre_buffer", 500, model.SettingGroupRoom)
+	// let viewers send emoji reactions, they are broadcast aggregated
+	EnableReactions = NewBoolSetting("enable_reactions", true, model.SettingGroupRoom)
+	// let rooms that opted in keep their chat for the danmaku export
+	ChatHistory = NewBoolSetting("chat_history", false, model.SettingGroupRoom)
+	// chat messages a room keeps, the oldest are deleted first, 0 is unlimited
+	ChatHistoryLimit = NewInt64Setting("chat_history_limit", 10000, model.SettingGroupRoom)
+	// leave the messages of deleted and banned users out of danmaku exports
+	ChatHistoryRedact = NewBoolSetting("chat_history_redact", false, model.SettingGroupRoom)
+	// let room webhooks target loopback and private addresses
+	AllowWebhookToPrivate = NewBoolSetting("allow_webhook_to_private", false, model.SettingGroupRoom)
+	// rooms a user may create per hour, admins are not limited, 0 disables the limit
+	CreateRoomRateLimit = NewInt64Setting("create_room_rate_limit", 0, model.SettingGroupRoom)
+	// rooms that may exist on the server, 0 is unlimited
+	MaxRoomCount = NewInt64Setting("max_room_count", 0, model.SettingGroupRoom)
+	// comma separated room names that can not be used, case insensitive
+	ReservedRoomNames = NewStringSetting("reserved_room_names", "", model.SettingGroupRoom)
+	// comma separated hosts browsers may open room websockets from, empty allows any origin
+	WebsocketAllowedOrigins = NewStringSetting("websocket_allowed_origins", "", model.SettingGroupRoom)
 )
 
 var (
@@ -23,19 +23,35 @@ const (
 type ElementMessageType int32
 
 const (
-	ElementMessageType_UNKNOWN        ElementMessageType = 0
-	ElementMessageType_ERROR          ElementMessageType = 1
-	ElementMessageType_CHAT_MESSAGE   ElementMessageType = 2
-	ElementMessageType_PLAY           ElementMessageType = 3
-	ElementMessageType_PAUSE          ElementMessageType = 4
-	ElementMessageType_CHECK_SEEK     ElementMessageType = 5
-	ElementMessageType_TOO_FAST       ElementMessageType = 6
-	ElementMessageType_TOO_SLOW       ElementMessageType = 7
-	ElementMessageType_CHANGE_RATE    ElementMessageType = 8
-	ElementMessageType_CHANGE_SEEK    ElementMessageType = 9
-	ElementMessageType_CHANGE_CURRENT ElementMessageType = 10
-	ElementMessageType_CHANGE_MOVIES  ElementMessageType = 11
-	ElementMessageType_CHANGE_PEOPLE  ElementMessageType = 12
+	ElementMessageType_UNKNOWN            ElementMessageType = 0
+	ElementMessageType_ERROR              ElementMessageType = 1
+	ElementMessageType_CHAT_MESSAGE       ElementMessageType = 2
+	ElementMessageType_PLAY               ElementMessageType = 3
+	ElementMessageType_PAUSE              ElementMessageType = 4
+	ElementMessageType_CHECK_SEEK         ElementMessageType = 5
+	ElementMessageType_TOO_FAST           ElementMessageType = 6
+	ElementMessageType_TOO_SLOW           ElementMessageType = 7
+	ElementMessageType_CHANGE_RATE        ElementMessageType = 8
+	ElementMessageType_CHANGE_SEEK        ElementMessageType = 9
+	ElementMessageType_CHANGE_CURRENT     ElementMessageType = 10
+	ElementMessageType_CHANGE_MOVIES      ElementMessageType = 11
+	ElementMessageType_CHANGE_PEOPLE      ElementMessageType = 12
+	ElementMessageType_CHANGE_VERSION     ElementMessageType = 13
+	ElementMessageType_START_BUFFERING    ElementMessageType = 14
+	ElementMessageType_STOP_BUFFERING     ElementMessageType = 15
+	ElementMessageType_SYNC               ElementMessageType = 16
+	ElementMessageType_CHANGE_CREATOR     ElementMessageType = 17
+	ElementMessageType_WHISPER            ElementMessageType = 18
+	ElementMessageType_FORCE_SEEK         ElementMessageType = 19
+	ElementMessageType_MOVIE_DURATION     ElementMessageType = 20
+	ElementMessageType_PLAYBACK_LOCK      ElementMessageType = 21
+	ElementMessageType_CHANGE_CURRENT_URL ElementMessageType = 22
+	ElementMessageType_AUTO_ADVANCED      ElementMessageType = 23
+	ElementMessageType_ROOM_VISIBILITY    ElementMessageType = 24
+	ElementMessageType_REACTION           ElementMessageType = 25
+	ElementMessageType_REACTIONS          ElementMessageType = 26
+	ElementMessageType_MAINTENANCE        ElementMessageType = 27
+	ElementMessageType_BATCH              ElementMessageType = 28
 )
 
 // Enum value maps for ElementMessageType.
@@ -54,21 +70,53 @@ var (
 		10: "CHANGE_CURRENT",
 		11: "CHANGE_MOVIES",
 		12: "CHANGE_PEOPLE",
+		13: "CHANGE_VERSION",
+		14: "START_BUFFERING",
+		15: "STOP_BUFFERING",
+		16: "SYNC",
+		17: "CHANGE_CREATOR",
+		18: "WHISPER",
+		19: "FORCE_SEEK",
+		20: "MOVIE_DURATION",
+		21: "PLAYBACK_LOCK",
+		22: "CHANGE_CURRENT_URL",
+		23: "AUTO_ADVANCED",
+		24: "ROOM_VISIBILITY",
+		25: "REACTION",
+		26: "REACTIONS",
+		27: "MAINTENANCE",
+		28: "BATCH",
 	}
 	ElementMessageType_value = map[string]int32{
-		"UNKNOWN":        0,
-		"ERROR":          1,
-		"CHAT_MESSAGE":   2,
-		"PLAY":           3,
-		"PAUSE":          4,
-		"CHECK_SEEK":     5,
-		"TOO_FAST":       6,
-		"TOO_SLOW":       7,
-		"CHANGE_RATE":    8,
-		"CHANGE_SEEK":    9,
-		"CHANGE_CURRENT": 10,
-		"CHANGE_MOVIES":  11,
-		"CHANGE_PEOPLE":  12,
+		"UNKNOWN":            0,
+		"ERROR":              1,
+		"CHAT_MESSAGE":       2,
+		"PLAY":               3,
+		"PAUSE":              4,
+		"CHECK_SEEK":         5,
+		"TOO_FAST":           6,
+		"TOO_SLOW":           7,
+		"CHANGE_RATE":        8,
+		"CHANGE_SEEK":        9,
+		"CHANGE_CURRENT":     10,
+		"CHANGE_MOVIES":      11,
+		"CHANGE_PEOPLE":      12,
+		"CHANGE_VERSION":     13,
+		"START_BUFFERING":    14,
+		"STOP_BUFFERING":     15,
+		"SYNC":               16,
+		"CHANGE_CREATOR":     17,
+		"WHISPER":            18,
+		"FORCE_SEEK":         19,
+		"MOVIE_DURATION":     20,
+		"PLAYBACK_LOCK":      21,
+		"CHANGE_CURRENT_URL": 22,
+		"AUTO_ADVANCED":      23,
+		"ROOM_VISIBILITY":    24,
+		"REACTION":           25,
+		"REACTIONS":          26,
+		"MAINTENANCE":        27,
+		"BATCH":              28,
 	}
 )
 
@@ -162,6 +210,61 @@ func (x *Status) GetPlaying() bool {
 	return false
 }
 
+type ReactionCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Emoji string `protobuf:"bytes,1,opt,name=emoji,proto3" json:"emoji,omitempty"`
+	Count int64  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *ReactionCount) Reset() {
+	*x = ReactionCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_message_message_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReactionCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReactionCount) ProtoMessage() {}
+
+func (x *ReactionCount) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_message_message_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReactionCount.ProtoReflect.Descriptor instead.
+func (*ReactionCount) Descriptor() ([]byte, []int) {
+	return file_proto_message_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ReactionCount) GetEmoji() string {
+	if x != nil {
+		return x.Emoji
+	}
+	return ""
+}
+
+func (x *ReactionCount) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
 type ElementMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -174,12 +277,22 @@ type ElementMessage struct {
 	Seek      float64            `protobuf:"fixed64,5,opt,name=seek,proto3" json:"seek,omitempty"`
 	PeopleNum int64              `protobuf:"varint,6,opt,name=peopleNum,proto3" json:"peopleNum,omitempty"`
 	Time      int64              `protobuf:"varint,7,opt,name=time,proto3" json:"time,omitempty"`
+	Version   uint32             `protobuf:"varint,8,opt,name=version,proto3" json:"version,omitempty"`
+	Playing   bool               `protobuf:"varint,9,opt,name=playing,proto3" json:"playing,omitempty"`
+	PreBuffer int64              `protobuf:"varint,10,opt,name=preBuffer,proto3" json:"preBuffer,omitempty"`
+	Receiver  string             `protobuf:"bytes,11,opt,name=receiver,proto3" json:"receiver,omitempty"`
+	Duration  float64            `protobuf:"fixed64,12,opt,name=duration,proto3" json:"duration,omitempty"`
+	Locked    bool               `protobuf:"varint,13,opt,name=locked,proto3" json:"locked,omitempty"`
+	Hidden    bool               `protobuf:"varint,14,opt,name=hidden,proto3" json:"hidden,omitempty"`
+	Reactions []*ReactionCount   `protobuf:"bytes,15,rep,name=reactions,proto3" json:"reactions,omitempty"`
+	Seq       uint64             `protobuf:"varint,16,opt,name=seq,proto3" json:"seq,omitempty"`
+	Batch     []*ElementMessage  `protobuf:"bytes,17,rep,name=batch,proto3" json:"batch,omitempty"`
 }
 
 func (x *ElementMessage) Reset() {
 	*x = ElementMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_proto_message_message_proto_msgTypes[1]
+		mi := &file_proto_message_message_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -192,7 +305,7 @@ func (x *ElementMessage) String() string {
 func (*ElementMessage) ProtoMessage() {}
 
 func (x *ElementMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_message_message_proto_msgTypes[1]
+	mi := &file_proto_message_message_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -205,7 +318,7 @@ func (x *ElementMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ElementMessage.ProtoReflect.Descriptor instead.
 func (*ElementMessage) Descriptor() ([]byte, []int) {
-	return file_proto_message_message_proto_rawDescGZIP(), []int{1}
+	return file_proto_message_message_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *ElementMessage) GetType() ElementMessageType {
@@ -257,6 +370,76 @@ func (x *ElementMessage) GetTime() int64 {
 	return 0
 }
 
+func (x *ElementMessage) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetPlaying() bool {
+	if x != nil {
+		return x.Playing
+	}
+	return false
+}
+
+func (x *ElementMessage) GetPreBuffer() int64 {
+	if x != nil {
+		return x.PreBuffer
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetReceiver() string {
+	if x != nil {
+		return x.Receiver
+	}
+	return ""
+}
+
+func (x *ElementMessage) GetDuration() float64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetLocked() bool {
+	if x != nil {
+		return x.Locked
+	}
+	return false
+}
+
+func (x *ElementMessage) GetHidden() bool {
+	if x != nil {
+		return x.Hidden
+	}
+	return false
+}
+
+func (x *ElementMessage) GetReactions() []*ReactionCount {
+	if x != nil {
+		return x.Reactions
+	}
+	return nil
+}
+
+func (x *ElementMessage) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ElementMessage) GetBatch() []*ElementMessage {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
 var File_proto_message_message_proto protoreflect.FileDescriptor
 
 var file_proto_message_message_proto_rawDesc = []byte{
@@ -267,34 +450,74 @@ var file_proto_message_message_proto_rawDesc = []byte{
 	0x65, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
 	0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69, 0x6e,
 	0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69, 0x6e, 0x67,
-	0x22, 0xcb, 0x01, 0x0a, 0x0e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0e, 0x32, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e,
-	0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79,
-	0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65,
-	0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73,
-	0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01,
-	0x28, 0x01, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65, 0x6b,
-	0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x12, 0x1c, 0x0a, 0x09,
-	0x70, 0x65, 0x6f, 0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52,
-	0x09, 0x70, 0x65, 0x6f, 0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69,
-	0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x2a, 0xdb,
-	0x01, 0x0a, 0x12, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e,
-	0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x01, 0x12, 0x10, 0x0a,
-	0x0c, 0x43, 0x48, 0x41, 0x54, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x02, 0x12,
-	0x08, 0x0a, 0x04, 0x50, 0x4c, 0x41, 0x59, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x50, 0x41, 0x55,
-	0x53, 0x45, 0x10, 0x04, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x5f, 0x53, 0x45,
-	0x45, 0x4b, 0x10, 0x05, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x46, 0x41, 0x53, 0x54,
-	0x10, 0x06, 0x12, 0x0c, 0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x53, 0x4c, 0x4f, 0x57, 0x10, 0x07,
-	0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x52, 0x41, 0x54, 0x45, 0x10,
-	0x08, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x53, 0x45, 0x45, 0x4b,
-	0x10, 0x09, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x43, 0x55, 0x52,
-	0x52, 0x45, 0x4e, 0x54, 0x10, 0x0a, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45,
-	0x5f, 0x4d, 0x4f, 0x56, 0x49, 0x45, 0x53, 0x10, 0x0b, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48, 0x41,
-	0x4e, 0x47, 0x45, 0x5f, 0x50, 0x45, 0x4f, 0x50, 0x4c, 0x45, 0x10, 0x0c, 0x42, 0x06, 0x5a, 0x04,
-	0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x22, 0x3b, 0x0a, 0x0d, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x6f, 0x6a, 0x69, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x65, 0x6d, 0x6f, 0x6a, 0x69, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0xf8, 0x03,
+	0x0a, 0x0e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x04, 0x73, 0x65, 0x65, 0x6b, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x65, 0x6f,
+	0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x70, 0x65,
+	0x6f, 0x70, 0x6c, 0x65, 0x4e, 0x75, 0x6d, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69, 0x6e, 0x67,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x70, 0x6c, 0x61, 0x79, 0x69, 0x6e, 0x67, 0x12,
+	0x1c, 0x0a, 0x09, 0x70, 0x72, 0x65, 0x42, 0x75, 0x66, 0x66, 0x65, 0x72, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x09, 0x70, 0x72, 0x65, 0x42, 0x75, 0x66, 0x66, 0x65, 0x72, 0x12, 0x1a, 0x0a,
+	0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x01, 0x52, 0x08, 0x64, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x12, 0x16, 0x0a,
+	0x06, 0x68, 0x69, 0x64, 0x64, 0x65, 0x6e, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x68,
+	0x69, 0x64, 0x64, 0x65, 0x6e, 0x12, 0x32, 0x0a, 0x09, 0x72, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x09,
+	0x72, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71,
+	0x18, 0x10, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x2b, 0x0a, 0x05, 0x62,
+	0x61, 0x74, 0x63, 0x68, 0x18, 0x11, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2e, 0x45, 0x6c, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x52, 0x05, 0x62, 0x61, 0x74, 0x63, 0x68, 0x2a, 0xf3, 0x03, 0x0a, 0x12, 0x45, 0x6c, 0x65,
+	0x6d, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05,
+	0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x43, 0x48, 0x41, 0x54, 0x5f,
+	0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x4c, 0x41,
+	0x59, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x50, 0x41, 0x55, 0x53, 0x45, 0x10, 0x04, 0x12, 0x0e,
+	0x0a, 0x0a, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x5f, 0x53, 0x45, 0x45, 0x4b, 0x10, 0x05, 0x12, 0x0c,
+	0x0a, 0x08, 0x54, 0x4f, 0x4f, 0x5f, 0x46, 0x41, 0x53, 0x54, 0x10, 0x06, 0x12, 0x0c, 0x0a, 0x08,
+	0x54, 0x4f, 0x4f, 0x5f, 0x53, 0x4c, 0x4f, 0x57, 0x10, 0x07, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x48,
+	0x41, 0x4e, 0x47, 0x45, 0x5f, 0x52, 0x41, 0x54, 0x45, 0x10, 0x08, 0x12, 0x0f, 0x0a, 0x0b, 0x43,
+	0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x53, 0x45, 0x45, 0x4b, 0x10, 0x09, 0x12, 0x12, 0x0a, 0x0e,
+	0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x43, 0x55, 0x52, 0x52, 0x45, 0x4e, 0x54, 0x10, 0x0a,
+	0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x4d, 0x4f, 0x56, 0x49, 0x45,
+	0x53, 0x10, 0x0b, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x50, 0x45,
+	0x4f, 0x50, 0x4c, 0x45, 0x10, 0x0c, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45,
+	0x5f, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e, 0x10, 0x0d, 0x12, 0x13, 0x0a, 0x0f, 0x53, 0x54,
+	0x41, 0x52, 0x54, 0x5f, 0x42, 0x55, 0x46, 0x46, 0x45, 0x52, 0x49, 0x4e, 0x47, 0x10, 0x0e, 0x12,
+	0x12, 0x0a, 0x0e, 0x53, 0x54, 0x4f, 0x50, 0x5f, 0x42, 0x55, 0x46, 0x46, 0x45, 0x52, 0x49, 0x4e,
+	0x47, 0x10, 0x0f, 0x12, 0x08, 0x0a, 0x04, 0x53, 0x59, 0x4e, 0x43, 0x10, 0x10, 0x12, 0x12, 0x0a,
+	0x0e, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x4f, 0x52, 0x10,
+	0x11, 0x12, 0x0b, 0x0a, 0x07, 0x57, 0x48, 0x49, 0x53, 0x50, 0x45, 0x52, 0x10, 0x12, 0x12, 0x0e,
+	0x0a, 0x0a, 0x46, 0x4f, 0x52, 0x43, 0x45, 0x5f, 0x53, 0x45, 0x45, 0x4b, 0x10, 0x13, 0x12, 0x12,
+	0x0a, 0x0e, 0x4d, 0x4f, 0x56, 0x49, 0x45, 0x5f, 0x44, 0x55, 0x52, 0x41, 0x54, 0x49, 0x4f, 0x4e,
+	0x10, 0x14, 0x12, 0x11, 0x0a, 0x0d, 0x50, 0x4c, 0x41, 0x59, 0x42, 0x41, 0x43, 0x4b, 0x5f, 0x4c,
+	0x4f, 0x43, 0x4b, 0x10, 0x15, 0x12, 0x16, 0x0a, 0x12, 0x43, 0x48, 0x41, 0x4e, 0x47, 0x45, 0x5f,
+	0x43, 0x55, 0x52, 0x52, 0x45, 0x4e, 0x54, 0x5f, 0x55, 0x52, 0x4c, 0x10, 0x16, 0x12, 0x11, 0x0a,
+	0x0d, 0x41, 0x55, 0x54, 0x4f, 0x5f, 0x41, 0x44, 0x56, 0x41, 0x4e, 0x43, 0x45, 0x44, 0x10, 0x17,
+	0x12, 0x13, 0x0a, 0x0f, 0x52, 0x4f, 0x4f, 0x4d, 0x5f, 0x56, 0x49, 0x53, 0x49, 0x42, 0x49, 0x4c,
+	0x49, 0x54, 0x59, 0x10, 0x18, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x41, 0x43, 0x54, 0x49, 0x4f,
+	0x4e, 0x10, 0x19, 0x12, 0x0d, 0x0a, 0x09, 0x52, 0x45, 0x41, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x53,
+	0x10, 0x1a, 0x12, 0x0f, 0x0a, 0x0b, 0x4d, 0x41, 0x49, 0x4e, 0x54, 0x45, 0x4e, 0x41, 0x4e, 0x43,
+	0x45, 0x10, 0x1b, 0x12, 0x09, 0x0a, 0x05, 0x42, 0x41, 0x54, 0x43, 0x48, 0x10, 0x1c, 0x42, 0x06,
+	0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -310,19 +533,22 @@ func file_proto_message_message_proto_rawDescGZIP() []byte {
 }
 
 var file_proto_message_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_message_message_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_message_message_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_proto_message_message_proto_goTypes = []interface{}{
 	(ElementMessageType)(0), // 0: proto.ElementMessageType
 	(*Status)(nil),          // 1: proto.Status
-	(*ElementMessage)(nil),  // 2: proto.ElementMessage
+	(*ReactionCount)(nil),   // 2: proto.ReactionCount
+	(*ElementMessage)(nil),  // 3: proto.ElementMessage
 }
 var file_proto_message_message_proto_depIdxs = []int32{
 	0, // 0: proto.ElementMessage.type:type_name -> proto.ElementMessageType
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	2, // 1: proto.ElementMessage.reactions:type_name -> proto.ReactionCount
+	3, // 2: proto.ElementMessage.batch:type_name -> proto.ElementMessage
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_proto_message_message_proto_init() }
@@ -344,6 +570,18 @@ func file_proto_message_message_proto_init() {
 			}
 		}
 		file_proto_message_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReactionCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_message_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ElementMessage); i {
 			case 0:
 				return &v.state
@@ -362,7 +600,7 @@ func file_proto_message_message_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_message_message_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
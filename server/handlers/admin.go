@@ -165,6 +165,8 @@ func genUserListResp(us []*dbModel.User) []*model.UserInfoResp {
 			Username:  v.Username,
 			Role:      v.Role,
 			CreatedAt: v.CreatedAt.UnixMilli(),
+			Color:     v.Color,
+			Avatar:    v.Avatar,
 		}
 	}
 	return resp
@@ -232,6 +234,8 @@ func genRoomUserListResp(us []*dbModel.User) []*model.RoomUsersResp {
 			UserID:      v.ID,
 			Username:    v.Username,
 			Role:        v.Role,
+			Color:       v.Color,
+			Avatar:      v.Avatar,
 			JoinAt:      v.RoomUserRelations[0].CreatedAt.UnixMilli(),
 			RoomID:      v.RoomUserRelations[0].RoomID,
 			Status:      v.RoomUserRelations[0].Status,
@@ -685,7 +689,7 @@ func AdminRoomPassword(ctx *gin.Context) {
 		return
 	}
 
-	creator, err := op.LoadOrInitUserByID(r.Value().CreatorID)
+	creator, err := op.LoadOrInitUserByID(r.Value().CreatedBy())
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("room creator not found"))
 		return
@@ -865,3 +869,56 @@ func AdminDisableVendorBackends(ctx *gin.Context) {
 
 	ctx.Status(http.StatusNoContent)
 }
+
+func AdminClearUserVendors(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.UserIDReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	u, err := op.LoadOrInitUserByID(req.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if u.Value().IsRoot() && !user.IsRoot() {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("cannot clear root vendors"))
+		return
+	}
+
+	if u.Value().IsAdmin() && !user.IsRoot() && u.Value().ID != user.ID {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("cannot clear admin vendors"))
+		return
+	}
+
+	if err := u.Value().ClearVendors(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func AdminRoomDebug(ctx *gin.Context) {
+	id := ctx.Query("id")
+	if len(id) != 32 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorStringResp("room id error"))
+		return
+	}
+
+	d, err := op.DebugDumpRoom(id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(d))
+}
+
+func AdminRoomsDebug(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(op.DebugDumpRooms()))
+}
@@ -87,6 +87,8 @@ func initAdmin(admin *gin.RouterGroup, root *gin.RouterGroup) {
 
 		admin.POST("/vendors/disable", AdminDisableVendorBackends)
 
+		admin.GET("/proxy/cache", AdminProxyCacheStats)
+
 		{
 			user := admin.Group("/user")
 
@@ -98,6 +100,9 @@ func initAdmin(admin *gin.RouterGroup, root *gin.RouterGroup) {
 
 			user.POST("/username", AdminUsername)
 
+			// 删除用户的第三方凭据
+			user.POST("/vendors/clear", AdminClearUserVendors)
+
 			// 查找用户
 			user.GET("/list", Users)
 
@@ -126,6 +131,10 @@ func initAdmin(admin *gin.RouterGroup, root *gin.RouterGroup) {
 			room.POST("/unban", UnBanRoom)
 
 			room.GET("/users", GetRoomUsers)
+
+			room.GET("/debug", AdminRoomDebug)
+
+			room.GET("/debug/list", AdminRoomsDebug)
 		}
 	}
 
@@ -137,7 +146,9 @@ func initAdmin(admin *gin.RouterGroup, root *gin.RouterGroup) {
 }
 
 func initRoom(room *gin.RouterGroup, needAuthUser *gin.RouterGroup, needAuthRoom *gin.RouterGroup) {
-	room.GET("/ws", NewWebSocketHandler(utils.NewWebSocketServer()))
+	room.GET("/ws", NewWebSocketHandler(utils.NewWebSocketServer(utils.WithCheckOrigin(checkWebSocketOrigin))))
+
+	needAuthRoom.POST("/ws/rtc", RTCOffer)
 
 	room.GET("/check", CheckRoom)
 
@@ -149,15 +160,39 @@ func initRoom(room *gin.RouterGroup, needAuthUser *gin.RouterGroup, needAuthRoom
 
 	needAuthUser.POST("/login", LoginRoom)
 
+	room.POST("/login/token", middlewares.NewTokenLoginLimiter(), LoginRoomWithToken)
+
 	needAuthRoom.POST("/delete", DeleteRoom)
 
 	needAuthRoom.POST("/pwd", SetRoomPassword)
 
+	needAuthRoom.POST("/lock", SetPlaybackLocked)
+
+	needAuthRoom.POST("/autoAdvance", SetAutoAdvance)
+
+	needAuthRoom.POST("/playlistSort", SetPlaylistSort)
+
 	needAuthRoom.GET("/settings", RoomSetting)
 
 	needAuthRoom.POST("/settings", SetRoomSetting)
 
 	needAuthRoom.GET("/users", RoomUsers)
+
+	needAuthRoom.POST("/kick", KickRoomUser)
+
+	needAuthRoom.GET("/activity", RoomActivity)
+
+	needAuthRoom.POST("/chat/clear", ClearChatHistory)
+
+	needAuthRoom.GET("/webhooks", RoomWebhooks)
+
+	needAuthRoom.POST("/webhooks/add", AddRoomWebhook)
+
+	needAuthRoom.POST("/webhooks/delete", DeleteRoomWebhook)
+
+	needAuthRoom.POST("/claim", ClaimRoom)
+
+	needAuthRoom.POST("/reclaim", ReclaimRoom)
 }
 
 func initMovie(movie *gin.RouterGroup, needAuthMovie *gin.RouterGroup) {
@@ -169,6 +204,10 @@ func initMovie(movie *gin.RouterGroup, needAuthMovie *gin.RouterGroup) {
 
 	needAuthMovie.POST("/current", ChangeCurrentMovie)
 
+	needAuthMovie.POST("/forceSeek", ForceSeek)
+
+	needAuthMovie.POST("/seekRelative", SeekRelative)
+
 	needAuthMovie.POST("/push", PushMovie)
 
 	needAuthMovie.POST("/pushs", PushMovies)
@@ -177,10 +216,18 @@ func initMovie(movie *gin.RouterGroup, needAuthMovie *gin.RouterGroup) {
 
 	needAuthMovie.POST("/swap", SwapMovie)
 
+	needAuthMovie.POST("/pin", PinMovie)
+
+	needAuthMovie.POST("/visibility", SetMovieVisibility)
+
 	needAuthMovie.POST("/delete", DelMovie)
 
 	needAuthMovie.POST("/clear", ClearMovies)
 
+	needAuthMovie.GET("/history", MovieHistory)
+
+	needAuthMovie.GET("/danmaku", ExportDanmaku)
+
 	movie.HEAD("/proxy/:roomId/:movieId", ProxyMovie)
 
 	movie.GET("/proxy/:roomId/:movieId", ProxyMovie)
@@ -207,6 +254,16 @@ func initUser(user *gin.RouterGroup, needAuthUser *gin.RouterGroup) {
 
 	needAuthUser.POST("/password", SetUserPassword)
 
+	needAuthUser.POST("/profile", SetUserProfile)
+
+	needAuthUser.GET("/session", UserSessionToken)
+
+	needAuthUser.POST("/session/rotate", RotateUserSessionToken)
+
+	needAuthUser.POST("/block", BlockUser)
+
+	needAuthUser.POST("/unblock", UnblockUser)
+
 	needAuthUser.GET("/providers", UserBindProviders)
 }
 
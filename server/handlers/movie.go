@@ -10,6 +10,7 @@ import (
 	"image/png"
 	"io"
 	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
@@ -56,13 +57,19 @@ func MovieList(ctx *gin.Context) {
 		return
 	}
 
-	m := room.GetMoviesWithPage(page, max)
+	m, total, err := getMoviesWithPage(ctx, user, room, page, max)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
 	mresp := make([]model.MoviesResp, len(m))
 	for i, v := range m {
 		mresp[i] = model.MoviesResp{
-			Id:      v.Movie.ID,
-			Base:    v.Movie.Base,
-			Creator: op.GetUserName(v.Movie.CreatorID),
+			Id:         v.Movie.ID,
+			Base:       v.Movie.Base,
+			Creator:    op.GetUserName(v.Movie.CreatorID),
+			Pinned:     v.Movie.Pinned,
+			Visibility: v.Movie.Visibility,
 		}
 		// hide url and headers when proxy
 		if user.ID != v.Movie.CreatorID && v.Movie.Base.Proxy {
@@ -75,11 +82,39 @@ func MovieList(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
 		"current": genCurrentResp(current),
-		"total":   room.GetMoviesCount(),
+		"total":   total,
 		"movies":  mresp,
 	}))
 }
 
+// movieErrStatus maps a missing movie to 404 and other errors to fallback
+func movieErrStatus(err error, fallback int) int {
+	var nf *op.ErrMovieNotFound
+	if errors.As(err, &nf) {
+		return http.StatusNotFound
+	}
+	return fallback
+}
+
+// getMoviesWithPage pages over the room movies the user can see,
+// optionally filtered by the kind query
+func getMoviesWithPage(ctx *gin.Context, user *op.User, room *op.Room, page, max int) ([]*op.Movie, int, error) {
+	visible := user.MovieVisibleFunc(room)
+	kind, ok := ctx.GetQuery("kind")
+	if !ok {
+		m, total := room.GetFilteredMoviesWithPage(visible, page, max)
+		return m, total, nil
+	}
+	k := dbModel.MediaKind(kind)
+	if !k.Valid() {
+		return nil, 0, model.ErrInvalidMediaKind
+	}
+	m, total := room.GetFilteredMoviesWithPage(func(m *dbModel.Movie) bool {
+		return m.Base.MediaKind == k && visible(m)
+	}, page, max)
+	return m, total, nil
+}
+
 func genCurrent(ctx context.Context, user *op.User, room *op.Room, current *op.Current) error {
 	if current.Movie.Base.VendorInfo.Vendor != "" {
 		return parse2VendorMovie(ctx, user, room, &current.Movie)
@@ -94,6 +129,8 @@ func genCurrent(ctx context.Context, user *op.User, room *op.Room, current *op.C
 	} else if current.Movie.Base.Proxy {
 		current.Movie.Base.Url = fmt.Sprintf("/api/movie/proxy/%s/%s", current.Movie.RoomID, current.Movie.ID)
 		current.Movie.Base.Headers = nil
+	} else {
+		current.Movie.Base.Url = room.RewriteMovieURL(&current.Movie)
 	}
 	if current.Movie.Base.Type == "" && current.Movie.Base.Url != "" {
 		current.Movie.Base.Type = utils.GetUrlExtension(current.Movie.Base.Url)
@@ -105,11 +142,13 @@ func genCurrentResp(current *op.Current) *model.CurrentMovieResp {
 	c := &model.CurrentMovieResp{
 		Status: current.Status,
 		Movie: model.MoviesResp{
-			Id:        current.Movie.ID,
-			CreatedAt: current.Movie.CreatedAt.UnixMilli(),
-			Base:      current.Movie.Base,
-			Creator:   op.GetUserName(current.Movie.CreatorID),
-			CreatorId: current.Movie.CreatorID,
+			Id:         current.Movie.ID,
+			CreatedAt:  current.Movie.CreatedAt.UnixMilli(),
+			Base:       current.Movie.Base,
+			Creator:    op.GetUserName(current.Movie.CreatorID),
+			CreatorId:  current.Movie.CreatorID,
+			Pinned:     current.Movie.Pinned,
+			Visibility: current.Movie.Visibility,
 		},
 	}
 	return c
@@ -141,14 +180,20 @@ func Movies(ctx *gin.Context) {
 		return
 	}
 
-	m := room.GetMoviesWithPage(int(page), int(max))
+	m, total, err := getMoviesWithPage(ctx, user, room, page, max)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
 
 	mresp := make([]*model.MoviesResp, len(m))
 	for i, v := range m {
 		mresp[i] = &model.MoviesResp{
-			Id:      v.Movie.ID,
-			Base:    v.Movie.Base,
-			Creator: op.GetUserName(v.Movie.CreatorID),
+			Id:         v.Movie.ID,
+			Base:       v.Movie.Base,
+			Creator:    op.GetUserName(v.Movie.CreatorID),
+			Pinned:     v.Movie.Pinned,
+			Visibility: v.Movie.Visibility,
 		}
 		// hide url and headers when proxy
 		if user.ID != v.Movie.CreatorID && v.Movie.Base.Proxy {
@@ -158,7 +203,7 @@ func Movies(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
-		"total":  room.GetMoviesCount(),
+		"total":  total,
 		"movies": mresp,
 	}))
 }
@@ -173,7 +218,7 @@ func PushMovie(ctx *gin.Context) {
 		return
 	}
 
-	err := user.AddMovieToRoom(room, (*dbModel.BaseMovie)(&req))
+	err := user.AddMovieToRoomContext(ctx.Request.Context(), room, (*dbModel.BaseMovie)(&req))
 	if err != nil {
 		if errors.Is(err, dbModel.ErrNoPermission) {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
@@ -248,7 +293,7 @@ func NewPublishKey(ctx *gin.Context) {
 	}
 	movie, err := room.GetMovieByID(req.Id)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
 		return
 	}
 
@@ -295,7 +340,7 @@ func EditMovie(ctx *gin.Context) {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
 		return
 	}
 
@@ -310,6 +355,60 @@ func EditMovie(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+func MovieHistory(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	id := ctx.Query("id")
+	if len(id) != 32 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+
+	history, err := user.MovieHistory(room, id)
+	if err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(history))
+}
+
+// ExportDanmaku downloads the kept chat of the movie as a danmaku file
+func ExportDanmaku(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	id := ctx.Query("id")
+	if len(id) != 32 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(model.ErrId))
+		return
+	}
+
+	ctx.Header("Content-Type", "application/xml; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, id))
+	// the body is streamed, an error after the first write cuts it short
+	if err := user.ExportDanmaku(room, ctx.Writer, id); err != nil {
+		if ctx.Writer.Written() {
+			_ = ctx.Error(err)
+			return
+		}
+		ctx.Writer.Header().Del("Content-Type")
+		ctx.Writer.Header().Del("Content-Disposition")
+		var notFound *op.ErrMovieNotFound
+		if errors.As(err, &notFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+}
+
 func DelMovie(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.RoomEntry).Value()
 	user := ctx.MustGet("user").(*op.UserEntry).Value()
@@ -321,12 +420,20 @@ func DelMovie(ctx *gin.Context) {
 	}
 
 	err := user.DeleteMoviesByID(room, req.Ids)
+	var partial *op.ErrDeleteMovies
+	if errors.As(err, &partial) && len(partial.Deleted) != 0 {
+		// the rest of the batch was deleted
+		_ = room.Broadcast(&op.ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_MOVIES,
+			Sender: user.Username,
+		})
+	}
 	if err != nil {
 		if errors.Is(err, dbModel.ErrNoPermission) {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
 		return
 	}
 
@@ -376,10 +483,40 @@ func SwapMovie(ctx *gin.Context) {
 	}
 
 	if err := room.SwapMoviePositions(req.Id1, req.Id2); err != nil {
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := room.Broadcast(&op.ElementMessage{
+		Type:   pb.ElementMessageType_CHANGE_MOVIES,
+		Sender: user.Username,
+	}); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func PinMovie(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.PinMovieReq{}
+	if err := model.Decode(ctx, &req); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
 
+	if err := user.SetMoviePinned(room, req.Id, req.Pinned); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
+		return
+	}
+
 	if err := room.Broadcast(&op.ElementMessage{
 		Type:   pb.ElementMessageType_CHANGE_MOVIES,
 		Sender: user.Username,
@@ -391,28 +528,66 @@ func SwapMovie(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+func SetMovieVisibility(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.SetMovieVisibilityReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	changed, err := user.SetMovieVisibility(room, req.Id, req.Visibility)
+	if err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
+		return
+	}
+
+	// the playlists of the members that gained or lost the movie changed
+	if changed {
+		if err := room.Broadcast(&op.ElementMessage{
+			Type:   pb.ElementMessageType_CHANGE_MOVIES,
+			Sender: user.Username,
+		}); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+			return
+		}
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func ChangeCurrentMovie(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.RoomEntry).Value()
 	user := ctx.MustGet("user").(*op.UserEntry).Value()
 
-	req := model.IdCanEmptyReq{}
+	req := model.ChangeCurrentMovieReq{}
 	err := model.Decode(ctx, &req)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 		return
 	}
 
-	if req.Id == "" {
+	switch {
+	case req.Id == "":
 		err = user.SetCurrentMovie(room, nil, false)
-	} else {
+	case req.Resume:
+		err = user.SetCurrentMovieResume(room, req.Id, true)
+	default:
 		err = user.SetCurrentMovieByID(room, req.Id, true)
 	}
 	if err != nil {
-		if errors.Is(err, dbModel.ErrNoPermission) {
+		if errors.Is(err, dbModel.ErrNoPermission) || errors.Is(err, op.ErrPlaybackLocked) {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
 			return
 		}
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
+		return
 	}
 
 	if err := room.Broadcast(&op.ElementMessage{
@@ -426,6 +601,50 @@ func ChangeCurrentMovie(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+func ForceSeek(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	var req model.ForceSeekReq
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.ForceSeek(room, req.Seek); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func SeekRelative(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	var req model.SeekRelativeReq
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SeekRelative(room, req.Delta); err != nil {
+		if errors.Is(err, op.ErrPlaybackLocked) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func ProxyMovie(ctx *gin.Context) {
 	if !settings.MovieProxy.Get() {
 		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("movie proxy is not enabled"))
@@ -445,7 +664,7 @@ func ProxyMovie(ctx *gin.Context) {
 
 	m, err := room.Value().GetMovieByID(ctx.Param("movieId"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		ctx.AbortWithStatusJSON(movieErrStatus(err, http.StatusBadRequest), model.NewApiErrorResp(err))
 		return
 	}
 
@@ -464,7 +683,7 @@ func ProxyMovie(ctx *gin.Context) {
 		// TODO: cache mpd file
 		fallthrough
 	default:
-		err = proxyURL(ctx, m.Movie.Base.Url, m.Movie.Base.Headers)
+		err = proxyURLWithCache(ctx, m.Movie.ID, m.Movie.Base.Url, m.Movie.Base.Headers)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
 			return
@@ -511,7 +730,7 @@ func ProxyMovie(ctx *gin.Context) {
 // 	}
 // }
 
-func proxyURL(ctx *gin.Context, u string, headers map[string]string) error {
+func checkProxyURL(u string) error {
 	if !settings.AllowProxyToLocal.Get() {
 		if l, err := utils.ParseURLIsLocalIP(u); err != nil {
 			return err
@@ -519,6 +738,13 @@ func proxyURL(ctx *gin.Context, u string, headers map[string]string) error {
 			return errors.New("not allow proxy to local")
 		}
 	}
+	return nil
+}
+
+func proxyURL(ctx *gin.Context, u string, headers map[string]string) error {
+	if err := checkProxyURL(u); err != nil {
+		return err
+	}
 	ctx2, cf := context.WithCancel(ctx)
 	defer cf()
 	req, err := http.NewRequestWithContext(ctx2, http.MethodGet, u, nil)
@@ -542,7 +768,7 @@ func proxyURL(ctx *gin.Context, u string, headers map[string]string) error {
 	ctx.Header("Cache-Control", resp.Header.Get("Cache-Control"))
 	ctx.Header("Content-Length", resp.Header.Get("Content-Length"))
 	ctx.Header("Content-Range", resp.Header.Get("Content-Range"))
-	ctx.Header("Content-Type", resp.Header.Get("Content-Type"))
+	ctx.Header("Content-Type", proxyContentType(u, resp.Header.Get("Content-Type")))
 	ctx.Status(resp.StatusCode)
 	_, err = io.Copy(ctx.Writer, resp.Body)
 	if err != nil && err != io.EOF {
@@ -551,6 +777,22 @@ func proxyURL(ctx *gin.Context, u string, headers map[string]string) error {
 	return nil
 }
 
+// proxyContentType falls back to the url extension when the upstream
+// does not tell the type, so players can tell audio from video
+func proxyContentType(u, ct string) string {
+	if ct != "" && ct != "application/octet-stream" {
+		return ct
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ct
+	}
+	if t := mime.TypeByExtension(path.Ext(pu.Path)); t != "" {
+		return t
+	}
+	return ct
+}
+
 type FormatErrNotSupportFileType string
 
 func (e FormatErrNotSupportFileType) Error() string {
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/cache"
+	"github.com/synctv-org/synctv/server/model"
+	"github.com/synctv-org/synctv/utils"
+)
+
+// proxyURLWithCache serves the movie from the shared segment cache,
+// upstreams that do not support range requests are passed through
+func proxyURLWithCache(ctx *gin.Context, movieID, u string, headers map[string]string) error {
+	c := cache.ProxySegmentCache()
+	if c == nil || c.NoRange(movieID) {
+		return proxyURL(ctx, u, headers)
+	}
+	rangeHeader := ctx.GetHeader("Range")
+	start, end, ok := parseRange(rangeHeader)
+	if !ok {
+		return proxyURL(ctx, u, headers)
+	}
+	if err := checkProxyURL(u); err != nil {
+		return err
+	}
+	fetch := func(ctx context.Context, start, end int64) (*cache.Segment, error) {
+		return fetchSegment(ctx, u, headers, start, end)
+	}
+
+	index := start / cache.SegmentSize
+	seg, err := c.Get(ctx, movieID, index, fetch)
+	if errors.Is(err, cache.ErrRangeNotSupported) {
+		c.MarkNoRange(movieID)
+		return proxyURL(ctx, u, headers)
+	}
+	if err != nil {
+		return err
+	}
+	if start >= seg.Total {
+		ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", seg.Total))
+		ctx.Status(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	if end < 0 || end >= seg.Total {
+		end = seg.Total - 1
+	}
+
+	ctx.Header("Accept-Ranges", "bytes")
+	ctx.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
+	ctx.Header("Content-Type", proxyContentType(u, seg.ContentType))
+	if rangeHeader != "" {
+		ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, seg.Total))
+		ctx.Status(http.StatusPartialContent)
+	} else {
+		ctx.Status(http.StatusOK)
+	}
+
+	for {
+		segStart := index * cache.SegmentSize
+		from := start - segStart
+		to := min(end-segStart+1, int64(len(seg.Data)))
+		if from >= to {
+			return io.ErrUnexpectedEOF
+		}
+		if _, err := ctx.Writer.Write(seg.Data[from:to]); err != nil {
+			return err
+		}
+		start = segStart + to
+		if start > end {
+			return nil
+		}
+		index++
+		seg, err = c.Get(ctx, movieID, index, fetch)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseRange parses a single range request header, end is -1 when open,
+// suffix and multiple ranges are not supported
+func parseRange(s string) (start, end int64, ok bool) {
+	if s == "" {
+		return 0, -1, true
+	}
+	spec, found := strings.CutPrefix(s, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found || first == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if last == "" {
+		return start, -1, true
+	}
+	end, err = strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func fetchSegment(ctx context.Context, u string, headers map[string]string, start, end int64) (*cache.Segment, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	// ranges must apply to the raw bytes
+	req.Header.Set("Accept-Encoding", "identity")
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", utils.UA)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		total, err := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		return &cache.Segment{
+			Total:       total,
+			ContentType: resp.Header.Get("Content-Type"),
+		}, nil
+	case http.StatusOK:
+		return nil, cache.ErrRangeNotSupported
+	default:
+		return nil, fmt.Errorf("unexpected upstream status: %s", resp.Status)
+	}
+	total, err := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+	return &cache.Segment{
+		Data:        data,
+		Total:       total,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// parseContentRangeTotal returns the complete length of a Content-Range header,
+// an unknown length can not be served in segments
+func parseContentRangeTotal(s string) (int64, error) {
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid content range: %s", s)
+	}
+	if s[i+1:] == "*" {
+		return 0, cache.ErrRangeNotSupported
+	}
+	total, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid content range: %s", s)
+	}
+	return total, nil
+}
+
+func AdminProxyCacheStats(ctx *gin.Context) {
+	c := cache.ProxySegmentCache()
+	if c == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorStringResp("proxy cache is not enabled"))
+		return
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(c.Stats()))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -50,7 +51,14 @@ func CreateRoom(ctx *gin.Context) {
 
 	room, err := user.CreateRoom(req.RoomName, req.Password, db.WithSetting(req.Setting))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		switch {
+		case errors.Is(err, op.ErrCreateRoomRateLimited):
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+		case errors.Is(err, op.ErrRoomCapacityReached):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		}
 		return
 	}
 
@@ -76,7 +84,8 @@ var roomHotCache = refreshcache.NewRefreshCache[[]*model.RoomListResp](func(cont
 				RoomName:     v.Name,
 				PeopleNum:    v.PeopleNum(),
 				NeedPassword: v.NeedPassword(),
-				Creator:      op.GetUserName(v.CreatorID),
+				CreatorID:    v.CreatedBy(),
+				Creator:      op.GetUserName(v.CreatedBy()),
 				CreatedAt:    v.CreatedAt.UnixMilli(),
 			})
 		}
@@ -225,7 +234,11 @@ func LoginRoom(ctx *gin.Context) {
 		return
 	}
 
-	if room.Value().CreatorID != user.ID && !room.Value().CheckPassword(req.Password) {
+	if err := room.Value().CheckPasswordOf(user.ID, req.Password); err != nil {
+		if errors.Is(err, op.ErrTooManyPasswordAttempts) {
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewApiErrorResp(err))
+			return
+		}
 		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorStringResp("password error"))
 		return
 	}
@@ -242,6 +255,41 @@ func LoginRoom(ctx *gin.Context) {
 	}))
 }
 
+func LoginRoomWithToken(ctx *gin.Context) {
+	req := model.LoginRoomWithTokenReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	room, err := op.LoadOrInitRoomByID(req.RoomId)
+	if err != nil {
+		if err == op.ErrRoomBanned || err == op.ErrRoomPending {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		return
+	}
+
+	user, err := room.Value().AuthenticateToken(req.UserId, req.SessionToken)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, model.NewApiErrorResp(err))
+		return
+	}
+
+	token, err := middlewares.NewAuthRoomToken(user, room.Value())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"roomId": room.Value().ID,
+		"token":  token,
+	}))
+}
+
 func DeleteRoom(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.RoomEntry)
 	user := ctx.MustGet("user").(*op.UserEntry).Value()
@@ -258,6 +306,30 @@ func DeleteRoom(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+func ClaimRoom(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	if err := room.ClaimRoot(user); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func ReclaimRoom(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	if err := room.ReclaimRoot(user); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func SetRoomPassword(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.RoomEntry).Value()
 	user := ctx.MustGet("user").(*op.UserEntry).Value()
@@ -289,11 +361,108 @@ func SetRoomPassword(ctx *gin.Context) {
 	}))
 }
 
+func SetPlaybackLocked(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.SetPlaybackLockedReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetPlaybackLocked(room, req.Locked); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func SetAutoAdvance(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.SetAutoAdvanceReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetAutoAdvance(room, req.Enabled); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func SetPlaylistSort(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.SetPlaylistSortReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetPlaylistSort(room, req.Sort); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func KickRoomUser(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.UserIDReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.KickUser(room, req.ID); err != nil {
+		var notFound *op.ErrUserNotFound
+		switch {
+		case errors.Is(err, dbModel.ErrNoPermission):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		case errors.As(err, &notFound), errors.Is(err, op.ErrUserNotConnected):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func RoomSetting(ctx *gin.Context) {
 	room := ctx.MustGet("room").(*op.RoomEntry).Value()
-	// user := ctx.MustGet("user").(*op.UserEntry)
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
 
-	ctx.JSON(http.StatusOK, model.NewApiDataResp(room.Settings))
+	s := room.Settings
+	// the default movie headers often carry credentials of the origin
+	if !user.HasRoomPermission(room, dbModel.PermissionEditRoom) {
+		s.DefaultMovieHeaders = nil
+	}
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(s))
 }
 
 func SetRoomSetting(ctx *gin.Context) {
@@ -376,3 +545,102 @@ func RoomUsers(ctx *gin.Context) {
 		"list":  genRoomUserListResp(db.GetAllUsers(append(scopes, db.Paginate(page, pageSize))...)),
 	}))
 }
+
+func RoomActivity(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "0"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(room.VisibleActivityLog(limit, user.MovieVisibleFunc(room))))
+}
+
+func ClearChatHistory(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	if err := user.ClearChatHistory(room); err != nil {
+		if errors.Is(err, dbModel.ErrNoPermission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func RoomWebhooks(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	hooks, err := user.RoomWebhooks(room)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(hooks))
+}
+
+func AddRoomWebhook(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.AddRoomWebhookReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	hook, err := user.AddRoomWebhook(room, req.URL, req.Events)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbModel.ErrNoPermission):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		case errors.Is(err, op.ErrInvalidWebhookURL),
+			errors.Is(err, op.ErrPrivateWebhookURL),
+			errors.Is(err, op.ErrInvalidWebhookEvent),
+			errors.Is(err, op.ErrTooManyWebhooks):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(&model.AddRoomWebhookResp{
+		ID:     hook.ID,
+		Secret: hook.Secret,
+	}))
+}
+
+func DeleteRoomWebhook(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.IdReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.DeleteRoomWebhook(room, req.Id); err != nil {
+		switch {
+		case errors.Is(err, dbModel.ErrNoPermission):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, model.NewApiErrorResp(err))
+		case errors.Is(err, db.ErrNotFound("room webhook")):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/synctv-org/synctv/internal/conf"
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/server/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func useTestDB(t *testing.T) {
+	t.Helper()
+	conf.Conf = conf.DefaultConfig()
+	conf.Conf.Database.Type = conf.DatabaseTypeSqlite3
+	d, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		TranslateError:                           true,
+		Logger:                                   logger.Discard,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		IgnoreRelationshipsWhenMigrating:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(d, conf.DatabaseTypeSqlite3); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Init(1024); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := d.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
+
+func loginRoom(user *op.UserEntry, req model.LoginRoomReq) int {
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/room/login", bytes.NewReader(body))
+	ctx.Set("user", user)
+	LoginRoom(ctx)
+	return w.Code
+}
+
+func TestLoginRoomPasswordAttempts(t *testing.T) {
+	useTestDB(t)
+	creator, err := op.CreateUser("creator", "password", db.WithRole(dbModel.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := op.CreateUser("member", "password", db.WithRole(dbModel.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := op.CreateRoom("room", "secret", 0, db.WithCreator(&creator.Value().User), db.WithStatus(dbModel.RoomStatusActive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := room.Value().ID
+	if code := loginRoom(creator, model.LoginRoomReq{RoomId: id}); code != http.StatusOK {
+		t.Fatalf("creator login = %d, want %d", code, http.StatusOK)
+	}
+	for i := 0; i < 5; i++ {
+		if code := loginRoom(member, model.LoginRoomReq{RoomId: id, Password: "wrong"}); code != http.StatusForbidden {
+			t.Fatalf("login with a wrong password = %d, want %d", code, http.StatusForbidden)
+		}
+	}
+	if code := loginRoom(member, model.LoginRoomReq{RoomId: id, Password: "secret"}); code != http.StatusTooManyRequests {
+		t.Fatalf("login after too many wrong passwords = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,6 +24,8 @@ func Me(ctx *gin.Context) {
 		Username:  user.Username,
 		Role:      user.Role,
 		CreatedAt: user.CreatedAt.UnixMilli(),
+		Color:     user.Color,
+		Avatar:    user.Avatar,
 	}))
 }
 
@@ -149,6 +152,100 @@ func SetUsername(ctx *gin.Context) {
 	ctx.Status(http.StatusNoContent)
 }
 
+func SetUserProfile(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	var req model.SetUserProfileReq
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetColor(req.Color); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.SetAvatar(req.Avatar); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// UserSessionToken returns the session token of the user, the token is
+// only stored hashed, so it is empty once the server no longer knows it
+// and RotateUserSessionToken issues a new one
+func UserSessionToken(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"userId":          user.ID,
+		"sessionToken":    user.SessionToken(),
+		"hasSessionToken": user.HasSessionToken(),
+	}))
+}
+
+func RotateUserSessionToken(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	token, err := user.RotateSessionToken()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(gin.H{
+		"userId":       user.ID,
+		"sessionToken": token,
+	}))
+}
+
+func BlockUser(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	var req model.BlockUserReq
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.BlockUser(req.Username); err != nil {
+		var notFound *op.ErrUserNotFound
+		if errors.As(err, &notFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func UnblockUser(ctx *gin.Context) {
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	var req model.BlockUserReq
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	if err := user.UnblockUser(req.Username); err != nil {
+		var notFound *op.ErrUserNotFound
+		if errors.As(err, &notFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, model.NewApiErrorResp(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
 func SetUserPassword(ctx *gin.Context) {
 	user := ctx.MustGet("user").(*op.UserEntry).Value()
 
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"io"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
 	log "github.com/sirupsen/logrus"
 	"github.com/synctv-org/synctv/internal/op"
+	"github.com/synctv-org/synctv/internal/settings"
 	pb "github.com/synctv-org/synctv/proto/message"
 	"github.com/synctv-org/synctv/server/middlewares"
 	"github.com/synctv-org/synctv/server/model"
@@ -18,6 +22,27 @@ import (
 
 const maxInterval = 10
 
+// checkWebSocketOrigin rejects upgrades from browsers on hosts missing from
+// settings.WebsocketAllowedOrigins, requests without an origin are not from browsers
+func checkWebSocketOrigin(r *http.Request) bool {
+	allowed := settings.WebsocketAllowedOrigins.Get()
+	origin := r.Header.Get("Origin")
+	if allowed == "" || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, host := range strings.Split(allowed, ",") {
+		host = strings.TrimSpace(host)
+		if host == "*" || (host != "" && strings.EqualFold(host, u.Host)) {
+			return true
+		}
+	}
+	return false
+}
+
 func NewWebSocketHandler(wss *utils.WebSocket) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		token := ctx.GetHeader("Sec-WebSocket-Protocol")
@@ -27,15 +52,26 @@ func NewWebSocketHandler(wss *utils.WebSocket) gin.HandlerFunc {
 			return
 		}
 
-		wss.Server(ctx.Writer, ctx.Request, []string{token}, NewWSMessageHandler(user, room))
+		wss.Server(ctx.Writer, ctx.Request, []string{token}, NewWSMessageHandler(user, room, ctx.Query("password")))
 	}
 }
 
-func NewWSMessageHandler(uE *op.UserEntry, rE *op.RoomEntry) func(c *websocket.Conn) error {
+// NewWSMessageHandler serves the connection of the user in the room, a
+// password sent on join is checked with the attempt limit of the room,
+// without one the room token is trusted as LoginRoom checked it
+func NewWSMessageHandler(uE *op.UserEntry, rE *op.RoomEntry, password string) func(c *websocket.Conn) error {
 	return func(c *websocket.Conn) error {
 		r := rE.Value()
 		u := uE.Value()
-		client, err := r.NewClient(u, c)
+		var (
+			client *op.Client
+			err    error
+		)
+		if password != "" {
+			client, err = r.RegClientWithPassword(u, c, password)
+		} else {
+			client, err = r.NewClient(u, c)
+		}
 		if err != nil {
 			log.Errorf("ws: register client error: %v", err)
 			wc, err2 := c.NextWriter(websocket.BinaryMessage)
@@ -50,6 +86,9 @@ func NewWSMessageHandler(uE *op.UserEntry, rE *op.RoomEntry) func(c *websocket.C
 			return em.Encode(wc)
 		}
 		log.Infof("ws: room %s user %s connected", r.Name, u.Username)
+		if err := client.Send(client.NewSyncMessage()); err != nil {
+			log.Errorf("ws: room %s user %s send sync message error: %v", r.Name, u.Username, err)
+		}
 		defer func() {
 			r.UnregisterClient(client)
 			client.Close()
@@ -60,8 +99,55 @@ func NewWSMessageHandler(uE *op.UserEntry, rE *op.RoomEntry) func(c *websocket.C
 	}
 }
 
+// RTCOffer answers the WebRTC offer of the user, see op.Room.RegClientWithOffer
+func RTCOffer(ctx *gin.Context) {
+	room := ctx.MustGet("room").(*op.RoomEntry).Value()
+	user := ctx.MustGet("user").(*op.UserEntry).Value()
+
+	req := model.RTCOfferReq{}
+	if err := model.Decode(ctx, &req); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		return
+	}
+
+	client, answer, err := room.RegClientWithOffer(user, req.ClientID, webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  req.SDP,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, op.ErrClientNotFound):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, model.NewApiErrorResp(err))
+		case errors.Is(err, op.ErrShuttingDown), errors.Is(err, op.ErrAlreadyClosed):
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewApiErrorResp(err))
+		default:
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, model.NewApiErrorResp(err))
+		}
+		return
+	}
+	if req.ClientID == "" {
+		log.Infof("rtc: room %s user %s connected", room.Name, user.Username)
+		if err := client.Send(client.NewSyncMessage()); err != nil {
+			log.Errorf("rtc: room %s user %s send sync message error: %v", room.Name, user.Username, err)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, model.NewApiDataResp(model.RTCAnswerResp{
+		Type: answer.Type.String(),
+		SDP:  answer.SDP,
+	}))
+}
+
 func handleWriterMessage(c *op.Client) error {
-	for v := range c.GetReadChan() {
+	return c.WriteLoop(func(v op.Message) error {
+		if pm, ok := v.(*op.PreparedMessage); ok {
+			if err := c.WritePreparedMessage(pm); err != nil {
+				log.Debugf("ws: room %s user %s write prepared message error: %v", c.Room().Name, c.User().Username, err)
+				return err
+			}
+			return nil
+		}
+
 		wc, err := c.NextWriter(v.MessageType())
 		if err != nil {
 			log.Debugf("ws: room %s user %s get next writer error: %v", c.Room().Name, c.User().Username, err)
@@ -73,11 +159,8 @@ func handleWriterMessage(c *op.Client) error {
 			return err
 		}
 
-		if err = wc.Close(); err != nil {
-			return err
-		}
-	}
-	return nil
+		return wc.Close()
+	})
 }
 
 func handleReaderMessage(c *op.Client) error {
@@ -96,6 +179,10 @@ func handleReaderMessage(c *op.Client) error {
 		case websocket.BinaryMessage:
 			var data []byte
 			if data, err = io.ReadAll(rd); err != nil {
+				if errors.Is(err, op.ErrMessageTooLarge) {
+					log.Warnf("ws: room %s user %s message too large", c.Room().Name, c.User().Username)
+					return err
+				}
 				log.Errorf("ws: room %s user %s read message error: %v", c.Room().Name, c.User().Username, err)
 				if err := c.Send(&op.ElementMessage{
 					Type:    pb.ElementMessageType_ERROR,
@@ -120,7 +207,7 @@ func handleReaderMessage(c *op.Client) error {
 			}
 
 			log.Debugf("ws: receive room %s user %s message: %+v", c.Room().Name, c.User().Username, msg.String())
-			if err = handleElementMsg(c, &msg); err != nil {
+			if err = c.Dispatch(&msg); err != nil {
 				log.Errorf("ws: room %s user %s handle message error: %v", c.Room().Name, c.User().Username, err)
 				return err
 			}
@@ -132,88 +219,112 @@ func handleReaderMessage(c *op.Client) error {
 	}
 }
 
-func handleElementMsg(cli *op.Client, msg *pb.ElementMessage) error {
-	var send = func(em *pb.ElementMessage) error {
-		em.Sender = cli.User().Username
-		return cli.Send((*op.ElementMessage)(em))
-	}
-	var broadcast = func(em *pb.ElementMessage, bc ...op.BroadcastConf) error {
-		em.Sender = cli.User().Username
-		return cli.Broadcast((*op.ElementMessage)(em), bc...)
-	}
-	var timeDiff float64
-	if msg.Time != 0 {
-		timeDiff = time.Since(time.UnixMilli(msg.Time)).Seconds()
-	} else {
-		timeDiff = 0.0
-	}
-	if timeDiff < 0 {
-		timeDiff = 0
-	} else if timeDiff > 1.5 {
-		timeDiff = 1.5
-	}
-	switch msg.Type {
-	case pb.ElementMessageType_CHAT_MESSAGE:
-		if len(msg.Message) > 4096 {
-			send(&pb.ElementMessage{
-				Type:    pb.ElementMessageType_ERROR,
-				Message: "message too long",
-			})
+// maxChatMessageLen bounds chat and whisper messages in bytes
+const maxChatMessageLen = 4096
+
+func init() {
+	op.UseMessageMiddleware(limitMessageLength)
+
+	op.HandleMessage(pb.ElementMessageType_CHAT_MESSAGE, handleChatMessage)
+	op.HandleMessage(pb.ElementMessageType_WHISPER, handleWhisper)
+	op.HandleMessage(pb.ElementMessageType_REACTION, handleReaction)
+	op.HandleMessage(pb.ElementMessageType_PLAY, handleSetStatus(true))
+	op.HandleMessage(pb.ElementMessageType_PAUSE, handleSetStatus(false))
+	op.HandleMessage(pb.ElementMessageType_CHANGE_RATE, handleSetSeekRate)
+	op.HandleMessage(pb.ElementMessageType_CHANGE_SEEK, handleSetSeekRate)
+	op.HandleMessage(pb.ElementMessageType_START_BUFFERING, handleBuffering(true))
+	op.HandleMessage(pb.ElementMessageType_STOP_BUFFERING, handleBuffering(false))
+	op.HandleMessage(pb.ElementMessageType_CHECK_SEEK, handleCheckSeek)
+}
+
+func limitMessageLength(next op.MessageHandler) op.MessageHandler {
+	return func(ctx *op.MessageContext) error {
+		switch ctx.Msg.Type {
+		case pb.ElementMessageType_CHAT_MESSAGE, pb.ElementMessageType_WHISPER:
+			if len(ctx.Msg.Message) > maxChatMessageLen {
+				ctx.SendError("message too long")
+				return nil
+			}
+		}
+		return next(ctx)
+	}
+}
+
+func handleChatMessage(ctx *op.MessageContext) error {
+	ctx.Broadcast(&pb.ElementMessage{
+		Type:    pb.ElementMessageType_CHAT_MESSAGE,
+		Message: ctx.Msg.Message,
+	})
+	if err := ctx.Room().RecordChat(ctx.User(), ctx.Msg.Message); err != nil {
+		log.Errorf("ws: room %s record chat error: %v", ctx.Room().ID, err)
+	}
+	return nil
+}
+
+func handleWhisper(ctx *op.MessageContext) error {
+	if err := ctx.Room().Whisper(ctx.User(), ctx.Msg.Receiver, ctx.Msg.Message); err != nil {
+		ctx.SendError(err.Error())
+	}
+	return nil
+}
+
+func handleReaction(ctx *op.MessageContext) error {
+	if err := ctx.Room().React(ctx.User(), ctx.Msg.Message); err != nil {
+		ctx.SendError(err.Error())
+	}
+	return nil
+}
+
+func handleSetStatus(playing bool) op.MessageHandler {
+	return func(ctx *op.MessageContext) error {
+		status, err := ctx.User().SetStatus(ctx.Room(), playing, ctx.Msg.Seek, ctx.Msg.Rate, ctx.TimeDiff)
+		if err != nil {
+			ctx.SendError(err.Error())
 			return nil
 		}
-		broadcast(&pb.ElementMessage{
-			Type:    pb.ElementMessageType_CHAT_MESSAGE,
-			Message: msg.Message,
-		})
-	case pb.ElementMessageType_PLAY:
-		status := cli.Room().SetStatus(true, msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_PLAY,
+		ctx.Broadcast(&pb.ElementMessage{
+			Type: ctx.Msg.Type,
 			Seek: status.Seek,
 			Rate: status.Rate,
-		}, op.WithIgnoreClient(cli))
-	case pb.ElementMessageType_PAUSE:
-		status := cli.Room().SetStatus(false, msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_PAUSE,
-			Seek: status.Seek,
-			Rate: status.Rate,
-		}, op.WithIgnoreClient(cli))
-	case pb.ElementMessageType_CHANGE_RATE:
-		status := cli.Room().SetSeekRate(msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_CHANGE_RATE,
-			Seek: status.Seek,
-			Rate: status.Rate,
-		}, op.WithIgnoreClient(cli))
-	case pb.ElementMessageType_CHANGE_SEEK:
-		status := cli.Room().SetSeekRate(msg.Seek, msg.Rate, timeDiff)
-		broadcast(&pb.ElementMessage{
-			Type: pb.ElementMessageType_CHANGE_SEEK,
-			Seek: status.Seek,
-			Rate: status.Rate,
-		}, op.WithIgnoreClient(cli))
-	case pb.ElementMessageType_CHECK_SEEK:
-		status := cli.Room().Current().Status
-		if status.Seek+maxInterval < msg.Seek+timeDiff {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_TOO_FAST,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
-		} else if status.Seek-maxInterval > msg.Seek+timeDiff {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_TOO_SLOW,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
-		} else {
-			send(&pb.ElementMessage{
-				Type: pb.ElementMessageType_CHECK_SEEK,
-				Seek: status.Seek,
-				Rate: status.Rate,
-			})
-		}
+		}, op.WithIgnoreClient(ctx.Client))
+		return nil
+	}
+}
+
+func handleSetSeekRate(ctx *op.MessageContext) error {
+	status, err := ctx.User().SetSeekRate(ctx.Room(), ctx.Msg.Seek, ctx.Msg.Rate, ctx.TimeDiff)
+	if err != nil {
+		ctx.SendError(err.Error())
+		return nil
+	}
+	ctx.Broadcast(&pb.ElementMessage{
+		Type: ctx.Msg.Type,
+		Seek: status.Seek,
+		Rate: status.Rate,
+	}, op.WithIgnoreClient(ctx.Client))
+	return nil
+}
+
+func handleBuffering(buffering bool) op.MessageHandler {
+	return func(ctx *op.MessageContext) error {
+		ctx.Room().SetClientBuffering(ctx.Client, buffering)
+		return nil
+	}
+}
+
+func handleCheckSeek(ctx *op.MessageContext) error {
+	status := ctx.Room().Current().Status
+	seek := ctx.Msg.Seek + ctx.TimeDiff
+	t := pb.ElementMessageType_CHECK_SEEK
+	if status.Seek+maxInterval < seek {
+		t = pb.ElementMessageType_TOO_FAST
+	} else if status.Seek-maxInterval > seek {
+		t = pb.ElementMessageType_TOO_SLOW
 	}
+	ctx.Send(&pb.ElementMessage{
+		Type: t,
+		Seek: status.Seek,
+		Rate: status.Rate,
+	})
 	return nil
 }
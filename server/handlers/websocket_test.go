@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synctv-org/synctv/internal/db"
+	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
+	pb "github.com/synctv-org/synctv/proto/message"
+)
+
+// receivedTypes returns the types of the element messages queued for c
+func receivedTypes(c *op.Client) []pb.ElementMessageType {
+	var types []pb.ElementMessageType
+	for {
+		select {
+		case msg := <-c.GetReadChan():
+			if pm, ok := msg.(*op.PreparedMessage); ok {
+				msg = pm.Message
+			}
+			if em, ok := msg.(*op.ElementMessage); ok {
+				types = append(types, em.Type)
+			}
+		case <-time.After(50 * time.Millisecond):
+			return types
+		}
+	}
+}
+
+func equalTypes(a, b []pb.ElementMessageType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandleElementMessage(t *testing.T) {
+	useTestDB(t)
+	creator, err := op.CreateUser("creator", "password", db.WithRole(dbModel.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := op.CreateUser("member", "password", db.WithRole(dbModel.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := op.CreateRoom("room", "", 0, db.WithCreator(&creator.Value().User), db.WithStatus(dbModel.RoomStatusActive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := entry.Value()
+	sender, err := room.NewClient(creator.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := room.NewClient(member.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("a", maxChatMessageLen+1)
+	// the cases run in order on the same room, the seek checks see the paused position
+	tests := []struct {
+		name       string
+		msg        *pb.ElementMessage
+		wantSender []pb.ElementMessageType
+		wantOther  []pb.ElementMessageType
+	}{
+		{"chat", &pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: "hi"},
+			[]pb.ElementMessageType{pb.ElementMessageType_CHAT_MESSAGE}, []pb.ElementMessageType{pb.ElementMessageType_CHAT_MESSAGE}},
+		{"chat too long", &pb.ElementMessage{Type: pb.ElementMessageType_CHAT_MESSAGE, Message: long},
+			[]pb.ElementMessageType{pb.ElementMessageType_ERROR}, nil},
+		{"whisper", &pb.ElementMessage{Type: pb.ElementMessageType_WHISPER, Receiver: "member", Message: "hi"},
+			nil, []pb.ElementMessageType{pb.ElementMessageType_WHISPER}},
+		{"whisper too long", &pb.ElementMessage{Type: pb.ElementMessageType_WHISPER, Receiver: "member", Message: long},
+			[]pb.ElementMessageType{pb.ElementMessageType_ERROR}, nil},
+		{"whisper to self", &pb.ElementMessage{Type: pb.ElementMessageType_WHISPER, Receiver: "creator", Message: "hi"},
+			[]pb.ElementMessageType{pb.ElementMessageType_ERROR}, nil},
+		{"reaction not allowed", &pb.ElementMessage{Type: pb.ElementMessageType_REACTION, Message: "not an emoji"},
+			[]pb.ElementMessageType{pb.ElementMessageType_ERROR}, nil},
+		{"play", &pb.ElementMessage{Type: pb.ElementMessageType_PLAY, Seek: 5, Rate: 1},
+			nil, []pb.ElementMessageType{pb.ElementMessageType_PLAY}},
+		{"change rate", &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_RATE, Seek: 5, Rate: 2},
+			nil, []pb.ElementMessageType{pb.ElementMessageType_CHANGE_RATE}},
+		{"invalid rate", &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_RATE, Seek: 5, Rate: 0},
+			[]pb.ElementMessageType{pb.ElementMessageType_ERROR}, nil},
+		{"pause", &pb.ElementMessage{Type: pb.ElementMessageType_PAUSE, Seek: 20, Rate: 1},
+			nil, []pb.ElementMessageType{pb.ElementMessageType_PAUSE}},
+		{"change seek", &pb.ElementMessage{Type: pb.ElementMessageType_CHANGE_SEEK, Seek: 30, Rate: 1},
+			nil, []pb.ElementMessageType{pb.ElementMessageType_CHANGE_SEEK}},
+		{"check seek", &pb.ElementMessage{Type: pb.ElementMessageType_CHECK_SEEK, Seek: 30},
+			[]pb.ElementMessageType{pb.ElementMessageType_CHECK_SEEK}, nil},
+		{"check seek too fast", &pb.ElementMessage{Type: pb.ElementMessageType_CHECK_SEEK, Seek: 30 + maxInterval + 1},
+			[]pb.ElementMessageType{pb.ElementMessageType_TOO_FAST}, nil},
+		{"check seek too slow", &pb.ElementMessage{Type: pb.ElementMessageType_CHECK_SEEK, Seek: 30 - maxInterval - 1},
+			[]pb.ElementMessageType{pb.ElementMessageType_TOO_SLOW}, nil},
+		{"start buffering", &pb.ElementMessage{Type: pb.ElementMessageType_START_BUFFERING}, nil, nil},
+		{"stop buffering", &pb.ElementMessage{Type: pb.ElementMessageType_STOP_BUFFERING}, nil, nil},
+		{"unhandled", &pb.ElementMessage{Type: pb.ElementMessageType_TOO_FAST}, nil, nil},
+	}
+	receivedTypes(sender)
+	receivedTypes(other)
+	for _, tt := range tests {
+		if err := sender.Dispatch(tt.msg); err != nil {
+			t.Fatalf("%s: Dispatch() = %v", tt.name, err)
+		}
+		if got := receivedTypes(sender); !equalTypes(got, tt.wantSender) {
+			t.Errorf("%s: sender got %v, want %v", tt.name, got, tt.wantSender)
+		}
+		if got := receivedTypes(other); !equalTypes(got, tt.wantOther) {
+			t.Errorf("%s: other client got %v, want %v", tt.name, got, tt.wantOther)
+		}
+	}
+}
+
+func TestHandleReactionDisabled(t *testing.T) {
+	useTestDB(t)
+	creator, err := op.CreateUser("creator", "password", db.WithRole(dbModel.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := op.CreateRoom("room", "", 0, db.WithCreator(&creator.Value().User), db.WithStatus(dbModel.RoomStatusActive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := entry.Value()
+	c, err := room.NewClient(creator.Value(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receivedTypes(c)
+	reaction := &pb.ElementMessage{Type: pb.ElementMessageType_REACTION, Message: "🔥"}
+	if err := c.Dispatch(reaction); err != nil {
+		t.Fatal(err)
+	}
+	// the reaction is broadcast with the next window
+	if got := receivedTypes(c); len(got) != 0 {
+		t.Fatalf("got %v before the reactions were disabled, want nothing", got)
+	}
+	settings := room.Settings
+	settings.DisableReactions = true
+	if err := room.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	receivedTypes(c)
+	if err := c.Dispatch(reaction); err != nil {
+		t.Fatal(err)
+	}
+	if got := receivedTypes(c); !equalTypes(got, []pb.ElementMessageType{pb.ElementMessageType_ERROR}) {
+		t.Fatalf("got %v, want the reactions disabled error", got)
+	}
+}
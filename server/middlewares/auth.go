@@ -65,7 +65,7 @@ func AuthRoom(Authorization string) (*op.UserEntry, *op.RoomEntry, error) {
 		return nil, nil, err
 	}
 
-	if len(claims.RoomId) != 32 {
+	if op.ValidateRoomID(claims.RoomId) != nil {
 		return nil, nil, ErrAuthFailed
 	}
 
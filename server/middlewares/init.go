@@ -19,15 +19,20 @@ func Init(e *gin.Engine) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		options := []limiter.Option{
-			limiter.WithTrustForwardHeader(conf.Conf.RateLimit.TrustForwardHeader),
-		}
-		if conf.Conf.RateLimit.TrustedClientIPHeader != "" {
-			options = append(options, limiter.WithClientIPHeader(conf.Conf.RateLimit.TrustedClientIPHeader))
-		}
-		e.Use(NewLimiter(d, conf.Conf.RateLimit.Limit, options...))
+		e.Use(NewLimiter(d, conf.Conf.RateLimit.Limit, limiterOptions()...))
 	}
 	if conf.Conf.Server.Http.Quic && conf.Conf.Server.Http.CertPath != "" && conf.Conf.Server.Http.KeyPath != "" {
 		e.Use(NewQuic())
 	}
 }
+
+// limiterOptions finds the client ip the way the rate limit config asks
+func limiterOptions() []limiter.Option {
+	options := []limiter.Option{
+		limiter.WithTrustForwardHeader(conf.Conf.RateLimit.TrustForwardHeader),
+	}
+	if conf.Conf.RateLimit.TrustedClientIPHeader != "" {
+		options = append(options, limiter.WithClientIPHeader(conf.Conf.RateLimit.TrustedClientIPHeader))
+	}
+	return options
+}
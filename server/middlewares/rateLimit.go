@@ -11,6 +11,15 @@ import (
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
+// tokenLoginLimit is how many session token logins a client ip may try per minute
+const tokenLoginLimit = 10
+
+// NewTokenLoginLimiter limits the session token logins of a client ip,
+// it applies even when the global rate limit is disabled
+func NewTokenLoginLimiter() gin.HandlerFunc {
+	return NewLimiter(time.Minute, tokenLoginLimit, limiterOptions()...)
+}
+
 func NewLimiter(Period time.Duration, Limit int64, options ...limiter.Option) gin.HandlerFunc {
 	limit := limiter.New(memory.NewStore(), limiter.Rate{
 		Period: Period,
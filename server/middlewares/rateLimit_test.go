@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/synctv-org/synctv/internal/conf"
+)
+
+func TestTokenLoginLimiter(t *testing.T) {
+	conf.Conf = conf.DefaultConfig()
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.POST("/login/token", NewTokenLoginLimiter(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusUnauthorized)
+	})
+	login := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login/token", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	for i := 0; i < tokenLoginLimit; i++ {
+		if code := login(); code != http.StatusUnauthorized {
+			t.Fatalf("login %d = %d, want %d", i, code, http.StatusUnauthorized)
+		}
+	}
+	if code := login(); code != http.StatusTooManyRequests {
+		t.Fatalf("login over the limit = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
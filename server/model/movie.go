@@ -12,9 +12,15 @@ import (
 var (
 	ErrUrlTooLong  = errors.New("url too long")
 	ErrEmptyName   = errors.New("empty name")
-	ErrNameTooLong = errors.New("name too long")
 	ErrTypeTooLong = errors.New("type too long")
 
+	ErrExternalSystemTooLong = errors.New("external system too long")
+	ErrExternalIDTooLong     = errors.New("external id too long")
+
+	ErrInvalidDuration = errors.New("duration must not be negative")
+
+	ErrInvalidMediaKind = errors.New("invalid media kind")
+
 	ErrId = errors.New("id must be greater than 0")
 
 	ErrEmptyIds = errors.New("empty ids")
@@ -31,16 +37,31 @@ func (p *PushMovieReq) Validate() error {
 		return ErrUrlTooLong
 	}
 
+	// the name length is checked by the room against its movie field limits
 	if p.Name == "" {
 		return ErrEmptyName
-	} else if len(p.Name) > 128 {
-		return ErrNameTooLong
 	}
 
 	if len(p.Type) > 32 {
 		return ErrTypeTooLong
 	}
 
+	if len(p.ExternalSystem) > 32 {
+		return ErrExternalSystemTooLong
+	}
+
+	if len(p.ExternalID) > 64 {
+		return ErrExternalIDTooLong
+	}
+
+	if p.Duration < 0 {
+		return ErrInvalidDuration
+	}
+
+	if !p.MediaKind.Valid() {
+		return ErrInvalidMediaKind
+	}
+
 	return nil
 }
 
@@ -89,6 +110,16 @@ func (i *IdCanEmptyReq) Validate() error {
 	return nil
 }
 
+type ChangeCurrentMovieReq struct {
+	IdCanEmptyReq
+	// Resume starts the movie where it was left instead of from the start
+	Resume bool `json:"resume"`
+}
+
+func (c *ChangeCurrentMovieReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(c)
+}
+
 type EditMovieReq struct {
 	IdReq
 	PushMovieReq
@@ -128,6 +159,41 @@ func (i *IdsReq) Validate() error {
 	return nil
 }
 
+type PinMovieReq struct {
+	Id     string `json:"id"`
+	Pinned bool   `json:"pinned"`
+}
+
+func (p *PinMovieReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(p)
+}
+
+func (p *PinMovieReq) Validate() error {
+	if len(p.Id) != 32 {
+		return ErrId
+	}
+	return nil
+}
+
+type SetMovieVisibilityReq struct {
+	Id         string                `json:"id"`
+	Visibility model.MovieVisibility `json:"visibility"`
+}
+
+func (s *SetMovieVisibilityReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetMovieVisibilityReq) Validate() error {
+	if len(s.Id) != 32 {
+		return ErrId
+	}
+	if !s.Visibility.Valid() {
+		return op.ErrInvalidMovieVisibility
+	}
+	return nil
+}
+
 type SwapMovieReq struct {
 	Id1 string `json:"id1"`
 	Id2 string `json:"id2"`
@@ -144,12 +210,42 @@ func (s *SwapMovieReq) Validate() error {
 	return nil
 }
 
+type ForceSeekReq struct {
+	Seek float64 `json:"seek"`
+}
+
+func (f *ForceSeekReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(f)
+}
+
+func (f *ForceSeekReq) Validate() error {
+	if f.Seek < 0 {
+		return op.ErrInvalidSeek
+	}
+	return nil
+}
+
+type SeekRelativeReq struct {
+	Delta float64 `json:"delta"`
+}
+
+func (s *SeekRelativeReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SeekRelativeReq) Validate() error {
+	return nil
+}
+
 type MoviesResp struct {
 	Id        string          `json:"id"`
 	CreatedAt int64           `json:"createAt"`
 	Base      model.BaseMovie `json:"base"`
 	Creator   string          `json:"creator"`
 	CreatorId string          `json:"creatorId"`
+	Pinned    bool            `json:"pinned"`
+	// Visibility decides who the movie is listed for, see model.MovieVisibility
+	Visibility model.MovieVisibility `json:"visibility,omitempty"`
 }
 
 type CurrentMovieResp struct {
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/synctv-org/synctv/internal/model"
 	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
 )
 
 var (
@@ -24,6 +25,10 @@ var (
 	ErrEmptyUsername          = errors.New("empty username")
 	ErrUsernameTooLong        = errors.New("username too long")
 	ErrUsernameHasInvalidChar = errors.New("username has invalid char")
+
+	ErrInvalidBufferingAssistRatio     = op.ErrInvalidBufferingAssistRatio
+	ErrInvalidBufferingAssistThreshold = op.ErrInvalidBufferingAssistThreshold
+	ErrInvalidAllowedRates             = op.ErrInvalidAllowedRates
 )
 
 var (
@@ -65,7 +70,11 @@ func (c *CreateRoomReq) Validate() error {
 		}
 	}
 
-	return nil
+	return validateRoomSettings(&c.Setting)
+}
+
+func validateRoomSettings(s *dbModel.RoomSettings) error {
+	return op.ValidateRoomSettings(s)
 }
 
 type RoomListResp struct {
@@ -91,13 +100,38 @@ func (l *LoginRoomReq) Decode(ctx *gin.Context) error {
 func (l *LoginRoomReq) Validate() error {
 	if l.RoomId == "" {
 		return ErrEmptyRoomName
-	} else if len(l.RoomId) != 32 {
-		return errors.New("invalid room id")
+	} else if err := op.ValidateRoomID(l.RoomId); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+type LoginRoomWithTokenReq struct {
+	RoomId       string `json:"roomId"`
+	UserId       string `json:"userId"`
+	SessionToken string `json:"sessionToken"`
+}
+
+func (l *LoginRoomWithTokenReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(l)
+}
+
+func (l *LoginRoomWithTokenReq) Validate() error {
+	if l.RoomId == "" {
+		return ErrEmptyRoomName
+	} else if err := op.ValidateRoomID(l.RoomId); err != nil {
+		return err
+	}
+	if len(l.UserId) != 32 {
+		return errors.New("invalid user id")
+	}
+	if l.SessionToken == "" {
+		return errors.New("session token is empty")
+	}
+	return nil
+}
+
 type SetRoomPasswordReq struct {
 	Password string `json:"password"`
 }
@@ -117,6 +151,70 @@ func (s *SetRoomPasswordReq) Validate() error {
 	return nil
 }
 
+type SetPlaybackLockedReq struct {
+	Locked bool `json:"locked"`
+}
+
+func (s *SetPlaybackLockedReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetPlaybackLockedReq) Validate() error {
+	return nil
+}
+
+type SetAutoAdvanceReq struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (s *SetAutoAdvanceReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetAutoAdvanceReq) Validate() error {
+	return nil
+}
+
+type SetPlaylistSortReq struct {
+	Sort dbModel.PlaylistSort `json:"sort"`
+}
+
+func (s *SetPlaylistSortReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetPlaylistSortReq) Validate() error {
+	if s.Sort == "" || !s.Sort.Valid() {
+		return errors.New("invalid playlist sort")
+	}
+	return nil
+}
+
+type AddRoomWebhookReq struct {
+	URL    string                 `json:"url"`
+	Events []dbModel.WebhookEvent `json:"events"`
+}
+
+func (a *AddRoomWebhookReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(a)
+}
+
+func (a *AddRoomWebhookReq) Validate() error {
+	if a.URL == "" {
+		return errors.New("url is required")
+	}
+	if len(a.Events) == 0 {
+		return errors.New("events is required")
+	}
+	return nil
+}
+
+type AddRoomWebhookResp struct {
+	ID string `json:"id"`
+	// Secret is only returned once, it signs the webhook requests
+	Secret string `json:"secret"`
+}
+
 type RoomIDReq struct {
 	Id string `json:"id"`
 }
@@ -140,15 +238,40 @@ func (s *SetRoomSettingReq) Decode(ctx *gin.Context) error {
 }
 
 func (s *SetRoomSettingReq) Validate() error {
-	return nil
+	return validateRoomSettings((*dbModel.RoomSettings)(s))
 }
 
 type RoomUsersResp struct {
 	UserID      string                     `json:"userId"`
 	Username    string                     `json:"username"`
 	Role        dbModel.Role               `json:"role"`
+	Color       string                     `json:"color,omitempty"`
+	Avatar      string                     `json:"avatar,omitempty"`
 	JoinAt      int64                      `json:"joinAt"`
 	RoomID      string                     `json:"roomId"`
 	Status      dbModel.RoomUserStatus     `json:"status"`
 	Permissions dbModel.RoomUserPermission `json:"permissions"`
 }
+
+type RTCOfferReq struct {
+	// ClientID is the receiver of the SYNC message of a websocket client
+	// the peer joins, empty registers a client without websocket
+	ClientID string `json:"clientId"`
+	SDP      string `json:"sdp"`
+}
+
+func (r *RTCOfferReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(r)
+}
+
+func (r *RTCOfferReq) Validate() error {
+	if r.SDP == "" {
+		return errors.New("sdp is required")
+	}
+	return nil
+}
+
+type RTCAnswerResp struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
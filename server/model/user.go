@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	json "github.com/json-iterator/go"
 	dbModel "github.com/synctv-org/synctv/internal/model"
+	"github.com/synctv-org/synctv/internal/op"
 	"github.com/synctv-org/synctv/internal/provider"
 )
 
@@ -61,6 +62,31 @@ type UserInfoResp struct {
 	Username  string       `json:"username"`
 	Role      dbModel.Role `json:"role"`
 	CreatedAt int64        `json:"createdAt"`
+	Color     string       `json:"color,omitempty"`
+	Avatar    string       `json:"avatar,omitempty"`
+}
+
+var (
+	ErrInvalidColor  = op.ErrInvalidColor
+	ErrAvatarTooLong = op.ErrAvatarTooLong
+	ErrInvalidAvatar = op.ErrInvalidAvatar
+)
+
+// SetUserProfileReq sets the user display color and avatar, empty values clear them
+type SetUserProfileReq struct {
+	Color  string `json:"color"`
+	Avatar string `json:"avatar"`
+}
+
+func (s *SetUserProfileReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(s)
+}
+
+func (s *SetUserProfileReq) Validate() error {
+	if err := op.ValidateColor(s.Color); err != nil {
+		return err
+	}
+	return op.ValidateAvatar(s.Avatar)
 }
 
 type SetUsernameReq struct {
@@ -82,6 +108,21 @@ func (s *SetUsernameReq) Decode(ctx *gin.Context) error {
 	return json.NewDecoder(ctx.Request.Body).Decode(s)
 }
 
+type BlockUserReq struct {
+	Username string `json:"username"`
+}
+
+func (b *BlockUserReq) Decode(ctx *gin.Context) error {
+	return json.NewDecoder(ctx.Request.Body).Decode(b)
+}
+
+func (b *BlockUserReq) Validate() error {
+	if b.Username == "" {
+		return errors.New("username is empty")
+	}
+	return nil
+}
+
 type UserIDReq struct {
 	ID string `json:"id"`
 }
@@ -231,6 +231,11 @@ func (o *Once) Done() (doned bool) {
 	return
 }
 
+// Did reports whether Do ran f, unlike Done it does not keep a later Do from running
+func (o *Once) Did() bool {
+	return atomic.LoadUint32(&o.done) == 1
+}
+
 func (o *Once) Do(f func()) {
 	if atomic.LoadUint32(&o.done) == 0 {
 		o.doSlow(f)
@@ -107,3 +107,18 @@ func TestIsLocalIP(t *testing.T) {
 		})
 	}
 }
+
+func TestOnceDid(t *testing.T) {
+	var o utils.Once
+	if o.Did() {
+		t.Fatal("Did() = true before Do")
+	}
+	ran := false
+	o.Do(func() { ran = true })
+	if !ran {
+		t.Fatal("Did() kept Do from running")
+	}
+	if !o.Did() {
+		t.Fatal("Did() = false after Do")
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 type WebSocket struct {
 	Heartbeat time.Duration
+	// CheckOrigin decides whether an upgrade request is accepted, nil accepts any origin
+	CheckOrigin func(r *http.Request) bool
 }
 
 func DefaultWebSocket() *WebSocket {
@@ -23,6 +25,12 @@ func WithHeartbeatInterval(d time.Duration) WebSocketConfig {
 	}
 }
 
+func WithCheckOrigin(f func(r *http.Request) bool) WebSocketConfig {
+	return func(ws *WebSocket) {
+		ws.CheckOrigin = f
+	}
+}
+
 func NewWebSocketServer(conf ...WebSocketConfig) *WebSocket {
 	ws := DefaultWebSocket()
 	for _, wsc := range conf {
@@ -53,9 +61,12 @@ func (ws *WebSocket) newUpgrader(conf ...UpgraderConf) *websocket.Upgrader {
 		HandshakeTimeout: time.Second * 30,
 		ReadBufferSize:   1024,
 		WriteBufferSize:  1024,
-		CheckOrigin: func(r *http.Request) bool {
+		CheckOrigin:      ws.CheckOrigin,
+	}
+	if ug.CheckOrigin == nil {
+		ug.CheckOrigin = func(r *http.Request) bool {
 			return true
-		},
+		}
 	}
 	for _, uc := range conf {
 		uc(ug)